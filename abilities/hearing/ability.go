@@ -19,10 +19,11 @@ type Ability struct {
 
 // AbilityConfiguration represents an ability configuration
 type AbilityConfiguration struct {
-	DispatchDuration     time.Duration `toml:"dispatch_duration"`
-	SampleRate           int           `toml:"sample_rate"`
-	SignificantBits      int           `toml:"significant_bits"`
-	SilenceMaxAudioLevel float64       `toml:"silence_max_audio_level"`
+	DispatchDuration     time.Duration                          `toml:"dispatch_duration"`
+	SampleRate           int                                    `toml:"sample_rate"`
+	SamplesEncoding      astibrain.SamplesEncodingConfiguration `toml:"samples_encoding"`
+	SignificantBits      int                                    `toml:"significant_bits"`
+	SilenceMaxAudioLevel float64                                `toml:"silence_max_audio_level"`
 }
 
 // NewAbility creates a new ability.
@@ -57,10 +58,11 @@ func (a *Ability) Description() string {
 
 // PayloadSamples represents the samples payload
 type PayloadSamples struct {
-	SampleRate           int     `json:"sample_rate"`
-	Samples              []int32 `json:"samples"`
-	SignificantBits      int     `json:"significant_bits"`
-	SilenceMaxAudioLevel float64 `json:"silence_max_audio_level"`
+	EncodedSamples       *astibrain.EncodedSamples `json:"encoded_samples,omitempty"`
+	SampleRate           int                       `json:"sample_rate"`
+	Samples              []int32                   `json:"samples,omitempty"`
+	SignificantBits      int                       `json:"significant_bits"`
+	SilenceMaxAudioLevel float64                   `json:"silence_max_audio_level"`
 }
 
 // Run implements the astibrain.Runnable interface
@@ -117,14 +119,31 @@ func (a *Ability) Run(ctx context.Context) (err error) {
 				a.dispatchFunc(astibrain.Event{
 					AbilityName: name,
 					Name:        websocketEventNameSamples,
-					Payload: PayloadSamples{
-						SampleRate:           a.c.SampleRate,
-						Samples:              dispatchBuf,
-						SignificantBits:      a.c.SignificantBits,
-						SilenceMaxAudioLevel: a.c.SilenceMaxAudioLevel,
-					},
+					Payload:     a.newPayloadSamples(dispatchBuf),
 				})
 			}
 		}
 	}
 }
+
+// newPayloadSamples creates a new samples payload and encodes samples if needed
+func (a *Ability) newPayloadSamples(samples []int32) (p PayloadSamples) {
+	// Create payload
+	p = PayloadSamples{
+		SampleRate:           a.c.SampleRate,
+		SignificantBits:      a.c.SignificantBits,
+		SilenceMaxAudioLevel: a.c.SilenceMaxAudioLevel,
+	}
+
+	// Encode samples
+	var err error
+	if p.EncodedSamples, err = astibrain.EncodeSamples(samples, a.c.SamplesEncoding); err != nil {
+		astilog.Error(errors.Wrap(err, "astihearing: encoding samples failed"))
+	}
+
+	// Samples have not been encoded
+	if p.EncodedSamples == nil {
+		p.Samples = samples
+	}
+	return
+}
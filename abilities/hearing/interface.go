@@ -115,6 +115,15 @@ func (i *Interface) brainWebsocketListenerSamples(brainName string) astiws.Liste
 			return nil
 		}
 
+		// Decode samples
+		if p.EncodedSamples != nil {
+			var err error
+			if p.Samples, err = p.EncodedSamples.Decode(); err != nil {
+				astilog.Error(errors.Wrap(err, "astihearing: decoding samples failed"))
+				return nil
+			}
+		}
+
 		// Execute callbacks
 		for _, fn := range i.onSamples {
 			if err := fn(brainName, p.Samples, p.SampleRate, p.SignificantBits, p.SilenceMaxAudioLevel); err != nil {
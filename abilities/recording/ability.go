@@ -0,0 +1,368 @@
+package astirecording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/cryptix/wav"
+	"github.com/pkg/errors"
+)
+
+// Ability represents an object capable of recording raw audio samples to disk
+type Ability struct {
+	activated    bool
+	c            AbilityConfiguration
+	dispatchFunc astibrain.DispatchFunc
+	m            sync.Mutex // Locks activated and r
+	r            *recording
+}
+
+// recording represents an ongoing recording.
+// The wav file is created once the first samples have been received since its header needs the sample rate.
+type recording struct {
+	brainName       string
+	f               *os.File
+	max             int // Max number of samples
+	n               int // Number of samples written
+	name            string
+	path            string
+	sampleRate      int
+	significantBits int
+	w               *wav.Writer
+}
+
+// AbilityConfiguration represents an ability configuration
+// Directory is the directory recordings are written to. Default is the temp directory.
+// MaxDuration is the max duration of a recording after which it's stopped automatically so that a forgotten recording
+// doesn't fill the disk. Default is 5 minutes.
+type AbilityConfiguration struct {
+	Directory   string        `toml:"directory"`
+	MaxDuration time.Duration `toml:"max_duration"`
+}
+
+// NewAbility creates a new ability
+func NewAbility(c AbilityConfiguration) (a *Ability, err error) {
+	// Create
+	a = &Ability{c: c}
+
+	// Default configuration values
+	if len(a.c.Directory) == 0 {
+		a.c.Directory = os.TempDir()
+	}
+	if a.c.MaxDuration == 0 {
+		a.c.MaxDuration = 5 * time.Minute
+	}
+
+	// Absolute paths
+	if a.c.Directory, err = filepath.Abs(a.c.Directory); err != nil {
+		err = errors.Wrapf(err, "astirecording: filepath abs of %s failed", a.c.Directory)
+		return
+	}
+	return
+}
+
+// Name implements the astibrain.Ability interface
+func (a *Ability) Name() string {
+	return name
+}
+
+// Description implements the astibrain.Ability interface
+func (a *Ability) Description() string {
+	return "Records raw audio samples to disk"
+}
+
+// SetDispatchFunc implements the astibrain.Dispatcher interface
+func (a *Ability) SetDispatchFunc(fn astibrain.DispatchFunc) {
+	a.dispatchFunc = fn
+}
+
+// Activate implements the astibrain.Activable interface
+// The ongoing recording is stopped when the ability is deactivated.
+func (a *Ability) Activate(activated bool) {
+	// Lock
+	a.m.Lock()
+	a.activated = activated
+
+	// Ability is activated or no recording is ongoing
+	if activated || a.r == nil {
+		a.m.Unlock()
+		return
+	}
+
+	// Stop recording
+	p, err := a.stopUnsafe(stopReasonDeactivated)
+	a.m.Unlock()
+	if err != nil {
+		astilog.Error(errors.Wrap(err, "astirecording: stopping recording failed"))
+	}
+	a.dispatch(websocketEventNameRecordingStopped, p)
+}
+
+// StartRecording starts recording the received samples to <directory>/<name>.wav.
+// It fails if a recording is already ongoing.
+func (a *Ability) StartRecording(name string) (err error) {
+	// Validate name
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		err = fmt.Errorf("astirecording: invalid recording name %s", name)
+		return
+	}
+
+	// Lock
+	a.m.Lock()
+
+	// Ability is not activated
+	if !a.activated {
+		a.m.Unlock()
+		err = errors.New("astirecording: ability is not activated")
+		return
+	}
+
+	// Recording is already ongoing
+	if a.r != nil {
+		err = fmt.Errorf("astirecording: recording %s is already ongoing", a.r.name)
+		a.m.Unlock()
+		return
+	}
+
+	// Create recording
+	r := &recording{
+		name: name,
+		path: filepath.Join(a.c.Directory, name+".wav"),
+	}
+	a.r = r
+	a.m.Unlock()
+
+	// Dispatch
+	astilog.Debugf("astirecording: starting recording %s", r.name)
+	a.dispatch(websocketEventNameRecordingStarted, PayloadRecording{Name: r.name, Path: r.path})
+	return
+}
+
+// StopRecording stops the ongoing recording.
+// It fails if no recording is ongoing.
+func (a *Ability) StopRecording() (err error) {
+	// Lock
+	a.m.Lock()
+
+	// No recording is ongoing
+	if a.r == nil {
+		a.m.Unlock()
+		err = errors.New("astirecording: no recording is ongoing")
+		return
+	}
+
+	// Stop
+	p, err := a.stopUnsafe(stopReasonRequested)
+	a.m.Unlock()
+	if err != nil {
+		err = errors.Wrap(err, "astirecording: stopping recording failed")
+	}
+
+	// Dispatch
+	a.dispatch(websocketEventNameRecordingStopped, p)
+	return
+}
+
+// stopUnsafe closes the ongoing recording and returns the recording stopped payload.
+// a.m must be locked.
+func (a *Ability) stopUnsafe(reason string) (p PayloadRecording, err error) {
+	// Create payload
+	r := a.r
+	a.r = nil
+	p = PayloadRecording{
+		BrainName: r.brainName,
+		Name:      r.name,
+		Path:      r.path,
+		Reason:    reason,
+	}
+	if r.sampleRate > 0 {
+		p.Duration = float64(r.n) / float64(r.sampleRate)
+	}
+	astilog.Debugf("astirecording: stopping recording %s (%s)", r.name, reason)
+
+	// No samples have been received
+	if r.f == nil {
+		return
+	}
+
+	// Close wav writer
+	if err = r.w.Close(); err != nil {
+		err = errors.Wrap(err, "astirecording: closing wav writer failed")
+	}
+
+	// Close file
+	if errClose := r.f.Close(); errClose != nil && err == nil {
+		err = errors.Wrapf(errClose, "astirecording: closing %s failed", r.path)
+	}
+	return
+}
+
+// open creates the wav file of the recording
+func (r *recording) open(sampleRate, significantBits int) (err error) {
+	// Create dir
+	if err = os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		err = errors.Wrapf(err, "astirecording: mkdirall %s failed", filepath.Dir(r.path))
+		return
+	}
+
+	// Create file
+	if r.f, err = os.Create(r.path); err != nil {
+		err = errors.Wrapf(err, "astirecording: creating %s failed", r.path)
+		return
+	}
+
+	// Create wav writer
+	wf := wav.File{
+		Channels:        1,
+		SampleRate:      uint32(sampleRate),
+		SignificantBits: uint16(significantBits),
+	}
+	if r.w, err = wf.NewWriter(r.f); err != nil {
+		r.f.Close()
+		r.f = nil
+		err = errors.Wrap(err, "astirecording: creating wav writer failed")
+		return
+	}
+	r.sampleRate = sampleRate
+	r.significantBits = significantBits
+	return
+}
+
+// write writes the samples to the ongoing recording and stops it once its max duration has been reached
+func (a *Ability) write(p PayloadSamples) {
+	// Lock
+	a.m.Lock()
+
+	// No recording is ongoing
+	r := a.r
+	if r == nil {
+		a.m.Unlock()
+		return
+	}
+
+	// The recording is bound to the first brain sending samples
+	if len(r.brainName) == 0 {
+		r.brainName = p.BrainName
+	} else if r.brainName != p.BrainName {
+		a.m.Unlock()
+		return
+	}
+
+	// Open recording
+	if r.f == nil {
+		if err := r.open(p.SampleRate, p.SignificantBits); err != nil {
+			a.m.Unlock()
+			astilog.Error(errors.Wrapf(err, "astirecording: opening recording %s failed", r.name))
+			return
+		}
+		r.max = int(a.c.MaxDuration.Seconds() * float64(p.SampleRate))
+	} else if p.SampleRate != r.sampleRate {
+		a.m.Unlock()
+		astilog.Errorf("astirecording: sample rate %d differs from the sample rate %d of recording %s, dropping samples", p.SampleRate, r.sampleRate, r.name)
+		return
+	}
+
+	// Enforce max duration
+	samples := p.Samples
+	if len(samples) > r.max-r.n {
+		samples = samples[:r.max-r.n]
+	}
+
+	// Write samples
+	for _, s := range samples {
+		if err := r.w.WriteInt32(s); err != nil {
+			astilog.Error(errors.Wrapf(err, "astirecording: writing wav sample to recording %s failed", r.name))
+			break
+		}
+		r.n++
+	}
+
+	// Max duration has not been reached
+	if r.n < r.max {
+		a.m.Unlock()
+		return
+	}
+
+	// Stop recording
+	pr, err := a.stopUnsafe(stopReasonMaxDuration)
+	a.m.Unlock()
+	if err != nil {
+		astilog.Error(errors.Wrap(err, "astirecording: stopping recording failed"))
+	}
+	a.dispatch(websocketEventNameRecordingStopped, pr)
+}
+
+// dispatch dispatches an event to Bob
+func (a *Ability) dispatch(eventName string, p PayloadRecording) {
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        eventName,
+			Payload:     p,
+		})
+	}
+}
+
+// WebsocketListeners implements the astibrain.WebsocketListener interface
+func (a *Ability) WebsocketListeners() map[string]astiws.ListenerFunc {
+	return map[string]astiws.ListenerFunc{
+		websocketEventNameRecordingStart: a.websocketListenerRecordingStart,
+		websocketEventNameRecordingStop:  a.websocketListenerRecordingStop,
+		websocketEventNameSamples:        a.websocketListenerSamples,
+	}
+}
+
+// websocketListenerRecordingStart listens to the recording.start websocket event
+func (a *Ability) websocketListenerRecordingStart(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	// Unmarshal payload
+	var n string
+	if err := json.Unmarshal(payload, &n); err != nil {
+		astilog.Error(errors.Wrapf(err, "astirecording: json unmarshaling %s into %#v failed", payload, n))
+		return nil
+	}
+
+	// Start recording
+	if err := a.StartRecording(n); err != nil {
+		astilog.Error(errors.Wrapf(err, "astirecording: starting recording %s failed", n))
+	}
+	return nil
+}
+
+// websocketListenerRecordingStop listens to the recording.stop websocket event
+func (a *Ability) websocketListenerRecordingStop(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	if err := a.StopRecording(); err != nil {
+		astilog.Error(errors.Wrap(err, "astirecording: stopping recording failed"))
+	}
+	return nil
+}
+
+// websocketListenerSamples listens to the samples websocket event
+func (a *Ability) websocketListenerSamples(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	// Unmarshal payload
+	var p PayloadSamples
+	if err := json.Unmarshal(payload, &p); err != nil {
+		astilog.Error(errors.Wrapf(err, "astirecording: json unmarshaling %s into %#v failed", payload, p))
+		return nil
+	}
+
+	// Decode samples
+	if p.EncodedSamples != nil {
+		var err error
+		if p.Samples, err = p.EncodedSamples.Decode(); err != nil {
+			astilog.Error(errors.Wrap(err, "astirecording: decoding samples failed"))
+			return nil
+		}
+	}
+
+	// Write
+	a.write(p)
+	return nil
+}
@@ -0,0 +1,134 @@
+package astirecording
+
+import (
+	"encoding/json"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+)
+
+// Interface is the interface of the ability
+type Interface struct {
+	c            InterfaceConfiguration
+	dispatchFunc astibob.DispatchFunc
+	onStarted    []RecordingFunc
+	onStopped    []RecordingFunc
+}
+
+// InterfaceConfiguration represents an interface configuration
+type InterfaceConfiguration struct {
+	SamplesEncoding astibrain.SamplesEncodingConfiguration `toml:"samples_encoding"`
+}
+
+// RecordingFunc represents the callback executed when a recording has started or stopped
+type RecordingFunc func(brainName string, p PayloadRecording) error
+
+// NewInterface creates a new interface
+func NewInterface(c InterfaceConfiguration) *Interface {
+	return &Interface{c: c}
+}
+
+// Name implements the astibob.Interface interface
+func (i *Interface) Name() string {
+	return name
+}
+
+// SetDispatchFunc implements the astibob.Dispatcher interface
+func (i *Interface) SetDispatchFunc(fn astibob.DispatchFunc) {
+	i.dispatchFunc = fn
+}
+
+// OnRecordingStarted adds a callback executed when a recording has started
+func (i *Interface) OnRecordingStarted(fn RecordingFunc) {
+	i.onStarted = append(i.onStarted, fn)
+}
+
+// OnRecordingStopped adds a callback executed when a recording has stopped
+func (i *Interface) OnRecordingStopped(fn RecordingFunc) {
+	i.onStopped = append(i.onStopped, fn)
+}
+
+// Samples creates a samples cmd
+func (i *Interface) Samples(brainName string, samples []int32, sampleRate, significantBits int) *astibob.Cmd {
+	// Create payload
+	p := PayloadSamples{
+		BrainName:       brainName,
+		SampleRate:      sampleRate,
+		SignificantBits: significantBits,
+	}
+
+	// Encode samples
+	var err error
+	if p.EncodedSamples, err = astibrain.EncodeSamples(samples, i.c.SamplesEncoding); err != nil {
+		astilog.Error(errors.Wrap(err, "astirecording: encoding samples failed"))
+	}
+
+	// Samples have not been encoded
+	if p.EncodedSamples == nil {
+		p.Samples = samples
+	}
+	return &astibob.Cmd{
+		AbilityName: name,
+		EventName:   websocketEventNameSamples,
+		Payload:     p,
+	}
+}
+
+// StartRecording creates a start recording cmd
+func (i *Interface) StartRecording(recordingName string) *astibob.Cmd {
+	return &astibob.Cmd{
+		AbilityName: name,
+		EventName:   websocketEventNameRecordingStart,
+		Payload:     recordingName,
+	}
+}
+
+// StopRecording creates a stop recording cmd
+func (i *Interface) StopRecording() *astibob.Cmd {
+	return &astibob.Cmd{
+		AbilityName: name,
+		EventName:   websocketEventNameRecordingStop,
+	}
+}
+
+// BrainWebsocketListeners implements the astibob.BrainWebsocketListener interface
+func (i *Interface) BrainWebsocketListeners() map[string]astibob.BrainWebsocketListenerFunc {
+	return map[string]astibob.BrainWebsocketListenerFunc{
+		websocketEventNameRecordingStarted: i.brainWebsocketListenerRecording(websocketEventNameRecordingStarted),
+		websocketEventNameRecordingStopped: i.brainWebsocketListenerRecording(websocketEventNameRecordingStopped),
+	}
+}
+
+// brainWebsocketListenerRecording listens to the recording.started and recording.stopped brain websocket events
+func (i *Interface) brainWebsocketListenerRecording(clientEventName string) astibob.BrainWebsocketListenerFunc {
+	return func(brainName string) astiws.ListenerFunc {
+		return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			// Unmarshal payload
+			var p PayloadRecording
+			if err := json.Unmarshal(payload, &p); err != nil {
+				astilog.Error(errors.Wrapf(err, "astirecording: json unmarshaling %s into %#v failed", payload, p))
+				return nil
+			}
+
+			// Execute callbacks
+			fns := i.onStarted
+			if clientEventName == websocketEventNameRecordingStopped {
+				fns = i.onStopped
+			}
+			for _, fn := range fns {
+				if err := fn(brainName, p); err != nil {
+					astilog.Error(errors.Wrap(err, "astirecording: executing callback failed"))
+				}
+			}
+
+			// Dispatch to clients
+			if i.dispatchFunc != nil {
+				i.dispatchFunc(astibob.ClientEvent{Name: clientEventName, Payload: p})
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package astirecording
+
+import (
+	"github.com/asticode/go-astibob/brain"
+)
+
+// Constants
+const (
+	name = "Recording"
+)
+
+// Stop reasons
+const (
+	stopReasonDeactivated = "deactivated"
+	stopReasonMaxDuration = "max.duration"
+	stopReasonRequested   = "requested"
+)
+
+// Websocket event names
+const (
+	websocketEventNameRecordingStart   = "recording.start"
+	websocketEventNameRecordingStarted = "recording.started"
+	websocketEventNameRecordingStop    = "recording.stop"
+	websocketEventNameRecordingStopped = "recording.stopped"
+	websocketEventNameSamples          = "samples"
+)
+
+// PayloadRecording represents a recording payload.
+// Duration, in seconds, and Reason are only set once the recording has stopped, see the stop reason constants.
+type PayloadRecording struct {
+	BrainName string  `json:"brain_name,omitempty"`
+	Duration  float64 `json:"duration,omitempty"`
+	Name      string  `json:"name"`
+	Path      string  `json:"path"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// PayloadSamples represents the samples payload.
+// It's the same as the one of the understanding ability so that both abilities can consume the same sample stream.
+type PayloadSamples struct {
+	BrainName       string                    `json:"brain_name"`
+	EncodedSamples  *astibrain.EncodedSamples `json:"encoded_samples,omitempty"`
+	SampleRate      int                       `json:"sample_rate"`
+	Samples         []int32                   `json:"samples,omitempty"`
+	SignificantBits int                       `json:"significant_bits"`
+}
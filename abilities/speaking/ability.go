@@ -1,25 +1,102 @@
 package astispeaking
 
 import (
+	"context"
 	"sync"
 
 	"encoding/json"
 
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astibob/pkg/sampleformat"
 	"github.com/asticode/go-astilog"
 	"github.com/asticode/go-astiws"
 	"github.com/pkg/errors"
+	"github.com/rs/xid"
 )
 
 // Ability represents an object capable of saying words to an audio output.
+// Sentences are said in FIFO order. When paused, the sentence being said is interrupted and put back at the front of
+// the queue, and queued sentences wait until the ability is resumed.
 type Ability struct {
-	activated bool
-	m         sync.Mutex
-	s         Speaker
+	c            AbilityConfiguration
+	cancelled    bool
+	cancelSay    context.CancelFunc
+	dispatchFunc astibrain.DispatchFunc
+	m            sync.Mutex // Locks cancelled, cancelSay, paused, pq, pqLoaded, q, resumed, running and saying
+	p            Player
+	paused       bool
+	pq           *persistedQueue
+	pqLoaded     bool
+	q            []PayloadSay
+	queued       chan struct{}
+	resumed      chan struct{}
+	running      bool
+	s            Speaker
+	saying       *PayloadSay
+	sy           Synthesizer
 }
 
-// NewAbility creates a new ability
+// AbilityConfiguration represents an ability configuration
+// Language is the language used when the say payload doesn't provide any.
+// Output options are only used with a synthesizer and convert its samples to the format the player expects before
+// they're played. If OutputSampleRate is > 0, samples are resampled to it. If OutputSignificantBits is > 0, samples are
+// converted from SynthesizerSignificantBits, 16 by default, to it. If OutputSampleFormat is int16, samples are clipped
+// to the 16 bits range. If it's float32, samples are converted to floats between -1 and 1 and played with
+// Float32Player.PlayFloat32, which the player must implement.
+// If PersistQueue is true, queued sentences are journaled to QueuePath, each entry being synced to disk, and the ones
+// that have not been said yet are reloaded the first time the ability is switched on, so that they survive a restart.
+// Sentences are marked as done in the journal once they've been said, cancelled or have failed, before being removed
+// from it, so that they're never said twice. A sentence interrupted because the ability has been switched off is said again.
+// QueueSize is the max number of sentences waiting to be said, new sentences being dropped once it's reached.
+type AbilityConfiguration struct {
+	Language                   string `toml:"language"`
+	OutputSampleFormat         string `toml:"output_sample_format"`
+	OutputSampleRate           int    `toml:"output_sample_rate"`
+	OutputSignificantBits      int    `toml:"output_significant_bits"`
+	PersistQueue               bool   `toml:"persist_queue"`
+	QueuePath                  string `toml:"queue_path"`
+	QueueSize                  int    `toml:"queue_size"`
+	SynthesizerSignificantBits int    `toml:"synthesizer_significant_bits"`
+}
+
+// NewAbility creates a new ability that says sentences using a speaker
 func NewAbility(s Speaker) *Ability {
-	return &Ability{s: s}
+	return NewSpeakerAbility(s, AbilityConfiguration{})
+}
+
+// NewSpeakerAbility creates a new ability that says sentences using a speaker and a configuration
+func NewSpeakerAbility(s Speaker, c AbilityConfiguration) *Ability {
+	return newAbility(c, func(a *Ability) { a.s = s })
+}
+
+// NewSynthesizerAbility creates a new ability that says sentences by playing the samples produced by a synthesizer
+func NewSynthesizerAbility(s Synthesizer, p Player, c AbilityConfiguration) *Ability {
+	return newAbility(c, func(a *Ability) {
+		a.p = p
+		a.sy = s
+	})
+}
+
+// newAbility creates a new ability
+func newAbility(c AbilityConfiguration, fn func(a *Ability)) (a *Ability) {
+	// Create
+	a = &Ability{
+		c:      c,
+		queued: make(chan struct{}, 1),
+	}
+	fn(a)
+
+	// Default configuration values
+	if a.c.QueueSize <= 0 {
+		a.c.QueueSize = 100
+	}
+	if a.c.SynthesizerSignificantBits <= 0 {
+		a.c.SynthesizerSignificantBits = 16
+	}
+
+	// Create persisted queue
+	a.pq = newPersistedQueue(a.c)
+	return
 }
 
 // Name implements the astibrain.Ability interface
@@ -32,43 +109,407 @@ func (a *Ability) Description() string {
 	return "Says words to your audio output using speech synthesis"
 }
 
-// Activate implements the astibrain.Activable interface
-func (a *Ability) Activate(activated bool) {
+// SetDispatchFunc implements the astibrain.Dispatcher interface
+func (a *Ability) SetDispatchFunc(fn astibrain.DispatchFunc) {
+	a.dispatchFunc = fn
+}
+
+// Run implements the astibrain.Runnable interface
+func (a *Ability) Run(ctx context.Context) (err error) {
+	// Update running attribute
+	// The persisted queue is loaded in the same critical section so that sentences queued meanwhile are not reloaded
+	a.m.Lock()
+	a.paused = false
+	a.running = true
+	a.loadQueueUnsafe()
+	a.m.Unlock()
+	defer func() {
+		a.m.Lock()
+		a.running = false
+		a.pq.close()
+		a.m.Unlock()
+	}()
+
+	// Listen
+	for {
+		// Get next sentence
+		var p PayloadSay
+		var sayCtx context.Context
+		var cancel context.CancelFunc
+		if p, sayCtx, cancel, err = a.next(ctx); err != nil {
+			err = errors.Wrap(err, "astispeaking: getting next sentence failed")
+			return
+		}
+
+		// Say
+		a.say(sayCtx, p)
+		cancel()
+	}
+}
+
+// next waits for a sentence to be queued and for the ability to be resumed if it's paused, pops the sentence and
+// creates a context that is cancelled if the ability is paused or the sentence is cancelled while it's being said
+func (a *Ability) next(ctx context.Context) (p PayloadSay, sayCtx context.Context, cancel context.CancelFunc, err error) {
+	for {
+		// Ability is not paused and a sentence is queued
+		a.m.Lock()
+		if !a.paused && len(a.q) > 0 {
+			p = a.q[0]
+			a.q = a.q[1:]
+			sayCtx, cancel = context.WithCancel(ctx)
+			a.cancelled = false
+			a.cancelSay = cancel
+			a.saying = &p
+			a.m.Unlock()
+			return
+		}
+		wait := a.queued
+		if a.paused {
+			wait = a.resumed
+		}
+		a.m.Unlock()
+
+		// Wait for the ability to be resumed or for a sentence to be queued
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			err = errors.Wrap(ctx.Err(), "astispeaking: context error")
+			return
+		}
+	}
+}
+
+// Say adds a sentence to the queue and returns its id.
+// The id is empty if the ability is not running or if the queue is full.
+func (a *Ability) Say(text string) (id string) {
+	p := PayloadSay{Text: text}
+	if !a.enqueue(&p) {
+		return
+	}
+	return p.ID
+}
+
+// enqueue adds a sentence to the queue and sets its id if it doesn't have any
+func (a *Ability) enqueue(p *PayloadSay) bool {
+	// Lock
 	a.m.Lock()
 	defer a.m.Unlock()
-	a.activated = activated
+
+	// Ability is not running
+	if !a.running {
+		astilog.Error("astispeaking: ability is not running")
+		return false
+	}
+
+	// Queue is full
+	if len(a.q) >= a.c.QueueSize {
+		astilog.Errorf("astispeaking: queue is full, dropping %s", p.Text)
+		return false
+	}
+
+	// Set id
+	if len(p.ID) == 0 {
+		p.ID = xid.New().String()
+	}
+
+	// Add to queue
+	a.q = append(a.q, *p)
+	a.pq.queued(*p)
+
+	// Notify
+	select {
+	case a.queued <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Cancel drops the sentence if it's queued and interrupts it if it's being said
+func (a *Ability) Cancel(id string) {
+	// Lock
+	a.m.Lock()
+
+	// Sentence is being said
+	if a.saying != nil && a.saying.ID == id {
+		a.cancelSayingUnsafe()
+		a.m.Unlock()
+		return
+	}
+
+	// Remove sentence from queue
+	var ps []PayloadSay
+	for idx, p := range a.q {
+		if p.ID == id {
+			ps = append(ps, p)
+			a.q = append(a.q[:idx], a.q[idx+1:]...)
+			a.pq.markDone(p.ID, a.pendingUnsafe())
+			break
+		}
+	}
+	a.m.Unlock()
+
+	// Dispatch
+	for _, p := range ps {
+		a.dispatch(websocketEventNameSayCancelled, p)
+	}
+}
+
+// CancelAll drops all queued sentences and interrupts the sentence being said
+func (a *Ability) CancelAll() {
+	// Lock
+	a.m.Lock()
+
+	// Interrupt the sentence being said
+	a.cancelSayingUnsafe()
+
+	// Empty queue
+	ps := a.q
+	a.q = nil
+	for _, p := range ps {
+		a.pq.markDone(p.ID, a.pendingUnsafe())
+	}
+	a.m.Unlock()
+
+	// Dispatch
+	for _, p := range ps {
+		a.dispatch(websocketEventNameSayCancelled, p)
+	}
+}
+
+// cancelSayingUnsafe interrupts the sentence being said and makes sure it's not put back in the queue.
+// Assumption is made that m is locked
+func (a *Ability) cancelSayingUnsafe() {
+	if a.saying == nil {
+		return
+	}
+	a.cancelled = true
+	a.cancelSay()
+}
+
+// Pause implements the astibrain.Pausable interface
+func (a *Ability) Pause() {
+	// Lock
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// Already paused
+	if a.paused {
+		return
+	}
+
+	// Pause
+	a.paused = true
+	a.resumed = make(chan struct{})
+
+	// Interrupt the sentence being said
+	if a.cancelSay != nil {
+		a.cancelSay()
+	}
+}
+
+// Resume implements the astibrain.Pausable interface
+func (a *Ability) Resume() {
+	// Lock
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// Not paused
+	if !a.paused {
+		return
+	}
+
+	// Resume
+	a.paused = false
+	close(a.resumed)
+}
+
+// say says a sentence and dispatches events around it
+func (a *Ability) say(ctx context.Context, p PayloadSay) {
+	// Dispatch
+	a.dispatch(websocketEventNameSaying, p)
+
+	// Say
+	l := astibrain.LoggerFromContext(ctx)
+	l.Debugf("astispeaking: saying %s", p.Text)
+	err := a.sayWithVoice(ctx, p)
+
+	// Update saying attribute
+	// Sentences interrupted because the ability has been switched off are only said again if the queue is persisted
+	a.m.Lock()
+	a.saying = nil
+	cancelled, paused := a.cancelled, a.paused
+	if err != nil && ctx.Err() != nil && !cancelled && (paused || a.pq != nil) {
+		a.q = append([]PayloadSay{p}, a.q...)
+	} else {
+		a.pq.markDone(p.ID, a.pendingUnsafe())
+	}
+	a.m.Unlock()
+
+	// Process error
+	if err != nil {
+		// Sentence has been interrupted
+		if ctx.Err() != nil {
+			if cancelled {
+				l.Debugf("astispeaking: saying %s has been cancelled", p.Text)
+				a.dispatch(websocketEventNameSayCancelled, p)
+			} else if paused {
+				l.Debugf("astispeaking: saying %s has been interrupted, it will be said again once resumed", p.Text)
+			} else {
+				l.Debugf("astispeaking: saying %s has been interrupted", p.Text)
+			}
+			return
+		}
+		l.Error(errors.Wrapf(err, "astispeaking: saying %s failed", p.Text))
+		return
+	}
+
+	// Dispatch
+	a.dispatch(websocketEventNameSaid, p)
+}
+
+// sayWithVoice says a sentence with either the speaker or the synthesizer
+func (a *Ability) sayWithVoice(ctx context.Context, p PayloadSay) (err error) {
+	// Speaker
+	if a.s != nil {
+		return a.s.Say(p.Text)
+	}
+
+	// Get language
+	language := p.Language
+	if len(language) == 0 {
+		language = a.c.Language
+	}
+
+	// Synthesize
+	var samples []int32
+	var sampleRate int
+	if samples, sampleRate, err = a.sy.Say(ctx, p.Text, language); err != nil {
+		err = errors.Wrap(err, "astispeaking: synthesizing failed")
+		return
+	}
+
+	// Convert
+	var significantBits int
+	samples, sampleRate, significantBits = a.convert(samples, sampleRate)
+
+	// Play float samples
+	if a.c.OutputSampleFormat == astisampleformat.SampleFormatFloat32 {
+		v, ok := a.p.(Float32Player)
+		if !ok {
+			err = errors.New("astispeaking: player doesn't implement Float32Player")
+			return
+		}
+		if err = v.PlayFloat32(ctx, astisampleformat.Int32ToFloat32(samples, significantBits), sampleRate); err != nil {
+			err = errors.Wrap(err, "astispeaking: playing failed")
+			return
+		}
+		return
+	}
+
+	// Play
+	if err = a.p.Play(ctx, astisampleformat.Denormalize(samples, a.c.OutputSampleFormat, significantBits), sampleRate); err != nil {
+		err = errors.Wrap(err, "astispeaking: playing failed")
+		return
+	}
+	return
+}
+
+// convert resamples synthesized samples and converts their significant bits to the ones the player expects
+// Samples are returned as is if the output options are not set or match the synthesizer format.
+func (a *Ability) convert(samples []int32, sampleRate int) ([]int32, int, int) {
+	// Resample
+	if a.c.OutputSampleRate > 0 {
+		samples = astisampleformat.Resample(samples, sampleRate, a.c.OutputSampleRate)
+		sampleRate = a.c.OutputSampleRate
+	}
+
+	// Convert significant bits
+	significantBits := a.c.SynthesizerSignificantBits
+	if a.c.OutputSignificantBits > 0 {
+		samples = astisampleformat.ConvertSignificantBits(samples, significantBits, a.c.OutputSignificantBits)
+		significantBits = a.c.OutputSignificantBits
+	}
+
+	return samples, sampleRate, significantBits
+}
+
+// dispatch dispatches an event
+func (a *Ability) dispatch(eventName string, p PayloadSay) {
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        eventName,
+			Payload:     p,
+		})
+	}
 }
 
 // WebsocketListeners implements the astibrain.WebsocketListener interface
 func (a *Ability) WebsocketListeners() map[string]astiws.ListenerFunc {
 	return map[string]astiws.ListenerFunc{
-		websocketEventNameSay: a.websocketListenerSay,
+		websocketEventNameSay:          a.websocketListenerSay,
+		websocketEventNameSayCancel:    a.websocketListenerSayCancel,
+		websocketEventNameSayCancelAll: a.websocketListenerSayCancelAll,
 	}
 }
 
+// PayloadSay represents a say payload
+type PayloadSay struct {
+	ID       string `json:"id,omitempty"`
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+// A plain string is still accepted as the text for backward compatibility
+func (p *PayloadSay) UnmarshalJSON(b []byte) (err error) {
+	// Plain string
+	var s string
+	if err = json.Unmarshal(b, &s); err == nil {
+		p.Text = s
+		return
+	}
+
+	// Object
+	type payloadSay PayloadSay
+	var v payloadSay
+	if err = json.Unmarshal(b, &v); err != nil {
+		return
+	}
+	*p = PayloadSay(v)
+	return
+}
+
 // websocketListenerSay listens to the say websocket event
 func (a *Ability) websocketListenerSay(c *astiws.Client, eventName string, payload json.RawMessage) error {
-	// Ability is not activated
-	a.m.Lock()
-	activated := a.activated
-	a.m.Unlock()
-	if !activated {
-		astilog.Error("astispeaking: ability is not activated")
+	// Unmarshal payload
+	var p PayloadSay
+	if err := json.Unmarshal(payload, &p); err != nil {
+		astilog.Error(errors.Wrapf(err, "astispeaking: json unmarshaling %s into %#v failed", payload, p))
 		return nil
 	}
 
+	// Add to queue
+	a.enqueue(&p)
+	return nil
+}
+
+// websocketListenerSayCancel listens to the say.cancel websocket event
+func (a *Ability) websocketListenerSayCancel(c *astiws.Client, eventName string, payload json.RawMessage) error {
 	// Unmarshal payload
-	var i string
-	if err := json.Unmarshal(payload, &i); err != nil {
-		astilog.Error(errors.Wrapf(err, "astispeaking: json unmarshaling %s into %#v failed", payload, i))
+	var id string
+	if err := json.Unmarshal(payload, &id); err != nil {
+		astilog.Error(errors.Wrapf(err, "astispeaking: json unmarshaling %s into %#v failed", payload, id))
 		return nil
 	}
 
-	// Say
-	astilog.Debugf("astispeaking: saying %s", i)
-	if err := a.s.Say(i); err != nil {
-		astilog.Error(errors.Wrapf(err, "astispeaking: saying %s failed", i))
-		return nil
-	}
+	// Cancel
+	a.Cancel(id)
+	return nil
+}
+
+// websocketListenerSayCancelAll listens to the say.cancel.all websocket event
+func (a *Ability) websocketListenerSayCancelAll(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	a.CancelAll()
 	return nil
 }
@@ -0,0 +1,70 @@
+package astispeaking
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSynthesizer represents a synthesizer returning fixed samples
+type testSynthesizer struct {
+	sampleRate int
+	samples    []int32
+}
+
+func (s *testSynthesizer) Say(ctx context.Context, text, language string) ([]int32, int, error) {
+	return s.samples, s.sampleRate, nil
+}
+
+// testPlayer represents a player recording what it has played
+type testPlayer struct {
+	floats     []float32
+	ints       []int32
+	sampleRate int
+}
+
+func (p *testPlayer) Play(ctx context.Context, samples []int32, sampleRate int) error {
+	p.ints, p.sampleRate = samples, sampleRate
+	return nil
+}
+
+// testFloat32Player represents a player recording the float samples it has played
+type testFloat32Player struct {
+	testPlayer
+}
+
+func (p *testFloat32Player) PlayFloat32(ctx context.Context, samples []float32, sampleRate int) error {
+	p.floats, p.sampleRate = samples, sampleRate
+	return nil
+}
+
+func TestAbilityOutputSampleFormat(t *testing.T) {
+	sy := &testSynthesizer{sampleRate: 8000, samples: []int32{-32767, 0, 32767, 40000}}
+
+	// Float samples are played with PlayFloat32
+	fp := &testFloat32Player{}
+	a := NewSynthesizerAbility(sy, fp, AbilityConfiguration{OutputSampleFormat: "float32", OutputSampleRate: 16000})
+	assert.NoError(t, a.sayWithVoice(context.Background(), PayloadSay{Text: "test"}))
+	assert.Nil(t, fp.ints)
+	assert.Equal(t, 16000, fp.sampleRate)
+	assert.Len(t, fp.floats, 8)
+	assert.InDeltaSlice(t, []float32{-1, -0.5, 0, 0.5, 1}, fp.floats[:5], 0.001)
+
+	// Players must implement PlayFloat32 to play float samples
+	a = NewSynthesizerAbility(sy, &testPlayer{}, AbilityConfiguration{OutputSampleFormat: "float32"})
+	assert.Error(t, a.sayWithVoice(context.Background(), PayloadSay{Text: "test"}))
+
+	// Int16 samples are clipped
+	p := &testPlayer{}
+	a = NewSynthesizerAbility(sy, p, AbilityConfiguration{OutputSampleFormat: "int16", OutputSignificantBits: 24})
+	assert.NoError(t, a.sayWithVoice(context.Background(), PayloadSay{Text: "test"}))
+	assert.Equal(t, []int32{-32767, 0, 32767, 32767}, p.ints)
+	assert.Equal(t, 8000, p.sampleRate)
+
+	// Samples are played as is without output options
+	p = &testPlayer{}
+	a = NewSynthesizerAbility(sy, p, AbilityConfiguration{})
+	assert.NoError(t, a.sayWithVoice(context.Background(), PayloadSay{Text: "test"}))
+	assert.Equal(t, sy.samples, p.ints)
+}
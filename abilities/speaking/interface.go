@@ -1,10 +1,15 @@
 package astispeaking
 
 import (
+	"encoding/json"
 	"net/http"
 	"sync"
 
 	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
 )
 
 // Interface is the interface of the ability
@@ -62,6 +67,72 @@ func (i *Interface) Say(s string) *astibob.Cmd {
 	}
 }
 
+// SayWithLanguage creates a say cmd with a specific language
+func (i *Interface) SayWithLanguage(s, language string) *astibob.Cmd {
+	i.addToHistory(s)
+	return &astibob.Cmd{
+		AbilityName: name,
+		EventName:   websocketEventNameSay,
+		Payload: PayloadSay{
+			Language: language,
+			Text:     s,
+		},
+	}
+}
+
+// Cancel creates a cmd cancelling a sentence
+func (i *Interface) Cancel(id string) *astibob.Cmd {
+	return &astibob.Cmd{
+		AbilityName: name,
+		EventName:   websocketEventNameSayCancel,
+		Payload:     id,
+	}
+}
+
+// CancelAll creates a cmd cancelling all sentences that have not been said yet
+func (i *Interface) CancelAll() *astibob.Cmd {
+	return &astibob.Cmd{
+		AbilityName: name,
+		EventName:   websocketEventNameSayCancelAll,
+	}
+}
+
+// BrainWebsocketListeners implements the astibob.BrainWebsocketListener interface
+func (i *Interface) BrainWebsocketListeners() map[string]astibob.BrainWebsocketListenerFunc {
+	return map[string]astibob.BrainWebsocketListenerFunc{
+		websocketEventNameSaid:         i.brainWebsocketListenerSaying,
+		websocketEventNameSayCancelled: i.brainWebsocketListenerSaying,
+		websocketEventNameSaying:       i.brainWebsocketListenerSaying,
+	}
+}
+
+// brainWebsocketListenerSaying listens to the saying, said and say.cancelled brain websocket events
+func (i *Interface) brainWebsocketListenerSaying(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadSay
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astispeaking: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Get event name
+		var n = websocketEventNameSaying
+		switch astibrain.WebsocketEventName(eventName) {
+		case astibrain.WebsocketAbilityEventName(name, websocketEventNameSaid):
+			n = websocketEventNameSaid
+		case astibrain.WebsocketAbilityEventName(name, websocketEventNameSayCancelled):
+			n = websocketEventNameSayCancelled
+		}
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: n, Payload: p})
+		}
+		return nil
+	}
+}
+
 // APIHandlers implements the astibob.APIHandle interface
 func (i *Interface) APIHandlers() map[string]http.Handler {
 	return map[string]http.Handler{
@@ -97,6 +168,8 @@ func (i *Interface) webTemplateIndex() string {
 	return `{{ define "title" }}Speaking{{ end }}
 {{ define "css" }}{{ end }}
 {{ define "html" }}
+	<div class="header">Saying</div>
+	<p id="saying"></p>
 	<div class="header">History</div>
 	<div class="flex" id="history"></div>
 {{ end }}
@@ -133,6 +206,15 @@ func (i *Interface) webTemplateIndex() string {
 				case base.abilityWebsocketEventName("history"):
 					speaking.addHistory(payload);
 					break;
+				case base.abilityWebsocketEventName("said"):
+					$("#saying").text("");
+					break;
+				case base.abilityWebsocketEventName("say.cancelled"):
+					if ($("#saying").data("id") === payload.id) $("#saying").text("");
+					break;
+				case base.abilityWebsocketEventName("saying"):
+					$("#saying").data("id", payload.id).text(payload.text);
+					break;
 			}
 		}
 	}
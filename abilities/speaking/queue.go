@@ -0,0 +1,292 @@
+package astispeaking
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// persistedQueueEntry represents an entry of the persisted queue journal
+// Entries either queue a sentence or mark it as done so that it's never said again once the queue is reloaded.
+type persistedQueueEntry struct {
+	Done bool        `json:"done,omitempty"`
+	ID   string      `json:"id"`
+	Say  *PayloadSay `json:"say,omitempty"`
+}
+
+// persistedQueue represents a queue persisted to a JSON lines journal
+// A nil *persistedQueue is valid and doesn't persist anything. Assumption is made that the ability's m is locked
+// whenever its methods are called.
+// The journal is opened once and kept open until the ability stops running. Each entry is synced to disk before
+// append returns so that it survives a crash.
+type persistedQueue struct {
+	done int // Number of done entries since the journal has been compacted
+	f    *os.File
+	max  int
+	path string
+}
+
+// newPersistedQueue creates a new persisted queue
+// It returns nil if the queue is not persisted.
+func newPersistedQueue(c AbilityConfiguration) *persistedQueue {
+	// Queue is not persisted
+	if !c.PersistQueue {
+		return nil
+	}
+
+	// No path
+	if len(c.QueuePath) == 0 {
+		astilog.Error("astispeaking: queue path is empty, queue won't be persisted")
+		return nil
+	}
+	return &persistedQueue{
+		max:  c.QueueSize,
+		path: c.QueuePath,
+	}
+}
+
+// load replays the journal and returns the sentences that have been queued but are not done yet, oldest first
+// A missing journal is considered as empty. Only the max most recent sentences are returned.
+func (q *persistedQueue) load() (ps []PayloadSay, err error) {
+	// Open file
+	var f *os.File
+	if f, err = os.Open(q.path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+		err = errors.Wrapf(err, "astispeaking: opening %s failed", q.path)
+		return
+	}
+	defer f.Close()
+
+	// Loop through lines
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16<<20)
+	for s.Scan() {
+		// Unmarshal
+		var e persistedQueueEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			astilog.Error(errors.Wrapf(err, "astispeaking: json unmarshaling queue entry %s failed", s.Bytes()))
+			continue
+		}
+
+		// Replay
+		if e.Done {
+			for idx, p := range ps {
+				if p.ID == e.ID {
+					ps = append(ps[:idx], ps[idx+1:]...)
+					break
+				}
+			}
+		} else if e.Say != nil {
+			ps = append(ps, *e.Say)
+		}
+	}
+	if err = s.Err(); err != nil {
+		err = errors.Wrapf(err, "astispeaking: scanning %s failed", q.path)
+		return
+	}
+
+	// Bound
+	if len(ps) > q.max {
+		astilog.Errorf("astispeaking: dropping %d persisted sentences exceeding the queue size", len(ps)-q.max)
+		ps = ps[len(ps)-q.max:]
+	}
+	return
+}
+
+// compact rewrites the journal so that it only contains the pending sentences
+// The journal is replaced atomically so that it's never left half written.
+func (q *persistedQueue) compact(ps []PayloadSay) (err error) {
+	// Create temporary file
+	tmp := q.path + ".tmp"
+	var f *os.File
+	if f, err = os.Create(tmp); err != nil {
+		err = errors.Wrapf(err, "astispeaking: creating %s failed", tmp)
+		return
+	}
+
+	// Write entries
+	w := bufio.NewWriter(f)
+	for idx := range ps {
+		if err = writeQueueEntry(w, persistedQueueEntry{ID: ps[idx].ID, Say: &ps[idx]}); err != nil {
+			f.Close()
+			err = errors.Wrapf(err, "astispeaking: writing to %s failed", tmp)
+			return
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		err = errors.Wrapf(err, "astispeaking: flushing %s failed", tmp)
+		return
+	}
+
+	// Sync
+	if err = f.Sync(); err != nil {
+		f.Close()
+		err = errors.Wrapf(err, "astispeaking: syncing %s failed", tmp)
+		return
+	}
+
+	// Close
+	if err = f.Close(); err != nil {
+		err = errors.Wrapf(err, "astispeaking: closing %s failed", tmp)
+		return
+	}
+
+	// Replace journal
+	// The previous journal is closed so that the next entry is appended to the new one
+	if err = os.Rename(tmp, q.path); err != nil {
+		err = errors.Wrapf(err, "astispeaking: renaming %s into %s failed", tmp, q.path)
+		return
+	}
+	q.close()
+	q.done = 0
+	return
+}
+
+// close closes the journal and mutes the error (which is still logged)
+// It's reopened by the next append.
+func (q *persistedQueue) close() {
+	// Queue is not persisted or journal is not open
+	if q == nil || q.f == nil {
+		return
+	}
+
+	// Close
+	if err := q.f.Close(); err != nil {
+		astilog.Error(errors.Wrapf(err, "astispeaking: closing %s failed", q.path))
+	}
+	q.f = nil
+}
+
+// queued appends a queued sentence to the journal and mutes the error (which is still logged)
+func (q *persistedQueue) queued(p PayloadSay) {
+	// Queue is not persisted
+	if q == nil {
+		return
+	}
+
+	// Append
+	if err := q.append(persistedQueueEntry{ID: p.ID, Say: &p}); err != nil {
+		astilog.Error(errors.Wrapf(err, "astispeaking: persisting queued sentence %s failed", p.ID))
+	}
+}
+
+// markDone marks a sentence as done in the journal and mutes the error (which is still logged)
+// The journal is compacted with the pending sentences once enough sentences are done.
+func (q *persistedQueue) markDone(id string, pending []PayloadSay) {
+	// Queue is not persisted
+	if q == nil {
+		return
+	}
+
+	// Append
+	if err := q.append(persistedQueueEntry{Done: true, ID: id}); err != nil {
+		astilog.Error(errors.Wrapf(err, "astispeaking: marking sentence %s as done failed", id))
+		return
+	}
+	q.done++
+
+	// Compact
+	if q.done >= q.max {
+		if err := q.compact(pending); err != nil {
+			astilog.Error(errors.Wrap(err, "astispeaking: compacting queue failed"))
+		}
+	}
+}
+
+// append appends an entry to the journal and syncs it to disk
+func (q *persistedQueue) append(e persistedQueueEntry) (err error) {
+	// Open file
+	if q.f == nil {
+		if q.f, err = os.OpenFile(q.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			q.f = nil
+			err = errors.Wrapf(err, "astispeaking: opening %s failed", q.path)
+			return
+		}
+	}
+
+	// Write
+	if err = writeQueueEntry(q.f, e); err != nil {
+		err = errors.Wrapf(err, "astispeaking: writing to %s failed", q.path)
+		return
+	}
+
+	// Sync
+	if err = q.f.Sync(); err != nil {
+		err = errors.Wrapf(err, "astispeaking: syncing %s failed", q.path)
+		return
+	}
+	return
+}
+
+// writeQueueEntry writes an entry as a JSON line
+func writeQueueEntry(w io.Writer, e persistedQueueEntry) (err error) {
+	// Marshal
+	var b []byte
+	if b, err = json.Marshal(e); err != nil {
+		err = errors.Wrapf(err, "astispeaking: json marshaling %#v failed", e)
+		return
+	}
+
+	// Write
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		err = errors.Wrap(err, "astispeaking: writing failed")
+		return
+	}
+	return
+}
+
+// pendingUnsafe returns the sentence being said, if any, followed by the queued sentences
+// Assumption is made that m is locked
+func (a *Ability) pendingUnsafe() (ps []PayloadSay) {
+	if a.saying != nil {
+		ps = append(ps, *a.saying)
+	}
+	return append(ps, a.q...)
+}
+
+// loadQueueUnsafe reloads the persisted queue the first time the ability is switched on
+// It must be called before sentences can be queued so that they're not reloaded twice.
+// Assumption is made that m is locked
+func (a *Ability) loadQueueUnsafe() {
+	// Queue is not persisted or has already been loaded
+	if a.pq == nil || a.pqLoaded {
+		return
+	}
+	a.pqLoaded = true
+
+	// Load
+	ps, err := a.pq.load()
+	if err != nil {
+		astilog.Error(errors.Wrap(err, "astispeaking: loading persisted queue failed"))
+		return
+	}
+	astilog.Debugf("astispeaking: %d persisted sentence(s) have been reloaded", len(ps))
+
+	// Update queue
+	a.q = append(ps, a.q...)
+	if len(a.q) > a.c.QueueSize {
+		astilog.Errorf("astispeaking: dropping %d sentence(s) exceeding the queue size once the persisted queue has been reloaded", len(a.q)-a.c.QueueSize)
+		a.q = a.q[:a.c.QueueSize]
+	}
+
+	// Compact
+	if err = a.pq.compact(a.q); err != nil {
+		astilog.Error(errors.Wrap(err, "astispeaking: compacting queue failed"))
+	}
+
+	// Notify
+	if len(a.q) > 0 {
+		select {
+		case a.queued <- struct{}{}:
+		default:
+		}
+	}
+}
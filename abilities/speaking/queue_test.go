@@ -0,0 +1,115 @@
+package astispeaking
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPersistedQueueForTest creates a persisted queue whose journal is in a temporary directory
+func newPersistedQueueForTest(t *testing.T, max int) *persistedQueue {
+	q := newPersistedQueue(AbilityConfiguration{PersistQueue: true, QueuePath: filepath.Join(t.TempDir(), "queue"), QueueSize: max})
+	t.Cleanup(q.close)
+	return q
+}
+
+// ids returns the ids of sentences
+func ids(ps []PayloadSay) (o []string) {
+	for _, p := range ps {
+		o = append(o, p.ID)
+	}
+	return
+}
+
+// journalLines returns the lines of the journal
+func journalLines(t *testing.T, q *persistedQueue) []string {
+	b, err := ioutil.ReadFile(q.path)
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestPersistedQueueReplay(t *testing.T) {
+	q := newPersistedQueueForTest(t, 10)
+
+	// Missing journal is empty
+	ps, err := q.load()
+	assert.NoError(t, err)
+	assert.Empty(t, ps)
+
+	// Done sentences are not replayed
+	for _, id := range []string{"1", "2", "3"} {
+		q.queued(PayloadSay{ID: id, Text: id})
+	}
+	q.markDone("2", nil)
+	ps, err = q.load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, ids(ps))
+	assert.Len(t, journalLines(t, q), 4)
+
+	// Invalid entries are skipped
+	assert.NoError(t, writeQueueEntry(q.f, persistedQueueEntry{}))
+	_, err = q.f.WriteString("invalid\n")
+	assert.NoError(t, err)
+	q.queued(PayloadSay{ID: "4", Text: "4"})
+	ps, err = q.load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3", "4"}, ids(ps))
+
+	// Only the most recent sentences are replayed
+	q.max = 2
+	ps, err = q.load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "4"}, ids(ps))
+}
+
+func TestPersistedQueueCompaction(t *testing.T) {
+	q := newPersistedQueueForTest(t, 2)
+	for _, id := range []string{"1", "2", "3"} {
+		q.queued(PayloadSay{ID: id, Text: id})
+	}
+
+	// Journal is compacted once enough sentences are done
+	q.markDone("1", []PayloadSay{{ID: "2"}, {ID: "3"}})
+	assert.Len(t, journalLines(t, q), 4)
+	q.markDone("2", []PayloadSay{{ID: "3", Text: "3"}})
+	assert.Len(t, journalLines(t, q), 1)
+	assert.Nil(t, q.f)
+	assert.Equal(t, 0, q.done)
+
+	// Entries are appended to the compacted journal
+	q.queued(PayloadSay{ID: "4", Text: "4"})
+	ps, err := q.load()
+	assert.NoError(t, err)
+	assert.Equal(t, []PayloadSay{{ID: "3", Text: "3"}, {ID: "4", Text: "4"}}, ps)
+
+	// Closing is idempotent and the journal is reopened by the next append
+	q.close()
+	q.close()
+	q.queued(PayloadSay{ID: "5", Text: "5"})
+	assert.Len(t, journalLines(t, q), 3)
+}
+
+func TestAbilityLoadQueue(t *testing.T) {
+	// Persist
+	path := filepath.Join(t.TempDir(), "queue")
+	q := newPersistedQueue(AbilityConfiguration{PersistQueue: true, QueuePath: path, QueueSize: 10})
+	for _, id := range []string{"1", "2", "3"} {
+		q.queued(PayloadSay{ID: id, Text: id})
+	}
+	q.close()
+
+	// Reload into a smaller queue
+	a := NewSpeakerAbility(nil, AbilityConfiguration{PersistQueue: true, QueuePath: path, QueueSize: 2})
+	a.m.Lock()
+	a.loadQueueUnsafe()
+	a.loadQueueUnsafe()
+	a.m.Unlock()
+	defer a.pq.close()
+	assert.Equal(t, []string{"2", "3"}, ids(a.q))
+
+	// Journal has been compacted
+	assert.Len(t, journalLines(t, a.pq), 2)
+}
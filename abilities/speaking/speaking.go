@@ -1,5 +1,7 @@
 package astispeaking
 
+import "context"
+
 // Constants
 const (
 	name = "Speaking"
@@ -7,10 +9,31 @@ const (
 
 // Websocket event names
 const (
-	websocketEventNameSay = "say"
+	websocketEventNameSaid         = "said"
+	websocketEventNameSay          = "say"
+	websocketEventNameSayCancel    = "say.cancel"
+	websocketEventNameSayCancelAll = "say.cancel.all"
+	websocketEventNameSayCancelled = "say.cancelled"
+	websocketEventNameSaying       = "saying"
 )
 
 // Speaker represents an object capable of saying things to an audio output
 type Speaker interface {
 	Say(s string) error
 }
+
+// Synthesizer represents an object capable of synthesizing speech into audio samples
+type Synthesizer interface {
+	Say(ctx context.Context, text, language string) (samples []int32, sampleRate int, err error)
+}
+
+// Player represents an object capable of playing audio samples to an audio output
+type Player interface {
+	Play(ctx context.Context, samples []int32, sampleRate int) error
+}
+
+// Float32Player represents a player capable of playing float samples between -1 and 1. It's required when the output
+// sample format is float32.
+type Float32Player interface {
+	PlayFloat32(ctx context.Context, samples []float32, sampleRate int) error
+}
@@ -3,8 +3,8 @@ package astiunderstanding
 import (
 	"context"
 	"encoding/json"
-	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"fmt"
@@ -12,24 +12,69 @@ import (
 	"sync"
 
 	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astibob/pkg/sampleformat"
 	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astitools/audio"
 	"github.com/asticode/go-astitools/sync"
 	"github.com/asticode/go-astiws"
-	"github.com/cryptix/wav"
 	"github.com/pkg/errors"
-	"github.com/rs/xid"
 )
 
 // Ability represents an object capable of doing speech to text analysis
 type Ability struct {
+	actx         context.Context // Set while running
+	af           func() []AudioFilter
+	afs          map[pipelineKey][]AudioFilter // Only accessed in Run
+	als          map[pipelineKey]*audioLevel   // Only accessed in Run
+	am           sync.Mutex                    // Locks actx and as
+	as           map[string]*audioSource       // Indexed by source
+	b            *batch                        // Only accessed in Run
 	c            AbilityConfiguration
 	ch           chan PayloadSamples
+	chr          chan struct{} // Receives whenever sources have been removed
+	cm           sync.Mutex    // Locks c.Language, c.SilenceMaxAudioLevel, c.Sources and rs
 	d            *astisync.Do
 	dispatchFunc astibrain.DispatchFunc
+	dm           sync.Mutex              // Locks ds
+	dms          map[pipelineKey][]int32 // Incomplete trailing frames waiting to be downmixed, only accessed in Run
+	ds           map[pipelineKey]*astisync.Do
+	f            int        // Number of in-flight speech to text calls
+	fm           sync.Mutex // Locks f
+	gaugeFunc    astibrain.GaugeFunc
+	gs           map[pipelineKey]float64 // Only accessed in Run
+	ir           *IntentRouter
+	ld           LanguageDetector
+	lps          map[string]SpeechParser       // Indexed by language
+	lss          map[pipelineKey]DetectorState // Only accessed in Run
+	observeFunc  astibrain.ObserveFunc
 	m            sync.Mutex // Locks sds
+	oa           bool       // Whether a one-shot capture is armed
+	om           sync.Mutex // Locks oa and ows
+	ows          []chan listenOnceResult
 	p            SpeechParser
+	pw           sync.Once  // Warns that no speech parser has been set
+	qc           *sync.Cond // Broadcast whenever qs changes
+	qm           sync.Mutex // Locks qs
+	qs           map[pipelineKey][]queuedSamples
+	rs           []string // Removed sources whose pipeline has not been removed yet
+	s            *SamplesStore
 	sd           func() SilenceDetector
-	sds          map[string]SilenceDetector // Indexed by brain name
+	sds          map[pipelineKey]SilenceDetector
+	sem          chan struct{}           // Limits the number of concurrent speech to text calls
+	sps          map[pipelineKey]bool    // Only accessed in Run
+	ss           map[pipelineKey]*stream // Only accessed in Run
+	tc           chan PayloadAnalysis    // Transcript output port
+	um           sync.Mutex              // Locks us
+	us           UtteranceStats
+	wd           WakeWordDetector
+	wds          map[pipelineKey]*wake // Only accessed in Run
+	wh           *webhook
+}
+
+// wake represents the wake state of a brain
+type wake struct {
+	at             time.Time
+	lastActivityAt time.Time
 }
 
 // AbilityConfiguration represents an ability configuration
@@ -37,19 +82,143 @@ type Ability struct {
 // TODO Add option in UI to prepare training data
 // TODO Add option in UI to train data
 type AbilityConfiguration struct {
-	SamplesDirectory string `toml:"samples_directory"`
-	StoreSamples     bool   `toml:"store_samples"`
+	// If AGCTargetLevel is > 0, samples are amplified toward that RMS level, the gain being bounded by AGCMaxGain if
+	// it's > 0
+	AGCMaxGain     float64 `toml:"agc_max_gain"`
+	AGCTargetLevel float64 `toml:"agc_target_level"`
+
+	// If ActiveIdleTimeout is > 0, the brain stays awake until it's been silent for that duration
+	ActiveIdleTimeout time.Duration `toml:"active_idle_timeout"`
+
+	// AnalysisQueueSize is the max number of utterances waiting to be parsed per pipeline, 10 by default and < 0 meaning
+	// unbounded. Once the queue is full, AnalysisQueuePolicy is applied, see the AnalysisQueuePolicy constants, the
+	// oldest utterance being dropped by default.
+	AnalysisQueuePolicy string `toml:"analysis_queue_policy"`
+	AnalysisQueueSize   int    `toml:"analysis_queue_size"`
+
+	// AudioLevelInterval is the min duration between two audio level events of a pipeline, 0 disabling them
+	AudioLevelInterval time.Duration `toml:"audio_level_interval"`
+
+	// If BargeIn is true, speech detected and speech ended events are dispatched
+	BargeIn bool `toml:"barge_in"`
+
+	// Batch options are only used when the speech parser implements the BatchSpeechParser interface
+	// BatchSize is the max number of utterances parsed in one call and BatchMaxLatency, 200ms by default, is the max
+	// duration a batch waits for utterances once it has one.
+	BatchMaxLatency time.Duration `toml:"batch_max_latency"`
+	BatchSize       int           `toml:"batch_size"`
+
+	// If Channels is > 1, received samples are interleaved and are downmixed to mono according to DownmixMode, see the
+	// DownmixMode constants, channels being averaged by default. DownmixChannel is the channel kept with
+	// DownmixModeSelect.
+	Channels       int    `toml:"channels"`
+	DownmixChannel int    `toml:"downmix_channel"`
+	DownmixMode    string `toml:"downmix_mode"`
+
+	// Language is provided to speech parsers when no language detector has been set
+	Language string `toml:"language"`
+
+	// If ListenOnce is true, samples are ignored until a one-shot capture is armed, see ListenOnce
+	ListenOnce bool `toml:"listen_once"`
+
+	// MaxConcurrentSpeechToText is the max number of speech to text calls running at once, 0 meaning unlimited
+	MaxConcurrentSpeechToText int `toml:"max_concurrent_speech_to_text"`
+
+	// Utterances shorter than MinUtteranceDuration are discarded and utterances longer than MaxUtteranceDuration are
+	// handled according to UtteranceOverflowMode, see the UtteranceOverflowMode constants, being split by default. 0
+	// disables a bound. If LogUtteranceBounds is true, utterances altered by the bounds are logged.
+	LogUtteranceBounds    bool          `toml:"log_utterance_bounds"`
+	MaxUtteranceDuration  time.Duration `toml:"max_utterance_duration"`
+	MinUtteranceDuration  time.Duration `toml:"min_utterance_duration"`
+	UtteranceOverflowMode string        `toml:"utterance_overflow_mode"`
+
+	// SampleFormat is the format of the received samples, see the astisampleformat.SampleFormat constants
+	SampleFormat string `toml:"sample_format"`
+
+	// If StoreSamples is true and SamplesDirectory is set, utterances are stored as wav files to be validated in a
+	// sub-directory of SamplesDirectory, which is also where training data is prepared. If SamplesCompression is true,
+	// stored samples are gzipped. Once the samples exceed
+	// SamplesMaxSize bytes, if > 0, the oldest ones are removed first. Samples storing events are dispatched at most
+	// every SamplesProgressInterval, 0 disabling them, and only for utterances of at least SamplesProgressMinSize bytes.
+	SamplesCompression      bool          `toml:"samples_compression"`
+	SamplesDirectory        string        `toml:"samples_directory"`
+	SamplesMaxSize          int64         `toml:"samples_max_size"`
+	SamplesProgressInterval time.Duration `toml:"samples_progress_interval"`
+	SamplesProgressMinSize  int64         `toml:"samples_progress_min_size"`
+	StoreSamples            bool          `toml:"store_samples"`
+
+	// If SilenceMaxAudioLevel is > 0, it overrides the silence max audio level of the received samples
+	SilenceMaxAudioLevel float64 `toml:"silence_max_audio_level"`
+
+	// Sources are the named input sources, each having a pipeline of its own, see AddSource
+	Sources map[string]SourceConfiguration `toml:"sources"`
+
+	// TargetSampleRate is the sample rate the speech parser expects, 0 meaning the closest one it accepts
+	TargetSampleRate int `toml:"target_sample_rate"`
+
+	// If TranscribeFileSegmentation is true, files transcribed with TranscribeFile are split into utterances first
+	TranscribeFileSegmentation bool `toml:"transcribe_file_segmentation"`
+
+	// If TranscriptPort is true, analyses are sent to the "transcript" output port, see astibrain.Producer, whose buffer
+	// size is TranscriptPortSize, 16 by default
+	TranscriptPort     bool `toml:"transcript_port"`
+	TranscriptPortSize int  `toml:"transcript_port_size"`
+
+	// WakeWordTimeout is the duration samples are processed for once a wake word has been detected, 5s by default
+	WakeWordTimeout time.Duration `toml:"wake_word_timeout"`
+
+	// Webhook POSTs analyses to an external HTTP endpoint
+	Webhook WebhookConfiguration `toml:"webhook"`
 }
 
 // NewAbility creates a new ability
+// If p is nil, samples are still processed and stored but no analysis is dispatched, see PlaceholderSpeechParser.
 func NewAbility(p SpeechParser, sd func() SilenceDetector, c AbilityConfiguration) (a *Ability, err error) {
 	// Create
 	a = &Ability{
+		as:  make(map[string]*audioSource),
 		c:   c,
+		chr: make(chan struct{}, 1),
 		d:   astisync.NewDo(),
+		ds:  make(map[pipelineKey]*astisync.Do),
+		lps: make(map[string]SpeechParser),
 		p:   p,
+		qs:  make(map[pipelineKey][]queuedSamples),
 		sd:  sd,
-		sds: make(map[string]SilenceDetector),
+		sds: make(map[pipelineKey]SilenceDetector),
+		wh:  newWebhook(c.Webhook),
+	}
+	a.qc = sync.NewCond(&a.qm)
+	if c.TranscriptPort {
+		if c.TranscriptPortSize <= 0 {
+			c.TranscriptPortSize = 16
+		}
+		a.tc = make(chan PayloadAnalysis, c.TranscriptPortSize)
+	}
+	if c.MaxConcurrentSpeechToText > 0 {
+		a.sem = make(chan struct{}, c.MaxConcurrentSpeechToText)
+	}
+
+	// Copy sources so that they can be updated while the ability is on
+	a.c.Sources = make(map[string]SourceConfiguration)
+	for n, sc := range c.Sources {
+		a.c.Sources[n] = sc
+	}
+
+	// Dispatch circuit breaker state changes
+	if v, ok := p.(*CircuitBreakerSpeechParser); ok {
+		v.OnStateChange(a.dispatchCircuitBreakerState)
+	}
+
+	// Default configuration values
+	if a.c.AnalysisQueueSize == 0 {
+		a.c.AnalysisQueueSize = 10
+	}
+	if a.c.BatchMaxLatency == 0 {
+		a.c.BatchMaxLatency = 200 * time.Millisecond
+	}
+	if a.c.WakeWordTimeout == 0 {
+		a.c.WakeWordTimeout = 5 * time.Second
 	}
 
 	// Absolute paths
@@ -58,15 +227,126 @@ func NewAbility(p SpeechParser, sd func() SilenceDetector, c AbilityConfiguratio
 			err = errors.Wrapf(err, "astiunderstanding: filepath abs of %s failed", a.c.SamplesDirectory)
 			return
 		}
+
+		// Create samples store
+		if a.s, err = NewSamplesStore(SamplesStoreConfiguration{
+			Compression:      a.c.SamplesCompression,
+			Directory:        samplesToBeValidatedDirectory(a.c.SamplesDirectory),
+			MaxSize:          a.c.SamplesMaxSize,
+			ProgressInterval: a.c.SamplesProgressInterval,
+			ProgressMinSize:  a.c.SamplesProgressMinSize,
+		}); err != nil {
+			err = errors.Wrap(err, "astiunderstanding: creating samples store failed")
+			return
+		}
 	}
 	return
 }
 
+// OutputPorts implements the astibrain.Producer interface
+func (a *Ability) OutputPorts() map[string]interface{} {
+	if a.tc == nil {
+		return nil
+	}
+	return map[string]interface{}{outputPortTranscript: (<-chan PayloadAnalysis)(a.tc)}
+}
+
 // SetDispatchFunc implements the astibrain.Dispatcher interface
 func (a *Ability) SetDispatchFunc(fn astibrain.DispatchFunc) {
 	a.dispatchFunc = fn
 }
 
+// SetGaugeFunc implements the astibrain.Gauger interface
+func (a *Ability) SetGaugeFunc(fn astibrain.GaugeFunc) {
+	a.gaugeFunc = fn
+}
+
+// SetObserveFunc implements the astibrain.Observer interface
+func (a *Ability) SetObserveFunc(fn astibrain.ObserveFunc) {
+	a.observeFunc = fn
+}
+
+// SetWakeWordDetector sets the wake word detector.
+// Once set, speech samples are only processed if a wake word has been detected recently.
+func (a *Ability) SetWakeWordDetector(d WakeWordDetector) {
+	a.wd = d
+}
+
+// SetLanguageDetector sets the language detector used to pick the language of each utterance
+func (a *Ability) SetLanguageDetector(d LanguageDetector) {
+	a.ld = d
+}
+
+// SetLanguageSpeechParser sets the speech parser used for a specific language.
+// The default speech parser is used for languages without a specific speech parser.
+func (a *Ability) SetLanguageSpeechParser(language string, p SpeechParser) {
+	a.lps[language] = p
+}
+
+// Reconfiguration represents the configuration values that can be changed while the ability is on.
+// Nil values are left untouched.
+type Reconfiguration struct {
+	Language             *string  `json:"language,omitempty"`
+	SilenceMaxAudioLevel *float64 `json:"silence_max_audio_level,omitempty"`
+}
+
+// Reconfigure implements the astibrain.Reconfigurable interface
+// cfg can either be a Reconfiguration or its JSON representation.
+func (a *Ability) Reconfigure(cfg interface{}) (err error) {
+	// Get reconfiguration
+	var r Reconfiguration
+	switch v := cfg.(type) {
+	case Reconfiguration:
+		r = v
+	case *Reconfiguration:
+		r = *v
+	case json.RawMessage:
+		if err = json.Unmarshal(v, &r); err != nil {
+			err = errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", v, r)
+			return
+		}
+	case []byte:
+		if err = json.Unmarshal(v, &r); err != nil {
+			err = errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", v, r)
+			return
+		}
+	default:
+		err = fmt.Errorf("astiunderstanding: invalid configuration type %T", cfg)
+		return
+	}
+
+	// Validate
+	if r.SilenceMaxAudioLevel != nil && *r.SilenceMaxAudioLevel < 0 {
+		err = fmt.Errorf("astiunderstanding: silence max audio level %f is negative", *r.SilenceMaxAudioLevel)
+		return
+	}
+
+	// Apply
+	a.cm.Lock()
+	defer a.cm.Unlock()
+	if r.Language != nil {
+		a.c.Language = *r.Language
+	}
+	if r.SilenceMaxAudioLevel != nil {
+		a.c.SilenceMaxAudioLevel = *r.SilenceMaxAudioLevel
+	}
+	return
+}
+
+// defaultLanguage returns the language provided to speech parsers when no language has been detected
+func (a *Ability) defaultLanguage() string {
+	a.cm.Lock()
+	defer a.cm.Unlock()
+	return a.c.Language
+}
+
+// silenceMaxAudioLevel returns the silence max audio level overriding the one of the received samples
+func (a *Ability) silenceMaxAudioLevel() float64 {
+	a.cm.Lock()
+	defer a.cm.Unlock()
+	return a.c.SilenceMaxAudioLevel
+}
+
 // Name implements the astibrain.Ability interface
 func (a *Ability) Name() string {
 	return name
@@ -77,30 +357,184 @@ func (a *Ability) Description() string {
 	return "Executes a speech to text analysis on audio samples"
 }
 
+// Describe implements the astibrain.Describable interface
+// Languages are the languages a specific speech parser has been set for, the default language first.
+func (a *Ability) Describe() (d astibrain.AbilityDescriptor) {
+	// Create descriptor
+	d = astibrain.AbilityDescriptor{
+		Actions:     []string{websocketEventNameSamples},
+		Description: a.Description(),
+		DisplayName: name,
+	}
+	if a.c.ListenOnce {
+		d.Actions = append(d.Actions, websocketEventNameListenOnce)
+	}
+
+	// Get languages
+	dl := a.defaultLanguage()
+	var ls []string
+	for l := range a.lps {
+		if l != dl {
+			ls = append(ls, l)
+		}
+	}
+	sort.Strings(ls)
+	if len(dl) > 0 {
+		ls = append([]string{dl}, ls...)
+	}
+	d.Metadata = map[string]interface{}{"languages": ls}
+	return
+}
+
 // Run implements the astibrain.Runnable interface
 func (a *Ability) Run(ctx context.Context) (err error) {
 	// Reset
+	a.als = make(map[pipelineKey]*audioLevel)
+	a.b = nil
 	a.ch = make(chan PayloadSamples)
+	a.afs = make(map[pipelineKey][]AudioFilter)
+	a.dms = make(map[pipelineKey][]int32)
+	a.gs = make(map[pipelineKey]float64)
+	a.lss = make(map[pipelineKey]DetectorState)
+	a.sps = make(map[pipelineKey]bool)
+	a.ss = make(map[pipelineKey]*stream)
+	a.wds = make(map[pipelineKey]*wake)
+	a.cm.Lock()
+	a.rs = nil
+	a.cm.Unlock()
 	a.m.Lock()
 	for _, sd := range a.sds {
 		sd.Reset()
 	}
 	a.m.Unlock()
 
+	// Close streams
+	defer func() {
+		for n, s := range a.ss {
+			s.close(nil, false)
+			delete(a.ss, n)
+		}
+	}()
+
+	// No speech parser
+	if a.p == nil {
+		a.pw.Do(func() {
+			astilog.Warn("astiunderstanding: no speech parser has been set, samples will be processed and stored but not analyzed")
+		})
+	}
+
+	// Start webhook
+	a.wh.start(ctx)
+	defer a.wh.wait()
+
+	// Read audio sources
+	a.readAudioSources(ctx)
+	defer a.stopReadingAudioSources()
+
+	// Get batch speech parser
+	bp, isBatch := a.batchSpeechParser()
+
+	// Flush pending batch
+	if isBatch {
+		defer a.flushBatch(bp)
+	}
+
+	// Make sure the samples feed is not blocked on the analysis queue once the context is done
+	if a.c.AnalysisQueuePolicy == AnalysisQueuePolicyBlock {
+		go a.unblockQueue(ctx)
+	}
+
 	// Listen
 	for {
 		select {
 		case p := <-a.ch:
-			// Create silence detector for the brain
+			// Get source
+			sc, ok := a.source(p.Source)
+			if !ok {
+				astilog.Debugf("astiunderstanding: dropping samples from unknown source %s of brain %s", p.Source, p.BrainName)
+				continue
+			}
+			k := newPipelineKey(p.BrainName, p.Source)
+
+			// Override sample rate
+			if sc.SampleRate > 0 {
+				p.SampleRate = sc.SampleRate
+			}
+
+			// Audio source has reconnected
+			if p.reconnected {
+				a.sourceReconnected(ctx, k, p, bp, isBatch)
+				continue
+			}
+
+			// Normalize
+			p.Samples = astisampleformat.Normalize(p.Samples, a.c.SampleFormat, p.SignificantBits)
+
+			// Downmix
+			p.Samples, a.dms[k] = Downmix(p.Samples, a.c.Channels, a.c.DownmixMode, a.c.DownmixChannel, a.dms[k])
+
+			// Override silence max audio level
+			if l := a.silenceMaxAudioLevel(); l > 0 {
+				p.SilenceMaxAudioLevel = l
+			}
+			if sc.SilenceMaxAudioLevel > 0 {
+				p.SilenceMaxAudioLevel = sc.SilenceMaxAudioLevel
+			}
+
+			// Apply automatic gain control
+			p.Samples, a.gs[k] = a.applyGain(p.Samples, p.SignificantBits, a.gs[k])
+
+			// Apply audio filters
+			p.Samples = a.applyAudioFilters(k, p.Samples, p.SampleRate)
+
+			// Meter audio level
+			a.meterAudioLevel(k, p)
+
+			// Create silence detector for the pipeline
 			a.m.Lock()
-			if _, ok := a.sds[p.BrainName]; !ok {
-				a.sds[p.BrainName] = a.sd()
+			sd, ok := a.sds[k]
+			if !ok {
+				sd = a.sd()
+				a.sds[k] = sd
 			}
 			a.m.Unlock()
 
 			// Add samples to silence detector and retrieve speech samples
 			// TODO Apply human voice filter
-			speechSamples := a.sds[p.BrainName].Add(p.Samples, p.SampleRate, p.SilenceMaxAudioLevel)
+			speechSamples := nonEmptyUtterances(addSamples(ctx, sd, p))
+
+			// Context is done
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Dispatch listening state
+			a.dispatchListeningState(k, sd)
+
+			// Check whether brain is awake
+			// Samples received while no one-shot capture is armed are ignored as if the brain was asleep
+			isAwake := a.isAwake(k, p) && a.isListening()
+
+			// Detect speech
+			if a.c.BargeIn {
+				a.detectSpeech(k, sd, p, isAwake, speechSamples)
+			}
+
+			// Brain is not awake and no stream is ongoing
+			if !isAwake {
+				if _, ok := a.ss[k]; !ok {
+					continue
+				}
+			}
+
+			// Parser can stream
+			if sp, ok := a.p.(StreamingSpeechParser); ok {
+				a.streamSamples(ctx, sp, k, p, speechSamples)
+				continue
+			}
+
+			// Enforce utterance bounds
+			speechSamples = a.boundUtterances(speechSamples, p.SampleRate)
 
 			// No speech samples
 			if len(speechSamples) <= 0 {
@@ -109,8 +543,16 @@ func (a *Ability) Run(ctx context.Context) (err error) {
 
 			// Process samples
 			for _, samples := range speechSamples {
-				a.processSamples(p.BrainName, samples, p.SampleRate, p.SignificantBits)
+				if isBatch {
+					a.batchSamples(ctx, bp, k, samples, p.SampleRate, p.SignificantBits)
+				} else {
+					a.processSamples(ctx, k, samples, p.SampleRate, p.SignificantBits)
+				}
 			}
+		case <-a.b.timeout():
+			a.flushBatch(bp)
+		case <-a.chr:
+			a.removePipelines()
 		case <-ctx.Done():
 			err = errors.Wrap(err, "astiunderstanding: context error")
 			return
@@ -118,167 +560,569 @@ func (a *Ability) Run(ctx context.Context) (err error) {
 	}
 }
 
-// processSamples processes samples
-func (a *Ability) processSamples(brainName string, samples []int32, sampleRate, significantBits int) {
-	// Make sure the following is not blocking but still executed in FIFO order
-	a.d.Do(func() {
-		// Execute speech to text analysis
-		start := time.Now()
-		astilog.Debugf("astiunderstanding: starting speech to text analysis on %d samples from brain %s", len(samples), brainName)
-		text, err := a.p.SpeechToText(samples, sampleRate, significantBits)
-		if err != nil {
-			astilog.Error(errors.Wrap(err, "astiunderstanding: speech to text analysis failed"))
-			return
+// isAwake checks whether a wake word has been detected recently for the pipeline and dispatches a sleep event once it
+// goes back to sleep.
+// It always returns true if no wake word detector has been set.
+func (a *Ability) isAwake(k pipelineKey, p PayloadSamples) bool {
+	// No wake word detector
+	if a.wd == nil {
+		return true
+	}
+
+	// Detect wake word
+	// A fresh wake word resets the timeouts
+	now := time.Now()
+	if a.wd.Detect(p.Samples, p.SampleRate) {
+		a.wds[k] = &wake{at: now, lastActivityAt: now}
+		a.dispatchWakeEvent(websocketEventNameWakeWord, p.BrainName)
+	}
+
+	// Brain is asleep
+	w, ok := a.wds[k]
+	if !ok {
+		return false
+	}
+
+	// Check timeout
+	var isAwake bool
+	if a.c.ActiveIdleTimeout > 0 {
+		if astiaudio.AudioLevel(p.Samples) > p.SilenceMaxAudioLevel {
+			w.lastActivityAt = now
 		}
-		astilog.Debugf("astiunderstanding: speech to text analysis done in %s", time.Now().Sub(start))
+		isAwake = now.Sub(w.lastActivityAt) <= a.c.ActiveIdleTimeout
+	} else {
+		isAwake = now.Sub(w.at) <= a.c.WakeWordTimeout
+	}
+
+	// Go back to sleep
+	if !isAwake {
+		delete(a.wds, k)
+		a.dispatchWakeEvent(websocketEventNameSleep, p.BrainName)
+	}
+	return isAwake
+}
+
+// dispatchWakeEvent dispatches a wake word or sleep event
+func (a *Ability) dispatchWakeEvent(eventName, brainName string) {
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        eventName,
+			Payload:     brainName,
+		})
+	}
+}
+
+// detectSpeech dispatches an event whenever the user starts or stops talking
+func (a *Ability) detectSpeech(k pipelineKey, sd SilenceDetector, p PayloadSamples, isAwake bool, speechSamples [][]int32) {
+	// Get speech state
+	wasSpeaking := a.sps[k]
+	isSpeaking := isSpeechActive(sd, p, wasSpeaking, speechSamples)
+
+	// Speech can only start once the brain is awake
+	if isSpeaking == wasSpeaking || (isSpeaking && !isAwake) {
+		return
+	}
+	a.sps[k] = isSpeaking
+
+	// Get event name
+	eventName := websocketEventNameSpeechEnded
+	if isSpeaking {
+		eventName = websocketEventNameSpeechDetected
+	}
 
-		// Dispatch analysis
-		if len(text) > 0 && a.dispatchFunc != nil {
+	// Dispatch
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        eventName,
+			Payload:     p.BrainName,
+		})
+	}
+}
+
+// isSpeechActive checks whether the user is talking.
+// If the silence detector can't tell, speech starts as soon as the audio level exceeds the silence max audio level
+// and stops once the silence detector has returned speech samples.
+func isSpeechActive(sd SilenceDetector, p PayloadSamples, wasSpeaking bool, speechSamples [][]int32) bool {
+	if v, ok := sd.(ActiveSpeechDetector); ok {
+		return v.IsSpeechActive()
+	} else if len(speechSamples) > 0 {
+		return false
+	}
+	return wasSpeaking || astiaudio.AudioLevel(p.Samples) > p.SilenceMaxAudioLevel
+}
+
+// streamSamples feeds the pipeline's stream with the received samples and closes it once the silence detector has
+// returned speech samples.
+// Samples are streamed as soon as they're received since the silence detector only returns speech samples once the
+// speech is over.
+func (a *Ability) streamSamples(ctx context.Context, sp StreamingSpeechParser, k pipelineKey, p PayloadSamples, speechSamples [][]int32) {
+	// Create stream
+	s, ok := a.ss[k]
+	if !ok {
+		sctx, _ := astibrain.StartSpan(ctx, spanNameUtterance)
+		s = newStream(sctx)
+		a.ss[k] = s
+		go a.runStream(sp, s, k, p.SampleRate, p.SignificantBits)
+	}
+
+	// Feed stream
+	// It doesn't block so that a speech parser slow to consume its stream doesn't hold up Run
+	samples, _, _ := a.convert(p.Samples, p.SampleRate, p.SignificantBits)
+	s.push(samples)
+
+	// Speech is not over yet
+	if len(speechSamples) <= 0 {
+		return
+	}
+
+	// Close stream
+	s.close(speechSamples, false)
+	delete(a.ss, k)
+}
+
+// runStream executes a streaming speech to text analysis
+func (a *Ability) runStream(sp StreamingSpeechParser, s *stream, k pipelineKey, sourceSampleRate, sourceSignificantBits int) {
+	// Make sure the span is ended
+	var processed bool
+	defer func() {
+		if !processed {
+			astibrain.SpanFromContext(s.ctx).End()
+		}
+	}()
+
+	// Get format
+	sampleRate, significantBits := a.sampleRate(sourceSampleRate), a.significantBits(sourceSignificantBits)
+
+	// Execute speech to text analysis
+	start := time.Now()
+	astilog.Debugf("astiunderstanding: starting streaming speech to text analysis from brain %s", k.brainName)
+	text, err := a.speechToTextStream(sp, s.ch, k, sampleRate, significantBits)
+
+	// Make sure the stream is drained in case the parser has returned early
+	for range s.ch {
+	}
+
+	// Pipeline has been removed
+	if s.discarded {
+		return
+	}
+
+	// Process error
+	if err != nil {
+		a.processError(k, errors.Wrap(err, "astiunderstanding: streaming speech to text analysis failed"))
+		return
+	}
+	astilog.Debugf("astiunderstanding: streaming speech to text analysis done in %s", time.Now().Sub(start))
+
+	// Observe
+	if a.observeFunc != nil {
+		a.observeFunc("speech_to_text_stream", time.Now().Sub(start))
+	}
+
+	// Merge speech samples
+	var samples []int32
+	for _, ss := range s.samples {
+		cs, _, _ := a.convert(ss, sourceSampleRate, sourceSignificantBits)
+		samples = append(samples, cs...)
+	}
+
+	// Get duration
+	// Only the time spent once the speech is over is taken into account since the stream lasts as long as the speech
+	d := time.Now().Sub(start)
+	if !s.closedAt.IsZero() {
+		d = time.Now().Sub(s.closedAt)
+	}
+
+	// Make sure the following is still executed in FIFO order
+	processed = true
+	a.doer(k).Do(func() {
+		defer astibrain.SpanFromContext(s.ctx).End()
+		a.processResult(s.ctx, k, SpeechResult{Language: a.defaultLanguage(), Text: text}, "", d, samples, sampleRate, significantBits)
+	})
+}
+
+// speechToTextStream executes the streaming speech to text analysis and dispatches partial texts
+func (a *Ability) speechToTextStream(sp StreamingSpeechParser, ch <-chan []int32, k pipelineKey, sampleRate, significantBits int) (text string, err error) {
+	defer recoverSpeechParser(&err)
+	return sp.SpeechToTextStream(ch, sampleRate, significantBits, func(partial string) {
+		if len(partial) > 0 && a.dispatchFunc != nil {
 			a.dispatchFunc(astibrain.Event{
 				AbilityName: name,
-				Name:        websocketEventNameAnalysis,
+				Name:        websocketEventNameAnalysisPartial,
 				Payload: PayloadAnalysis{
-					BrainName: brainName,
-					Text:      text,
+					BrainName: k.brainName,
+					Source:    k.source,
+					Text:      partial,
 				},
 			})
 		}
+	})
+}
 
-		// Check if samples have to be stored
-		if a.c.StoreSamples && len(a.c.SamplesDirectory) > 0 {
-			// Store samples
-			id, err := a.storeSamples(text, samples, sampleRate, significantBits)
-			if err != nil {
-				astilog.Error(errors.Wrap(err, "astiunderstanding: storing samples failed"))
-			} else if a.dispatchFunc != nil {
-				a.dispatchFunc(astibrain.Event{
-					AbilityName: name,
-					Name:        websocketEventNameSamplesStored,
-					Payload:     newPayloadStoredSamples(id, text),
-				})
-			}
+// processSamples processes samples
+func (a *Ability) processSamples(ctx context.Context, k pipelineKey, samples []int32, sampleRate, significantBits int) {
+	// Start span
+	// It's ended once the utterance has been processed or dropped
+	sctx, _ := astibrain.StartSpan(ctx, spanNameUtterance)
+
+	// Enqueue
+	if !a.enqueueSamples(ctx, k, queuedSamples{
+		ctx:             sctx,
+		sampleRate:      sampleRate,
+		samples:         samples,
+		significantBits: significantBits,
+	}) {
+		return
+	}
+
+	// Make sure the following is not blocking but still executed in FIFO order
+	a.doer(k).Do(func() {
+		// Dequeue
+		s, ok := a.dequeueSamples(k)
+		if !ok {
+			return
 		}
+		defer astibrain.SpanFromContext(s.ctx).End()
+		samples, sampleRate, significantBits := s.samples, s.sampleRate, s.significantBits
+
+		// Convert
+		samples, sampleRate, significantBits = a.convert(samples, sampleRate, significantBits)
+
+		// Execute speech to text analysis
+		start := time.Now()
+		astilog.Debugf("astiunderstanding: starting speech to text analysis on %d samples from brain %s", len(samples), k.brainName)
+		r, backend, err := a.speechToText(s.ctx, samples, sampleRate, significantBits)
+		if err != nil && s.ctx.Err() != nil {
+			astilog.Debugf("astiunderstanding: speech to text analysis from brain %s has been aborted since the ability has been stopped", k.brainName)
+			a.listenedOnce(listenOnceResult{err: err})
+			return
+		} else if err != nil {
+			a.processError(k, errors.Wrap(err, "astiunderstanding: speech to text analysis failed"))
+			return
+		}
+		d := time.Now().Sub(start)
+		astilog.Debugf("astiunderstanding: speech to text analysis done in %s", d)
+
+		// Observe
+		if a.observeFunc != nil {
+			a.observeFunc("speech_to_text", d)
+		}
+
+		// Process result
+		a.processResult(s.ctx, k, r, backend, d, samples, sampleRate, significantBits)
 	})
 }
 
-// PayloadAnalysis represents an analysis payload
-type PayloadAnalysis struct {
-	BrainName string `json:"brain_name"`
-	Text      string `json:"text"`
+// speechToText executes the speech to text analysis and returns the backend that produced the result if the parser
+// provides it.
+// A panicking speech parser is considered as failed.
+// It holds a speech to text slot until the speech parser has returned, even if the context is done before that.
+func (a *Ability) speechToText(ctx context.Context, samples []int32, sampleRate, significantBits int) (r SpeechResult, backend string, err error) {
+	// Acquire speech to text slot
+	// It's released by the goroutine executing the speech parser if there's one
+	release, async := a.acquireSpeechToText(), false
+	defer func() {
+		if !async {
+			release()
+		}
+	}()
+
+	// Recover
+	defer recoverSpeechParser(&err)
+
+	// Get language and parser
+	language := a.language(samples, sampleRate)
+	p := a.p
+	if v, ok := a.lps[language]; ok {
+		p = v
+	}
+
+	// No speech parser
+	// The result is empty so that no analysis is dispatched but samples are still stored
+	if p == nil {
+		r.Language = language
+		return
+	}
+
+	// Context is done
+	// Utterances still queued once the ability is stopped are not parsed
+	if ctx.Err() != nil {
+		err = errors.Wrap(ctx.Err(), "astiunderstanding: context error")
+		return
+	}
+
+	// Execute speech to text analysis
+	if isContextAware(p, language) {
+		r, backend, err = parseSpeech(ctx, p, samples, sampleRate, significantBits, language)
+	} else {
+		async = true
+		r, backend, err = speechToTextUntilDone(ctx, p, samples, sampleRate, significantBits, language, release)
+	}
+	if err != nil {
+		return
+	}
+
+	// Add language
+	if len(r.Language) == 0 {
+		r.Language = language
+	}
+	return
 }
 
-// PayloadStoredSamples represents stored samples payload
-type PayloadStoredSamples struct {
-	ID            string `json:"id"`
-	Text          string `json:"text"`
-	WavStaticPath string `json:"wav_static_path"`
+// speechToTextResult represents a speech to text result executed in a goroutine
+type speechToTextResult struct {
+	backend string
+	err     error
+	r       SpeechResult
 }
 
-// newPayloadStoredSamples creates a new stored samples payload
-func newPayloadStoredSamples(id, text string) PayloadStoredSamples {
-	return PayloadStoredSamples{
-		ID:            id,
-		Text:          text,
-		WavStaticPath: fmt.Sprintf("/samples%s.wav", id),
+// speechToTextUntilDone executes the speech to text analysis of a speech parser not honouring the context in a goroutine
+// and returns as soon as either the analysis is done or the context is done.
+// In the latter case, the goroutine lingers until the speech parser returns and its result is discarded.
+// release is executed by the goroutine once the speech parser has returned.
+func speechToTextUntilDone(ctx context.Context, p SpeechParser, samples []int32, sampleRate, significantBits int, language string, release func()) (r SpeechResult, backend string, err error) {
+	// Execute speech to text analysis
+	// Channel is buffered so that the goroutine doesn't block once the context is done
+	ch := make(chan speechToTextResult, 1)
+	go func() {
+		var res speechToTextResult
+		defer func() { ch <- res }()
+		defer release()
+		defer recoverSpeechParser(&res.err)
+		res.r, res.backend, res.err = parseSpeech(ctx, p, samples, sampleRate, significantBits, language)
+	}()
+
+	// Wait
+	select {
+	case res := <-ch:
+		r, backend, err = res.r, res.backend, res.err
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "astiunderstanding: context error")
 	}
+	return
 }
 
-// samplesToBeValidatedDirectory returns the directory containing samples to be validated
-func samplesToBeValidatedDirectory(samplesDirectory string) string {
-	return filepath.Join(samplesDirectory, "to_be_validated")
+// addSamples adds samples to the silence detector with the context if it accepts one
+func addSamples(ctx context.Context, sd SilenceDetector, p PayloadSamples) [][]int32 {
+	if v, ok := sd.(ContextSilenceDetector); ok {
+		return v.AddWithContext(ctx, p.Samples, p.SampleRate, p.SilenceMaxAudioLevel)
+	}
+	return sd.Add(p.Samples, p.SampleRate, p.SilenceMaxAudioLevel)
 }
 
-// samplesValidatedDirectory returns the directory containing validated samples
-func samplesValidatedDirectory(samplesDirectory string) string {
-	return filepath.Join(samplesDirectory, "validated")
+// language returns the language of the samples
+func (a *Ability) language(samples []int32, sampleRate int) string {
+	// No language detector
+	if a.ld == nil {
+		return a.defaultLanguage()
+	}
+
+	// Detect language
+	l, err := a.ld.DetectLanguage(samples, sampleRate)
+	if err != nil {
+		astilog.Error(errors.Wrap(err, "astiunderstanding: detecting language failed"))
+		return a.defaultLanguage()
+	}
+	return l
 }
 
-// storeSamples stores the samples for later validation
-func (a *Ability) storeSamples(text string, samples []int32, sampleRate, significantBits int) (id string, err error) {
-	// Create id
-	id = filepath.Join(time.Now().Format("2006-01-02"), xid.New().String())
+// processError logs and dispatches a speech to text analysis error
+func (a *Ability) processError(k pipelineKey, err error) {
+	// Log
+	astilog.Error(err)
 
-	// Store samples wav
-	if err = a.storeSamplesWav(id, samples, sampleRate, significantBits); err != nil {
-		err = errors.Wrap(err, "astiunderstanding: storing samples wav failed")
-		return
+	// Create payload
+	p := PayloadAnalysisError{
+		BrainName: k.brainName,
+		Error:     err.Error(),
+		Source:    k.source,
+	}
+	if errors.Cause(err) == ErrCircuitOpen {
+		p.Reason = analysisErrorReasonCircuitOpen
 	}
 
-	// Store samples txt
-	if err = a.storeSamplesTxt(id, text); err != nil {
-		err = errors.Wrap(err, "astiunderstanding: storing samples txt failed")
-		return
+	// Listened once
+	a.listenedOnce(listenOnceResult{err: err})
+
+	// Dispatch
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameAnalysisError,
+			Payload:     p,
+		})
 	}
-	return
 }
 
-// storeSamplesWav stores the samples as a wav file
-func (a *Ability) storeSamplesWav(id string, samples []int32, sampleRate, significantBits int) (err error) {
-	// Create wav path
-	wavPath := filepath.Join(samplesToBeValidatedDirectory(a.c.SamplesDirectory), id+".wav")
+// dispatchCircuitBreakerState dispatches the state of the circuit breaker whenever it changes
+func (a *Ability) dispatchCircuitBreakerState(state string) {
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameCircuitBreaker,
+			Payload:     PayloadCircuitBreaker{State: state},
+		})
+	}
+}
 
-	// Create dir
-	if err = os.MkdirAll(filepath.Dir(wavPath), 0755); err != nil {
-		err = errors.Wrapf(err, "astiunderstanding: mkdirall %s failed", filepath.Dir(wavPath))
-		return
+// processResult dispatches the analysis and stores the samples if needed.
+// d is the duration of the speech to text analysis.
+// ctx carries the span of the utterance, if any.
+func (a *Ability) processResult(ctx context.Context, k pipelineKey, r SpeechResult, backend string, d time.Duration, samples []int32, sampleRate, significantBits int) {
+	// Create payload
+	text := r.Text
+	p := PayloadAnalysis{
+		Alternatives: r.Alternatives,
+		Backend:      backend,
+		BrainName:    k.brainName,
+		Confidence:   r.Confidence,
+		DurationMs:   int64(d / time.Millisecond),
+		Language:     r.Language,
+		SampleCount:  len(samples),
+		Source:       k.source,
+		Text:         text,
+		TraceID:      astibrain.TraceIDFromContext(ctx),
 	}
 
-	// Create wav file
-	var f *os.File
-	if f, err = os.Create(wavPath); err != nil {
-		err = errors.Wrapf(err, "astiunderstanding: creating %s failed", wavPath)
-		return
+	// Dispatch analysis
+	if len(text) > 0 && a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameAnalysis,
+			Payload:     p,
+		})
 	}
-	defer f.Close()
 
-	// Create wav writer
-	wf := wav.File{
-		Channels:        1,
-		SampleRate:      uint32(sampleRate),
-		SignificantBits: uint16(significantBits),
+	// Send analysis to webhook
+	if len(text) > 0 {
+		a.wh.send(p)
 	}
-	var r *wav.Writer
-	if r, err = wf.NewWriter(f); err != nil {
-		err = errors.Wrap(err, "astiunderstanding: creating wav writer failed")
-		return
+
+	// Send analysis to transcript port
+	if len(text) > 0 && a.tc != nil {
+		select {
+		case a.tc <- p:
+		default:
+			astilog.Errorf("astiunderstanding: transcript port is full, analysis of %s has been dropped", k.source)
+		}
 	}
-	defer r.Close()
 
-	// Write wav samples
-	for _, sample := range samples {
-		if err = r.WriteInt32(sample); err != nil {
-			err = errors.Wrap(err, "astiunderstanding: writing wav sample failed")
-			return
+	// Listened once
+	a.listenedOnce(listenOnceResult{p: p})
+
+	// Route intent
+	if len(text) > 0 {
+		a.routeIntent(ctx, k, text)
+	}
+
+	// Check if samples have to be stored
+	if a.c.StoreSamples && a.s != nil {
+		// Store samples
+		ss, err := a.s.StoreWithProgress(text, samples, sampleRate, significantBits, a.dispatchSamplesStoring)
+		if err != nil {
+			astilog.Error(errors.Wrap(err, "astiunderstanding: storing samples failed"))
+		} else if a.dispatchFunc != nil {
+			a.dispatchFunc(astibrain.Event{
+				AbilityName: name,
+				Name:        websocketEventNameSamplesStored,
+				Payload:     newPayloadStoredSamples(ss.ID, ss.Text),
+			})
 		}
 	}
-	return
 }
 
-// storeSamplesTxt stores the samples information in a txt file
-func (a *Ability) storeSamplesTxt(id, text string) (err error) {
-	// Create txt path
-	txtPath := filepath.Join(samplesToBeValidatedDirectory(a.c.SamplesDirectory), id+".txt")
-
-	// Create txt file
-	var f *os.File
-	if f, err = os.Create(txtPath); err != nil {
-		err = errors.Wrapf(err, "astiunderstanding: creating %s failed", txtPath)
-		return
+// dispatchSamplesStoring dispatches the progress of samples being stored
+func (a *Ability) dispatchSamplesStoring(id string, written, total int64) {
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameSamplesStoring,
+			Payload: PayloadSamplesStoring{
+				ID:           id,
+				TotalBytes:   total,
+				WrittenBytes: written,
+			},
+		})
 	}
-	defer f.Close()
+}
 
-	// Write data
-	if _, err = f.Write([]byte(text)); err != nil {
-		err = errors.Wrap(err, "astiunderstanding: writing text failed")
-		return
+// PayloadAnalysis represents an analysis payload
+// DurationMs is the duration in milliseconds of the speech to text analysis and SampleCount is the number of samples
+// provided to the speech parser. For batches, DurationMs is the duration of the whole batch. For streams, it's the
+// duration between the end of the speech and the final text.
+// Source is the name of the input source the samples have been received from, if any.
+type PayloadAnalysis struct {
+	Alternatives []SpeechAlternative `json:"alternatives,omitempty"`
+	Backend      string              `json:"backend,omitempty"`
+	BrainName    string              `json:"brain_name"`
+	Confidence   float64             `json:"confidence,omitempty"`
+	DurationMs   int64               `json:"duration_ms,omitempty"`
+	Language     string              `json:"language,omitempty"`
+	SampleCount  int                 `json:"sample_count,omitempty"`
+	Source       string              `json:"source,omitempty"`
+	Text         string              `json:"text"`
+	TraceID      string              `json:"trace_id,omitempty"`
+}
+
+// Analysis error reasons
+const (
+	analysisErrorReasonCircuitOpen = "circuit open"
+)
+
+// PayloadAnalysisError represents an analysis error payload
+type PayloadAnalysisError struct {
+	BrainName string `json:"brain_name"`
+	Error     string `json:"error"`
+	Reason    string `json:"reason,omitempty"`
+	Source    string `json:"source,omitempty"`
+}
+
+// PayloadCircuitBreaker represents a circuit breaker payload
+type PayloadCircuitBreaker struct {
+	State string `json:"state"`
+}
+
+// PayloadSamplesStoring represents samples storing payload
+// ID is the ID of the samples once they have been stored.
+type PayloadSamplesStoring struct {
+	ID           string `json:"id"`
+	TotalBytes   int64  `json:"total_bytes"`
+	WrittenBytes int64  `json:"written_bytes"`
+}
+
+// PayloadStoredSamples represents stored samples payload
+type PayloadStoredSamples struct {
+	ID            string `json:"id"`
+	Text          string `json:"text"`
+	WavStaticPath string `json:"wav_static_path"`
+}
+
+// newPayloadStoredSamples creates a new stored samples payload
+func newPayloadStoredSamples(id, text string) PayloadStoredSamples {
+	return PayloadStoredSamples{
+		ID:            id,
+		Text:          text,
+		WavStaticPath: fmt.Sprintf("/samples/%s.wav", id),
 	}
-	return
+}
+
+// samplesToBeValidatedDirectory returns the directory containing samples to be validated
+func samplesToBeValidatedDirectory(samplesDirectory string) string {
+	return filepath.Join(samplesDirectory, "to_be_validated")
+}
+
+// samplesValidatedDirectory returns the directory containing validated samples
+func samplesValidatedDirectory(samplesDirectory string) string {
+	return filepath.Join(samplesDirectory, "validated")
 }
 
 // WebsocketListeners implements the astibrain.WebsocketListener interface
 func (a *Ability) WebsocketListeners() map[string]astiws.ListenerFunc {
 	return map[string]astiws.ListenerFunc{
-		websocketEventNameSamples: a.websocketListenerSamples,
+		websocketEventNameListenOnce: a.websocketListenerListenOnce,
+		websocketEventNameSamples:    a.websocketListenerSamples,
 	}
 }
 
@@ -291,6 +1135,15 @@ func (a *Ability) websocketListenerSamples(c *astiws.Client, eventName string, p
 		return nil
 	}
 
+	// Decode samples
+	if p.EncodedSamples != nil {
+		var err error
+		if p.Samples, err = p.EncodedSamples.Decode(); err != nil {
+			astilog.Error(errors.Wrap(err, "astiunderstanding: decoding samples failed"))
+			return nil
+		}
+	}
+
 	// Dispatch
 	a.ch <- p
 	return nil
@@ -0,0 +1,395 @@
+package astiunderstanding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAudioSource represents an audio source whose samples are provided by the test
+type testAudioSource struct {
+	ch chan []int32
+}
+
+func newTestAudioSource() *testAudioSource {
+	return &testAudioSource{ch: make(chan []int32)}
+}
+
+func (s *testAudioSource) Close() error { return nil }
+
+func (s *testAudioSource) Read(ctx context.Context) (samples []int32, sampleRate, significantBits int, err error) {
+	select {
+	case samples = <-s.ch:
+		return samples, 16000, 16, nil
+	case <-ctx.Done():
+		return nil, 0, 0, ctx.Err()
+	}
+}
+
+// testSilenceDetector represents a silence detector returning the utterances provided by the test
+type testSilenceDetector struct {
+	fn func(samples []int32) [][]int32
+}
+
+func (d *testSilenceDetector) Add(samples []int32, sampleRate int, silenceMaxAudioLevel float64) [][]int32 {
+	return d.fn(samples)
+}
+
+func (d *testSilenceDetector) Reset() {}
+
+// testSpeechParser represents a speech parser recording the samples it's been provided
+type testSpeechParser struct {
+	fn func(samples []int32) (string, error)
+	m  sync.Mutex // Locks ss
+	ss [][]int32
+}
+
+func (p *testSpeechParser) SpeechToText(samples []int32, sampleRate, significantBits int) (string, error) {
+	p.m.Lock()
+	p.ss = append(p.ss, samples)
+	p.m.Unlock()
+	return p.fn(samples)
+}
+
+func (p *testSpeechParser) samples() [][]int32 {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return append([][]int32{}, p.ss...)
+}
+
+// testDispatcher represents a dispatch func recording events whose name is in names
+type testDispatcher struct {
+	ch    chan astibrain.Event
+	names map[string]bool
+}
+
+func newTestDispatcher(names ...string) *testDispatcher {
+	d := &testDispatcher{ch: make(chan astibrain.Event, 10), names: make(map[string]bool)}
+	for _, n := range names {
+		d.names[n] = true
+	}
+	return d
+}
+
+func (d *testDispatcher) dispatch(e astibrain.Event) {
+	if d.names[e.Name] {
+		d.ch <- e
+	}
+}
+
+func (d *testDispatcher) next(t *testing.T) astibrain.Event {
+	select {
+	case e := <-d.ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event has been dispatched")
+		return astibrain.Event{}
+	}
+}
+
+// runAbilityForTest runs an ability reading samples from a test audio source and returns the func stopping it
+// Run is expected to be still running when the ability is stopped.
+func runAbilityForTest(t *testing.T, a *Ability) (s *testAudioSource, stop func()) {
+	s = newTestAudioSource()
+	a.AddAudioSource("test", s, SourceConfiguration{})
+	ctx, cancel := context.WithCancel(context.Background())
+	chanDone := make(chan error, 1)
+	go func() { chanDone <- a.Run(ctx) }()
+	stop = func() {
+		select {
+		case <-chanDone:
+			t.Fatal("ability has stopped running")
+		default:
+		}
+		cancel()
+		<-chanDone
+	}
+	return
+}
+
+func TestAbilityRecoversFromParserPanic(t *testing.T) {
+	// Parser panics on its first analysis only
+	var n int
+	p := &testSpeechParser{fn: func(samples []int32) (string, error) {
+		if n++; n == 1 {
+			panic("test")
+		}
+		return "test", nil
+	}}
+	a, err := NewAbility(p, func() SilenceDetector {
+		return &testSilenceDetector{fn: func(samples []int32) [][]int32 { return [][]int32{samples} }}
+	}, AbilityConfiguration{})
+	assert.NoError(t, err)
+	d := newTestDispatcher(websocketEventNameAnalysis, websocketEventNameAnalysisError)
+	a.SetDispatchFunc(d.dispatch)
+	s, stop := runAbilityForTest(t, a)
+	defer stop()
+
+	// Panic is dispatched as an analysis error
+	s.ch <- []int32{1, 2}
+	e := d.next(t)
+	assert.Equal(t, websocketEventNameAnalysisError, e.Name)
+	assert.Contains(t, e.Payload.(PayloadAnalysisError).Error, "speech parser panicked: test")
+	assert.Equal(t, "test", e.Payload.(PayloadAnalysisError).Source)
+
+	// Ability is still on and keeps analyzing samples
+	s.ch <- []int32{3, 4}
+	e = d.next(t)
+	assert.Equal(t, websocketEventNameAnalysis, e.Name)
+	assert.Equal(t, [][]int32{{1, 2}, {3, 4}}, p.samples())
+}
+
+func TestAbilitySkipsEmptyUtterances(t *testing.T) {
+	// Silence detector returns nil and empty utterances along with a valid one for each sample
+	p := &testSpeechParser{fn: func(samples []int32) (string, error) { return "test", nil }}
+	a, err := NewAbility(p, func() SilenceDetector {
+		return &testSilenceDetector{fn: func(samples []int32) [][]int32 {
+			if len(samples) == 0 {
+				return [][]int32{nil, {}}
+			}
+			return [][]int32{nil, samples, {}, samples[:1]}
+		}}
+	}, AbilityConfiguration{})
+	assert.NoError(t, err)
+	d := newTestDispatcher(websocketEventNameAnalysis, websocketEventNameAnalysisError)
+	a.SetDispatchFunc(d.dispatch)
+	s, stop := runAbilityForTest(t, a)
+	defer stop()
+
+	// Only empty utterances
+	s.ch <- []int32{}
+
+	// Only non empty utterances are provided to the parser
+	s.ch <- []int32{1, 2}
+	for idx := 0; idx < 2; idx++ {
+		assert.Equal(t, websocketEventNameAnalysis, d.next(t).Name)
+	}
+	assert.Equal(t, [][]int32{{1, 2}, {1}}, p.samples())
+}
+
+// listenOnceForTest arms a one-shot capture in a goroutine and returns once it's armed
+func listenOnceForTest(t *testing.T, a *Ability) <-chan listenOnceResult {
+	ch := make(chan listenOnceResult, 1)
+	go func() {
+		p, err := a.ListenOnce(context.Background())
+		ch <- listenOnceResult{err: err, p: p}
+	}()
+	for deadline := time.Now().Add(time.Second); !a.isListening() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if !a.isListening() {
+		t.Fatal("one-shot capture has not been armed")
+	}
+	return ch
+}
+
+// nextListenOnceResult returns the result of a one-shot capture
+func nextListenOnceResult(t *testing.T, ch <-chan listenOnceResult) listenOnceResult {
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("one-shot capture has not been resolved")
+		return listenOnceResult{}
+	}
+}
+
+func TestListenOnceDisabled(t *testing.T) {
+	a, err := NewAbility(nil, nil, AbilityConfiguration{})
+	assert.NoError(t, err)
+
+	// Direct call fails right away
+	_, err = a.ListenOnce(context.Background())
+	assert.Equal(t, ErrListenOnceDisabled, err)
+	assert.True(t, a.isListening())
+
+	// HTTP call fails right away
+	rec := httptest.NewRecorder()
+	a.httpHandlerListenOnce(rec, httptest.NewRequest(http.MethodPost, "/listen-once", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestListenOnce(t *testing.T) {
+	// Parser transcribes utterances starting with 0 into an empty text and fails on utterances starting with -1
+	p := &testSpeechParser{fn: func(samples []int32) (string, error) {
+		switch samples[0] {
+		case -1:
+			return "", errors.New("test")
+		case 0:
+			return "", nil
+		}
+		return "test", nil
+	}}
+	a, err := NewAbility(p, func() SilenceDetector {
+		return &testSilenceDetector{fn: func(samples []int32) [][]int32 { return [][]int32{samples} }}
+	}, AbilityConfiguration{ListenOnce: true})
+	assert.NoError(t, err)
+	s, stop := runAbilityForTest(t, a)
+	defer stop()
+
+	// Samples are ignored until a one-shot capture is armed
+	assert.False(t, a.isListening())
+
+	// Transcript is returned and the capture is disarmed
+	ch := listenOnceForTest(t, a)
+	s.ch <- []int32{1}
+	r := nextListenOnceResult(t, ch)
+	assert.NoError(t, r.err)
+	assert.Equal(t, "test", r.p.Text)
+	assert.False(t, a.isListening())
+
+	// Empty transcripts resolve the capture as well
+	ch = listenOnceForTest(t, a)
+	s.ch <- []int32{0}
+	r = nextListenOnceResult(t, ch)
+	assert.NoError(t, r.err)
+	assert.Equal(t, "", r.p.Text)
+	assert.False(t, a.isListening())
+
+	// Failed analyses resolve the capture with their error
+	ch = listenOnceForTest(t, a)
+	s.ch <- []int32{-1}
+	r = nextListenOnceResult(t, ch)
+	assert.Error(t, r.err)
+	assert.False(t, a.isListening())
+	assert.Equal(t, [][]int32{{1}, {0}, {-1}}, p.samples())
+}
+
+func TestListenOnceDroppedUtterance(t *testing.T) {
+	a, err := NewAbility(nil, nil, AbilityConfiguration{
+		AnalysisQueuePolicy: AnalysisQueuePolicyDropOldest,
+		AnalysisQueueSize:   1,
+		ListenOnce:          true,
+	})
+	assert.NoError(t, err)
+	ch := listenOnceForTest(t, a)
+
+	// Utterance dropped by the analysis queue resolves the capture
+	k := newPipelineKey("", "test")
+	a.qs[k] = []queuedSamples{{ctx: context.Background(), samples: []int32{1}}}
+	assert.False(t, a.enqueueSamples(context.Background(), k, queuedSamples{ctx: context.Background(), samples: []int32{2}}))
+	assert.Equal(t, ErrUtteranceDropped, nextListenOnceResult(t, ch).err)
+	assert.False(t, a.isListening())
+}
+
+func TestSpeechToTextSlotIsHeldUntilParserReturns(t *testing.T) {
+	// Parser blocks until the test unblocks it
+	chUnblock := make(chan struct{})
+	p := &testSpeechParser{fn: func(samples []int32) (string, error) {
+		<-chUnblock
+		return "test", nil
+	}}
+	a, err := NewAbility(p, nil, AbilityConfiguration{MaxConcurrentSpeechToText: 1})
+	assert.NoError(t, err)
+
+	// Context is done while the parser is still running
+	ctx, cancel := context.WithCancel(context.Background())
+	chDone := make(chan error, 1)
+	go func() {
+		_, _, err := a.speechToText(ctx, []int32{1}, 16000, 16)
+		chDone <- err
+	}()
+	for deadline := time.Now().Add(time.Second); len(p.samples()) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.Error(t, <-chDone)
+
+	// Slot is released only once the parser has returned
+	assert.Equal(t, 1, a.InFlightSpeechToText())
+	assert.Len(t, a.sem, 1)
+	close(chUnblock)
+	for deadline := time.Now().Add(time.Second); a.InFlightSpeechToText() > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, a.InFlightSpeechToText())
+	assert.Len(t, a.sem, 0)
+}
+
+// testContextKey represents the key of the value carried by test contexts
+type testContextKey struct{}
+
+// testContextSpeechParser represents a detailed and language speech parser taking a context, recording what it's
+// been provided
+type testContextSpeechParser struct {
+	err       error
+	language  string
+	value     interface{}
+	withValue bool
+}
+
+func (p *testContextSpeechParser) SpeechToText(samples []int32, sampleRate, significantBits int) (string, error) {
+	return "", errors.New("context variant has not been used")
+}
+
+func (p *testContextSpeechParser) SpeechToTextDetailed(samples []int32, sampleRate, significantBits int) (SpeechResult, error) {
+	return SpeechResult{}, errors.New("context variant has not been used")
+}
+
+func (p *testContextSpeechParser) SpeechToTextDetailedWithContext(ctx context.Context, samples []int32, sampleRate, significantBits int) (SpeechResult, error) {
+	p.value, p.withValue = ctx.Value(testContextKey{}), true
+	return SpeechResult{Confidence: 0.5, Text: "detailed"}, p.err
+}
+
+func (p *testContextSpeechParser) SpeechToTextWithLanguage(samples []int32, sampleRate, significantBits int, language string) (string, error) {
+	return "", errors.New("context variant has not been used")
+}
+
+func (p *testContextSpeechParser) SpeechToTextWithLanguageContext(ctx context.Context, samples []int32, sampleRate, significantBits int, language string) (string, error) {
+	p.language, p.value, p.withValue = language, ctx.Value(testContextKey{}), true
+	return "language", p.err
+}
+
+func TestSpeechToTextForwardsContext(t *testing.T) {
+	// Primary fails so that the secondary is used
+	primary := &testContextSpeechParser{err: errors.New("test")}
+	secondary := &testContextSpeechParser{}
+	p := NewCircuitBreakerSpeechParser(NewFallbackSpeechParser(primary, secondary, 0), CircuitBreakerConfiguration{})
+	a, err := NewAbility(p, nil, AbilityConfiguration{})
+	assert.NoError(t, err)
+	assert.True(t, isContextAware(p, ""))
+	assert.True(t, isContextAware(p, "fr"))
+	ctx := context.WithValue(context.Background(), testContextKey{}, "test")
+
+	// Detailed result and backend are returned through the wrappers
+	r, backend, err := a.speechToText(ctx, []int32{1}, 16000, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, SpeechResult{Confidence: 0.5, Text: "detailed"}, r)
+	assert.Equal(t, SpeechParserBackendSecondary, backend)
+	assert.Equal(t, "test", primary.value)
+	assert.Equal(t, "test", secondary.value)
+
+	// Language is provided along with the context
+	a.c.Language = "fr"
+	r, backend, err = a.speechToText(ctx, []int32{1}, 16000, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, SpeechResult{Language: "fr", Text: "language"}, r)
+	assert.Equal(t, SpeechParserBackendSecondary, backend)
+	assert.Equal(t, "fr", secondary.language)
+	assert.Equal(t, "test", secondary.value)
+	assert.Len(t, a.sem, 0)
+}
+
+func TestSpeechToTextWithoutContextIsNotContextAware(t *testing.T) {
+	// Secondary doesn't take a context
+	primary := &testContextSpeechParser{err: errors.New("test")}
+	secondary := &testSpeechParser{fn: func(samples []int32) (string, error) { return "test", nil }}
+	p := NewCircuitBreakerSpeechParser(NewFallbackSpeechParser(primary, secondary, 0), CircuitBreakerConfiguration{})
+	assert.False(t, isContextAware(p, ""))
+	a, err := NewAbility(p, nil, AbilityConfiguration{})
+	assert.NoError(t, err)
+
+	// Backend is still returned when the analysis runs in a goroutine
+	r, backend, err := a.speechToText(context.Background(), []int32{1}, 16000, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", r.Text)
+	assert.Equal(t, SpeechParserBackendSecondary, backend)
+	assert.True(t, primary.withValue)
+}
@@ -0,0 +1,320 @@
+package astiunderstanding
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/cryptix/wav"
+	"github.com/pkg/errors"
+)
+
+// AudioSource represents an object capable of providing audio samples to the ability without going through Bob,
+// such as a file, a network stream or a test fixture.
+// Read must block until samples are available and return io.EOF once there are no samples left. Audio sources
+// reconnecting to a network stream should return ErrAudioSourceReconnected once they have reconnected so that the
+// utterance in progress is not merged with the audio received after the reconnection.
+type AudioSource interface {
+	Close() error
+	Read(ctx context.Context) (samples []int32, sampleRate, significantBits int, err error)
+}
+
+// RewindableAudioSource represents an audio source capable of providing its samples from the start again
+// Audio sources are rewound each time the ability is switched on so that a file, for instance, is read again instead
+// of returning io.EOF right away.
+type RewindableAudioSource interface {
+	AudioSource
+	Rewind() error
+}
+
+// audioSource represents an audio source read by the ability
+type audioSource struct {
+	cancel context.CancelFunc // Set while the audio source is read
+	s      AudioSource
+}
+
+// AddAudioSource adds a named input source whose samples are read from an audio source while the ability is on.
+// Samples read from an audio source have no brain name since they're captured by the brain running the ability, and
+// its silence max audio level should be set in c since the audio source doesn't provide one.
+// The audio source is closed once the source is removed, see RemoveSource.
+func (a *Ability) AddAudioSource(source string, s AudioSource, c SourceConfiguration) {
+	// Add source
+	a.AddSource(source, c)
+
+	// Lock
+	a.am.Lock()
+	defer a.am.Unlock()
+
+	// Replace previous audio source
+	if v, ok := a.as[source]; ok {
+		a.closeAudioSource(source, v)
+	}
+
+	// Add audio source
+	as := &audioSource{s: s}
+	a.as[source] = as
+
+	// Ability is running
+	if a.actx != nil {
+		a.readAudioSource(a.actx, source, as)
+	}
+}
+
+// removeAudioSource stops reading an audio source and closes it
+func (a *Ability) removeAudioSource(source string) {
+	a.am.Lock()
+	defer a.am.Unlock()
+	if v, ok := a.as[source]; ok {
+		a.closeAudioSource(source, v)
+		delete(a.as, source)
+	}
+}
+
+// closeAudioSource stops reading an audio source and closes it
+// It must be called while holding am.
+func (a *Ability) closeAudioSource(source string, as *audioSource) {
+	if as.cancel != nil {
+		as.cancel()
+		as.cancel = nil
+	}
+	if err := as.s.Close(); err != nil {
+		astilog.Error(errors.Wrapf(err, "astiunderstanding: closing audio source %s failed", source))
+	}
+}
+
+// readAudioSources starts reading audio sources until ctx is done
+// It must only be called in Run.
+func (a *Ability) readAudioSources(ctx context.Context) {
+	a.am.Lock()
+	defer a.am.Unlock()
+	a.actx = ctx
+	for source, as := range a.as {
+		// Rewind
+		if v, ok := as.s.(RewindableAudioSource); ok {
+			if err := v.Rewind(); err != nil {
+				astilog.Error(errors.Wrapf(err, "astiunderstanding: rewinding audio source %s failed", source))
+			}
+		}
+
+		// Read
+		a.readAudioSource(ctx, source, as)
+	}
+}
+
+// stopReadingAudioSources stops reading audio sources without closing them so that they can be read again once the
+// ability is switched back on
+func (a *Ability) stopReadingAudioSources() {
+	a.am.Lock()
+	defer a.am.Unlock()
+	a.actx = nil
+	for _, as := range a.as {
+		if as.cancel != nil {
+			as.cancel()
+			as.cancel = nil
+		}
+	}
+}
+
+// readAudioSource starts reading an audio source in a goroutine and feeds Run with its samples
+// It must be called while holding am.
+func (a *Ability) readAudioSource(ctx context.Context, source string, as *audioSource) {
+	// Create context
+	ctx, as.cancel = context.WithCancel(ctx)
+
+	// Read
+	ch := a.ch
+	go func() {
+		var lastSampleRate, lastSignificantBits int
+		for {
+			// Read samples
+			samples, sampleRate, significantBits, err := as.s.Read(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				} else if errors.Cause(err) == ErrAudioSourceReconnected {
+					// Audio source has reconnected
+					// The format of the last samples is provided so that the flushed utterance can be processed
+					astilog.Debugf("astiunderstanding: audio source %s has reconnected", source)
+					select {
+					case ch <- PayloadSamples{
+						SampleRate:      lastSampleRate,
+						SignificantBits: lastSignificantBits,
+						Source:          source,
+						reconnected:     true,
+					}:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				} else if err == io.EOF {
+					astilog.Debugf("astiunderstanding: audio source %s has no samples left", source)
+					return
+				}
+				astilog.Error(errors.Wrapf(err, "astiunderstanding: reading audio source %s failed", source))
+				return
+			}
+
+			// Dispatch
+			lastSampleRate, lastSignificantBits = sampleRate, significantBits
+			select {
+			case ch <- PayloadSamples{
+				SampleRate:      sampleRate,
+				Samples:         samples,
+				SignificantBits: significantBits,
+				Source:          source,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// FileAudioSourceConfiguration represents a file audio source configuration
+// ChunkDuration is the duration of the samples returned by each read. Default is 100ms.
+// If Realtime is true, reads are paced so that samples are provided at the speed they've been recorded.
+type FileAudioSourceConfiguration struct {
+	ChunkDuration time.Duration `toml:"chunk_duration"`
+	Realtime      bool          `toml:"realtime"`
+}
+
+// FileAudioSource represents an audio source reading a mono wav file
+// It's rewound to the start of its samples each time the ability is switched on.
+type FileAudioSource struct {
+	c          FileAudioSourceConfiguration
+	f          *os.File
+	lastReadAt time.Time
+	m          sync.Mutex // Locks lastReadAt and r
+	r          *wav.Reader
+	size       int64
+	wf         wav.File
+}
+
+// NewFileAudioSource creates a new file audio source
+func NewFileAudioSource(path string, c FileAudioSourceConfiguration) (s *FileAudioSource, err error) {
+	// Create
+	s = &FileAudioSource{c: c}
+
+	// Default configuration values
+	if s.c.ChunkDuration <= 0 {
+		s.c.ChunkDuration = 100 * time.Millisecond
+	}
+
+	// Stat file
+	var fi os.FileInfo
+	if fi, err = os.Stat(path); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: stating %s failed", path)
+		return
+	}
+
+	// Open file
+	if s.f, err = os.Open(path); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: opening %s failed", path)
+		return
+	}
+
+	// Create wav reader
+	s.size = fi.Size()
+	if s.r, err = wav.NewReader(s.f, s.size); err != nil {
+		s.f.Close()
+		err = errors.Wrap(err, "astiunderstanding: creating wav reader failed")
+		return
+	}
+	s.wf = s.r.GetFile()
+	return
+}
+
+// Rewind implements the RewindableAudioSource interface
+// The wav header is parsed again so that the next read starts at the beginning of the data chunk.
+func (s *FileAudioSource) Rewind() (err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Seek
+	if _, err = s.f.Seek(0, io.SeekStart); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: seeking %s failed", s.f.Name())
+		return
+	}
+
+	// Create wav reader
+	var r *wav.Reader
+	if r, err = wav.NewReader(s.f, s.size); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: creating wav reader failed")
+		return
+	}
+	s.lastReadAt = time.Time{}
+	s.r = r
+	return
+}
+
+// Close implements the AudioSource interface
+func (s *FileAudioSource) Close() error {
+	if err := s.f.Close(); err != nil {
+		return errors.Wrapf(err, "astiunderstanding: closing %s failed", s.f.Name())
+	}
+	return nil
+}
+
+// Read implements the AudioSource interface
+func (s *FileAudioSource) Read(ctx context.Context) (samples []int32, sampleRate, significantBits int, err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Pace reads
+	if s.c.Realtime && !s.lastReadAt.IsZero() {
+		select {
+		case <-time.After(s.c.ChunkDuration - time.Since(s.lastReadAt)):
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+	s.lastReadAt = time.Now()
+
+	// Read samples
+	sampleRate, significantBits = int(s.wf.SampleRate), int(s.wf.SignificantBits)
+	n := int(time.Duration(sampleRate) * s.c.ChunkDuration / time.Second)
+	if n <= 0 {
+		n = 1
+	}
+	samples = make([]int32, 0, n)
+	var sample int32
+	for len(samples) < n {
+		if sample, err = s.r.ReadSample(); err != nil {
+			if err == io.EOF && len(samples) > 0 {
+				err = nil
+				return
+			} else if err != io.EOF {
+				err = errors.Wrap(err, "astiunderstanding: reading wav sample failed")
+			}
+			return
+		}
+		samples = append(samples, sample)
+	}
+	return
+}
+
+// NullAudioSource represents an audio source that never provides samples
+type NullAudioSource struct{}
+
+// NewNullAudioSource creates a new null audio source
+func NewNullAudioSource() *NullAudioSource {
+	return &NullAudioSource{}
+}
+
+// Close implements the AudioSource interface
+func (s *NullAudioSource) Close() error {
+	return nil
+}
+
+// Read implements the AudioSource interface
+func (s *NullAudioSource) Read(ctx context.Context) (samples []int32, sampleRate, significantBits int, err error) {
+	<-ctx.Done()
+	err = ctx.Err()
+	return
+}
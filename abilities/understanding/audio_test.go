@@ -0,0 +1,93 @@
+package astiunderstanding
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeWAVForTest writes a canonical mono 16 bits wav file and returns its path
+func writeWAVForTest(t *testing.T, samples []int16, sampleRate int) string {
+	return writeMultiChannelWAVForTest(t, samples, sampleRate, 1)
+}
+
+// writeMultiChannelWAVForTest writes a canonical 16 bits wav file whose samples are interleaved and returns its path
+func writeMultiChannelWAVForTest(t *testing.T, samples []int16, sampleRate, channels int) string {
+	// Create header
+	b := make([]byte, 44, 44+2*len(samples))
+	copy(b, "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], uint32(36+2*len(samples)))
+	copy(b[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], 1)
+	binary.LittleEndian.PutUint16(b[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(b[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(b[28:], uint32(2*channels*sampleRate))
+	binary.LittleEndian.PutUint16(b[32:], uint16(2*channels))
+	binary.LittleEndian.PutUint16(b[34:], 16)
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], uint32(2*len(samples)))
+
+	// Add samples
+	for _, s := range samples {
+		b = binary.LittleEndian.AppendUint16(b, uint16(s))
+	}
+
+	// Write
+	p := filepath.Join(t.TempDir(), "test.wav")
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFileAudioSourceRewind(t *testing.T) {
+	// Chunks hold 2 samples
+	s, err := NewFileAudioSource(writeWAVForTest(t, []int16{1, -2, 3}, 20), FileAudioSourceConfiguration{})
+	assert.NoError(t, err)
+	defer s.Close()
+	readAll := func() (ss [][]int32) {
+		for {
+			samples, sampleRate, significantBits, err := s.Read(context.Background())
+			if err == io.EOF {
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 20, sampleRate)
+			assert.Equal(t, 16, significantBits)
+			ss = append(ss, samples)
+		}
+	}
+	assert.Equal(t, [][]int32{{1, -2}, {3}}, readAll())
+	assert.Empty(t, readAll())
+
+	// Samples are read again from the start once rewound
+	assert.NoError(t, s.Rewind())
+	assert.Equal(t, [][]int32{{1, -2}, {3}}, readAll())
+}
+
+func TestAbilityRewindsAudioSources(t *testing.T) {
+	s, err := NewFileAudioSource(writeWAVForTest(t, []int16{1}, 10), FileAudioSourceConfiguration{})
+	assert.NoError(t, err)
+	a, err := NewAbility(nil, nil, AbilityConfiguration{})
+	assert.NoError(t, err)
+	a.AddAudioSource("test", s, SourceConfiguration{})
+	defer a.removeAudioSource("test")
+
+	// Audio source has no samples left
+	_, _, _, err = s.Read(context.Background())
+	assert.NoError(t, err)
+
+	// Audio source is read from the start once the ability reads its audio sources
+	a.ch = make(chan PayloadSamples, 1)
+	a.readAudioSources(context.Background())
+	defer a.stopReadingAudioSources()
+	p := <-a.ch
+	assert.Equal(t, []int32{1}, p.Samples)
+	assert.Equal(t, "test", p.Source)
+}
@@ -0,0 +1,147 @@
+package astiunderstanding
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// BatchSpeechParser represents an object capable of parsing several utterances in one call
+// SpeechToTextBatch must return one text per utterance, in the same order.
+type BatchSpeechParser interface {
+	SpeechParser
+	SpeechToTextBatch(samples [][]int32, sampleRate, significantBits int) ([]string, error)
+}
+
+// batch represents utterances waiting to be parsed in one call.
+// Utterances of a batch share the same sample rate and significant bits.
+type batch struct {
+	items           []batchItem
+	sampleRate      int
+	significantBits int
+	t               *time.Timer
+}
+
+// batchItem represents an utterance waiting to be parsed
+type batchItem struct {
+	ctx     context.Context // Carries the span of the utterance
+	k       pipelineKey
+	samples []int32
+}
+
+// timeout returns the channel receiving once the max latency of the batch has been reached.
+// A nil *batch returns a nil channel that never receives.
+func (b *batch) timeout() <-chan time.Time {
+	if b == nil || b.t == nil {
+		return nil
+	}
+	return b.t.C
+}
+
+// batchSpeechParser returns the batch speech parser if batching is enabled
+func (a *Ability) batchSpeechParser() (BatchSpeechParser, bool) {
+	if a.c.BatchSize <= 1 {
+		return nil, false
+	}
+	p, ok := a.p.(BatchSpeechParser)
+	return p, ok
+}
+
+// batchSamples adds samples to the current batch and flushes it once it's full.
+// It must only be called in Run.
+func (a *Ability) batchSamples(ctx context.Context, p BatchSpeechParser, k pipelineKey, samples []int32, sampleRate, significantBits int) {
+	// Convert
+	samples, sampleRate, significantBits = a.convert(samples, sampleRate, significantBits)
+
+	// Utterances with a different format can't be part of the current batch
+	if a.b != nil && (a.b.sampleRate != sampleRate || a.b.significantBits != significantBits) {
+		a.flushBatch(p)
+	}
+
+	// Create batch
+	if a.b == nil {
+		a.b = &batch{
+			sampleRate:      sampleRate,
+			significantBits: significantBits,
+			t:               time.NewTimer(a.c.BatchMaxLatency),
+		}
+	}
+
+	// Add samples
+	sctx, _ := astibrain.StartSpan(ctx, spanNameUtterance)
+	a.b.items = append(a.b.items, batchItem{ctx: sctx, k: k, samples: samples})
+
+	// Batch is full
+	if len(a.b.items) >= a.c.BatchSize {
+		a.flushBatch(p)
+	}
+}
+
+// flushBatch parses the current batch and dispatches one analysis per utterance.
+// It must only be called in Run.
+func (a *Ability) flushBatch(p BatchSpeechParser) {
+	// No batch
+	if a.b == nil {
+		return
+	}
+
+	// Reset batch
+	b := a.b
+	a.b = nil
+	b.t.Stop()
+
+	// Make sure the following is not blocking but still executed in FIFO order
+	a.d.Do(func() {
+		// Make sure spans are ended
+		defer func() {
+			for _, i := range b.items {
+				astibrain.SpanFromContext(i.ctx).End()
+			}
+		}()
+
+		// Get samples
+		var samples = make([][]int32, 0, len(b.items))
+		for _, i := range b.items {
+			samples = append(samples, i.samples)
+		}
+
+		// Execute speech to text analysis
+		start := time.Now()
+		astilog.Debugf("astiunderstanding: starting batch speech to text analysis on %d utterances", len(samples))
+		release := a.acquireSpeechToText()
+		texts, err := a.speechToTextBatch(p, samples, b.sampleRate, b.significantBits)
+		release()
+		if err == nil && len(texts) != len(samples) {
+			err = fmt.Errorf("astiunderstanding: batch speech parser returned %d texts for %d utterances", len(texts), len(samples))
+		}
+		if err != nil {
+			for _, i := range b.items {
+				a.processError(i.k, errors.Wrap(err, "astiunderstanding: batch speech to text analysis failed"))
+			}
+			return
+		}
+		d := time.Now().Sub(start)
+		astilog.Debugf("astiunderstanding: batch speech to text analysis done in %s", d)
+
+		// Observe
+		if a.observeFunc != nil {
+			a.observeFunc("speech_to_text_batch", d)
+		}
+
+		// Process results in order
+		for idx, i := range b.items {
+			a.processResult(i.ctx, i.k, SpeechResult{Language: a.defaultLanguage(), Text: texts[idx]}, "", d, i.samples, b.sampleRate, b.significantBits)
+		}
+	})
+}
+
+// speechToTextBatch executes the batch speech to text analysis.
+// A panicking speech parser is considered as failed.
+func (a *Ability) speechToTextBatch(p BatchSpeechParser, samples [][]int32, sampleRate, significantBits int) (texts []string, err error) {
+	defer recoverSpeechParser(&err)
+	return p.SpeechToTextBatch(samples, sampleRate, significantBits)
+}
@@ -0,0 +1,196 @@
+package astiunderstanding
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Circuit breaker states
+const (
+	CircuitBreakerStateClosed   = "closed"
+	CircuitBreakerStateHalfOpen = "half_open"
+	CircuitBreakerStateOpen     = "open"
+)
+
+// ErrCircuitOpen is the error returned when the circuit breaker short-circuits a call
+var ErrCircuitOpen = errors.New("astiunderstanding: circuit open")
+
+// CircuitBreakerConfiguration represents a circuit breaker configuration
+// The circuit is opened once MaxFailures consecutive calls have failed and calls are short-circuited for Cooldown.
+// Once the cooldown is over, one probe call is allowed: the circuit is closed if it succeeds and opened again otherwise.
+type CircuitBreakerConfiguration struct {
+	Cooldown    time.Duration `toml:"cooldown"`
+	MaxFailures int           `toml:"max_failures"`
+}
+
+// CircuitBreakerStateFunc represents the callback executed when the state of the circuit breaker changes
+type CircuitBreakerStateFunc func(state string)
+
+// CircuitBreakerSpeechParser represents a speech parser that stops calling the wrapped speech parser once it keeps on
+// failing
+type CircuitBreakerSpeechParser struct {
+	c        CircuitBreakerConfiguration
+	failures int
+	m        sync.Mutex // Locks failures, openedAt, probing and state
+	onState  []CircuitBreakerStateFunc
+	openedAt time.Time
+	p        SpeechParser
+	probing  bool
+	state    string
+}
+
+// NewCircuitBreakerSpeechParser creates a new circuit breaker speech parser
+func NewCircuitBreakerSpeechParser(p SpeechParser, c CircuitBreakerConfiguration) (b *CircuitBreakerSpeechParser) {
+	// Create
+	b = &CircuitBreakerSpeechParser{
+		c:     c,
+		p:     p,
+		state: CircuitBreakerStateClosed,
+	}
+
+	// Default configuration values
+	if b.c.Cooldown == 0 {
+		b.c.Cooldown = 30 * time.Second
+	}
+	if b.c.MaxFailures <= 0 {
+		b.c.MaxFailures = 5
+	}
+	return
+}
+
+// OnStateChange adds a callback executed when the state of the circuit breaker changes
+func (b *CircuitBreakerSpeechParser) OnStateChange(fn CircuitBreakerStateFunc) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.onState = append(b.onState, fn)
+}
+
+// State returns the state of the circuit breaker
+func (b *CircuitBreakerSpeechParser) State() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.state
+}
+
+// Capabilities implements the SpeechParserCapabilities interface
+// It returns the capabilities of the wrapped speech parser, if any.
+func (b *CircuitBreakerSpeechParser) Capabilities() (f SpeechParserFormat) {
+	if v, ok := b.p.(SpeechParserCapabilities); ok {
+		f = v.Capabilities()
+	}
+	return
+}
+
+// SpeechToText implements the SpeechParser interface
+func (b *CircuitBreakerSpeechParser) SpeechToText(samples []int32, sampleRate, significantBits int) (text string, err error) {
+	var r SpeechResult
+	r, _, err = b.speechToTextWrapped(context.Background(), samples, sampleRate, significantBits, "")
+	text = r.Text
+	return
+}
+
+// SpeechToTextDetailed implements the DetailedSpeechParser interface
+func (b *CircuitBreakerSpeechParser) SpeechToTextDetailed(samples []int32, sampleRate, significantBits int) (r SpeechResult, err error) {
+	r, _, err = b.speechToTextWrapped(context.Background(), samples, sampleRate, significantBits, "")
+	return
+}
+
+// isContextAware implements the wrapperSpeechParser interface
+func (b *CircuitBreakerSpeechParser) isContextAware(language string) bool {
+	return isContextAware(b.p, language)
+}
+
+// speechToTextWrapped implements the wrapperSpeechParser interface
+// The context, the language and the backend are forwarded to and from the wrapped speech parser.
+func (b *CircuitBreakerSpeechParser) speechToTextWrapped(ctx context.Context, samples []int32, sampleRate, significantBits int, language string) (r SpeechResult, backend string, err error) {
+	// Allow
+	if err = b.allow(); err != nil {
+		return
+	}
+
+	// Execute speech to text analysis
+	defer func() { b.done(err) }()
+	defer recoverSpeechParser(&err)
+	return parseSpeech(ctx, b.p, samples, sampleRate, significantBits, language)
+}
+
+// allow checks whether the call can reach the wrapped speech parser
+func (b *CircuitBreakerSpeechParser) allow() error {
+	// Lock
+	b.m.Lock()
+	var fns []CircuitBreakerStateFunc
+	defer func() {
+		b.m.Unlock()
+		b.notify(fns)
+	}()
+
+	// Process state
+	switch b.state {
+	case CircuitBreakerStateOpen:
+		// Cooldown is not over yet
+		if time.Since(b.openedAt) < b.c.Cooldown {
+			return ErrCircuitOpen
+		}
+
+		// Probe
+		fns = b.setStateUnsafe(CircuitBreakerStateHalfOpen)
+		b.probing = true
+	case CircuitBreakerStateHalfOpen:
+		// Only one probe is allowed at a time
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// done updates the state of the circuit breaker based on the result of the call
+func (b *CircuitBreakerSpeechParser) done(err error) {
+	// Lock
+	b.m.Lock()
+	var fns []CircuitBreakerStateFunc
+	defer func() {
+		b.m.Unlock()
+		b.notify(fns)
+	}()
+
+	// Call has succeeded
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		fns = b.setStateUnsafe(CircuitBreakerStateClosed)
+		return
+	}
+
+	// Call has failed
+	b.failures++
+	if b.state == CircuitBreakerStateHalfOpen || b.failures >= b.c.MaxFailures {
+		b.openedAt = time.Now()
+		fns = b.setStateUnsafe(CircuitBreakerStateOpen)
+	}
+}
+
+// setStateUnsafe updates the state and returns the callbacks to execute if it has changed.
+// Assumption is made that m is locked
+func (b *CircuitBreakerSpeechParser) setStateUnsafe(state string) []CircuitBreakerStateFunc {
+	if b.state == state {
+		return nil
+	}
+	b.state = state
+	return append([]CircuitBreakerStateFunc{}, b.onState...)
+}
+
+// notify executes the state callbacks outside of the lock
+func (b *CircuitBreakerSpeechParser) notify(fns []CircuitBreakerStateFunc) {
+	if len(fns) == 0 {
+		return
+	}
+	s := b.State()
+	for _, fn := range fns {
+		fn(s)
+	}
+}
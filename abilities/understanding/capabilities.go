@@ -0,0 +1,114 @@
+package astiunderstanding
+
+import (
+	"fmt"
+
+	"github.com/asticode/go-astibob/pkg/sampleformat"
+)
+
+// SpeechParserCapabilities represents a speech parser capable of declaring the audio format it accepts so that
+// samples are converted accordingly before being provided to it
+type SpeechParserCapabilities interface {
+	SpeechParser
+	Capabilities() SpeechParserFormat
+}
+
+// SpeechParserFormat represents the audio format a speech parser accepts
+// Empty lists mean any value is accepted. Samples are always provided as mono samples.
+type SpeechParserFormat struct {
+	Channels        []int
+	SampleRates     []int
+	SignificantBits []int
+}
+
+// format returns the audio format the speech parser accepts
+func (a *Ability) format() (f SpeechParserFormat) {
+	if v, ok := a.p.(SpeechParserCapabilities); ok {
+		f = v.Capabilities()
+	}
+	return
+}
+
+// Init implements the astibrain.Initializable interface
+// It makes sure samples can be converted to the audio format the speech parser accepts.
+func (a *Ability) Init() (err error) {
+	// Get format
+	f := a.format()
+
+	// Samples are downmixed to mono
+	if len(f.Channels) > 0 && !containsInt(f.Channels, 1) {
+		err = fmt.Errorf("astiunderstanding: speech parser only accepts %v channels whereas samples are downmixed to mono", f.Channels)
+		return
+	}
+
+	// Target sample rate is not accepted
+	if a.c.TargetSampleRate > 0 && len(f.SampleRates) > 0 && !containsInt(f.SampleRates, a.c.TargetSampleRate) {
+		err = fmt.Errorf("astiunderstanding: speech parser only accepts %v sample rates whereas target sample rate is %d", f.SampleRates, a.c.TargetSampleRate)
+		return
+	}
+
+	// Invalid significant bits
+	for _, b := range f.SignificantBits {
+		if b < 2 || b > 32 {
+			err = fmt.Errorf("astiunderstanding: speech parser accepts %d significant bits which is not between 2 and 32", b)
+			return
+		}
+	}
+	return
+}
+
+// convert converts samples to the audio format the speech parser accepts
+func (a *Ability) convert(samples []int32, sampleRate, significantBits int) ([]int32, int, int) {
+	dstSampleRate, dstSignificantBits := a.sampleRate(sampleRate), a.significantBits(significantBits)
+	samples = astisampleformat.Resample(samples, sampleRate, dstSampleRate)
+	samples = astisampleformat.ConvertSignificantBits(samples, significantBits, dstSignificantBits)
+	return samples, dstSampleRate, dstSignificantBits
+}
+
+// sampleRate returns the sample rate the speech parser expects
+// If the speech parser declares the sample rates it accepts, the closest one is used.
+func (a *Ability) sampleRate(sourceSampleRate int) int {
+	if a.c.TargetSampleRate > 0 {
+		return a.c.TargetSampleRate
+	}
+	return closestInt(a.format().SampleRates, sourceSampleRate)
+}
+
+// significantBits returns the significant bits the speech parser expects
+// If the speech parser declares the significant bits it accepts, the closest one is used.
+func (a *Ability) significantBits(sourceSignificantBits int) int {
+	return closestInt(a.format().SignificantBits, sourceSignificantBits)
+}
+
+// containsInt checks whether a slice contains a value
+func containsInt(s []int, v int) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// closestInt returns the value of a slice closest to v, preferring higher values in case of a tie.
+// It returns v if the slice is empty.
+func closestInt(s []int, v int) (o int) {
+	if len(s) == 0 {
+		return v
+	}
+	o = s[0]
+	for _, i := range s[1:] {
+		if d, od := absInt(i-v), absInt(o-v); d < od || (d == od && i > o) {
+			o = i
+		}
+	}
+	return
+}
+
+// absInt returns the absolute value of an int
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,44 @@
+package astiunderstanding
+
+// Gauges
+const (
+	gaugeSpeechToTextInFlight = "speech_to_text_in_flight"
+)
+
+// acquireSpeechToText waits for a speech to text slot if the number of concurrent speech to text calls is limited and
+// returns the func releasing it.
+// Callers waiting for a slot are bounded by the analysis queue since speech to text calls are executed in the order
+// utterances have been queued.
+func (a *Ability) acquireSpeechToText() (release func()) {
+	// Wait for a slot
+	if a.sem != nil {
+		a.sem <- struct{}{}
+	}
+
+	// Update in-flight count
+	a.updateInFlight(1)
+	return func() {
+		a.updateInFlight(-1)
+		if a.sem != nil {
+			<-a.sem
+		}
+	}
+}
+
+// updateInFlight updates the number of in-flight speech to text calls and reports it
+func (a *Ability) updateInFlight(delta int) {
+	a.fm.Lock()
+	a.f += delta
+	f := a.f
+	a.fm.Unlock()
+	if a.gaugeFunc != nil {
+		a.gaugeFunc(gaugeSpeechToTextInFlight, float64(f))
+	}
+}
+
+// InFlightSpeechToText returns the number of speech to text calls currently in flight
+func (a *Ability) InFlightSpeechToText() int {
+	a.fm.Lock()
+	defer a.fm.Unlock()
+	return a.f
+}
@@ -0,0 +1,54 @@
+package astiunderstanding
+
+// Downmix modes
+const (
+	DownmixModeAverage = "average"
+	DownmixModeSelect  = "select"
+)
+
+// Downmix converts interleaved multi-channel samples to mono samples.
+// With DownmixModeSelect, only the provided channel is kept. Otherwise channels are averaged.
+// Samples are returned as is if there's only one channel. Since chunks don't necessarily end on a frame boundary, the
+// samples of an incomplete trailing frame are returned as the remainder which has to be provided with the next chunk.
+func Downmix(samples []int32, channels int, mode string, channel int, remainder []int32) (o, r []int32) {
+	// Nothing to do
+	if channels <= 1 {
+		return samples, nil
+	}
+
+	// Prepend remainder
+	if len(remainder) > 0 {
+		samples = append(append(make([]int32, 0, len(remainder)+len(samples)), remainder...), samples...)
+	}
+
+	// Make sure the channel is valid
+	if channel < 0 || channel >= channels {
+		channel = 0
+	}
+
+	// Loop through frames
+	o = make([]int32, len(samples)/channels)
+	for idx := range o {
+		// Get frame
+		frame := samples[idx*channels : (idx+1)*channels]
+
+		// Select
+		if mode == DownmixModeSelect {
+			o[idx] = frame[channel]
+			continue
+		}
+
+		// Average
+		var sum int64
+		for _, s := range frame {
+			sum += int64(s)
+		}
+		o[idx] = int32(sum / int64(channels))
+	}
+
+	// Keep incomplete trailing frame
+	if n := len(samples) % channels; n > 0 {
+		r = append([]int32{}, samples[len(samples)-n:]...)
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package astiunderstanding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownmix(t *testing.T) {
+	for _, v := range []struct {
+		name              string
+		samples           []int32
+		channels          int
+		mode              string
+		channel           int
+		remainder         []int32
+		expected          []int32
+		expectedRemainder []int32
+	}{
+		{name: "mono", samples: []int32{1, 2, 3}, channels: 1, expected: []int32{1, 2, 3}},
+		{name: "average", samples: []int32{1, 3, -4, -6}, channels: 2, expected: []int32{2, -5}},
+		{name: "select", samples: []int32{1, 2, 3, 4, 5, 6}, channels: 3, mode: DownmixModeSelect, channel: 1, expected: []int32{2, 5}},
+		{name: "invalid channel", samples: []int32{1, 2, 3, 4}, channels: 2, mode: DownmixModeSelect, channel: 2, expected: []int32{1, 3}},
+		{name: "trailing partial frame", samples: []int32{1, 3, 5}, channels: 2, expected: []int32{2}, expectedRemainder: []int32{5}},
+		{name: "remainder", samples: []int32{7, 2, 4}, channels: 2, remainder: []int32{5}, expected: []int32{6, 3}},
+		{name: "remainder only", samples: []int32{2}, channels: 3, remainder: []int32{1}, expected: []int32{}, expectedRemainder: []int32{1, 2}},
+		{name: "remainder with trailing partial frame", samples: []int32{2, 3, 4, 5}, channels: 3, mode: DownmixModeSelect, channel: 2, remainder: []int32{1}, expected: []int32{3}, expectedRemainder: []int32{4, 5}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			o, r := Downmix(v.samples, v.channels, v.mode, v.channel, v.remainder)
+			assert.Equal(t, v.expected, o)
+			assert.Equal(t, v.expectedRemainder, r)
+		})
+	}
+}
+
+func TestDownmixChunks(t *testing.T) {
+	// Downmixing chunks that don't end on a frame boundary is the same as downmixing all samples at once
+	samples := []int32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	expected, _ := Downmix(samples, 3, DownmixModeAverage, 0, nil)
+	var o, r []int32
+	for _, c := range [][]int32{samples[:1], samples[1:5], samples[5:6], samples[6:11], samples[11:]} {
+		var d []int32
+		d, r = Downmix(c, 3, DownmixModeAverage, 0, r)
+		o = append(o, d...)
+	}
+	assert.Equal(t, expected, o)
+	assert.Empty(t, r)
+}
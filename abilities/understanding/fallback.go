@@ -0,0 +1,130 @@
+package astiunderstanding
+
+import (
+	"context"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Speech parser backends
+const (
+	SpeechParserBackendPrimary   = "primary"
+	SpeechParserBackendSecondary = "secondary"
+)
+
+// backendSpeechParser represents an object capable of parsing speech and returning which backend produced the text
+type backendSpeechParser interface {
+	SpeechToTextWithBackend(samples []int32, sampleRate, significantBits int) (r SpeechResult, backend string, err error)
+}
+
+// FallbackSpeechParser represents a speech parser that falls back to a secondary speech parser when the primary one
+// fails or times out
+type FallbackSpeechParser struct {
+	primary   SpeechParser
+	secondary SpeechParser
+	timeout   time.Duration
+}
+
+// NewFallbackSpeechParser creates a new fallback speech parser
+// If timeout is 0, the secondary speech parser is only used when the primary one fails
+func NewFallbackSpeechParser(primary, secondary SpeechParser, timeout time.Duration) *FallbackSpeechParser {
+	return &FallbackSpeechParser{
+		primary:   primary,
+		secondary: secondary,
+		timeout:   timeout,
+	}
+}
+
+// SpeechToText implements the SpeechParser interface
+func (p *FallbackSpeechParser) SpeechToText(samples []int32, sampleRate, significantBits int) (text string, err error) {
+	var r SpeechResult
+	r, _, err = p.SpeechToTextWithBackend(samples, sampleRate, significantBits)
+	text = r.Text
+	return
+}
+
+// SpeechToTextDetailed implements the DetailedSpeechParser interface
+func (p *FallbackSpeechParser) SpeechToTextDetailed(samples []int32, sampleRate, significantBits int) (r SpeechResult, err error) {
+	r, _, err = p.SpeechToTextWithBackend(samples, sampleRate, significantBits)
+	return
+}
+
+// fallbackResult represents a fallback speech parser result
+type fallbackResult struct {
+	backend string
+	err     error
+	r       SpeechResult
+}
+
+// SpeechToTextWithBackend executes the speech to text analysis and returns which backend produced the text.
+// When the primary speech parser times out, it keeps running alongside the secondary one and the first text produced
+// is returned.
+func (p *FallbackSpeechParser) SpeechToTextWithBackend(samples []int32, sampleRate, significantBits int) (r SpeechResult, backend string, err error) {
+	return p.speechToTextWrapped(context.Background(), samples, sampleRate, significantBits, "")
+}
+
+// isContextAware implements the wrapperSpeechParser interface
+func (p *FallbackSpeechParser) isContextAware(language string) bool {
+	return isContextAware(p.primary, language) && isContextAware(p.secondary, language)
+}
+
+// speechToTextWrapped implements the wrapperSpeechParser interface
+// The context and the language are forwarded to both speech parsers.
+func (p *FallbackSpeechParser) speechToTextWrapped(ctx context.Context, samples []int32, sampleRate, significantBits int, language string) (r SpeechResult, backend string, err error) {
+	// Create results channel
+	// It's buffered so that the remaining parser doesn't block once a result has been returned
+	ch := make(chan fallbackResult, 2)
+
+	// Run primary
+	go p.run(ctx, ch, SpeechParserBackendPrimary, p.primary, samples, sampleRate, significantBits, language)
+
+	// Create timeout
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		t := time.NewTimer(p.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	// Wait for the results
+	var pending, isSecondaryRunning = 1, false
+	for pending > 0 {
+		select {
+		case fr := <-ch:
+			// Success
+			pending--
+			if fr.err == nil {
+				return fr.r, fr.backend, nil
+			}
+
+			// Log
+			err = errors.Wrapf(fr.err, "astiunderstanding: %s speech parser failed", fr.backend)
+			astilog.Debug(err)
+		case <-timeout:
+			timeout = nil
+			astilog.Debugf("astiunderstanding: primary speech parser timed out after %s", p.timeout)
+		case <-ctx.Done():
+			err = errors.Wrap(ctx.Err(), "astiunderstanding: context error")
+			return
+		}
+
+		// Run secondary
+		if !isSecondaryRunning {
+			isSecondaryRunning = true
+			pending++
+			go p.run(ctx, ch, SpeechParserBackendSecondary, p.secondary, samples, sampleRate, significantBits, language)
+		}
+	}
+	return
+}
+
+// run runs a speech parser and sends its result in the channel
+// A panicking speech parser is considered as failed
+func (p *FallbackSpeechParser) run(ctx context.Context, ch chan fallbackResult, backend string, sp SpeechParser, samples []int32, sampleRate, significantBits int, language string) {
+	fr := fallbackResult{backend: backend}
+	defer func() { ch <- fr }()
+	defer recoverSpeechParser(&fr.err)
+	fr.r, _, fr.err = parseSpeech(ctx, sp, samples, sampleRate, significantBits, language)
+}
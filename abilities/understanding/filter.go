@@ -0,0 +1,188 @@
+package astiunderstanding
+
+import (
+	"math"
+	"time"
+
+	"github.com/asticode/go-astitools/audio"
+)
+
+// AudioFilter represents an object capable of processing audio samples before they're provided to the silence
+// detector
+// Filters are created per pipeline so that they can manage their own state between calls, see SetAudioFilters.
+type AudioFilter interface {
+	Process(samples []int32, sampleRate int) []int32
+}
+
+// AudioFilterFunc is an adapter allowing a function to be used as a stateless audio filter
+type AudioFilterFunc func(samples []int32, sampleRate int) []int32
+
+// Process implements the AudioFilter interface
+func (f AudioFilterFunc) Process(samples []int32, sampleRate int) []int32 {
+	return f(samples, sampleRate)
+}
+
+// SetAudioFilters sets the function creating the filter chain of each pipeline.
+// Received samples go through the filters in order, after the automatic gain control and before both the audio level
+// metering and the silence detector, which means speech parsers are provided filtered samples as well. If fn is nil or
+// returns no filter, samples are left untouched.
+// It must be called before the ability is switched on.
+func (a *Ability) SetAudioFilters(fn func() []AudioFilter) {
+	a.af = fn
+}
+
+// applyAudioFilters applies the filter chain of a pipeline to samples
+// It must only be called in Run.
+func (a *Ability) applyAudioFilters(k pipelineKey, samples []int32, sampleRate int) []int32 {
+	// No filters
+	if a.af == nil {
+		return samples
+	}
+
+	// Create filter chain for the pipeline
+	fs, ok := a.afs[k]
+	if !ok {
+		fs = a.af()
+		a.afs[k] = fs
+	}
+
+	// Loop through filters
+	for _, f := range fs {
+		samples = f.Process(samples, sampleRate)
+	}
+	return samples
+}
+
+// HighPassFilter represents a first order high-pass filter attenuating frequencies below its cutoff frequency, such as
+// hum and rumble.
+type HighPassFilter struct {
+	cutoff  float64
+	prevIn  float64
+	prevOut float64
+}
+
+// NewHighPassFilter creates a new high-pass filter whose cutoff frequency is in Hz
+func NewHighPassFilter(cutoff float64) *HighPassFilter {
+	return &HighPassFilter{cutoff: cutoff}
+}
+
+// Process implements the AudioFilter interface
+func (f *HighPassFilter) Process(samples []int32, sampleRate int) []int32 {
+	// Filter is disabled
+	if f.cutoff <= 0 || sampleRate <= 0 {
+		return samples
+	}
+
+	// Get coefficient
+	rc := 1 / (2 * math.Pi * f.cutoff)
+	dt := 1 / float64(sampleRate)
+	alpha := rc / (rc + dt)
+
+	// Loop through samples
+	o := make([]int32, len(samples))
+	for idx, s := range samples {
+		in := float64(s)
+		f.prevOut = alpha * (f.prevOut + in - f.prevIn)
+		f.prevIn = in
+		o[idx] = int32(f.prevOut)
+	}
+	return o
+}
+
+// NoiseGateFilterConfiguration represents a noise gate filter configuration
+// Threshold is the audio level below which steps are muted, see astiaudio.AudioLevel.
+// HoldDuration is the duration during which the gate stays open once the audio level has gone below the threshold so
+// that the end of words is not cut.
+// StepDuration is the duration of the steps samples are gated by. Default is 10ms.
+type NoiseGateFilterConfiguration struct {
+	HoldDuration time.Duration `toml:"hold_duration"`
+	StepDuration time.Duration `toml:"step_duration"`
+	Threshold    float64       `toml:"threshold"`
+}
+
+// NoiseGateFilter represents a filter muting steps whose audio level is below a threshold
+type NoiseGateFilter struct {
+	c    NoiseGateFilterConfiguration
+	hold int // Number of samples during which the gate stays open
+}
+
+// NewNoiseGateFilter creates a new noise gate filter
+func NewNoiseGateFilter(c NoiseGateFilterConfiguration) (f *NoiseGateFilter) {
+	// Create
+	f = &NoiseGateFilter{c: c}
+
+	// Default configuration values
+	if f.c.StepDuration <= 0 {
+		f.c.StepDuration = 10 * time.Millisecond
+	}
+	return
+}
+
+// Process implements the AudioFilter interface
+func (f *NoiseGateFilter) Process(samples []int32, sampleRate int) []int32 {
+	// Get sizes
+	stepSize := int(int64(sampleRate) * int64(f.c.StepDuration) / int64(time.Second))
+	if stepSize <= 0 {
+		return samples
+	}
+	holdSize := int(int64(sampleRate) * int64(f.c.HoldDuration) / int64(time.Second))
+
+	// Loop through steps
+	o := make([]int32, len(samples))
+	for start := 0; start < len(samples); start += stepSize {
+		// Get step
+		end := start + stepSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+		step := samples[start:end]
+
+		// Open gate
+		if astiaudio.AudioLevel(step) >= f.c.Threshold {
+			f.hold = holdSize
+			copy(o[start:end], step)
+			continue
+		}
+
+		// Gate is held open
+		if f.hold > 0 {
+			f.hold -= len(step)
+			copy(o[start:end], step)
+		}
+	}
+	return o
+}
+
+// GainFilter represents a filter applying a fixed gain to samples
+type GainFilter struct {
+	gain float64
+	max  float64
+}
+
+// NewGainFilter creates a new gain filter
+// Amplified samples are clamped to their significant bits so that they never overflow. If significantBits is <= 0,
+// samples are clamped to 32 bits.
+func NewGainFilter(gain float64, significantBits int) *GainFilter {
+	if significantBits <= 0 || significantBits > 32 {
+		significantBits = 32
+	}
+	return &GainFilter{
+		gain: gain,
+		max:  math.Pow(2, float64(significantBits-1)) - 1,
+	}
+}
+
+// Process implements the AudioFilter interface
+func (f *GainFilter) Process(samples []int32, sampleRate int) []int32 {
+	o := make([]int32, len(samples))
+	for idx, s := range samples {
+		v := float64(s) * f.gain
+		if v > f.max {
+			v = f.max
+		} else if v < -f.max {
+			v = -f.max
+		}
+		o[idx] = int32(v)
+	}
+	return o
+}
@@ -0,0 +1,85 @@
+package astiunderstanding
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighPassFilter(t *testing.T) {
+	// Constant offset
+	samples := make([]int32, 1600)
+	for idx := range samples {
+		samples[idx] = 1000
+	}
+
+	// Disabled filter leaves samples untouched
+	assert.Equal(t, samples, NewHighPassFilter(0).Process(samples, 16000))
+	assert.Equal(t, samples, NewHighPassFilter(100).Process(samples, 0))
+
+	// Constant offset is removed
+	o := NewHighPassFilter(100).Process(samples, 16000)
+	assert.Len(t, o, len(samples))
+	assert.InDelta(t, 962, o[0], 1)
+	assert.Equal(t, int32(0), o[len(o)-1])
+
+	// State is kept between calls
+	f := NewHighPassFilter(100)
+	assert.Equal(t, o, append(f.Process(samples[:800], 16000), f.Process(samples[800:], 16000)...))
+}
+
+func TestNoiseGateFilter(t *testing.T) {
+	// Steps and hold are 2 samples long
+	c := NoiseGateFilterConfiguration{HoldDuration: 2 * time.Millisecond, StepDuration: 2 * time.Millisecond, Threshold: 50}
+
+	// Quiet steps are muted once the hold is over and the last step may be shorter
+	f := NewNoiseGateFilter(c)
+	assert.Equal(t, []int32{100, -100, 1, 1, 0, 0, 100, 100, 1}, f.Process([]int32{100, -100, 1, 1, 1, 1, 100, 100, 1}, 1000))
+
+	// Hold is kept between calls
+	f = NewNoiseGateFilter(c)
+	assert.Equal(t, []int32{100, 100}, f.Process([]int32{100, 100}, 1000))
+	assert.Equal(t, []int32{1, 1, 0, 0}, f.Process([]int32{1, 1, 1, 1}, 1000))
+
+	// Default step duration is 10ms
+	f = NewNoiseGateFilter(NoiseGateFilterConfiguration{Threshold: 50})
+	assert.Equal(t, 10*time.Millisecond, f.c.StepDuration)
+
+	// Steps shorter than a sample leave samples untouched
+	assert.Equal(t, []int32{1, 1}, f.Process([]int32{1, 1}, 10))
+}
+
+func TestGainFilter(t *testing.T) {
+	// Amplified samples are clamped to their significant bits
+	assert.Equal(t, []int32{20, -20, 32767, -32767}, NewGainFilter(2, 16).Process([]int32{10, -10, 20000, -20000}, 16000))
+	assert.Equal(t, []int32{5, -5}, NewGainFilter(0.5, 16).Process([]int32{10, -10}, 16000))
+
+	// Invalid significant bits default to 32
+	assert.Equal(t, []int32{math.MaxInt32, -math.MaxInt32}, NewGainFilter(2, 0).Process([]int32{math.MaxInt32, math.MinInt32 + 1}, 16000))
+}
+
+func TestApplyAudioFilters(t *testing.T) {
+	// No filters
+	a := &Ability{afs: make(map[pipelineKey][]AudioFilter)}
+	k1, k2 := pipelineKey{source: "1"}, pipelineKey{source: "2"}
+	assert.Equal(t, []int32{1}, a.applyAudioFilters(k1, []int32{1}, 16000))
+
+	// Filters are applied in order
+	var created int
+	a.SetAudioFilters(func() []AudioFilter {
+		created++
+		return []AudioFilter{
+			NewGainFilter(2, 16),
+			AudioFilterFunc(func(samples []int32, sampleRate int) []int32 { return append(samples, int32(sampleRate)) }),
+		}
+	})
+	assert.Equal(t, []int32{2, 4, 16000}, a.applyAudioFilters(k1, []int32{1, 2}, 16000))
+
+	// Filter chains are created once per pipeline
+	a.applyAudioFilters(k1, []int32{1}, 16000)
+	assert.Equal(t, 1, created)
+	a.applyAudioFilters(k2, []int32{1}, 16000)
+	assert.Equal(t, 2, created)
+}
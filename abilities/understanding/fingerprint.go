@@ -0,0 +1,62 @@
+package astiunderstanding
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/asticode/go-astilog"
+)
+
+// FingerprintSpeechParserConfiguration represents a fingerprint speech parser configuration
+// Transcripts are the canned transcripts indexed by the fingerprint of the samples they're returned for, see
+// FingerprintSamples. Default is the transcript returned for unknown fingerprints, which are logged so that they can
+// be added to Transcripts.
+type FingerprintSpeechParserConfiguration struct {
+	Default     string            `toml:"default"`
+	Transcripts map[string]string `toml:"transcripts"`
+}
+
+// FingerprintSpeechParser represents a speech parser returning canned transcripts instead of recognizing audio.
+// Transcripts are deterministic which makes it suitable to test the understanding pipeline end to end, for instance
+// with a FileAudioSource.
+type FingerprintSpeechParser struct {
+	c FingerprintSpeechParserConfiguration
+}
+
+// NewFingerprintSpeechParser creates a new fingerprint speech parser
+func NewFingerprintSpeechParser(c FingerprintSpeechParserConfiguration) *FingerprintSpeechParser {
+	// Copy transcripts so that the configuration can't be changed once the parser has been created
+	ts := make(map[string]string)
+	for f, t := range c.Transcripts {
+		ts[f] = t
+	}
+	c.Transcripts = ts
+	return &FingerprintSpeechParser{c: c}
+}
+
+// FingerprintSamples returns the fingerprint of samples which is the hex encoded SHA-1 of the samples written as 32
+// bits little endian integers
+func FingerprintSamples(samples []int32) string {
+	h := sha1.New()
+	b := make([]byte, 4)
+	for _, s := range samples {
+		binary.LittleEndian.PutUint32(b, uint32(s))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SpeechToText implements the SpeechParser interface
+func (p *FingerprintSpeechParser) SpeechToText(samples []int32, sampleRate, significantBits int) (string, error) {
+	// Get fingerprint
+	f := FingerprintSamples(samples)
+
+	// Unknown fingerprint
+	t, ok := p.c.Transcripts[f]
+	if !ok {
+		astilog.Debugf("astiunderstanding: no transcript for fingerprint %s of %d samples", f, len(samples))
+		return p.c.Default, nil
+	}
+	return t, nil
+}
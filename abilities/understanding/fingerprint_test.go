@@ -0,0 +1,47 @@
+package astiunderstanding
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintSamples(t *testing.T) {
+	assert.Equal(t, "da39a3ee5e6b4b0d3255bfef95601890afd80709", FingerprintSamples(nil))
+	assert.Equal(t, "964f9aad8b635d5c6705bd9f3a6a1b7a3f0e7ad9", FingerprintSamples([]int32{1, -1, 256}))
+	assert.NotEqual(t, FingerprintSamples([]int32{1, -1, 256}), FingerprintSamples([]int32{256, -1, 1}))
+}
+
+func TestFingerprintSpeechParser(t *testing.T) {
+	// Create parser
+	c := FingerprintSpeechParserConfiguration{
+		Default:     "default",
+		Transcripts: map[string]string{FingerprintSamples([]int32{1, 2, 3}): "known"},
+	}
+	p := NewFingerprintSpeechParser(c)
+
+	// Configuration can't be changed once the parser has been created
+	c.Transcripts[FingerprintSamples([]int32{4})] = "changed"
+
+	// Known and unknown fingerprints
+	for _, v := range []struct {
+		expected string
+		samples  []int32
+	}{
+		{expected: "known", samples: []int32{1, 2, 3}},
+		{expected: "default", samples: []int32{3, 2, 1}},
+		{expected: "default", samples: []int32{4}},
+	} {
+		text, err := p.SpeechToText(v.samples, 16000, 16)
+		assert.NoError(t, err)
+		assert.Equal(t, v.expected, text)
+	}
+
+	// Transcripts are returned end to end for wav files
+	a, err := NewAbility(p, nil, AbilityConfiguration{})
+	assert.NoError(t, err)
+	text, err := a.TranscribeFile(context.Background(), writeWAVForTest(t, []int16{1, 2, 3}, 16000))
+	assert.NoError(t, err)
+	assert.Equal(t, "known", text)
+}
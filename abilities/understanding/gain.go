@@ -0,0 +1,65 @@
+package astiunderstanding
+
+import (
+	"math"
+)
+
+// agcSmoothing is the fraction of the gap between the current gain and the desired gain that is closed for each
+// buffer so that the gain doesn't pump from one buffer to the next
+const agcSmoothing = 0.2
+
+// rms returns the root mean square of samples
+func rms(samples []int32) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// applyGain applies the automatic gain control to samples and returns the amplified samples as well as the gain that
+// has been applied.
+// gain is the gain applied to the previous buffer of the pipeline, 0 meaning there's none yet. Amplified samples are
+// clamped to their significant bits so that they never clip.
+// It's a no-op returning 0 if AGCTargetLevel is <= 0.
+func (a *Ability) applyGain(samples []int32, significantBits int, gain float64) ([]int32, float64) {
+	// AGC is disabled
+	if a.c.AGCTargetLevel <= 0 {
+		return samples, 0
+	}
+
+	// Get full scale
+	if significantBits <= 0 || significantBits > 32 {
+		significantBits = 32
+	}
+	max := math.Pow(2, float64(significantBits-1)) - 1
+
+	// Get desired gain
+	// Buffers without any signal keep the previous gain
+	if gain <= 0 {
+		gain = 1
+	}
+	if v := rms(samples); v > 0 {
+		desired := a.c.AGCTargetLevel * max / v
+		if a.c.AGCMaxGain > 0 && desired > a.c.AGCMaxGain {
+			desired = a.c.AGCMaxGain
+		}
+		gain += (desired - gain) * agcSmoothing
+	}
+
+	// Apply gain
+	o := make([]int32, len(samples))
+	for idx, s := range samples {
+		v := float64(s) * gain
+		if v > max {
+			v = max
+		} else if v < -max {
+			v = -max
+		}
+		o[idx] = int32(v)
+	}
+	return o, gain
+}
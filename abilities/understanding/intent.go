@@ -0,0 +1,182 @@
+package astiunderstanding
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// IntentHandler represents the handler executed when a transcript matches an intent.
+// The context is cancelled once the ability is switched off, which happens when the brain shuts down.
+type IntentHandler func(ctx context.Context, i PayloadIntent) error
+
+// PayloadIntent represents an intent payload
+// Name is the name of the matched intent and Params are the named groups captured by its pattern. Both are empty when
+// no intent has matched.
+type PayloadIntent struct {
+	BrainName string            `json:"brain_name"`
+	Name      string            `json:"name,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Text      string            `json:"text"`
+	TraceID   string            `json:"trace_id,omitempty"`
+}
+
+// IntentRouter represents an object capable of routing transcripts to handlers
+// Patterns are matched in the order they've been registered and the first match wins.
+type IntentRouter struct {
+	m  sync.Mutex // Locks rs
+	rs []intentRoute
+}
+
+// intentRoute represents an intent route
+type intentRoute struct {
+	h    IntentHandler
+	name string
+	r    *regexp.Regexp
+}
+
+// valuesContext represents a context whose values are retrieved from another context
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+// Value implements the context.Context interface
+func (c valuesContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// NewIntentRouter creates a new intent router
+func NewIntentRouter() *IntentRouter {
+	return &IntentRouter{}
+}
+
+// Handle registers a handler executed when a transcript matches pattern.
+// pattern is a regular expression whose named groups, such as (?P<room>\w+), are provided as params. Transcripts are
+// trimmed and matched case insensitively.
+func (r *IntentRouter) Handle(name, pattern string, h IntentHandler) (err error) {
+	// Compile
+	var re *regexp.Regexp
+	if re, err = regexp.Compile("(?i)" + pattern); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: compiling pattern %s of intent %s failed", pattern, name)
+		return
+	}
+
+	// Add route
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.rs = append(r.rs, intentRoute{
+		h:    h,
+		name: name,
+		r:    re,
+	})
+	return
+}
+
+// match returns the first route matching text and its params
+func (r *IntentRouter) match(text string) (ir intentRoute, params map[string]string, ok bool) {
+	// Lock
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// Loop through routes
+	text = strings.TrimSpace(text)
+	for _, ir = range r.rs {
+		// Match
+		m := ir.r.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+
+		// Get params
+		for idx, n := range ir.r.SubexpNames() {
+			if len(n) == 0 {
+				continue
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[n] = m[idx]
+		}
+		ok = true
+		return
+	}
+	return
+}
+
+// SetIntentRouter sets the intent router that analysis texts are routed to.
+// An intent event is dispatched for each matched transcript and an intent unmatched event for the others.
+func (a *Ability) SetIntentRouter(r *IntentRouter) {
+	a.ir = r
+}
+
+// routeIntent routes an analysis text to its intent handler
+// ctx carries the span of the utterance, if any, and its trace id is provided in the payload.
+func (a *Ability) routeIntent(ctx context.Context, k pipelineKey, text string) {
+	// No intent router
+	if a.ir == nil {
+		return
+	}
+
+	// Create payload
+	p := PayloadIntent{
+		BrainName: k.brainName,
+		Source:    k.source,
+		Text:      text,
+		TraceID:   astibrain.TraceIDFromContext(ctx),
+	}
+
+	// Match
+	ir, params, ok := a.ir.match(text)
+	if !ok {
+		// Log
+		astilog.Debugf("astiunderstanding: no intent matches %s", text)
+
+		// Dispatch
+		if a.dispatchFunc != nil {
+			a.dispatchFunc(astibrain.Event{
+				AbilityName: name,
+				Name:        websocketEventNameIntentUnmatched,
+				Payload:     p,
+			})
+		}
+		return
+	}
+	p.Name, p.Params = ir.name, params
+
+	// Log
+	astilog.Debugf("astiunderstanding: %s matches intent %s", text, ir.name)
+
+	// Dispatch
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameIntent,
+			Payload:     p,
+		})
+	}
+
+	// Get context
+	// The handler's context is cancelled with the ability but carries the values, such as the span, of the utterance
+	a.am.Lock()
+	actx := a.actx
+	a.am.Unlock()
+	if actx == nil {
+		return
+	}
+	hctx := valuesContext{Context: actx, values: ctx}
+
+	// Execute handler
+	// Handlers are executed in a goroutine so that long running actions don't block the analyses
+	go func() {
+		if err := ir.h(hctx, p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: executing handler of intent %s failed", ir.name))
+		}
+	}()
+}
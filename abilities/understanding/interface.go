@@ -2,51 +2,72 @@ package astiunderstanding
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-
+	"strconv"
 	"strings"
+	"time"
 
 	"io/ioutil"
 
-	"context"
-
 	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astibob/brain"
 	"github.com/asticode/go-astilog"
-	"github.com/asticode/go-astitools/os"
 	"github.com/asticode/go-astiws"
 	"github.com/pkg/errors"
 )
 
 // Interface is the interface of the ability
 type Interface struct {
-	c               InterfaceConfiguration
-	dispatchFunc    astibob.DispatchFunc
-	onAnalysis      []AnalysisFunc
-	onSamplesStored []SamplesStoredFunc
+	c                InterfaceConfiguration
+	dispatchFunc     astibob.DispatchFunc
+	onAnalysis       []AnalysisFunc
+	onIntent         []IntentFunc
+	onSamplesStored  []SamplesStoredFunc
+	onSourceAnalysis []SourceAnalysisFunc
+	onSpeech         []SpeechFunc
+	s                *SamplesStore
 }
 
 // InterfaceConfiguration represents an interface configuration
 type InterfaceConfiguration struct {
-	SamplesDirectory string `toml:"samples_directory"`
+	SamplesDirectory string                                 `toml:"samples_directory"`
+	SamplesEncoding  astibrain.SamplesEncodingConfiguration `toml:"samples_encoding"`
 }
 
 // AnalysisFunc represents the callback executed upon receiving results of an analysis
 type AnalysisFunc func(analysisBrainName, audioBrainName, text string) error
 
+// IntentFunc represents the callback executed upon receiving an intent
+// Unmatched transcripts are received with an empty intent name.
+type IntentFunc func(analysisBrainName string, i PayloadIntent) error
+
 // PayloadSamples represents the samples payload
+// Source is the name of the input source the samples have been captured from. It must have been added to the
+// ability's sources, see SourceConfiguration.
 type PayloadSamples struct {
-	BrainName            string  `json:"brain_name"`
-	SampleRate           int     `json:"sample_rate"`
-	Samples              []int32 `json:"samples"`
-	SignificantBits      int     `json:"significant_bits"`
-	SilenceMaxAudioLevel float64 `json:"silence_max_audio_level"`
+	BrainName            string                    `json:"brain_name"`
+	EncodedSamples       *astibrain.EncodedSamples `json:"encoded_samples,omitempty"`
+	SampleRate           int                       `json:"sample_rate"`
+	Samples              []int32                   `json:"samples,omitempty"`
+	SignificantBits      int                       `json:"significant_bits"`
+	SilenceMaxAudioLevel float64                   `json:"silence_max_audio_level"`
+	Source               string                    `json:"source,omitempty"`
+	reconnected          bool                      // Set when an audio source has reconnected, see ErrAudioSourceReconnected
 }
 
 // SamplesStoredFunc represents the callback executed when samples have been stored
 type SamplesStoredFunc func(brainName, id, text string) error
 
+// SourceAnalysisFunc represents the callback executed upon receiving results of an analysis, along with the name of
+// the input source the samples have been captured from
+type SourceAnalysisFunc func(analysisBrainName, audioBrainName, source, text string) error
+
+// SpeechFunc represents the callback executed when the user starts or stops talking
+type SpeechFunc func(analysisBrainName, audioBrainName string, isSpeaking bool) error
+
 // NewInterface creates a new interface
 func NewInterface(c InterfaceConfiguration) (i *Interface, err error) {
 	// Create
@@ -62,6 +83,12 @@ func NewInterface(c InterfaceConfiguration) (i *Interface, err error) {
 			return
 		}
 	}
+
+	// Create samples store
+	if i.s, err = NewSamplesStore(SamplesStoreConfiguration{Directory: samplesToBeValidatedDirectory(i.c.SamplesDirectory)}); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: creating samples store failed")
+		return
+	}
 	return
 }
 
@@ -77,16 +104,43 @@ func (i *Interface) Name() string {
 
 // Samples creates a samples cmd
 func (i *Interface) Samples(brainName string, samples []int32, sampleRate, significantBits int, silenceMaxAudioLevel float64) *astibob.Cmd {
+	return i.SourceSamples(brainName, "", samples, sampleRate, significantBits, silenceMaxAudioLevel)
+}
+
+// SourceSamples creates a samples cmd for samples captured from a named input source
+func (i *Interface) SourceSamples(brainName, source string, samples []int32, sampleRate, significantBits int, silenceMaxAudioLevel float64) *astibob.Cmd {
+	// Create payload
+	p := PayloadSamples{
+		BrainName:            brainName,
+		SampleRate:           sampleRate,
+		SignificantBits:      significantBits,
+		SilenceMaxAudioLevel: silenceMaxAudioLevel,
+		Source:               source,
+	}
+
+	// Encode samples
+	var err error
+	if p.EncodedSamples, err = astibrain.EncodeSamples(samples, i.c.SamplesEncoding); err != nil {
+		astilog.Error(errors.Wrap(err, "astiunderstanding: encoding samples failed"))
+	}
+
+	// Samples have not been encoded
+	if p.EncodedSamples == nil {
+		p.Samples = samples
+	}
 	return &astibob.Cmd{
 		AbilityName: name,
 		EventName:   websocketEventNameSamples,
-		Payload: PayloadSamples{
-			BrainName:            brainName,
-			SampleRate:           sampleRate,
-			Samples:              samples,
-			SignificantBits:      significantBits,
-			SilenceMaxAudioLevel: silenceMaxAudioLevel,
-		},
+		Payload:     p,
+	}
+}
+
+// ListenOnce creates a cmd arming a one-shot capture on a brain whose ability has the ListenOnce option enabled.
+// Its transcript is received as an analysis.
+func (i *Interface) ListenOnce() *astibob.Cmd {
+	return &astibob.Cmd{
+		AbilityName: name,
+		EventName:   websocketEventNameListenOnce,
 	}
 }
 
@@ -95,11 +149,28 @@ func (i *Interface) OnAnalysis(fn AnalysisFunc) {
 	i.onAnalysis = append(i.onAnalysis, fn)
 }
 
+// OnIntent adds a callback executed upon receiving an intent, matched or not
+// The ability must have an intent router, see SetIntentRouter.
+func (i *Interface) OnIntent(fn IntentFunc) {
+	i.onIntent = append(i.onIntent, fn)
+}
+
 // OnSamplesStored adds a callback executed upon receiving notification that samples have been stored
 func (i *Interface) OnSamplesStored(fn SamplesStoredFunc) {
 	i.onSamplesStored = append(i.onSamplesStored, fn)
 }
 
+// OnSourceAnalysis adds a callback executed upon receiving an analysis, along with the name of its input source
+func (i *Interface) OnSourceAnalysis(fn SourceAnalysisFunc) {
+	i.onSourceAnalysis = append(i.onSourceAnalysis, fn)
+}
+
+// OnSpeech adds a callback executed when the user starts or stops talking.
+// The BargeIn option of the ability configuration must be enabled.
+func (i *Interface) OnSpeech(fn SpeechFunc) {
+	i.onSpeech = append(i.onSpeech, fn)
+}
+
 // onSamplesStoredDispatch is the samples stored callback for the dispatch
 func (i *Interface) onSamplesStoredDispatch(brainName, id, text string) error {
 	if i.dispatchFunc != nil {
@@ -111,8 +182,21 @@ func (i *Interface) onSamplesStoredDispatch(brainName, id, text string) error {
 // BrainWebsocketListeners implements the astibob.BrainWebsocketListener interface
 func (i *Interface) BrainWebsocketListeners() map[string]astibob.BrainWebsocketListenerFunc {
 	return map[string]astibob.BrainWebsocketListenerFunc{
-		websocketEventNameAnalysis:      i.brainWebsocketListenerAnalysis,
-		websocketEventNameSamplesStored: i.brainWebsocketListenerSamplesStored,
+		websocketEventNameAnalysis:        i.brainWebsocketListenerAnalysis,
+		websocketEventNameAnalysisDropped: i.brainWebsocketListenerAnalysisDropped,
+		websocketEventNameAnalysisError:   i.brainWebsocketListenerAnalysisError,
+		websocketEventNameAnalysisPartial: i.brainWebsocketListenerAnalysisPartial,
+		websocketEventNameAudioLevel:      i.brainWebsocketListenerAudioLevel,
+		websocketEventNameCircuitBreaker:  i.brainWebsocketListenerCircuitBreaker,
+		websocketEventNameIntent:          i.brainWebsocketListenerIntent(websocketEventNameIntent),
+		websocketEventNameIntentUnmatched: i.brainWebsocketListenerIntent(websocketEventNameIntentUnmatched),
+		websocketEventNameListeningState:  i.brainWebsocketListenerListeningState,
+		websocketEventNameSamplesStored:   i.brainWebsocketListenerSamplesStored,
+		websocketEventNameSamplesStoring:  i.brainWebsocketListenerSamplesStoring,
+		websocketEventNameSpeechDetected:  i.brainWebsocketListenerSpeech(true),
+		websocketEventNameSpeechEnded:     i.brainWebsocketListenerSpeech(false),
+		websocketEventNameSleep:           i.brainWebsocketListenerWake(websocketEventNameSleep),
+		websocketEventNameWakeWord:        i.brainWebsocketListenerWake(websocketEventNameWakeWord),
 	}
 }
 
@@ -126,12 +210,202 @@ func (i *Interface) brainWebsocketListenerAnalysis(brainName string) astiws.List
 			return nil
 		}
 
+		// Log
+		astilog.Debugf("astiunderstanding: brain %s has analyzed %d samples from brain %s in %dms", brainName, p.SampleCount, p.BrainName, p.DurationMs)
+
 		// Execute callbacks
 		for _, fn := range i.onAnalysis {
 			if err := fn(brainName, p.BrainName, p.Text); err != nil {
 				astilog.Error(errors.Wrap(err, "astiunderstanding: executing analysis callback failed"))
 			}
 		}
+		for _, fn := range i.onSourceAnalysis {
+			if err := fn(brainName, p.BrainName, p.Source, p.Text); err != nil {
+				astilog.Error(errors.Wrap(err, "astiunderstanding: executing source analysis callback failed"))
+			}
+		}
+		return nil
+	}
+}
+
+// brainWebsocketListenerAnalysisDropped listens to the analysis.dropped brain websocket event
+func (i *Interface) brainWebsocketListenerAnalysisDropped(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadAnalysisDropped
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Log
+		astilog.Errorf("astiunderstanding: speech parser of brain %s can't keep up, utterance from brain %s has been dropped", brainName, p.BrainName)
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: websocketEventNameAnalysisDropped, Payload: p})
+		}
+		return nil
+	}
+}
+
+// brainWebsocketListenerAnalysisError listens to the analysis.error brain websocket event
+func (i *Interface) brainWebsocketListenerAnalysisError(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadAnalysisError
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Get message
+		m := "Analysis of samples from brain " + p.BrainName
+		if len(p.Source) > 0 {
+			m += " (source " + p.Source + ")"
+		}
+		m += " failed"
+		if len(p.Reason) > 0 {
+			m += " (" + p.Reason + ")"
+		}
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: "error", Payload: m})
+		}
+		return nil
+	}
+}
+
+// brainWebsocketListenerAnalysisPartial listens to the analysis.partial brain websocket event
+func (i *Interface) brainWebsocketListenerAnalysisPartial(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadAnalysis
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: websocketEventNameAnalysisPartial, Payload: p})
+		}
+		return nil
+	}
+}
+
+// brainWebsocketListenerListeningState listens to the listening.state brain websocket event
+func (i *Interface) brainWebsocketListenerListeningState(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadListeningState
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: websocketEventNameListeningState, Payload: p})
+		}
+		return nil
+	}
+}
+
+// brainWebsocketListenerAudioLevel listens to the audio.level brain websocket event
+func (i *Interface) brainWebsocketListenerAudioLevel(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadAudioLevel
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: websocketEventNameAudioLevel, Payload: p})
+		}
+		return nil
+	}
+}
+
+// brainWebsocketListenerCircuitBreaker listens to the circuit.breaker brain websocket event
+func (i *Interface) brainWebsocketListenerCircuitBreaker(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadCircuitBreaker
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Log
+		if p.State == CircuitBreakerStateOpen {
+			astilog.Errorf("astiunderstanding: speech parser circuit of brain %s is open, running in degraded mode", brainName)
+		} else {
+			astilog.Infof("astiunderstanding: speech parser circuit of brain %s is %s", brainName, p.State)
+		}
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: websocketEventNameCircuitBreaker, Payload: PayloadCircuitBreakerClient{
+				BrainName: brainName,
+				State:     p.State,
+			}})
+		}
+		return nil
+	}
+}
+
+// PayloadCircuitBreakerClient represents a circuit breaker client payload
+type PayloadCircuitBreakerClient struct {
+	BrainName string `json:"brain_name"`
+	State     string `json:"state"`
+}
+
+// brainWebsocketListenerIntent listens to the intent and intent.unmatched brain websocket events
+func (i *Interface) brainWebsocketListenerIntent(clientEventName string) astibob.BrainWebsocketListenerFunc {
+	return func(brainName string) astiws.ListenerFunc {
+		return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			// Unmarshal payload
+			var p PayloadIntent
+			if err := json.Unmarshal(payload, &p); err != nil {
+				astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+				return nil
+			}
+
+			// Execute callbacks
+			for _, fn := range i.onIntent {
+				if err := fn(brainName, p); err != nil {
+					astilog.Error(errors.Wrap(err, "astiunderstanding: executing intent callback failed"))
+				}
+			}
+
+			// Dispatch to clients
+			if i.dispatchFunc != nil {
+				i.dispatchFunc(astibob.ClientEvent{Name: clientEventName, Payload: p})
+			}
+			return nil
+		}
+	}
+}
+
+// brainWebsocketListenerSamplesStoring listens to the samples.storing brain websocket event
+func (i *Interface) brainWebsocketListenerSamplesStoring(brainName string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal payload
+		var p PayloadSamplesStoring
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, p))
+			return nil
+		}
+
+		// Dispatch to clients
+		if i.dispatchFunc != nil {
+			i.dispatchFunc(astibob.ClientEvent{Name: websocketEventNameSamplesStoring, Payload: p})
+		}
 		return nil
 	}
 }
@@ -156,6 +430,48 @@ func (i *Interface) brainWebsocketListenerSamplesStored(brainName string) astiws
 	}
 }
 
+// brainWebsocketListenerSpeech listens to the speech.detected and speech.ended brain websocket events
+func (i *Interface) brainWebsocketListenerSpeech(isSpeaking bool) astibob.BrainWebsocketListenerFunc {
+	return func(brainName string) astiws.ListenerFunc {
+		return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			// Unmarshal payload
+			var audioBrainName string
+			if err := json.Unmarshal(payload, &audioBrainName); err != nil {
+				astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, audioBrainName))
+				return nil
+			}
+
+			// Execute callbacks
+			for _, fn := range i.onSpeech {
+				if err := fn(brainName, audioBrainName, isSpeaking); err != nil {
+					astilog.Error(errors.Wrap(err, "astiunderstanding: executing speech callback failed"))
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// brainWebsocketListenerWake listens to the wake.word and sleep brain websocket events
+func (i *Interface) brainWebsocketListenerWake(clientEventName string) astibob.BrainWebsocketListenerFunc {
+	return func(brainName string) astiws.ListenerFunc {
+		return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			// Unmarshal payload
+			var audioBrainName string
+			if err := json.Unmarshal(payload, &audioBrainName); err != nil {
+				astilog.Error(errors.Wrapf(err, "astiunderstanding: json unmarshaling %s into %#v failed", payload, audioBrainName))
+				return nil
+			}
+
+			// Dispatch to clients
+			if i.dispatchFunc != nil {
+				i.dispatchFunc(astibob.ClientEvent{Name: clientEventName, Payload: audioBrainName})
+			}
+			return nil
+		}
+	}
+}
+
 // APIHandlers implements the astibob.APIHandle interface
 func (i *Interface) APIHandlers() map[string]http.Handler {
 	return map[string]http.Handler{
@@ -166,34 +482,18 @@ func (i *Interface) APIHandlers() map[string]http.Handler {
 // apiHandlerIndex handles the index api request
 func (i *Interface) apiHandlerIndex() http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		// Walk folder
-		ss := []PayloadStoredSamples{}
-		root := samplesToBeValidatedDirectory(i.c.SamplesDirectory)
-		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-			// Process error
-			if err != nil {
-				return err
-			}
-
-			// Only process wav files
-			if info.IsDir() || !strings.HasSuffix(path, ".wav") {
-				return nil
-			}
-
-			// Get id
-			id := strings.TrimSuffix(strings.TrimPrefix(path, root), ".wav")
-
-			// Read txt file
-			txtPath := strings.TrimSuffix(path, ".wav") + ".txt"
-			var text []byte
-			if text, err = ioutil.ReadFile(txtPath); err != nil {
-				return errors.Wrapf(err, "reading %s failed", txtPath)
-			}
+		// List stored samples
+		l, err := i.s.List()
+		if err != nil {
+			astibob.APIWriteError(rw, http.StatusInternalServerError, errors.Wrap(err, "astiunderstanding: listing stored samples failed"))
+			return
+		}
 
-			// Append
-			ss = append(ss, newPayloadStoredSamples(id, string(text)))
-			return nil
-		})
+		// Create payload
+		ss := []PayloadStoredSamples{}
+		for _, m := range l {
+			ss = append(ss, newPayloadStoredSamples(m.ID, m.Text))
+		}
 
 		// Write
 		astibob.APIWrite(rw, ss)
@@ -238,9 +538,10 @@ func (i *Interface) ClientWebsocketListenerHandleSamples(reward string) astiws.L
 			}
 
 			// Copy wav file
-			var src, dst = filepath.Join(samplesToBeValidatedDirectory(i.c.SamplesDirectory), p.ID+".wav"), filepath.Join(samplesValidatedDirectory(i.c.SamplesDirectory), p.ID+".wav")
-			if err = astios.Copy(context.Background(), src, dst); err != nil {
-				err = errors.Wrapf(err, "astiunderstanding: copying %s to %s failed", src, dst)
+			// Validated samples are always uncompressed so that they can be used for training as is
+			var dst = filepath.Join(samplesValidatedDirectory(i.c.SamplesDirectory), p.ID+".wav")
+			if err = i.copyWav(p.ID, dst); err != nil {
+				err = errors.Wrapf(err, "astiunderstanding: copying wav of %s to %s failed", p.ID, dst)
 				return nil
 			}
 
@@ -252,15 +553,10 @@ func (i *Interface) ClientWebsocketListenerHandleSamples(reward string) astiws.L
 			}
 		}
 
-		// Remove files
-		for _, p := range []string{
-			filepath.Join(samplesToBeValidatedDirectory(i.c.SamplesDirectory), p.ID+".wav"),
-			filepath.Join(samplesToBeValidatedDirectory(i.c.SamplesDirectory), p.ID+".txt"),
-		} {
-			if err = os.Remove(p); err != nil {
-				err = errors.Wrapf(err, "astiunderstanding: removing %s failed", p)
-				return nil
-			}
+		// Remove stored samples
+		if err = i.s.Remove(p.ID); err != nil {
+			err = errors.Wrapf(err, "astiunderstanding: removing stored samples %s failed", p.ID)
+			return nil
 		}
 
 		// Dispatch to clients
@@ -271,13 +567,84 @@ func (i *Interface) ClientWebsocketListenerHandleSamples(reward string) astiws.L
 	}
 }
 
+// copyWav copies the stored samples as a wav file
+func (i *Interface) copyWav(id, dst string) (err error) {
+	// Open stored samples
+	var rc io.ReadCloser
+	if rc, _, err = i.s.Open(id); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: opening stored samples %s failed", id)
+		return
+	}
+	defer rc.Close()
+
+	// Create dir
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: mkdirall %s failed", filepath.Dir(dst))
+		return
+	}
+
+	// Create destination
+	var f *os.File
+	if f, err = os.Create(dst); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: creating %s failed", dst)
+		return
+	}
+	defer f.Close()
+
+	// Copy
+	if _, err = io.Copy(f, rc); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: copying to %s failed", dst)
+		return
+	}
+	return
+}
+
 // StaticHandlers implements the astibob.StaticHandler interface
 func (i *Interface) StaticHandlers() map[string]http.Handler {
 	return map[string]http.Handler{
-		"/samples": http.FileServer(http.Dir(samplesToBeValidatedDirectory(i.c.SamplesDirectory))),
+		"/samples": i.staticHandlerSamples(),
 	}
 }
 
+// staticHandlerSamples serves the stored samples as wav files.
+// Compressed samples are decompressed on the fly.
+func (i *Interface) staticHandlerSamples() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Get id
+		// The path has been stripped from the handler pattern
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".wav")
+		if len(id) == 0 || strings.Contains(id, "..") {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// Open stored samples
+		rc, size, err := i.s.Open(id)
+		if err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: opening stored samples %s failed", id))
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		defer rc.Close()
+
+		// Serve
+		// Range requests are handled so that audio players can seek: out of bounds ranges are clamped and
+		// unsatisfiable ones get a 416
+		rw.Header().Set("Content-Type", "audio/wav")
+		if rs, ok := rc.(io.ReadSeeker); ok {
+			http.ServeContent(rw, r, id+".wav", time.Time{}, rs)
+			return
+		}
+
+		// Write
+		rw.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		if _, err = io.Copy(rw, rc); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: writing stored samples %s failed", id))
+			return
+		}
+	})
+}
+
 // WebTemplates implements the astibob.WebTemplater interface
 func (i *Interface) WebTemplates() map[string]string {
 	return map[string]string{
@@ -290,6 +657,8 @@ func (i *Interface) webTemplateIndex() string {
 	return `{{ define "title" }}Understanding{{ end }}
 {{ define "css" }}{{ end }}
 {{ define "html" }}
+	<div class="header">Live transcript</div>
+	<p id="analysis-partial"></p>
 	<div class="header">Validate samples</div>
 	<p>Listen to the audio, write the transcript and press "Enter" to validate or "Ctrl+Enter" to remove.</p>
 	<div class="flex" id="samples-to-be-validated"></div>
@@ -388,6 +757,12 @@ func (i *Interface) webTemplateIndex() string {
 		},
     	websocketFunc: function(event_name, payload) {
 			switch (event_name) {
+				case base.abilityWebsocketEventName("analysis.partial"):
+					$("#analysis-partial").text(payload.text);
+					break;
+				case base.abilityWebsocketEventName("wake.word"):
+					asticode.notifier.info("Listening to " + payload);
+					break;
 				case base.abilityWebsocketEventName("error"):
 					// Display message
 					asticode.notifier.error(payload);
@@ -0,0 +1,83 @@
+package astiunderstanding
+
+import (
+	"math"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astitools/audio"
+)
+
+// PayloadAudioLevel represents an audio level payload.
+// Levels are normalized between 0 and 1 based on the significant bits of the samples.
+// Gain is the gain applied by the automatic gain control, if enabled.
+type PayloadAudioLevel struct {
+	BrainName       string  `json:"brain_name"`
+	Gain            float64 `json:"gain,omitempty"`
+	Level           float64 `json:"level"`
+	SilenceMaxLevel float64 `json:"silence_max_level"`
+	Source          string  `json:"source,omitempty"`
+}
+
+// audioLevel represents the audio level of a pipeline since the last audio level event
+type audioLevel struct {
+	at   time.Time
+	peak float64
+}
+
+// normalizeAudioLevel normalizes an audio level between 0 and 1
+func normalizeAudioLevel(l float64, significantBits int) float64 {
+	if significantBits <= 0 || significantBits > 32 {
+		significantBits = 32
+	}
+	if l = l / math.Pow(2, float64(significantBits-1)); l > 1 {
+		return 1
+	}
+	return l
+}
+
+// meterAudioLevel dispatches the peak audio level received since the last audio level event at most once per
+// AudioLevelInterval.
+// It must only be called in Run.
+func (a *Ability) meterAudioLevel(k pipelineKey, p PayloadSamples) {
+	// Metering is disabled
+	if a.c.AudioLevelInterval <= 0 {
+		return
+	}
+
+	// Get audio level
+	l, ok := a.als[k]
+	if !ok {
+		l = &audioLevel{}
+		a.als[k] = l
+	}
+
+	// Update peak
+	if v := astiaudio.AudioLevel(p.Samples); v > l.peak {
+		l.peak = v
+	}
+
+	// Throttle
+	if time.Since(l.at) < a.c.AudioLevelInterval {
+		return
+	}
+
+	// Dispatch
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameAudioLevel,
+			Payload: PayloadAudioLevel{
+				BrainName:       p.BrainName,
+				Gain:            a.gs[k],
+				Level:           normalizeAudioLevel(l.peak, p.SignificantBits),
+				SilenceMaxLevel: normalizeAudioLevel(p.SilenceMaxAudioLevel, p.SignificantBits),
+				Source:          p.Source,
+			},
+		})
+	}
+
+	// Reset
+	l.at = time.Now()
+	l.peak = 0
+}
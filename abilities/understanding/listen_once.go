@@ -0,0 +1,159 @@
+package astiunderstanding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+)
+
+// Listen once errors
+var (
+	// ErrListenOnceDisabled is the error returned when arming a one-shot capture while the ListenOnce option is disabled
+	ErrListenOnceDisabled = errors.New("astiunderstanding: listen once is disabled")
+	// ErrUtteranceDropped is the error returned when the utterance of a one-shot capture has been dropped before being
+	// analyzed
+	ErrUtteranceDropped = errors.New("astiunderstanding: utterance has been dropped")
+)
+
+// listenOnceResult represents the result of a one-shot capture
+type listenOnceResult struct {
+	err error
+	p   PayloadAnalysis
+}
+
+// ListenOnce arms a one-shot capture and waits for its transcript.
+// It returns ErrListenOnceDisabled if the ListenOnce option is disabled. Otherwise samples are ignored until a one-shot
+// capture is armed. The capture is disarmed once the first utterance has been analyzed, and the resulting analysis,
+// whose text may be empty, is returned to every caller waiting for it. If the analysis fails, is aborted or if the
+// utterance is dropped by the analysis queue, the error is returned instead.
+func (a *Ability) ListenOnce(ctx context.Context) (p PayloadAnalysis, err error) {
+	// Listen once is disabled
+	if !a.c.ListenOnce {
+		err = ErrListenOnceDisabled
+		return
+	}
+
+	// Arm
+	ch := make(chan listenOnceResult, 1)
+	a.om.Lock()
+	a.oa = true
+	a.ows = append(a.ows, ch)
+	a.om.Unlock()
+
+	// Wait
+	select {
+	case r := <-ch:
+		p, err = r.p, r.err
+	case <-ctx.Done():
+		a.cancelListenOnce(ch)
+		err = errors.Wrap(ctx.Err(), "astiunderstanding: context error")
+	}
+	return
+}
+
+// armListenOnce arms a one-shot capture without waiting for its transcript
+func (a *Ability) armListenOnce() {
+	a.om.Lock()
+	defer a.om.Unlock()
+	a.oa = true
+}
+
+// cancelListenOnce removes a caller waiting for a one-shot capture
+// The capture remains armed for the other callers.
+func (a *Ability) cancelListenOnce(ch chan listenOnceResult) {
+	a.om.Lock()
+	defer a.om.Unlock()
+	for idx, w := range a.ows {
+		if w == ch {
+			a.ows = append(a.ows[:idx], a.ows[idx+1:]...)
+			break
+		}
+	}
+}
+
+// isListening returns whether samples have to be analyzed
+func (a *Ability) isListening() bool {
+	// Listen once is disabled
+	if !a.c.ListenOnce {
+		return true
+	}
+
+	// Check whether a one-shot capture is armed
+	a.om.Lock()
+	defer a.om.Unlock()
+	return a.oa
+}
+
+// listenedOnce disarms the one-shot capture and provides its result to the callers waiting for it
+func (a *Ability) listenedOnce(r listenOnceResult) {
+	// Listen once is disabled
+	if !a.c.ListenOnce {
+		return
+	}
+
+	// Lock
+	a.om.Lock()
+	defer a.om.Unlock()
+
+	// No one-shot capture is armed
+	if !a.oa {
+		return
+	}
+
+	// Disarm
+	a.oa = false
+	for _, ch := range a.ows {
+		ch <- r
+	}
+	a.ows = nil
+}
+
+// HTTPHandler implements the astibrain.HTTPHandler interface
+func (a *Ability) HTTPHandler() (string, http.Handler) {
+	return "/listen-once", http.HandlerFunc(a.httpHandlerListenOnce)
+}
+
+// httpHandlerListenOnce arms a one-shot capture and writes its analysis once it's available
+func (a *Ability) httpHandlerListenOnce(rw http.ResponseWriter, r *http.Request) {
+	// Check method
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Listen once
+	p, err := a.ListenOnce(r.Context())
+	if err == ErrListenOnceDisabled {
+		rw.WriteHeader(http.StatusConflict)
+		return
+	} else if err != nil {
+		astilog.Error(errors.Wrap(err, "astiunderstanding: listening once failed"))
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Write
+	rw.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(rw).Encode(p); err != nil {
+		astilog.Error(errors.Wrap(err, "astiunderstanding: writing analysis failed"))
+		return
+	}
+}
+
+// websocketListenerListenOnce listens to the listen once websocket event
+// The transcript is dispatched as an analysis event.
+func (a *Ability) websocketListenerListenOnce(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	// Listen once is disabled
+	if !a.c.ListenOnce {
+		astilog.Error(ErrListenOnceDisabled)
+		return nil
+	}
+
+	// Arm
+	a.armListenOnce()
+	return nil
+}
@@ -0,0 +1,34 @@
+package astiunderstanding
+
+import (
+	"fmt"
+	"time"
+)
+
+// PlaceholderSpeechParser represents a speech parser returning a placeholder text instead of recognizing audio so that
+// the rest of the pipeline, such as silence detection, storage and intents, can be exercised without a real speech
+// parser.
+// If Text is empty, the placeholder is the duration of the samples.
+type PlaceholderSpeechParser struct {
+	Text string
+}
+
+// NewPlaceholderSpeechParser creates a new placeholder speech parser
+func NewPlaceholderSpeechParser(text string) *PlaceholderSpeechParser {
+	return &PlaceholderSpeechParser{Text: text}
+}
+
+// SpeechToText implements the SpeechParser interface
+func (p *PlaceholderSpeechParser) SpeechToText(samples []int32, sampleRate, significantBits int) (string, error) {
+	// Text has been set
+	if len(p.Text) > 0 {
+		return p.Text, nil
+	}
+
+	// Get duration
+	var d time.Duration
+	if sampleRate > 0 {
+		d = time.Duration(int64(len(samples)) * int64(time.Second) / int64(sampleRate))
+	}
+	return fmt.Sprintf("<%s of speech>", d), nil
+}
@@ -0,0 +1,116 @@
+package astiunderstanding
+
+import (
+	"context"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+)
+
+// Analysis queue policies
+const (
+	// AnalysisQueuePolicyBlock blocks the samples feed until there's room in the queue
+	AnalysisQueuePolicyBlock = "block"
+	// AnalysisQueuePolicyDropOldest drops the oldest pending utterance
+	AnalysisQueuePolicyDropOldest = "drop.oldest"
+)
+
+// PayloadAnalysisDropped represents an analysis dropped payload
+type PayloadAnalysisDropped struct {
+	BrainName string `json:"brain_name"`
+	QueueSize int    `json:"queue_size"`
+	Source    string `json:"source,omitempty"`
+}
+
+// queuedSamples represents an utterance waiting to be parsed
+type queuedSamples struct {
+	ctx             context.Context // Carries the span of the utterance
+	sampleRate      int
+	samples         []int32
+	significantBits int
+}
+
+// enqueueSamples adds an utterance to the analysis queue of its pipeline while applying the queue policy and returns
+// whether a new analysis has to be scheduled.
+// When the oldest utterance is dropped, the analysis scheduled for it processes the new utterance instead.
+// The span of utterances that won't be analyzed is ended and the one-shot capture, if any, fails with ErrUtteranceDropped.
+func (a *Ability) enqueueSamples(ctx context.Context, k pipelineKey, s queuedSamples) bool {
+	// Lock
+	a.qm.Lock()
+
+	// Queue is not bounded
+	if a.c.AnalysisQueueSize <= 0 {
+		a.qs[k] = append(a.qs[k], s)
+		a.qm.Unlock()
+		return true
+	}
+
+	// Queue is full
+	if len(a.qs[k]) >= a.c.AnalysisQueueSize {
+		switch a.c.AnalysisQueuePolicy {
+		case AnalysisQueuePolicyBlock:
+			// Wait for the queue to be processed
+			for len(a.qs[k]) >= a.c.AnalysisQueueSize && ctx.Err() == nil {
+				a.qc.Wait()
+			}
+
+			// Context is done
+			if ctx.Err() != nil {
+				a.qm.Unlock()
+				astibrain.SpanFromContext(s.ctx).End()
+				a.listenedOnce(listenOnceResult{err: ErrUtteranceDropped})
+				return false
+			}
+		default:
+			// Drop oldest
+			d := a.qs[k][0]
+			a.qs[k] = append(a.qs[k][1:], s)
+			a.qm.Unlock()
+			astibrain.SpanFromContext(d.ctx).End()
+			a.listenedOnce(listenOnceResult{err: ErrUtteranceDropped})
+
+			// Dispatch
+			astilog.Debugf("astiunderstanding: analysis queue is full, dropping utterance from brain %s", k.brainName)
+			if a.dispatchFunc != nil {
+				a.dispatchFunc(astibrain.Event{
+					AbilityName: name,
+					Name:        websocketEventNameAnalysisDropped,
+					Payload: PayloadAnalysisDropped{
+						BrainName: k.brainName,
+						QueueSize: a.c.AnalysisQueueSize,
+						Source:    k.source,
+					},
+				})
+			}
+			return false
+		}
+	}
+
+	// Append
+	a.qs[k] = append(a.qs[k], s)
+	a.qm.Unlock()
+	return true
+}
+
+// dequeueSamples removes the oldest utterance from the analysis queue of a pipeline
+func (a *Ability) dequeueSamples(k pipelineKey) (s queuedSamples, ok bool) {
+	a.qm.Lock()
+	defer a.qm.Unlock()
+	if len(a.qs[k]) == 0 {
+		return
+	}
+	s, ok = a.qs[k][0], true
+	if a.qs[k] = a.qs[k][1:]; len(a.qs[k]) == 0 {
+		delete(a.qs, k)
+	}
+	a.qc.Broadcast()
+	return
+}
+
+// unblockQueue wakes up the samples feed blocked on the analysis queue once the context is done
+func (a *Ability) unblockQueue(ctx context.Context) {
+	<-ctx.Done()
+	a.qm.Lock()
+	a.qc.Broadcast()
+	a.qm.Unlock()
+}
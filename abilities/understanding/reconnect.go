@@ -0,0 +1,126 @@
+package astiunderstanding
+
+import (
+	"context"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/pkg/errors"
+)
+
+// ErrAudioSourceReconnected is the error audio sources return from Read once they have reconnected, which tells the
+// ability that the audio received before and after the reconnection is not contiguous.
+// The audio source is read again right away.
+var ErrAudioSourceReconnected = errors.New("astiunderstanding: audio source has reconnected")
+
+// FlushableSilenceDetector represents a silence detector capable of returning the speech samples it has buffered for
+// the utterance in progress
+// Flush must empty the buffer but doesn't have to reset the rest of the silence detector state since Reset is called
+// right after.
+type FlushableSilenceDetector interface {
+	SilenceDetector
+	Flush() [][]int32
+}
+
+// PayloadSourceReconnected represents a source reconnected payload
+// FlushedSegments is the number of utterances that were buffered by the silence detector when the source reconnected
+// and have been processed as if the speech was over.
+type PayloadSourceReconnected struct {
+	BrainName       string `json:"brain_name"`
+	FlushedSegments int    `json:"flushed_segments"`
+	Source          string `json:"source,omitempty"`
+}
+
+// sourceReconnected flushes the pipeline's silence detector, processes the utterance it had buffered and resets it
+// so that audio received after the reconnection is not appended to audio received before it.
+// It must only be called in Run.
+func (a *Ability) sourceReconnected(ctx context.Context, k pipelineKey, p PayloadSamples, bp BatchSpeechParser, isBatch bool) {
+	// Get silence detector
+	a.m.Lock()
+	sd, ok := a.sds[k]
+	a.m.Unlock()
+
+	// Flush and reset silence detector
+	var speechSamples [][]int32
+	if ok {
+		if v, ok := sd.(FlushableSilenceDetector); ok {
+			speechSamples = nonEmptyUtterances(v.Flush())
+		}
+		sd.Reset()
+		a.dispatchListeningState(k, sd)
+	}
+
+	// Drop the incomplete trailing frame received before the source disconnected
+	delete(a.dms, k)
+
+	// Dispatch
+	a.dispatchSourceReconnected(k, len(speechSamples))
+
+	// Check whether brain is awake
+	// Wake word timeouts are checked the next time samples are received
+	isAwake := a.isListening()
+	if a.wd != nil {
+		if _, ok := a.wds[k]; !ok {
+			isAwake = false
+		}
+	}
+
+	// Speech is over
+	if ok && a.c.BargeIn {
+		a.detectSpeech(k, sd, p, isAwake, speechSamples)
+	}
+
+	// Close ongoing stream
+	// Its samples have already been streamed
+	if s, ok := a.ss[k]; ok {
+		s.close(speechSamples, false)
+		delete(a.ss, k)
+		return
+	}
+
+	// Brain is not awake or parser can stream
+	if _, ok := a.p.(StreamingSpeechParser); ok || !isAwake {
+		return
+	}
+
+	// Process samples
+	for _, samples := range a.boundUtterances(speechSamples, p.SampleRate) {
+		if isBatch {
+			a.batchSamples(ctx, bp, k, samples, p.SampleRate, p.SignificantBits)
+		} else {
+			a.processSamples(ctx, k, samples, p.SampleRate, p.SignificantBits)
+		}
+	}
+}
+
+// dispatchSourceReconnected dispatches a source reconnected event
+func (a *Ability) dispatchSourceReconnected(k pipelineKey, flushedSegments int) {
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameSourceReconnected,
+			Payload: PayloadSourceReconnected{
+				BrainName:       k.brainName,
+				FlushedSegments: flushedSegments,
+				Source:          k.source,
+			},
+		})
+	}
+}
+
+// Flush implements the FlushableSilenceDetector interface
+func (d *AdaptiveSilenceDetector) Flush() (validSamples [][]int32) {
+	if len(d.speechSamples) > 0 {
+		validSamples = append(validSamples, d.speechSamples)
+		d.speechSamples = []int32{}
+	}
+	return
+}
+
+// Flush implements the FlushableSilenceDetector interface
+func (d *stepSilenceDetector) Flush() (validSamples [][]int32) {
+	if len(d.speechSamples) > 0 {
+		validSamples = append(validSamples, d.speechSamples)
+		d.speechSamples = []int32{}
+	}
+	return
+}
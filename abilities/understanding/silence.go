@@ -0,0 +1,200 @@
+package astiunderstanding
+
+import (
+	"sort"
+	"time"
+
+	"github.com/asticode/go-astitools/audio"
+)
+
+// Noise floor percentile
+const adaptiveSilenceDetectorNoiseFloorPercentile = 0.2
+
+// AdaptiveSilenceDetector represents a silence detector whose threshold adapts to the ambient noise.
+// The threshold is computed as an offset above a noise floor tracked over a rolling window of audio levels.
+type AdaptiveSilenceDetector struct {
+	buf           []int32
+	c             AdaptiveSilenceDetectorConfiguration
+	levels        []float64
+	preRoll       []int32
+	silenceSteps  int
+	speechSamples []int32
+}
+
+// AdaptiveSilenceDetectorConfiguration represents an adaptive silence detector configuration
+// AdaptationWindow is the duration of the audio levels history used to compute the noise floor.
+// MinSilenceDuration is the duration of silence needed to consider speech is over.
+// PreRollDuration is the duration of the audio kept before speech is detected and prepended to valid samples so that
+// the first phoneme is not clipped. If 0, no audio is prepended.
+// ThresholdOffset is added to the noise floor to compute the threshold. If 0, the silenceMaxAudioLevel provided to Add is used instead.
+type AdaptiveSilenceDetectorConfiguration struct {
+	AdaptationWindow   time.Duration `toml:"adaptation_window"`
+	MinSilenceDuration time.Duration `toml:"min_silence_duration"`
+	PreRollDuration    time.Duration `toml:"pre_roll_duration"`
+	StepDuration       time.Duration `toml:"step_duration"`
+	ThresholdOffset    float64       `toml:"threshold_offset"`
+}
+
+// NewAdaptiveSilenceDetector creates a new adaptive silence detector
+func NewAdaptiveSilenceDetector(c AdaptiveSilenceDetectorConfiguration) (d *AdaptiveSilenceDetector) {
+	// Create
+	d = &AdaptiveSilenceDetector{c: c}
+
+	// Default configuration values
+	if d.c.AdaptationWindow <= 0 {
+		d.c.AdaptationWindow = 10 * time.Second
+	}
+	if d.c.MinSilenceDuration <= 0 {
+		d.c.MinSilenceDuration = time.Second
+	}
+	if d.c.StepDuration <= 0 {
+		d.c.StepDuration = 30 * time.Millisecond
+	}
+	return
+}
+
+// Add implements the SilenceDetector interface
+func (d *AdaptiveSilenceDetector) Add(samples []int32, sampleRate int, silenceMaxAudioLevel float64) (validSamples [][]int32) {
+	// Get step size
+	stepSize := int(int64(sampleRate) * int64(d.c.StepDuration) / int64(time.Second))
+	if stepSize <= 0 {
+		return
+	}
+
+	// Get offset
+	offset := d.c.ThresholdOffset
+	if offset == 0 {
+		offset = silenceMaxAudioLevel
+	}
+
+	// Get max number of levels and silence steps
+	maxLevels := int(d.c.AdaptationWindow / d.c.StepDuration)
+	minSilenceSteps := int(d.c.MinSilenceDuration / d.c.StepDuration)
+
+	// Get pre roll size
+	preRollSize := int(int64(sampleRate) * int64(d.c.PreRollDuration) / int64(time.Second))
+
+	// Loop through steps
+	d.buf = append(d.buf, samples...)
+	for len(d.buf) >= stepSize {
+		// Get step
+		step := d.buf[:stepSize]
+		d.buf = d.buf[stepSize:]
+
+		// Compare the level to the threshold computed before adding the level to the history so that the step is not
+		// compared to itself
+		level := astiaudio.AudioLevel(step)
+		isSilence := level <= d.noiseFloor()+offset
+
+		// Add level to history
+		d.levels = append(d.levels, level)
+		if len(d.levels) > maxLevels {
+			d.levels = d.levels[len(d.levels)-maxLevels:]
+		}
+
+		// Silence before speech
+		// It's kept in the pre roll buffer
+		if isSilence && len(d.speechSamples) == 0 {
+			if preRollSize > 0 {
+				d.preRoll = append(d.preRoll, step...)
+				if len(d.preRoll) > preRollSize {
+					d.preRoll = d.preRoll[len(d.preRoll)-preRollSize:]
+				}
+			}
+			continue
+		}
+
+		// Speech starts
+		// The pre roll buffer is prepended
+		if len(d.speechSamples) == 0 && len(d.preRoll) > 0 {
+			d.speechSamples = append(d.speechSamples, d.preRoll...)
+			d.preRoll = []int32{}
+		}
+
+		// Append step
+		d.speechSamples = append(d.speechSamples, step...)
+
+		// Update silence steps
+		if !isSilence {
+			d.silenceSteps = 0
+			continue
+		}
+		d.silenceSteps++
+
+		// Speech is over
+		if d.silenceSteps >= minSilenceSteps {
+			validSamples = append(validSamples, d.speechSamples)
+			d.silenceSteps = 0
+			d.speechSamples = []int32{}
+		}
+	}
+	return
+}
+
+// noiseFloor returns the noise floor based on the audio levels history
+func (d *AdaptiveSilenceDetector) noiseFloor() float64 {
+	// No history
+	if len(d.levels) == 0 {
+		return 0
+	}
+
+	// Sort levels
+	ls := make([]float64, len(d.levels))
+	copy(ls, d.levels)
+	sort.Float64s(ls)
+	return ls[int(float64(len(ls)-1)*adaptiveSilenceDetectorNoiseFloorPercentile)]
+}
+
+// State implements the StatefulSilenceDetector interface
+func (d *AdaptiveSilenceDetector) State() DetectorState {
+	if d.IsSpeechActive() {
+		return DetectorStateSpeech
+	}
+	return DetectorStateSilence
+}
+
+// IsSpeechActive implements the ActiveSpeechDetector interface
+func (d *AdaptiveSilenceDetector) IsSpeechActive() bool {
+	return len(d.speechSamples) > 0
+}
+
+// Reset implements the SilenceDetector interface
+func (d *AdaptiveSilenceDetector) Reset() {
+	d.buf = []int32{}
+	d.levels = []float64{}
+	d.preRoll = []int32{}
+	d.silenceSteps = 0
+	d.speechSamples = []int32{}
+}
+
+// PassthroughSilenceDetector represents a silence detector that doesn't detect silences: every sample is considered as
+// speech and is emitted in fixed size chunks so that it's transcribed no matter what.
+// The chunk size controls the trade off between latency and speech parser efficiency.
+type PassthroughSilenceDetector struct {
+	buf          []int32
+	chunkSamples int
+}
+
+// NewPassthroughSilenceDetector creates a new passthrough silence detector emitting chunks of chunkSamples samples
+func NewPassthroughSilenceDetector(chunkSamples int) *PassthroughSilenceDetector {
+	if chunkSamples <= 0 {
+		chunkSamples = 1
+	}
+	return &PassthroughSilenceDetector{chunkSamples: chunkSamples}
+}
+
+// Add implements the SilenceDetector interface
+func (d *PassthroughSilenceDetector) Add(samples []int32, sampleRate int, silenceMaxAudioLevel float64) (validSamples [][]int32) {
+	d.buf = append(d.buf, samples...)
+	for len(d.buf) >= d.chunkSamples {
+		validSamples = append(validSamples, append([]int32{}, d.buf[:d.chunkSamples]...))
+		d.buf = d.buf[d.chunkSamples:]
+	}
+	return
+}
+
+// Reset implements the SilenceDetector interface
+// There's nothing to reset but the samples of the chunk being filled which are dropped.
+func (d *PassthroughSilenceDetector) Reset() {
+	d.buf = []int32{}
+}
@@ -0,0 +1,228 @@
+package astiunderstanding
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asticode/go-astitools/audio"
+)
+
+// SilenceDetectorAlgorithm represents a silence detection algorithm
+type SilenceDetectorAlgorithm string
+
+// Silence detection algorithms
+const (
+	SilenceDetectorAlgorithmEnergy       SilenceDetectorAlgorithm = "energy"
+	SilenceDetectorAlgorithmVoting       SilenceDetectorAlgorithm = "voting"
+	SilenceDetectorAlgorithmZeroCrossing SilenceDetectorAlgorithm = "zero_crossing"
+)
+
+// SilenceDetectorOptions represents the options of the built-in silence detectors
+// EnergyThreshold is the audio level below which a step is considered as silent. If 0, the silenceMaxAudioLevel
+// provided to Add is used instead.
+// MinSilenceDuration is the duration of silence needed to consider speech is over.
+// StepDuration is the duration of the steps samples are classified by.
+// ZeroCrossingRateThreshold is the number of zero crossings per sample below which a step is considered as silent.
+type SilenceDetectorOptions struct {
+	EnergyThreshold           float64       `toml:"energy_threshold"`
+	MinSilenceDuration        time.Duration `toml:"min_silence_duration"`
+	StepDuration              time.Duration `toml:"step_duration"`
+	ZeroCrossingRateThreshold float64       `toml:"zero_crossing_rate_threshold"`
+}
+
+// NewSilenceDetector creates a new built-in silence detector based on its algorithm
+func NewSilenceDetector(algo SilenceDetectorAlgorithm, o SilenceDetectorOptions) (sd SilenceDetector, err error) {
+	switch algo {
+	case SilenceDetectorAlgorithmEnergy:
+		sd = NewEnergySilenceDetector(o)
+	case SilenceDetectorAlgorithmVoting:
+		sd = NewVotingSilenceDetector(o)
+	case SilenceDetectorAlgorithmZeroCrossing:
+		sd = NewZeroCrossingSilenceDetector(o)
+	default:
+		err = fmt.Errorf("astiunderstanding: unknown silence detector algorithm %s", algo)
+	}
+	return
+}
+
+// EnergySilenceDetector represents a silence detector considering steps whose audio level is below a threshold as
+// silent.
+// It's cheap but tends to consider low energy consonants such as fricatives as silent.
+type EnergySilenceDetector struct {
+	*stepSilenceDetector
+}
+
+// NewEnergySilenceDetector creates a new energy silence detector
+func NewEnergySilenceDetector(o SilenceDetectorOptions) (d *EnergySilenceDetector) {
+	d = &EnergySilenceDetector{}
+	d.stepSilenceDetector = newStepSilenceDetector(o, d.isSilence)
+	return
+}
+
+// isSilence checks whether a step is silent
+func (d *EnergySilenceDetector) isSilence(step []int32, silenceMaxAudioLevel float64) bool {
+	t := d.o.EnergyThreshold
+	if t == 0 {
+		t = silenceMaxAudioLevel
+	}
+	return astiaudio.AudioLevel(step) <= t
+}
+
+// ZeroCrossingSilenceDetector represents a silence detector gating steps on their energy first: steps whose audio
+// level is above the threshold are considered as speech and, among the others, only steps whose zero crossing rate is
+// below a threshold are considered as silent.
+// Voiced speech has a low zero crossing rate but a high energy whereas fricatives have a high zero crossing rate
+// despite their low energy.
+type ZeroCrossingSilenceDetector struct {
+	*stepSilenceDetector
+	e *EnergySilenceDetector
+}
+
+// NewZeroCrossingSilenceDetector creates a new zero crossing silence detector
+func NewZeroCrossingSilenceDetector(o SilenceDetectorOptions) (d *ZeroCrossingSilenceDetector) {
+	d = &ZeroCrossingSilenceDetector{e: NewEnergySilenceDetector(o)}
+	d.stepSilenceDetector = newStepSilenceDetector(o, d.isSilence)
+	return
+}
+
+// isSilence checks whether a step is silent
+func (d *ZeroCrossingSilenceDetector) isSilence(step []int32, silenceMaxAudioLevel float64) bool {
+	// Step is loud enough to be speech
+	if !d.e.isSilence(step, silenceMaxAudioLevel) {
+		return false
+	}
+
+	// Tell noise from speech
+	return zeroCrossingRate(step) < d.o.ZeroCrossingRateThreshold
+}
+
+// zeroCrossingRate returns the number of sign changes per sample
+func zeroCrossingRate(samples []int32) float64 {
+	// Not enough samples
+	if len(samples) < 2 {
+		return 0
+	}
+
+	// Count crossings
+	var c int
+	for idx := 1; idx < len(samples); idx++ {
+		if (samples[idx-1] >= 0) != (samples[idx] >= 0) {
+			c++
+		}
+	}
+	return float64(c) / float64(len(samples)-1)
+}
+
+// VotingSilenceDetector represents a silence detector considering steps as silent only if both the energy and the
+// zero crossing rate agree, so that utterances are not cut during low energy consonants.
+type VotingSilenceDetector struct {
+	*stepSilenceDetector
+	e *EnergySilenceDetector
+}
+
+// NewVotingSilenceDetector creates a new voting silence detector
+func NewVotingSilenceDetector(o SilenceDetectorOptions) (d *VotingSilenceDetector) {
+	d = &VotingSilenceDetector{e: NewEnergySilenceDetector(o)}
+	d.stepSilenceDetector = newStepSilenceDetector(o, d.isSilence)
+	return
+}
+
+// isSilence checks whether a step is silent
+func (d *VotingSilenceDetector) isSilence(step []int32, silenceMaxAudioLevel float64) bool {
+	return d.e.isSilence(step, silenceMaxAudioLevel) && zeroCrossingRate(step) < d.o.ZeroCrossingRateThreshold
+}
+
+// stepSilenceDetector represents a silence detector splitting samples into steps and cutting utterances once enough
+// consecutive steps have been considered as silent
+type stepSilenceDetector struct {
+	buf           []int32
+	isSilence     func(step []int32, silenceMaxAudioLevel float64) bool
+	o             SilenceDetectorOptions
+	silenceSteps  int
+	speechSamples []int32
+}
+
+// newStepSilenceDetector creates a new step silence detector
+func newStepSilenceDetector(o SilenceDetectorOptions, isSilence func(step []int32, silenceMaxAudioLevel float64) bool) (d *stepSilenceDetector) {
+	// Create
+	d = &stepSilenceDetector{
+		isSilence: isSilence,
+		o:         o,
+	}
+
+	// Default options
+	if d.o.MinSilenceDuration <= 0 {
+		d.o.MinSilenceDuration = time.Second
+	}
+	if d.o.StepDuration <= 0 {
+		d.o.StepDuration = 30 * time.Millisecond
+	}
+	if d.o.ZeroCrossingRateThreshold <= 0 {
+		d.o.ZeroCrossingRateThreshold = 0.2
+	}
+	return
+}
+
+// Add implements the SilenceDetector interface
+func (d *stepSilenceDetector) Add(samples []int32, sampleRate int, silenceMaxAudioLevel float64) (validSamples [][]int32) {
+	// Get step size
+	stepSize := int(int64(sampleRate) * int64(d.o.StepDuration) / int64(time.Second))
+	if stepSize <= 0 {
+		return
+	}
+
+	// Get min number of silence steps
+	minSilenceSteps := int(d.o.MinSilenceDuration / d.o.StepDuration)
+
+	// Loop through steps
+	d.buf = append(d.buf, samples...)
+	for len(d.buf) >= stepSize {
+		// Get step
+		step := d.buf[:stepSize]
+		d.buf = d.buf[stepSize:]
+
+		// Silence before speech
+		isSilence := d.isSilence(step, silenceMaxAudioLevel)
+		if isSilence && len(d.speechSamples) == 0 {
+			continue
+		}
+
+		// Append step
+		d.speechSamples = append(d.speechSamples, step...)
+
+		// Update silence steps
+		if !isSilence {
+			d.silenceSteps = 0
+			continue
+		}
+		d.silenceSteps++
+
+		// Speech is over
+		if d.silenceSteps >= minSilenceSteps {
+			validSamples = append(validSamples, d.speechSamples)
+			d.silenceSteps = 0
+			d.speechSamples = []int32{}
+		}
+	}
+	return
+}
+
+// IsSpeechActive implements the ActiveSpeechDetector interface
+func (d *stepSilenceDetector) IsSpeechActive() bool {
+	return len(d.speechSamples) > 0
+}
+
+// State implements the StatefulSilenceDetector interface
+func (d *stepSilenceDetector) State() DetectorState {
+	if d.IsSpeechActive() {
+		return DetectorStateSpeech
+	}
+	return DetectorStateSilence
+}
+
+// Reset implements the SilenceDetector interface
+func (d *stepSilenceDetector) Reset() {
+	d.buf = []int32{}
+	d.silenceSteps = 0
+	d.speechSamples = []int32{}
+}
@@ -0,0 +1,96 @@
+package astiunderstanding
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stepForTest creates a 10 samples step repeating the pattern
+func stepForTest(pattern ...int32) (s []int32) {
+	for len(s) < 10 {
+		s = append(s, pattern...)
+	}
+	return
+}
+
+func TestSilenceDetectorsIsSilence(t *testing.T) {
+	o := SilenceDetectorOptions{EnergyThreshold: 100}
+	silent, voiced, fricative, hum := stepForTest(0), stepForTest(1000), stepForTest(50, -50), stepForTest(50)
+	for _, v := range []struct {
+		algo     SilenceDetectorAlgorithm
+		expected []bool // silent, voiced, fricative, hum
+	}{
+		{algo: SilenceDetectorAlgorithmEnergy, expected: []bool{true, false, true, true}},
+		{algo: SilenceDetectorAlgorithmVoting, expected: []bool{true, false, false, true}},
+		{algo: SilenceDetectorAlgorithmZeroCrossing, expected: []bool{true, false, false, true}},
+	} {
+		t.Run(string(v.algo), func(t *testing.T) {
+			sd, err := NewSilenceDetector(v.algo, o)
+			assert.NoError(t, err)
+			var isSilence func(step []int32, silenceMaxAudioLevel float64) bool
+			switch d := sd.(type) {
+			case *EnergySilenceDetector:
+				isSilence = d.isSilence
+			case *VotingSilenceDetector:
+				isSilence = d.isSilence
+			case *ZeroCrossingSilenceDetector:
+				isSilence = d.isSilence
+			}
+			var r []bool
+			for _, step := range [][]int32{silent, voiced, fricative, hum} {
+				r = append(r, isSilence(step, 0))
+			}
+			assert.Equal(t, v.expected, r)
+		})
+	}
+
+	// Unknown algorithm
+	_, err := NewSilenceDetector("invalid", o)
+	assert.Error(t, err)
+}
+
+func TestSilenceDetectorsEnergyThreshold(t *testing.T) {
+	// silenceMaxAudioLevel is used when no energy threshold is set
+	d := NewEnergySilenceDetector(SilenceDetectorOptions{})
+	assert.True(t, d.isSilence(stepForTest(1000), 1000))
+	assert.False(t, d.isSilence(stepForTest(1000), 999))
+}
+
+func TestSilenceDetectorsAdd(t *testing.T) {
+	// Steps are 10 samples long and speech is over after 2 silent steps
+	o := SilenceDetectorOptions{
+		EnergyThreshold:    100,
+		MinSilenceDuration: 20 * time.Millisecond,
+		StepDuration:       10 * time.Millisecond,
+	}
+	silent, voiced, fricative := stepForTest(0), stepForTest(1000), stepForTest(50, -50)
+	concat := func(steps ...[]int32) (s []int32) {
+		for _, step := range steps {
+			s = append(s, step...)
+		}
+		return
+	}
+	for _, v := range []struct {
+		algo     SilenceDetectorAlgorithm
+		expected [][]int32
+	}{
+		// Fricative is considered as silent and the utterance is cut in the middle of the word
+		{algo: SilenceDetectorAlgorithmEnergy, expected: [][]int32{concat(voiced, fricative, silent), concat(voiced, silent, silent)}},
+		// Fricative is part of the utterance
+		{algo: SilenceDetectorAlgorithmVoting, expected: [][]int32{concat(voiced, fricative, silent, voiced, silent, silent)}},
+		{algo: SilenceDetectorAlgorithmZeroCrossing, expected: [][]int32{concat(voiced, fricative, silent, voiced, silent, silent)}},
+	} {
+		t.Run(string(v.algo), func(t *testing.T) {
+			sd, err := NewSilenceDetector(v.algo, o)
+			assert.NoError(t, err)
+
+			// Leading silence is ignored and incomplete steps are kept for the next call
+			in := concat(silent, voiced, fricative, silent, voiced, silent, silent)
+			rs := sd.Add(in[:len(in)-5], 1000, 0)
+			rs = append(rs, sd.Add(in[len(in)-5:], 1000, 0)...)
+			assert.Equal(t, v.expected, rs)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package astiunderstanding
+
+import (
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astitools/sync"
+	"github.com/pkg/errors"
+)
+
+// SourceConfiguration represents the configuration of a named input source
+// SampleRate overrides the sample rate of the samples received from the source if > 0.
+// SilenceMaxAudioLevel overrides the silence max audio level of the samples received from the source if > 0. It
+// takes precedence over the SilenceMaxAudioLevel of the ability configuration.
+type SourceConfiguration struct {
+	SampleRate           int     `toml:"sample_rate"`
+	SilenceMaxAudioLevel float64 `toml:"silence_max_audio_level"`
+}
+
+// pipelineKey represents the key of the pipeline processing the samples of a source.
+// Samples without source are processed by one pipeline per brain.
+type pipelineKey struct {
+	brainName string
+	source    string
+}
+
+// newPipelineKey creates a new pipeline key
+func newPipelineKey(brainName, source string) pipelineKey {
+	return pipelineKey{brainName: brainName, source: source}
+}
+
+// AddSource adds or updates a named input source.
+// Samples tagged with a source are only processed once the source has been added.
+func (a *Ability) AddSource(source string, c SourceConfiguration) {
+	a.cm.Lock()
+	defer a.cm.Unlock()
+	a.c.Sources[source] = c
+}
+
+// RemoveSource removes a named input source and stops its pipeline: its silence detectors, ongoing streams and
+// pending utterances are discarded and its audio source, if any, is closed. Other sources are not affected.
+func (a *Ability) RemoveSource(source string) {
+	// Remove source
+	a.cm.Lock()
+	delete(a.c.Sources, source)
+	a.rs = append(a.rs, source)
+	a.cm.Unlock()
+
+	// Remove audio source
+	a.removeAudioSource(source)
+
+	// Remove silence detectors
+	a.m.Lock()
+	for k := range a.sds {
+		if k.source == source {
+			delete(a.sds, k)
+		}
+	}
+	a.m.Unlock()
+
+	// Remove pending utterances
+	a.qm.Lock()
+	for k := range a.qs {
+		if k.source == source {
+			for _, s := range a.qs[k] {
+				astibrain.SpanFromContext(s.ctx).End()
+			}
+			delete(a.qs, k)
+		}
+	}
+	a.qc.Broadcast()
+	a.qm.Unlock()
+
+	// Remove doers
+	a.dm.Lock()
+	for k, d := range a.ds {
+		if k.source == source {
+			if err := d.Close(); err != nil {
+				astilog.Error(errors.Wrapf(err, "astiunderstanding: closing doer of source %s failed", source))
+			}
+			delete(a.ds, k)
+		}
+	}
+	a.dm.Unlock()
+
+	// Ask Run to remove the rest of the pipeline
+	select {
+	case a.chr <- struct{}{}:
+	default:
+	}
+}
+
+// source returns the configuration of a source and whether samples from that source should be processed
+func (a *Ability) source(source string) (c SourceConfiguration, ok bool) {
+	// Samples have no source
+	if len(source) == 0 {
+		return c, true
+	}
+
+	// Get source
+	a.cm.Lock()
+	defer a.cm.Unlock()
+	c, ok = a.c.Sources[source]
+	return
+}
+
+// removePipelines removes the state only accessed in Run of the pipelines of the removed sources.
+// It must only be called in Run.
+func (a *Ability) removePipelines() {
+	// Get removed sources
+	a.cm.Lock()
+	rs := a.rs
+	a.rs = nil
+	a.cm.Unlock()
+
+	// Loop through removed sources
+	for _, source := range rs {
+		a.removePipeline(source)
+	}
+}
+
+// removePipeline removes the state only accessed in Run of the pipelines of a source
+func (a *Ability) removePipeline(source string) {
+	for k := range a.afs {
+		if k.source == source {
+			delete(a.afs, k)
+		}
+	}
+	for k := range a.als {
+		if k.source == source {
+			delete(a.als, k)
+		}
+	}
+	for k := range a.dms {
+		if k.source == source {
+			delete(a.dms, k)
+		}
+	}
+	for k := range a.gs {
+		if k.source == source {
+			delete(a.gs, k)
+		}
+	}
+	for k := range a.lss {
+		if k.source == source {
+			delete(a.lss, k)
+		}
+	}
+	for k := range a.sps {
+		if k.source == source {
+			delete(a.sps, k)
+		}
+	}
+	for k, s := range a.ss {
+		if k.source == source {
+			s.close(nil, true)
+			delete(a.ss, k)
+		}
+	}
+	for k := range a.wds {
+		if k.source == source {
+			delete(a.wds, k)
+		}
+	}
+	astilog.Debugf("astiunderstanding: pipeline of source %s has been removed", source)
+}
+
+// doer returns the doer executing the analyses of a pipeline in FIFO order.
+// Analyses of named sources run concurrently, one doer per source, whereas analyses of samples without source share
+// the same doer.
+func (a *Ability) doer(k pipelineKey) *astisync.Do {
+	// Samples have no source
+	if len(k.source) == 0 {
+		return a.d
+	}
+
+	// Get doer
+	a.dm.Lock()
+	defer a.dm.Unlock()
+	d, ok := a.ds[k]
+	if !ok {
+		d = astisync.NewDo()
+		a.ds[k] = d
+	}
+	return d
+}
@@ -0,0 +1,69 @@
+package astiunderstanding
+
+import (
+	"github.com/asticode/go-astibob/brain"
+)
+
+// DetectorState represents the state of a silence detector
+type DetectorState string
+
+// Detector states
+const (
+	DetectorStateSilence DetectorState = "silence"
+	DetectorStateSpeech  DetectorState = "speech"
+	DetectorStateUnknown DetectorState = "unknown"
+)
+
+// StatefulSilenceDetector represents a silence detector capable of telling whether it's currently in speech or in
+// silence, as opposed to the segments returned by Add which are only available once an utterance has ended
+type StatefulSilenceDetector interface {
+	SilenceDetector
+	State() DetectorState
+}
+
+// PayloadListeningState represents a listening state payload
+type PayloadListeningState struct {
+	BrainName string        `json:"brain_name"`
+	Source    string        `json:"source,omitempty"`
+	State     DetectorState `json:"state"`
+}
+
+// detectorState returns the state of a silence detector.
+// Silence detectors capable of telling whether speech is ongoing are in speech or in silence accordingly, the others
+// are in an unknown state.
+func detectorState(sd SilenceDetector) DetectorState {
+	if v, ok := sd.(StatefulSilenceDetector); ok {
+		return v.State()
+	} else if v, ok := sd.(ActiveSpeechDetector); ok {
+		if v.IsSpeechActive() {
+			return DetectorStateSpeech
+		}
+		return DetectorStateSilence
+	}
+	return DetectorStateUnknown
+}
+
+// dispatchListeningState dispatches a listening state event whenever the state of the pipeline's silence detector
+// changes.
+// It must only be called in Run.
+func (a *Ability) dispatchListeningState(k pipelineKey, sd SilenceDetector) {
+	// State has not changed
+	s := detectorState(sd)
+	if s == a.lss[k] {
+		return
+	}
+	a.lss[k] = s
+
+	// Dispatch
+	if a.dispatchFunc != nil {
+		a.dispatchFunc(astibrain.Event{
+			AbilityName: name,
+			Name:        websocketEventNameListeningState,
+			Payload: PayloadListeningState{
+				BrainName: k.brainName,
+				Source:    k.source,
+				State:     s,
+			},
+		})
+	}
+}
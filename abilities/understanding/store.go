@@ -0,0 +1,755 @@
+package astiunderstanding
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/cryptix/wav"
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+)
+
+// SamplesStore represents an object capable of storing samples on disk.
+// Each stored samples are written as a wav file with a json metadata sidecar. If compression is enabled, they're written
+// as gzipped raw PCM samples instead and the wav header is generated on retrieval.
+// Once the total size of the directory exceeds the max size, oldest samples are removed first.
+type SamplesStore struct {
+	c SamplesStoreConfiguration
+	m sync.Mutex
+}
+
+// SamplesStoreConfiguration represents a samples store configuration
+// If Compression is true, stored samples are gzipped. Compressed and uncompressed samples can be read whatever its value.
+// MaxSize is the max total size in bytes of the stored samples, as stored on disk. If 0, there's no limit.
+// ProgressInterval is the min duration between two progress callbacks while samples are being stored, see
+// StoreWithProgress. Samples whose uncompressed size is below ProgressMinSize bytes don't report any progress. If
+// ProgressInterval is 0, progress is never reported.
+type SamplesStoreConfiguration struct {
+	Compression      bool          `toml:"compression"`
+	Directory        string        `toml:"directory"`
+	MaxSize          int64         `toml:"max_size"`
+	ProgressInterval time.Duration `toml:"progress_interval"`
+	ProgressMinSize  int64         `toml:"progress_min_size"`
+}
+
+// StoreProgressFunc represents the callback executed while samples are being stored.
+// id is the id the stored samples will have once they have been stored, written and total are the number of
+// uncompressed bytes written so far and to be written.
+type StoreProgressFunc func(id string, written, total int64)
+
+// StoredSamples represents stored samples metadata
+// Compressed, DiskSize and Size are computed upon retrieval. DiskSize is the size of the samples on disk whereas Size is
+// the size of the wav file returned by Open.
+type StoredSamples struct {
+	Compressed      bool      `json:"compressed,omitempty"`
+	DiskSize        int64     `json:"disk_size,omitempty"`
+	ID              string    `json:"id"`
+	NumSamples      int       `json:"num_samples,omitempty"`
+	SampleRate      int       `json:"sample_rate"`
+	SignificantBits int       `json:"significant_bits"`
+	Size            int64     `json:"size,omitempty"`
+	StoredAt        time.Time `json:"stored_at"`
+	Text            string    `json:"text"`
+}
+
+// NewSamplesStore creates a new samples store
+func NewSamplesStore(c SamplesStoreConfiguration) (s *SamplesStore, err error) {
+	// Create
+	s = &SamplesStore{c: c}
+
+	// Absolute path
+	if s.c.Directory, err = filepath.Abs(s.c.Directory); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: filepath abs of %s failed", s.c.Directory)
+		return
+	}
+	return
+}
+
+// wavPath returns the wav path of the samples
+func (s *SamplesStore) wavPath(id string) string {
+	return filepath.Join(s.c.Directory, id+".wav")
+}
+
+// pcmPath returns the compressed pcm path of the samples
+func (s *SamplesStore) pcmPath(id string) string {
+	return filepath.Join(s.c.Directory, id+".pcm.gz")
+}
+
+// metadataPath returns the metadata path of the samples
+func (s *SamplesStore) metadataPath(id string) string {
+	return filepath.Join(s.c.Directory, id+".json")
+}
+
+// txtPath returns the legacy txt path of the samples
+func (s *SamplesStore) txtPath(id string) string {
+	return filepath.Join(s.c.Directory, id+".txt")
+}
+
+// WavPath returns the wav path of the samples.
+// Compressed samples have no wav file, use Open instead.
+func (s *SamplesStore) WavPath(id string) string {
+	return s.wavPath(id)
+}
+
+// Store stores the samples and rotates the store if needed
+func (s *SamplesStore) Store(text string, samples []int32, sampleRate, significantBits int) (ss StoredSamples, err error) {
+	return s.StoreWithProgress(text, samples, sampleRate, significantBits, nil)
+}
+
+// StoreWithProgress stores the samples, reporting progress while they're being written, and rotates the store if
+// needed
+func (s *SamplesStore) StoreWithProgress(text string, samples []int32, sampleRate, significantBits int, fn StoreProgressFunc) (ss StoredSamples, err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Create metadata
+	ss = StoredSamples{
+		ID:              filepath.Join(time.Now().Format("2006-01-02"), xid.New().String()),
+		NumSamples:      len(samples),
+		SampleRate:      sampleRate,
+		SignificantBits: significantBits,
+		StoredAt:        time.Now(),
+		Text:            text,
+	}
+
+	// Create progress
+	p := s.newStoreProgress(ss, fn)
+
+	// Store samples
+	if s.c.Compression {
+		if err = s.storePCM(ss, samples, p); err != nil {
+			err = errors.Wrap(err, "astiunderstanding: storing pcm failed")
+			return
+		}
+	} else {
+		if err = s.storeWav(ss, samples, p); err != nil {
+			err = errors.Wrap(err, "astiunderstanding: storing wav failed")
+			return
+		}
+	}
+
+	// Store metadata
+	if err = s.storeMetadata(ss); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: storing metadata failed")
+		return
+	}
+
+	// Rotate
+	if err = s.rotate(); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: rotating failed")
+		return
+	}
+
+	// Compute sizes
+	s.computeSizes(&ss)
+	return
+}
+
+// storePCM stores the samples as gzipped raw PCM samples
+func (s *SamplesStore) storePCM(ss StoredSamples, samples []int32, p *storeProgress) (err error) {
+	// Create dir
+	pcmPath := s.pcmPath(ss.ID)
+	if err = os.MkdirAll(filepath.Dir(pcmPath), 0755); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: mkdirall %s failed", filepath.Dir(pcmPath))
+		return
+	}
+
+	// Create pcm file
+	var f *os.File
+	if f, err = os.Create(pcmPath); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: creating %s failed", pcmPath)
+		return
+	}
+	defer f.Close()
+
+	// Write pcm samples
+	gw := gzip.NewWriter(f)
+	bw := bufio.NewWriter(gw)
+	sampleSize := pcmSampleSize(ss.SignificantBits)
+	for _, sample := range samples {
+		if err = writePCMSample(bw, sample, sampleSize); err != nil {
+			err = errors.Wrap(err, "astiunderstanding: writing pcm sample failed")
+			return
+		}
+		p.add(sampleSize)
+	}
+
+	// Flush
+	if err = bw.Flush(); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: flushing buffered writer failed")
+		return
+	}
+	if err = gw.Close(); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: closing gzip writer failed")
+		return
+	}
+	return
+}
+
+// storeWav stores the samples as a wav file
+func (s *SamplesStore) storeWav(ss StoredSamples, samples []int32, p *storeProgress) (err error) {
+	// Create dir
+	wavPath := s.wavPath(ss.ID)
+	if err = os.MkdirAll(filepath.Dir(wavPath), 0755); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: mkdirall %s failed", filepath.Dir(wavPath))
+		return
+	}
+
+	// Create wav file
+	var f *os.File
+	if f, err = os.Create(wavPath); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: creating %s failed", wavPath)
+		return
+	}
+	defer f.Close()
+
+	// Create wav writer
+	wf := wav.File{
+		Channels:        1,
+		SampleRate:      uint32(ss.SampleRate),
+		SignificantBits: uint16(ss.SignificantBits),
+	}
+	var r *wav.Writer
+	if r, err = wf.NewWriter(f); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: creating wav writer failed")
+		return
+	}
+	defer r.Close()
+
+	// Write wav samples
+	sampleSize := pcmSampleSize(ss.SignificantBits)
+	for _, sample := range samples {
+		if err = r.WriteInt32(sample); err != nil {
+			err = errors.Wrap(err, "astiunderstanding: writing wav sample failed")
+			return
+		}
+		p.add(sampleSize)
+	}
+	return
+}
+
+// storeProgress represents the progress of samples being stored
+type storeProgress struct {
+	fn       StoreProgressFunc
+	id       string
+	interval time.Duration
+	lastAt   time.Time
+	n        int
+	total    int64
+	written  int64
+}
+
+// newStoreProgress creates a new store progress.
+// It returns nil if no progress has to be reported.
+func (s *SamplesStore) newStoreProgress(ss StoredSamples, fn StoreProgressFunc) *storeProgress {
+	// Progress is disabled
+	total := int64(ss.NumSamples * pcmSampleSize(ss.SignificantBits))
+	if fn == nil || s.c.ProgressInterval <= 0 || total < s.c.ProgressMinSize {
+		return nil
+	}
+	return &storeProgress{
+		fn:       fn,
+		id:       ss.ID,
+		interval: s.c.ProgressInterval,
+		lastAt:   time.Now(),
+		total:    total,
+	}
+}
+
+// add adds written bytes and executes the callback at most once per interval.
+// A nil *storeProgress does nothing.
+func (p *storeProgress) add(n int) {
+	// Progress is disabled
+	if p == nil {
+		return
+	}
+
+	// Update
+	p.written += int64(n)
+
+	// Throttle
+	// Time is only checked every 1024 samples so that writing samples is not slowed down
+	if p.n++; p.n%1024 != 0 || time.Since(p.lastAt) < p.interval {
+		return
+	}
+	p.lastAt = time.Now()
+
+	// Execute callback
+	p.fn(p.id, p.written, p.total)
+}
+
+// storeMetadata stores the samples metadata in a json file
+func (s *SamplesStore) storeMetadata(ss StoredSamples) (err error) {
+	// Marshal
+	var b []byte
+	if b, err = json.Marshal(ss); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: marshaling %#v failed", ss)
+		return
+	}
+
+	// Write
+	metadataPath := s.metadataPath(ss.ID)
+	if err = ioutil.WriteFile(metadataPath, b, 0644); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: writing into %s failed", metadataPath)
+		return
+	}
+	return
+}
+
+// Get retrieves the stored samples metadata
+func (s *SamplesStore) Get(id string) (ss StoredSamples, err error) {
+	// Read metadata
+	var b []byte
+	if b, err = ioutil.ReadFile(s.metadataPath(id)); err != nil {
+		// Samples have been stored before metadata were introduced
+		if os.IsNotExist(err) {
+			return s.getLegacy(id)
+		}
+		err = errors.Wrapf(err, "astiunderstanding: reading %s failed", s.metadataPath(id))
+		return
+	}
+
+	// Unmarshal
+	if err = json.Unmarshal(b, &ss); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: unmarshaling %s failed", b)
+		return
+	}
+
+	// Compute sizes
+	s.computeSizes(&ss)
+	return
+}
+
+// computeSizes computes the on disk and uncompressed sizes of the stored samples
+func (s *SamplesStore) computeSizes(ss *StoredSamples) {
+	if fi, err := os.Stat(s.pcmPath(ss.ID)); err == nil {
+		ss.Compressed = true
+		ss.DiskSize = fi.Size()
+		ss.Size = wavHeaderSize + int64(ss.NumSamples*pcmSampleSize(ss.SignificantBits))
+	} else if fi, err := os.Stat(s.wavPath(ss.ID)); err == nil {
+		ss.Compressed = false
+		ss.DiskSize = fi.Size()
+		ss.Size = fi.Size()
+	}
+}
+
+// getLegacy retrieves the stored samples metadata from the legacy txt file
+func (s *SamplesStore) getLegacy(id string) (ss StoredSamples, err error) {
+	// Read txt file
+	var b []byte
+	if b, err = ioutil.ReadFile(s.txtPath(id)); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: reading %s failed", s.txtPath(id))
+		return
+	}
+
+	// Stat wav file
+	var fi os.FileInfo
+	if fi, err = os.Stat(s.wavPath(id)); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: stating %s failed", s.wavPath(id))
+		return
+	}
+
+	// Create metadata
+	ss = StoredSamples{
+		DiskSize: fi.Size(),
+		ID:       id,
+		Size:     fi.Size(),
+		StoredAt: fi.ModTime(),
+		Text:     string(b),
+	}
+	return
+}
+
+// Open opens the stored samples as a wav file.
+// Compressed samples are decompressed while being read, behind a generated wav header. The returned reader implements
+// io.Seeker so that it can serve range requests. Seeking compressed samples backward reopens them though, which
+// makes it more expensive.
+func (s *SamplesStore) Open(id string) (rc io.ReadCloser, size int64, err error) {
+	// Samples are not compressed
+	pcmPath := s.pcmPath(id)
+	if _, err = os.Stat(pcmPath); os.IsNotExist(err) {
+		// Stat wav file
+		wavPath := s.wavPath(id)
+		var fi os.FileInfo
+		if fi, err = os.Stat(wavPath); err != nil {
+			err = errors.Wrapf(err, "astiunderstanding: stating %s failed", wavPath)
+			return
+		}
+
+		// Open wav file
+		var f *os.File
+		if f, err = os.Open(wavPath); err != nil {
+			err = errors.Wrapf(err, "astiunderstanding: opening %s failed", wavPath)
+			return
+		}
+		return f, fi.Size(), nil
+	} else if err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: stating %s failed", pcmPath)
+		return
+	}
+
+	// Get metadata
+	var ss StoredSamples
+	if ss, err = s.Get(id); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: getting metadata of %s failed", id)
+		return
+	}
+
+	// Open compressed wav
+	var r *compressedWavReader
+	if r, err = openCompressedWav(pcmPath, wavHeader(ss.NumSamples, ss.SampleRate, ss.SignificantBits), ss.Size); err != nil {
+		return
+	}
+	return r, ss.Size, nil
+}
+
+// compressedWavReader represents a seekable reader decompressing a pcm file behind a wav header.
+// Since gzip streams can't be seeked, seeking is lazy: bytes are discarded when reading after seeking forward and the
+// file is reopened when reading after seeking backward.
+type compressedWavReader struct {
+	header []byte
+	next   int64 // Position the next read starts at
+	path   string
+	pos    int64 // Position of r
+	pr     *pcmReader
+	r      io.Reader
+	size   int64
+}
+
+// openCompressedWav opens a compressed pcm file behind a wav header
+func openCompressedWav(path string, header []byte, size int64) (r *compressedWavReader, err error) {
+	r = &compressedWavReader{
+		header: header,
+		path:   path,
+		size:   size,
+	}
+	if err = r.open(); err != nil {
+		return
+	}
+	return
+}
+
+// open (re)opens the pcm file and rewinds the reader
+func (r *compressedWavReader) open() (err error) {
+	// Open pcm file
+	var pr *pcmReader
+	if pr, err = openPCM(r.path); err != nil {
+		return
+	}
+
+	// Update reader
+	r.pos, r.pr = 0, pr
+	r.r = io.MultiReader(bytes.NewReader(r.header), pr)
+	return
+}
+
+// Read implements the io.Reader interface
+func (r *compressedWavReader) Read(p []byte) (n int, err error) {
+	// Rewind
+	if r.next < r.pos {
+		if err = r.pr.Close(); err != nil {
+			err = errors.Wrapf(err, "astiunderstanding: closing %s failed", r.path)
+			return
+		}
+		if err = r.open(); err != nil {
+			return
+		}
+	}
+
+	// Fast forward
+	if r.next > r.pos {
+		var d int64
+		d, err = io.CopyN(ioutil.Discard, r.r, r.next-r.pos)
+		r.pos += d
+		if err != nil {
+			return
+		}
+	}
+
+	// Read
+	n, err = r.r.Read(p)
+	r.pos += int64(n)
+	r.next = r.pos
+	return
+}
+
+// Seek implements the io.Seeker interface
+func (r *compressedWavReader) Seek(offset int64, whence int) (int64, error) {
+	// Get position
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.next + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, fmt.Errorf("astiunderstanding: invalid whence %d", whence)
+	}
+
+	// Check position
+	if next < 0 {
+		return 0, fmt.Errorf("astiunderstanding: negative position %d", next)
+	}
+	r.next = next
+	return next, nil
+}
+
+// Close implements the io.Closer interface
+func (r *compressedWavReader) Close() error {
+	return r.pr.Close()
+}
+
+// pcmReader represents a reader decompressing a pcm file
+type pcmReader struct {
+	f  *os.File
+	gr *gzip.Reader
+	r  io.Reader
+}
+
+// openPCM opens a compressed pcm file
+func openPCM(path string) (pr *pcmReader, err error) {
+	// Open file
+	pr = &pcmReader{}
+	if pr.f, err = os.Open(path); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: opening %s failed", path)
+		return
+	}
+
+	// Create gzip reader
+	if pr.gr, err = gzip.NewReader(bufio.NewReader(pr.f)); err != nil {
+		pr.f.Close()
+		err = errors.Wrapf(err, "astiunderstanding: creating gzip reader for %s failed", path)
+		return
+	}
+	pr.r = pr.gr
+	return
+}
+
+// Read implements the io.Reader interface
+func (pr *pcmReader) Read(p []byte) (int, error) {
+	return pr.r.Read(p)
+}
+
+// Close implements the io.Closer interface
+func (pr *pcmReader) Close() (err error) {
+	if err = pr.gr.Close(); err != nil {
+		pr.f.Close()
+		return
+	}
+	return pr.f.Close()
+}
+
+// Samples retrieves the stored samples
+func (s *SamplesStore) Samples(id string) (samples []int32, err error) {
+	// Samples are compressed
+	if _, errStat := os.Stat(s.pcmPath(id)); errStat == nil {
+		return s.pcmSamples(id)
+	}
+
+	// Stat wav file
+	wavPath := s.wavPath(id)
+	var fi os.FileInfo
+	if fi, err = os.Stat(wavPath); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: stating %s failed", wavPath)
+		return
+	}
+
+	// Open wav file
+	var f *os.File
+	if f, err = os.Open(wavPath); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: opening %s failed", wavPath)
+		return
+	}
+	defer f.Close()
+
+	// Create wav reader
+	var r *wav.Reader
+	if r, err = wav.NewReader(f, fi.Size()); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: creating wav reader failed")
+		return
+	}
+
+	// Read samples
+	var sample int32
+	for {
+		if sample, err = r.ReadSample(); err != nil {
+			if err != io.EOF {
+				err = errors.Wrap(err, "astiunderstanding: reading wav sample failed")
+				return
+			}
+			err = nil
+			break
+		}
+		samples = append(samples, sample)
+	}
+	return
+}
+
+// pcmSamples retrieves the compressed stored samples
+func (s *SamplesStore) pcmSamples(id string) (samples []int32, err error) {
+	// Get metadata
+	var ss StoredSamples
+	if ss, err = s.Get(id); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: getting metadata of %s failed", id)
+		return
+	}
+
+	// Open pcm file
+	var pr *pcmReader
+	if pr, err = openPCM(s.pcmPath(id)); err != nil {
+		return
+	}
+	defer pr.Close()
+
+	// Read samples
+	r := bufio.NewReader(pr)
+	sampleSize := pcmSampleSize(ss.SignificantBits)
+	samples = make([]int32, 0, ss.NumSamples)
+	var sample int32
+	for {
+		if sample, err = readPCMSample(r, sampleSize); err != nil {
+			if err != io.EOF {
+				err = errors.Wrap(err, "astiunderstanding: reading pcm sample failed")
+				return
+			}
+			err = nil
+			break
+		}
+		samples = append(samples, sample)
+	}
+	return
+}
+
+// List lists the stored samples metadata ordered from oldest to newest
+func (s *SamplesStore) List() (ss []StoredSamples, err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.list()
+}
+
+// list lists the stored samples metadata ordered from oldest to newest.
+// Assumption is made that m is locked
+func (s *SamplesStore) list() (ss []StoredSamples, err error) {
+	// Walk
+	ss = []StoredSamples{}
+	if err = filepath.Walk(s.c.Directory, func(path string, info os.FileInfo, err error) error {
+		// Process error
+		if err != nil {
+			if os.IsNotExist(err) && path == s.c.Directory {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		// Only process wav and compressed pcm files
+		var ext string
+		if strings.HasSuffix(path, ".wav") {
+			ext = ".wav"
+		} else if strings.HasSuffix(path, ".pcm.gz") {
+			ext = ".pcm.gz"
+		}
+		if info.IsDir() || len(ext) == 0 {
+			return nil
+		}
+
+		// Get metadata
+		var m StoredSamples
+		if m, err = s.Get(strings.TrimSuffix(strings.TrimPrefix(path, s.c.Directory+string(os.PathSeparator)), ext)); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: getting metadata of %s failed", path))
+			return nil
+		}
+
+		// Append
+		ss = append(ss, m)
+		return nil
+	}); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: walking through %s failed", s.c.Directory)
+		return
+	}
+
+	// Sort
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].StoredAt.Before(ss[j].StoredAt) })
+	return
+}
+
+// Remove removes the stored samples
+func (s *SamplesStore) Remove(id string) (err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.remove(id)
+}
+
+// remove removes the stored samples.
+// Assumption is made that m is locked
+func (s *SamplesStore) remove(id string) (err error) {
+	for _, p := range []string{s.wavPath(id), s.pcmPath(id), s.metadataPath(id), s.txtPath(id)} {
+		if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "astiunderstanding: removing %s failed", p)
+			return
+		}
+	}
+	return nil
+}
+
+// size returns the size of the stored samples
+func (s *SamplesStore) size(id string) (n int64) {
+	for _, p := range []string{s.wavPath(id), s.pcmPath(id), s.metadataPath(id), s.txtPath(id)} {
+		if fi, err := os.Stat(p); err == nil {
+			n += fi.Size()
+		}
+	}
+	return
+}
+
+// rotate removes the oldest stored samples until the total size is below the max size.
+// Assumption is made that m is locked
+func (s *SamplesStore) rotate() (err error) {
+	// No limit
+	if s.c.MaxSize <= 0 {
+		return
+	}
+
+	// List
+	var ss []StoredSamples
+	if ss, err = s.list(); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: listing failed")
+		return
+	}
+
+	// Get sizes
+	var total int64
+	sizes := make([]int64, len(ss))
+	for idx, m := range ss {
+		sizes[idx] = s.size(m.ID)
+		total += sizes[idx]
+	}
+
+	// Remove oldest samples
+	// The newest samples are always kept
+	for idx := 0; idx < len(ss)-1 && total > s.c.MaxSize; idx++ {
+		if err = s.remove(ss[idx].ID); err != nil {
+			err = errors.Wrapf(err, "astiunderstanding: removing %s failed", ss[idx].ID)
+			return
+		}
+		total -= sizes[idx]
+		astilog.Debugf("astiunderstanding: rotated stored samples %s", ss[idx].ID)
+	}
+	return
+}
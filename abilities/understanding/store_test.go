@@ -0,0 +1,118 @@
+package astiunderstanding
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getStoredSamplesForTest requests stored samples with an optional range header
+func getStoredSamplesForTest(t *testing.T, h http.Handler, id, rng string) (code int, body []byte, contentRange string) {
+	r := httptest.NewRequest(http.MethodGet, "/"+id+".wav", nil)
+	if len(rng) > 0 {
+		r.Header.Set("Range", rng)
+	}
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, r)
+	return rw.Code, rw.Body.Bytes(), rw.Header().Get("Content-Range")
+}
+
+func TestStaticHandlerSamplesRanges(t *testing.T) {
+	for _, compression := range []bool{false, true} {
+		t.Run("compression="+strconv.FormatBool(compression), func(t *testing.T) {
+			// Store samples
+			s, err := NewSamplesStore(SamplesStoreConfiguration{Compression: compression, Directory: t.TempDir()})
+			assert.NoError(t, err)
+			ss, err := s.Store("test", []int32{1, -2, 3, -4, 5, -6, 7, -8}, 16000, 16)
+			assert.NoError(t, err)
+			assert.Equal(t, compression, ss.Compressed)
+			h := (&Interface{s: s}).staticHandlerSamples()
+
+			// Full file
+			code, full, _ := getStoredSamplesForTest(t, h, ss.ID, "")
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, int(ss.Size), len(full))
+			assert.Equal(t, "RIFF", string(full[:4]))
+
+			// Ranges
+			size := strconv.Itoa(len(full))
+			for _, v := range []struct {
+				contentRange string
+				end          int
+				name         string
+				rng          string
+				start        int
+			}{
+				{contentRange: "bytes 44-47/" + size, end: 48, name: "samples", rng: "bytes=44-47", start: 44},
+				{contentRange: "bytes 50-" + strconv.Itoa(len(full)-1) + "/" + size, end: len(full), name: "clamped", rng: "bytes=50-100000", start: 50},
+				{contentRange: "bytes " + strconv.Itoa(len(full)-4) + "-" + strconv.Itoa(len(full)-1) + "/" + size, end: len(full), name: "suffix", rng: "bytes=-4", start: len(full) - 4},
+				{contentRange: "bytes 2-5/" + size, end: 6, name: "backward", rng: "bytes=2-5", start: 2},
+			} {
+				code, body, contentRange := getStoredSamplesForTest(t, h, ss.ID, v.rng)
+				assert.Equal(t, http.StatusPartialContent, code, v.name)
+				assert.Equal(t, v.contentRange, contentRange, v.name)
+				assert.Equal(t, full[v.start:v.end], body, v.name)
+			}
+
+			// Unsatisfiable range
+			code, _, contentRange := getStoredSamplesForTest(t, h, ss.ID, "bytes=100000-")
+			assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, code)
+			assert.Equal(t, "bytes */"+size, contentRange)
+
+			// Unknown samples
+			code, _, _ = getStoredSamplesForTest(t, h, "unknown", "")
+			assert.Equal(t, http.StatusNotFound, code)
+			code, _, _ = getStoredSamplesForTest(t, h, "../"+ss.ID, "")
+			assert.Equal(t, http.StatusNotFound, code)
+		})
+	}
+}
+
+func TestCompressedWavReaderSeek(t *testing.T) {
+	// Store samples
+	s, err := NewSamplesStore(SamplesStoreConfiguration{Compression: true, Directory: t.TempDir()})
+	assert.NoError(t, err)
+	ss, err := s.Store("test", []int32{1, 2, 3, 4}, 16000, 16)
+	assert.NoError(t, err)
+	rc, size, err := s.Open(ss.ID)
+	assert.NoError(t, err)
+	defer rc.Close()
+	full, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, int(size), len(full))
+	rs := rc.(io.ReadSeeker)
+
+	// Seeking backward reopens the file
+	b := make([]byte, 2)
+	n, err := rs.Seek(44, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(44), n)
+	_, err = io.ReadFull(rs, b)
+	assert.NoError(t, err)
+	assert.Equal(t, full[44:46], b)
+
+	// Seeking forward discards bytes
+	_, err = rs.Seek(2, io.SeekCurrent)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(rs, b)
+	assert.NoError(t, err)
+	assert.Equal(t, full[48:50], b)
+
+	// Seeking from the end
+	_, err = rs.Seek(-2, io.SeekEnd)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(rs, b)
+	assert.NoError(t, err)
+	assert.Equal(t, full[len(full)-2:], b)
+
+	// Invalid positions
+	_, err = rs.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+	_, err = rs.Seek(0, 42)
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package astiunderstanding
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// stream represents an ongoing streaming speech to text analysis
+// Chunks are pushed to a queue without blocking and are fed to the speech parser by a goroutine, in order, so that a
+// speech parser slow to open or to consume its stream doesn't hold up the goroutine receiving samples.
+type stream struct {
+	ch        chan []int32
+	closed    bool
+	closedAt  time.Time       // Set before ch is closed
+	cond      *sync.Cond      // Broadcast whenever closed or q change
+	ctx       context.Context // Carries the span of the utterance
+	discarded bool            // Set before ch is closed
+	m         sync.Mutex      // Locks closed, closedAt, discarded, q and samples
+	q         [][]int32
+	samples   [][]int32 // Set before ch is closed
+}
+
+// newStream creates a new stream and starts feeding it
+func newStream(ctx context.Context) (s *stream) {
+	s = &stream{
+		ch:  make(chan []int32),
+		ctx: ctx,
+	}
+	s.cond = sync.NewCond(&s.m)
+	go s.feed()
+	return
+}
+
+// push queues a chunk
+func (s *stream) push(samples []int32) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return
+	}
+	s.q = append(s.q, samples)
+	s.cond.Broadcast()
+}
+
+// close closes the stream once the queued chunks have been fed
+// If discarded is true, the queued chunks are dropped.
+func (s *stream) close(samples [][]int32, discarded bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.closedAt = time.Now()
+	s.discarded = discarded
+	s.samples = samples
+	if discarded {
+		s.q = nil
+	}
+	s.cond.Broadcast()
+}
+
+// feed feeds queued chunks to the channel and closes it once the stream is closed and its queue is empty
+// The channel is drained by runStream once the speech parser has returned, therefore feeding never blocks forever.
+func (s *stream) feed() {
+	defer close(s.ch)
+	for {
+		// Wait for a chunk
+		s.m.Lock()
+		for !s.closed && len(s.q) == 0 {
+			s.cond.Wait()
+		}
+
+		// Stream is closed and its queue is empty
+		if len(s.q) == 0 {
+			s.m.Unlock()
+			return
+		}
+
+		// Pop chunk
+		samples := s.q[0]
+		s.q = s.q[1:]
+		s.m.Unlock()
+
+		// Feed
+		s.ch <- samples
+	}
+}
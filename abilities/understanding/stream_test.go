@@ -0,0 +1,54 @@
+package astiunderstanding
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	// Pushing doesn't wait for the chunks to be consumed
+	s := newStream(context.Background())
+	chDone := make(chan struct{})
+	go func() {
+		defer close(chDone)
+		for idx := 0; idx < 3; idx++ {
+			s.push([]int32{int32(idx)})
+		}
+		s.close([][]int32{{0, 1, 2}}, false)
+	}()
+	select {
+	case <-chDone:
+	case <-time.After(time.Second):
+		t.Fatal("pushing has blocked")
+	}
+
+	// Chunks are fed in order before the channel is closed
+	var ss [][]int32
+	for samples := range s.ch {
+		ss = append(ss, samples)
+	}
+	assert.Equal(t, [][]int32{{0}, {1}, {2}}, ss)
+	assert.Equal(t, [][]int32{{0, 1, 2}}, s.samples)
+	assert.False(t, s.closedAt.IsZero())
+
+	// Chunks pushed once closed are ignored
+	s.push([]int32{3})
+	assert.Empty(t, s.q)
+}
+
+func TestStreamDiscarded(t *testing.T) {
+	// Queued chunks are dropped once discarded
+	s := newStream(context.Background())
+	s.push([]int32{0})
+	s.push([]int32{1})
+	s.close(nil, true)
+	var n int
+	for range s.ch {
+		n++
+	}
+	assert.True(t, n <= 1)
+	assert.True(t, s.discarded)
+}
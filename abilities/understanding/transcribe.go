@@ -0,0 +1,105 @@
+package astiunderstanding
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// TranscribeFile reads a wav file, parses it with the ability's speech parser and returns the transcript.
+// Multi-channel files are downmixed to mono according to DownmixMode and DownmixChannel, the number of channels being
+// read from the file header rather than from Channels.
+// It bypasses the live pipeline: nothing is dispatched, stored or sent to the webhook, and the ability doesn't have to
+// be on. If TranscribeFileSegmentation is true, the file is split into utterances by a new silence detector, whose
+// buffered speech is flushed once the file is over, and utterances are parsed in order and joined with a space.
+// Otherwise the whole file is parsed at once.
+func (a *Ability) TranscribeFile(ctx context.Context, path string) (text string, err error) {
+	// Read file
+	var samples []int32
+	var channels, sampleRate, significantBits int
+	if samples, channels, sampleRate, significantBits, err = readAudioFile(ctx, path); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: reading %s failed", path)
+		return
+	}
+
+	// Downmix
+	// The whole file has been read, therefore the samples of an incomplete trailing frame are dropped
+	samples, _ = Downmix(samples, channels, a.c.DownmixMode, a.c.DownmixChannel, nil)
+
+	// Segment
+	utterances := [][]int32{samples}
+	if a.c.TranscribeFileSegmentation {
+		utterances = a.segment(samples, sampleRate)
+	}
+
+	// Loop through utterances
+	var texts []string
+	for _, u := range utterances {
+		// Convert
+		u, uSampleRate, uSignificantBits := a.convert(u, sampleRate, significantBits)
+
+		// Execute speech to text analysis
+		r, _, err := a.speechToText(ctx, u, uSampleRate, uSignificantBits)
+		if err != nil {
+			return "", errors.Wrapf(err, "astiunderstanding: speech to text analysis of %s failed", path)
+		}
+
+		// Append text
+		if t := strings.TrimSpace(r.Text); len(t) > 0 {
+			texts = append(texts, t)
+		}
+	}
+	text = strings.Join(texts, " ")
+	astilog.Debugf("astiunderstanding: %s has been transcribed in %d utterance(s)", path, len(utterances))
+	return
+}
+
+// readAudioFile reads all the samples of a wav file, which are interleaved if it has several channels
+func readAudioFile(ctx context.Context, path string) (samples []int32, channels, sampleRate, significantBits int, err error) {
+	// Create audio source
+	var s *FileAudioSource
+	if s, err = NewFileAudioSource(path, FileAudioSourceConfiguration{}); err != nil {
+		err = errors.Wrap(err, "astiunderstanding: creating file audio source failed")
+		return
+	}
+	defer s.Close()
+	channels = int(s.wf.Channels)
+
+	// Loop through chunks
+	for {
+		// Context is done
+		if err = ctx.Err(); err != nil {
+			err = errors.Wrap(err, "astiunderstanding: context error")
+			return
+		}
+
+		// Read
+		var chunk []int32
+		if chunk, sampleRate, significantBits, err = s.Read(ctx); err != nil {
+			if err == io.EOF {
+				err = nil
+				return
+			}
+			err = errors.Wrap(err, "astiunderstanding: reading file audio source failed")
+			return
+		}
+		samples = append(samples, chunk...)
+	}
+}
+
+// segment splits samples into utterances with a new silence detector
+// Speech buffered by the silence detector once samples are over is flushed if the silence detector allows it.
+func (a *Ability) segment(samples []int32, sampleRate int) (utterances [][]int32) {
+	// Segment
+	sd := a.sd()
+	utterances = sd.Add(samples, sampleRate, a.silenceMaxAudioLevel())
+
+	// Flush
+	if v, ok := sd.(FlushableSilenceDetector); ok {
+		utterances = append(utterances, v.Flush()...)
+	}
+	return a.boundUtterances(nonEmptyUtterances(utterances), sampleRate)
+}
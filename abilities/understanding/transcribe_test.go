@@ -0,0 +1,40 @@
+package astiunderstanding
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscribeFileDownmix(t *testing.T) {
+	// Stereo file whose trailing frame is incomplete
+	path := writeMultiChannelWAVForTest(t, []int16{10, 20, -10, -30, 7}, 16000, 2)
+	for _, v := range []struct {
+		c        AbilityConfiguration
+		expected []int32
+		name     string
+	}{
+		{c: AbilityConfiguration{}, expected: []int32{15, -20}, name: "average"},
+		{c: AbilityConfiguration{DownmixChannel: 1, DownmixMode: DownmixModeSelect}, expected: []int32{20, -30}, name: "select"},
+		{c: AbilityConfiguration{Channels: 1}, expected: []int32{15, -20}, name: "file header wins over channels"},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			p := &testSpeechParser{fn: func(samples []int32) (string, error) { return " text ", nil }}
+			a, err := NewAbility(p, nil, v.c)
+			assert.NoError(t, err)
+			text, err := a.TranscribeFile(context.Background(), path)
+			assert.NoError(t, err)
+			assert.Equal(t, "text", text)
+			assert.Equal(t, [][]int32{v.expected}, p.samples())
+		})
+	}
+
+	// Mono files are not downmixed
+	p := &testSpeechParser{fn: func(samples []int32) (string, error) { return "", nil }}
+	a, err := NewAbility(p, nil, AbilityConfiguration{Channels: 2})
+	assert.NoError(t, err)
+	_, err = a.TranscribeFile(context.Background(), writeWAVForTest(t, []int16{1, 2, 3}, 16000))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]int32{{1, 2, 3}}, p.samples())
+}
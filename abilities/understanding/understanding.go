@@ -1,24 +1,221 @@
 package astiunderstanding
 
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
 // Constants
 const (
 	name = "Understanding"
 )
 
 // SilenceDetector represents an object capable of detecting valid samples between silences
+// Add must return one segment per utterance that has ended since the previous call, and nil if no utterance has ended.
+// Nil and empty segments are skipped: they are neither provided to the speech parser nor considered as the end of
+// the speech.
 type SilenceDetector interface {
 	Add(samples []int32, sampleRate int, silenceMaxAudioLevel float64) (validSamples [][]int32)
 	Reset()
 }
 
+// ContextSilenceDetector represents a silence detector capable of adding samples with a context.
+// The context is cancelled once the ability is stopped, in which case AddWithContext should return as soon as
+// possible. Its valid samples are then discarded.
+type ContextSilenceDetector interface {
+	SilenceDetector
+	AddWithContext(ctx context.Context, samples []int32, sampleRate int, silenceMaxAudioLevel float64) (validSamples [][]int32)
+}
+
+// ActiveSpeechDetector represents a silence detector capable of telling whether speech is ongoing
+type ActiveSpeechDetector interface {
+	SilenceDetector
+	IsSpeechActive() bool
+}
+
 // SpeechParser represents an object capable of parsing speech and returning the corresponding text
 type SpeechParser interface {
 	SpeechToText(samples []int32, sampleRate, significantBits int) (string, error)
 }
 
+// DetailedSpeechParser represents an object capable of parsing speech and returning the corresponding text with
+// its confidence and alternatives
+type DetailedSpeechParser interface {
+	SpeechParser
+	SpeechToTextDetailed(samples []int32, sampleRate, significantBits int) (SpeechResult, error)
+}
+
+// ContextSpeechParser represents an object capable of parsing speech with a context.
+// The context carries the span of the utterance being parsed, if tracing is enabled, so that the parser can start child
+// spans with astibrain.StartSpan. It's cancelled once the ability is stopped, in which case the parser should abort the
+// analysis and return as soon as possible.
+// Speech parsers not implementing it are executed in a goroutine so that the ability doesn't wait for them once it's
+// stopped, but the goroutine lingers until they return.
+type ContextSpeechParser interface {
+	SpeechParser
+	SpeechToTextWithContext(ctx context.Context, samples []int32, sampleRate, significantBits int) (string, error)
+}
+
+// ContextDetailedSpeechParser represents a detailed speech parser capable of parsing speech with a context, see
+// ContextSpeechParser
+type ContextDetailedSpeechParser interface {
+	DetailedSpeechParser
+	SpeechToTextDetailedWithContext(ctx context.Context, samples []int32, sampleRate, significantBits int) (SpeechResult, error)
+}
+
+// SpeechResult represents a detailed speech to text result
+type SpeechResult struct {
+	Alternatives []SpeechAlternative `json:"alternatives,omitempty"`
+	Confidence   float64             `json:"confidence"`
+	Language     string              `json:"language,omitempty"`
+	Text         string              `json:"text"`
+}
+
+// SpeechAlternative represents an alternative speech to text hypothesis
+type SpeechAlternative struct {
+	Confidence float64 `json:"confidence"`
+	Text       string  `json:"text"`
+}
+
+// speechToTextDetailed executes the detailed speech to text analysis if the parser provides it, and the simple one
+// otherwise
+func speechToTextDetailed(p SpeechParser, samples []int32, sampleRate, significantBits int) (r SpeechResult, err error) {
+	if v, ok := p.(DetailedSpeechParser); ok {
+		return v.SpeechToTextDetailed(samples, sampleRate, significantBits)
+	}
+	r.Text, err = p.SpeechToText(samples, sampleRate, significantBits)
+	return
+}
+
+// wrapperSpeechParser represents a speech parser wrapping other speech parsers, such as the circuit breaker and the
+// fallback speech parsers, which forwards the context and the language to the speech parsers it wraps
+type wrapperSpeechParser interface {
+	isContextAware(language string) bool
+	speechToTextWrapped(ctx context.Context, samples []int32, sampleRate, significantBits int, language string) (r SpeechResult, backend string, err error)
+}
+
+// parseSpeech executes the speech to text analysis with the richest variant the speech parser provides, and returns
+// the backend that produced the result if the parser provides it.
+// The context is only honoured by speech parsers taking one.
+func parseSpeech(ctx context.Context, p SpeechParser, samples []int32, sampleRate, significantBits int, language string) (r SpeechResult, backend string, err error) {
+	// Wrapper
+	if v, ok := p.(wrapperSpeechParser); ok {
+		return v.speechToTextWrapped(ctx, samples, sampleRate, significantBits, language)
+	}
+
+	// Language
+	if len(language) > 0 {
+		if v, ok := p.(ContextLanguageSpeechParser); ok {
+			r.Text, err = v.SpeechToTextWithLanguageContext(ctx, samples, sampleRate, significantBits, language)
+			return
+		} else if v, ok := p.(LanguageSpeechParser); ok {
+			r.Text, err = v.SpeechToTextWithLanguage(samples, sampleRate, significantBits, language)
+			return
+		}
+	}
+
+	// Context
+	if v, ok := p.(ContextDetailedSpeechParser); ok {
+		r, err = v.SpeechToTextDetailedWithContext(ctx, samples, sampleRate, significantBits)
+		return
+	} else if v, ok := p.(ContextSpeechParser); ok {
+		r.Text, err = v.SpeechToTextWithContext(ctx, samples, sampleRate, significantBits)
+		return
+	}
+
+	// Backend
+	if v, ok := p.(backendSpeechParser); ok {
+		return v.SpeechToTextWithBackend(samples, sampleRate, significantBits)
+	}
+	r, err = speechToTextDetailed(p, samples, sampleRate, significantBits)
+	return
+}
+
+// isContextAware checks whether parseSpeech honours the context all the way down to the speech parser that will be
+// executed
+func isContextAware(p SpeechParser, language string) bool {
+	if v, ok := p.(wrapperSpeechParser); ok {
+		return v.isContextAware(language)
+	}
+	if _, ok := p.(LanguageSpeechParser); ok && len(language) > 0 {
+		_, ok = p.(ContextLanguageSpeechParser)
+		return ok
+	}
+	switch p.(type) {
+	case ContextDetailedSpeechParser, ContextSpeechParser:
+		return true
+	}
+	return false
+}
+
+// recoverSpeechParser converts a speech parser panic into an error.
+// It must be deferred by the function calling the speech parser.
+func recoverSpeechParser(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("astiunderstanding: speech parser panicked: %v\n%s", r, debug.Stack())
+	}
+}
+
+// LanguageSpeechParser represents an object capable of parsing speech in a specific language
+type LanguageSpeechParser interface {
+	SpeechParser
+	SpeechToTextWithLanguage(samples []int32, sampleRate, significantBits int, language string) (string, error)
+}
+
+// ContextLanguageSpeechParser represents a language speech parser capable of parsing speech with a context, see
+// ContextSpeechParser
+type ContextLanguageSpeechParser interface {
+	LanguageSpeechParser
+	SpeechToTextWithLanguageContext(ctx context.Context, samples []int32, sampleRate, significantBits int, language string) (string, error)
+}
+
+// LanguageDetector represents an object capable of detecting the language spoken in audio samples
+type LanguageDetector interface {
+	DetectLanguage(samples []int32, sampleRate int) (string, error)
+}
+
+// StreamingSpeechParser represents an object capable of parsing speech while it is being received
+// SpeechToTextStream is fed chunks of samples until the channel is closed, executes fn on each partial text
+// and returns the final text
+type StreamingSpeechParser interface {
+	SpeechParser
+	SpeechToTextStream(chunks <-chan []int32, sampleRate, significantBits int, fn func(partial string)) (string, error)
+}
+
+// WakeWordDetector represents an object capable of detecting a wake word in audio samples
+type WakeWordDetector interface {
+	Detect(samples []int32, sampleRate int) bool
+}
+
 // Websocket event names
 const (
-	websocketEventNameAnalysis      = "analysis"
-	websocketEventNameSamples       = "samples"
-	websocketEventNameSamplesStored = "samples.stored"
+	websocketEventNameAnalysis          = "analysis"
+	websocketEventNameAnalysisDropped   = "analysis.dropped"
+	websocketEventNameAnalysisError     = "analysis.error"
+	websocketEventNameAnalysisPartial   = "analysis.partial"
+	websocketEventNameAudioLevel        = "audio.level"
+	websocketEventNameCircuitBreaker    = "circuit.breaker"
+	websocketEventNameIntent            = "intent"
+	websocketEventNameIntentUnmatched   = "intent.unmatched"
+	websocketEventNameListenOnce        = "listen.once"
+	websocketEventNameListeningState    = "listening.state"
+	websocketEventNameSamples           = "samples"
+	websocketEventNameSamplesStored     = "samples.stored"
+	websocketEventNameSamplesStoring    = "samples.storing"
+	websocketEventNameSleep             = "sleep"
+	websocketEventNameSourceReconnected = "source.reconnected"
+	websocketEventNameSpeechDetected    = "speech.detected"
+	websocketEventNameSpeechEnded       = "speech.ended"
+	websocketEventNameWakeWord          = "wake.word"
+)
+
+// Output port names
+const (
+	outputPortTranscript = "transcript"
+)
+
+// Span names
+const (
+	spanNameUtterance = "astiunderstanding.utterance"
 )
@@ -0,0 +1,97 @@
+package astiunderstanding
+
+import (
+	"time"
+
+	"github.com/asticode/go-astilog"
+)
+
+// Utterance overflow modes
+const (
+	UtteranceOverflowModeSplit    = "split"
+	UtteranceOverflowModeTruncate = "truncate"
+)
+
+// UtteranceStats represents the number of utterances altered by the utterance bounds
+type UtteranceStats struct {
+	Discarded int `json:"discarded"`
+	Split     int `json:"split"`
+	Truncated int `json:"truncated"`
+}
+
+// UtteranceStats returns the number of utterances altered by the utterance bounds
+func (a *Ability) UtteranceStats() UtteranceStats {
+	a.um.Lock()
+	defer a.um.Unlock()
+	return a.us
+}
+
+// utteranceSamples returns the number of samples of an utterance lasting d
+func utteranceSamples(d time.Duration, sampleRate int) int {
+	return int(d.Seconds() * float64(sampleRate))
+}
+
+// boundUtterances discards utterances that are too short and splits or truncates utterances that are too long
+func (a *Ability) boundUtterances(utterances [][]int32, sampleRate int) (o [][]int32) {
+	// No bounds
+	if a.c.MinUtteranceDuration <= 0 && a.c.MaxUtteranceDuration <= 0 {
+		return utterances
+	}
+
+	// Get bounds
+	min := utteranceSamples(a.c.MinUtteranceDuration, sampleRate)
+	max := utteranceSamples(a.c.MaxUtteranceDuration, sampleRate)
+
+	// Loop through utterances
+	for _, u := range utterances {
+		// Utterance is too long
+		if max > 0 && len(u) > max {
+			if a.c.UtteranceOverflowMode == UtteranceOverflowModeTruncate {
+				a.countUtterance(func(s *UtteranceStats) { s.Truncated++ })
+				if a.c.LogUtteranceBounds {
+					astilog.Debugf("astiunderstanding: truncating utterance of %d samples to %d samples", len(u), max)
+				}
+				u = u[:max]
+			} else {
+				a.countUtterance(func(s *UtteranceStats) { s.Split++ })
+				if a.c.LogUtteranceBounds {
+					astilog.Debugf("astiunderstanding: splitting utterance of %d samples into chunks of %d samples", len(u), max)
+				}
+				for len(u) > max {
+					o = append(o, u[:max])
+					u = u[max:]
+				}
+			}
+		}
+
+		// Utterance is too short
+		// The last chunk of a split utterance is discarded as well if it's too short
+		if len(u) < min {
+			a.countUtterance(func(s *UtteranceStats) { s.Discarded++ })
+			if a.c.LogUtteranceBounds {
+				astilog.Debugf("astiunderstanding: discarding utterance of %d samples shorter than %d samples", len(u), min)
+			}
+			continue
+		}
+		o = append(o, u)
+	}
+	return
+}
+
+// countUtterance updates the utterance stats
+func (a *Ability) countUtterance(fn func(s *UtteranceStats)) {
+	a.um.Lock()
+	defer a.um.Unlock()
+	fn(&a.us)
+}
+
+// nonEmptyUtterances removes nil and empty utterances so that they're never provided to the speech parser.
+// It returns nil if there are no utterances left.
+func nonEmptyUtterances(utterances [][]int32) (o [][]int32) {
+	for _, u := range utterances {
+		if len(u) > 0 {
+			o = append(o, u)
+		}
+	}
+	return
+}
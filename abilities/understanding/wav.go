@@ -0,0 +1,83 @@
+package astiunderstanding
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// wavHeaderSize is the size of a canonical wav header
+const wavHeaderSize = 44
+
+// pcmSampleSize returns the number of bytes a sample uses in a wav file
+func pcmSampleSize(significantBits int) int {
+	if n := (significantBits + 7) / 8; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// wavHeader generates the canonical header of a mono PCM wav file
+func wavHeader(numSamples, sampleRate, significantBits int) []byte {
+	// Get sizes
+	sampleSize := pcmSampleSize(significantBits)
+	dataSize := uint32(numSamples * sampleSize)
+
+	// Write header
+	b := make([]byte, wavHeaderSize)
+	copy(b[0:], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], 36+dataSize)
+	copy(b[8:], "WAVE")
+	copy(b[12:], "fmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(b[22:], 1) // Mono
+	binary.LittleEndian.PutUint32(b[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(b[28:], uint32(sampleRate*sampleSize))
+	binary.LittleEndian.PutUint16(b[32:], uint16(sampleSize))
+	binary.LittleEndian.PutUint16(b[34:], uint16(sampleSize*8))
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], dataSize)
+	return b
+}
+
+// writePCMSample writes a sample the way it's written in a wav file: little endian, signed except for 8 bits samples
+// which are unsigned
+func writePCMSample(w io.Writer, sample int32, sampleSize int) (err error) {
+	b := make([]byte, sampleSize)
+	if sampleSize == 1 {
+		b[0] = uint8(sample + 128)
+	} else {
+		for idx := range b {
+			b[idx] = byte(sample >> uint(8*idx))
+		}
+	}
+	_, err = w.Write(b)
+	return
+}
+
+// readPCMSample reads a sample written by writePCMSample
+func readPCMSample(r io.Reader, sampleSize int) (sample int32, err error) {
+	// Read
+	b := make([]byte, sampleSize)
+	if _, err = io.ReadFull(r, b); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return
+	}
+
+	// 8 bits samples are unsigned
+	if sampleSize == 1 {
+		sample = int32(b[0]) - 128
+		return
+	}
+
+	// Decode and extend sign
+	var u uint32
+	for idx := range b {
+		u |= uint32(b[idx]) << uint(8*idx)
+	}
+	shift := uint(32 - 8*sampleSize)
+	sample = int32(u<<shift) >> shift
+	return
+}
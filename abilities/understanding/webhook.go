@@ -0,0 +1,241 @@
+package astiunderstanding
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Webhook headers
+const (
+	WebhookHeaderSignature = "X-Astibob-Signature"
+)
+
+// WebhookConfiguration represents a webhook configuration
+// If URL is empty, the webhook is disabled. Otherwise, each analysis with a non-empty text is POSTed as JSON to URL by
+// a pool of Workers workers. At most QueueSize analyses wait for a worker, the ones exceeding it are dropped so that
+// the transcription loop is never blocked.
+// Requests time out after Timeout and failed requests, including the ones receiving a non-2xx response, are retried
+// up to MaxRetries times, waiting RetryDelay before the first retry and doubling it for each following retry.
+// If Secret is set, the hex encoded HMAC-SHA256 of the request body computed with the secret is provided in the
+// X-Astibob-Signature header so that the receiver can verify the request authenticity.
+type WebhookConfiguration struct {
+	MaxRetries int           `toml:"max_retries"`
+	QueueSize  int           `toml:"queue_size"`
+	RetryDelay time.Duration `toml:"retry_delay"`
+	Secret     string        `toml:"secret"`
+	Timeout    time.Duration `toml:"timeout"`
+	URL        string        `toml:"url"`
+	Workers    int           `toml:"workers"`
+}
+
+// WebhookStats represents the number of analyses handled by the webhook
+// Failed counts the analyses whose delivery has failed once retries have been exhausted.
+type WebhookStats struct {
+	Delivered int `json:"delivered"`
+	Dropped   int `json:"dropped"`
+	Failed    int `json:"failed"`
+}
+
+// webhook represents a webhook
+type webhook struct {
+	c  WebhookConfiguration
+	ch chan PayloadAnalysis
+	hc *http.Client
+	m  sync.Mutex // Locks s
+	s  WebhookStats
+	wg *sync.WaitGroup
+}
+
+// newWebhook creates a new webhook
+// It returns nil if the webhook is disabled.
+func newWebhook(c WebhookConfiguration) (w *webhook) {
+	// Webhook is disabled
+	if len(c.URL) == 0 {
+		return nil
+	}
+
+	// Default configuration values
+	if c.QueueSize <= 0 {
+		c.QueueSize = 100
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.Workers <= 0 {
+		c.Workers = 1
+	}
+
+	// Create
+	return &webhook{
+		c:  c,
+		ch: make(chan PayloadAnalysis, c.QueueSize),
+		hc: &http.Client{Timeout: c.Timeout},
+		wg: &sync.WaitGroup{},
+	}
+}
+
+// WebhookStats returns the number of analyses handled by the webhook
+func (a *Ability) WebhookStats() WebhookStats {
+	if a.wh == nil {
+		return WebhookStats{}
+	}
+	a.wh.m.Lock()
+	defer a.wh.m.Unlock()
+	return a.wh.s
+}
+
+// count updates the webhook stats
+func (w *webhook) count(fn func(s *WebhookStats)) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	fn(&w.s)
+}
+
+// start starts the workers until the context is done
+// A nil *webhook doesn't start anything.
+func (w *webhook) start(ctx context.Context) {
+	// Webhook is disabled
+	if w == nil {
+		return
+	}
+
+	// Loop through workers
+	for idx := 0; idx < w.c.Workers; idx++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for {
+				select {
+				case p := <-w.ch:
+					w.deliver(ctx, p)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// wait waits for the workers to be stopped
+func (w *webhook) wait() {
+	if w == nil {
+		return
+	}
+	w.wg.Wait()
+}
+
+// send enqueues an analysis without blocking
+// A nil *webhook doesn't send anything.
+func (w *webhook) send(p PayloadAnalysis) {
+	// Webhook is disabled
+	if w == nil {
+		return
+	}
+
+	// Enqueue
+	select {
+	case w.ch <- p:
+	default:
+		astilog.Errorf("astiunderstanding: webhook queue of %d analyses is full, dropping analysis", w.c.QueueSize)
+		w.count(func(s *WebhookStats) { s.Dropped++ })
+	}
+}
+
+// deliver POSTs an analysis to the webhook and retries if needed
+func (w *webhook) deliver(ctx context.Context, p PayloadAnalysis) {
+	// Marshal
+	b, err := json.Marshal(p)
+	if err != nil {
+		astilog.Error(errors.Wrapf(err, "astiunderstanding: json marshaling %#v failed", p))
+		w.count(func(s *WebhookStats) { s.Failed++ })
+		return
+	}
+
+	// Loop through attempts
+	delay := w.c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		// Post
+		if err = w.post(ctx, b); err == nil {
+			w.count(func(s *WebhookStats) { s.Delivered++ })
+			return
+		}
+
+		// Retries have been exhausted
+		if attempt >= w.c.MaxRetries {
+			astilog.Error(errors.Wrapf(err, "astiunderstanding: delivering analysis to webhook failed after %d attempt(s)", attempt+1))
+			w.count(func(s *WebhookStats) { s.Failed++ })
+			return
+		}
+
+		// Log
+		astilog.Debugf("astiunderstanding: delivering analysis to webhook failed, retrying in %s: %s", delay, err)
+
+		// Wait
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			w.count(func(s *WebhookStats) { s.Failed++ })
+			return
+		}
+	}
+}
+
+// post POSTs a body to the webhook
+func (w *webhook) post(ctx context.Context, b []byte) (err error) {
+	// Create request
+	var r *http.Request
+	if r, err = http.NewRequest(http.MethodPost, w.c.URL, bytes.NewReader(b)); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: creating request to %s failed", w.c.URL)
+		return
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+
+	// Sign
+	if len(w.c.Secret) > 0 {
+		r.Header.Set(WebhookHeaderSignature, SignWebhookBody(w.c.Secret, b))
+	}
+
+	// Send
+	var resp *http.Response
+	if resp, err = w.hc.Do(r); err != nil {
+		err = errors.Wrapf(err, "astiunderstanding: sending request to %s failed", w.c.URL)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Drain body so that the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	// Check status code
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("astiunderstanding: request to %s returned status code %d", w.c.URL, resp.StatusCode)
+		return
+	}
+	return
+}
+
+// SignWebhookBody returns the hex encoded HMAC-SHA256 of a webhook request body computed with the secret
+// Receivers can compare it to the X-Astibob-Signature header with hmac.Equal.
+func SignWebhookBody(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,120 @@
+package astiunderstanding
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhookBody(t *testing.T) {
+	assert.Equal(t, "dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355", SignWebhookBody("secret", []byte("body")))
+	assert.NotEqual(t, SignWebhookBody("secret", []byte("body")), SignWebhookBody("other", []byte("body")))
+}
+
+// testWebhookServer represents a webhook receiver failing the first requests
+type testWebhookServer struct {
+	bodies   [][]byte
+	fails    int
+	m        sync.Mutex // Locks bodies, fails and requests
+	requests []*http.Request
+}
+
+func (s *testWebhookServer) reset(fails int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.bodies, s.fails, s.requests = nil, fails, nil
+}
+
+func (s *testWebhookServer) received() ([]*http.Request, [][]byte) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]*http.Request{}, s.requests...), append([][]byte{}, s.bodies...)
+}
+
+func (s *testWebhookServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, b)
+	if s.fails > 0 {
+		s.fails--
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestWebhookDeliver(t *testing.T) {
+	// Signed request is retried until it succeeds
+	ts := &testWebhookServer{fails: 2}
+	s := httptest.NewServer(ts)
+	defer s.Close()
+	w := newWebhook(WebhookConfiguration{MaxRetries: 2, RetryDelay: time.Millisecond, Secret: "secret", URL: s.URL})
+	w.deliver(context.Background(), PayloadAnalysis{Text: "test"})
+	assert.Equal(t, WebhookStats{Delivered: 1}, w.s)
+	rs, bs := ts.received()
+	assert.Len(t, rs, 3)
+	for idx, r := range rs {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.True(t, hmac.Equal([]byte(SignWebhookBody("secret", bs[idx])), []byte(r.Header.Get(WebhookHeaderSignature))))
+		var p PayloadAnalysis
+		assert.NoError(t, json.Unmarshal(bs[idx], &p))
+		assert.Equal(t, "test", p.Text)
+	}
+
+	// Delivery fails once retries have been exhausted and requests are not signed without secret
+	ts.reset(3)
+	w = newWebhook(WebhookConfiguration{MaxRetries: 1, RetryDelay: time.Millisecond, URL: s.URL})
+	w.deliver(context.Background(), PayloadAnalysis{Text: "test"})
+	assert.Equal(t, WebhookStats{Failed: 1}, w.s)
+	rs, _ = ts.received()
+	assert.Len(t, rs, 2)
+	assert.Equal(t, "", rs[0].Header.Get(WebhookHeaderSignature))
+
+	// Delivery fails if the context is done while waiting for a retry
+	ts.reset(1)
+	w = newWebhook(WebhookConfiguration{MaxRetries: 1, RetryDelay: time.Hour, URL: s.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	w.deliver(ctx, PayloadAnalysis{Text: "test"})
+	assert.Equal(t, WebhookStats{Failed: 1}, w.s)
+}
+
+func TestWebhookSend(t *testing.T) {
+	// Disabled webhook does nothing
+	var w *webhook
+	assert.Nil(t, newWebhook(WebhookConfiguration{}))
+	w.send(PayloadAnalysis{})
+	w.start(context.Background())
+	w.wait()
+
+	// Analyses exceeding the queue are dropped
+	ts := &testWebhookServer{}
+	s := httptest.NewServer(ts)
+	defer s.Close()
+	w = newWebhook(WebhookConfiguration{QueueSize: 1, URL: s.URL})
+	w.send(PayloadAnalysis{Text: "1"})
+	w.send(PayloadAnalysis{Text: "2"})
+	assert.Equal(t, WebhookStats{Dropped: 1}, w.s)
+
+	// Queued analyses are delivered by the workers
+	ctx, cancel := context.WithCancel(context.Background())
+	w.start(ctx)
+	a := &Ability{wh: w}
+	for deadline := time.Now().Add(time.Second); a.WebhookStats().Delivered == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	w.wait()
+	assert.Equal(t, WebhookStats{Delivered: 1, Dropped: 1}, a.WebhookStats())
+	rs, _ := ts.received()
+	assert.Len(t, rs, 1)
+}
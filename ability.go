@@ -2,32 +2,48 @@ package astibob
 
 import (
 	"sync"
+	"time"
 
 	"net/http"
+
+	"github.com/asticode/go-astibob/brain"
 )
 
 // ability represents an ability
 type ability struct {
-	apiHandlers    map[string]http.Handler
-	description    string
-	key            string
-	o              bool
-	m              sync.Mutex
-	name           string
-	staticHandlers map[string]http.Handler
-	webHomepage    string
+	apiHandlers              map[string]http.Handler
+	brainWebsocketListeners  []astibrain.WebsocketEventName
+	clientWebsocketListeners []string
+	d                        *astibrain.AbilityDescriptor
+	description              string
+	key                      string
+	lastErr                  string
+	o                        bool
+	m                        sync.Mutex
+	name                     string
+	st                       astibrain.AbilityState
+	staticHandlers           map[string]http.Handler
+	uptime                   time.Duration // As of uptimeAt
+	uptimeAt                 time.Time
+	webHomepage              string
+	webTemplatesPaths        []string
 }
 
 // newAbility creates a new ability
-func newAbility(name, description string, isOn bool) *ability {
-	return &ability{
+func newAbility(name, description string, isOn bool) (a *ability) {
+	a = &ability{
 		apiHandlers:    make(map[string]http.Handler),
 		description:    description,
 		key:            key(name),
 		o:              isOn,
 		name:           name,
+		st:             astibrain.AbilityStateOff,
 		staticHandlers: make(map[string]http.Handler),
 	}
+	if isOn {
+		a.st = astibrain.AbilityStateOn
+	}
+	return
 }
 
 // apiHandler returns the API handler based on its path
@@ -38,6 +54,20 @@ func (a *ability) apiHandler(path string) (h http.Handler, ok bool) {
 	return
 }
 
+// descriptor returns the ability descriptor or nil if the brain hasn't described its abilities
+func (a *ability) descriptor() *astibrain.AbilityDescriptor {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.d
+}
+
+// setDescriptor sets the ability descriptor
+func (a *ability) setDescriptor(d astibrain.AbilityDescriptor) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.d = &d
+}
+
 // isOn returns whether the ability is on
 func (a *ability) isOn() bool {
 	a.m.Lock()
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/asticode/go-astibob/brain"
 	"github.com/asticode/go-astilog"
 	"github.com/asticode/go-astitools/template"
 	"github.com/asticode/go-astiws"
@@ -28,9 +29,10 @@ type Bob struct {
 
 // Configuration represents a Bob configuration.
 type Configuration struct {
-	BrainsServer       ServerConfiguration `toml:"brains_server"`
-	ClientsServer      ServerConfiguration `toml:"clients_server"`
-	ResourcesDirectory string              `toml:"resources_directory"`
+	BrainsServer       ServerConfiguration        `toml:"brains_server"`
+	ClientsServer      ServerConfiguration        `toml:"clients_server"`
+	Discovery          astibrain.DiscoveryOptions `toml:"discovery"`
+	ResourcesDirectory string                     `toml:"resources_directory"`
 }
 
 // New creates a new Bob.
@@ -52,8 +54,10 @@ func New(c Configuration) (b *Bob, err error) {
 	// Create servers
 	brainsWs := astiws.NewManager(c.BrainsServer.Ws)
 	clientsWs := astiws.NewManager(c.BrainsServer.Ws)
-	b.brainsServer = newBrainsServer(b.templater, b.brains, brainsWs, clientsWs, b.dispatcher, b.interfaces, c.BrainsServer)
-	b.clientsServer = newClientsServer(b.templater, b.brains, clientsWs, b.interfaces, b.stop, c)
+	r := newReplayer(c.ClientsServer.ReplaySize)
+	ss := newSubscriptions(c.ClientsServer.UnsubscribedEvents)
+	b.brainsServer = newBrainsServer(b.templater, b.brains, brainsWs, clientsWs, b.dispatcher, b.interfaces, r, ss, c.BrainsServer)
+	b.clientsServer = newClientsServer(b.templater, b.brains, clientsWs, b.interfaces, r, ss, b.stop, c)
 	return
 }
 
@@ -98,6 +102,15 @@ func (b *Bob) Run(ctx context.Context) (err error) {
 		}
 	}()
 
+	// Advertise brains server
+	if b.c.Discovery.Enabled {
+		if s, err := b.advertise(); err != nil {
+			astilog.Error(errors.Wrap(err, "astibob: advertising brains server failed"))
+		} else {
+			defer s.Shutdown()
+		}
+	}
+
 	// Dispatch event
 	// TODO Only fire this event once servers are up and running
 	b.dispatcher.dispatch(Event{Name: EventNameReady})
@@ -122,16 +135,29 @@ func (b *Bob) stop() {
 	b.cancel()
 }
 
-// dispatchWsEventToManager dispatches a websocket event to a manager.
-func dispatchWsEventToManager(ws *astiws.Manager, name string, payload interface{}) {
+// dispatchWsEventToManager dispatches a websocket event to the clients of a manager that are subscribed to it.
+func dispatchWsEventToManager(ws *astiws.Manager, ss *subscriptions, name string, payload interface{}) {
 	ws.Loop(func(k interface{}, c *astiws.Client) {
-		dispatchWsEventToClient(c, name, payload)
+		if !ss.isSubscribed(c, name) {
+			return
+		}
+		dispatchWsEventToClient(c, ss, name, payload)
 	})
 }
 
 // dispatchWsEventToClient dispatches a websocket event to a client.
-func dispatchWsEventToClient(c *astiws.Client, name string, payload interface{}) {
-	if err := c.Write(name, payload); err != nil {
+// The payload is wrapped in an envelope if the client has negotiated envelopes.
+func dispatchWsEventToClient(c *astiws.Client, ss *subscriptions, name string, payload interface{}) {
+	// Wrap
+	// Clients don't exchange the versions they know, they always receive the current version
+	var err error
+	if payload, err = wrapWsEvent(ss.hasEnvelope(c), nil, name, payload); err != nil {
+		astilog.Error(errors.Wrapf(err, "astibob: wrapping %s event for ws client %p failed", name, c))
+		return
+	}
+
+	// Write
+	if err = c.Write(name, payload); err != nil {
 		astilog.Error(errors.Wrapf(err, "astibob: writing %s event with payload %#v to ws client %p failed", name, payload, c))
 		return
 	}
@@ -3,35 +3,138 @@ package astibob
 import (
 	"sync"
 
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
 	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
 )
 
 // brain is a brain as Bob knows it
 type brain struct {
-	k    map[string]*ability // Indexed by key
-	key  string
-	m    sync.Mutex          // Locks a
-	n    map[string]*ability // Indexed by name
-	name string
-	ws   *astiws.Client
+	abilityStates  bool
+	envelope       bool
+	isReady        bool
+	k              map[string]*ability // Indexed by key
+	key            string
+	m              sync.Mutex // Locks a, abilityStates, isReady and reconfigures
+	maxMessageSize int
+	n              map[string]*ability // Indexed by normalized name
+	name           string
+	reconfigures   map[string]chan string // Indexed by reconfigure id
+	versions       map[string]int
+	ws             *astiws.Client
 }
 
 // newBrain creates a new brain
-func newBrain(name string, ws *astiws.Client) *brain {
+// versions are the schema versions of the websocket events the brain knows. Outgoing messages exceeding maxMessageSize
+// bytes are rejected.
+func newBrain(name string, ws *astiws.Client, envelope bool, versions map[string]int, maxMessageSize int) *brain {
 	return &brain{
-		k:    make(map[string]*ability),
-		key:  key(name),
-		n:    make(map[string]*ability),
-		name: name,
-		ws:   ws,
+		envelope:       envelope,
+		k:              make(map[string]*ability),
+		key:            key(name),
+		maxMessageSize: maxMessageSize,
+		n:              make(map[string]*ability),
+		name:           name,
+		reconfigures:   make(map[string]chan string),
+		versions:       versions,
+		ws:             ws,
 	}
 }
 
+// addListener adds a listener that receives payloads unwrapped from their envelope
+func (b *brain) addListener(eventName astibrain.WebsocketEventName, l astiws.ListenerFunc) {
+	if b.envelope {
+		l = astibrain.UnwrapWebsocketListener(l)
+	}
+	b.ws.AddListener(string(eventName), l)
+}
+
+// delListener removes the listeners of an event
+func (b *brain) delListener(eventName astibrain.WebsocketEventName) {
+	b.ws.DelListener(string(eventName))
+}
+
+// write writes an event wrapped in an envelope if needed
+func (b *brain) write(eventName astibrain.WebsocketEventName, payload interface{}) (err error) {
+	if payload, err = wrapWsEvent(b.envelope, b.versions, string(eventName), payload); err != nil {
+		return
+	}
+	return writeWsEvent(b.ws, b.maxMessageSize, string(eventName), payload)
+}
+
+// wrapWsEvent wraps an event payload in an envelope if envelopes have been negotiated
+func wrapWsEvent(envelope bool, versions map[string]int, eventName string, payload interface{}) (interface{}, error) {
+	// No envelope
+	if !envelope {
+		return payload, nil
+	}
+
+	// Wrap
+	e, err := astibrain.NewEnvelope(eventName, payload, versions)
+	if err != nil {
+		return nil, errors.Wrapf(err, "astibob: wrapping %s payload failed", eventName)
+	}
+	return e, nil
+}
+
+// dispatch writes an event and mutes the error (which is still logged)
+func (b *brain) dispatch(eventName astibrain.WebsocketEventName, payload interface{}) {
+	if err := b.write(eventName, payload); err != nil {
+		astilog.Error(errors.Wrapf(err, "astibob: writing %s event to brain %s failed", eventName, b.name))
+	}
+}
+
+// writeWsEvent writes an event
+// Messages exceeding maxMessageSize bytes are rejected, see astibrain.CheckWebsocketMessageSize.
+func writeWsEvent(c *astiws.Client, maxMessageSize int, eventName string, payload interface{}) (err error) {
+	// Check size
+	if err = astibrain.CheckWebsocketMessageSize(eventName, payload, maxMessageSize); err != nil {
+		err = errors.Wrapf(err, "astibob: checking event %s size failed", eventName)
+		return
+	}
+
+	// Write
+	if err = c.Write(eventName, payload); err != nil {
+		err = errors.Wrapf(err, "astibob: writing event %s with payload %#v failed", eventName, payload)
+		return
+	}
+	return
+}
+
+// ready returns whether the brain has resolved its AutoStart abilities
+func (b *brain) ready() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.isReady
+}
+
+// setReady sets whether the brain has resolved its AutoStart abilities
+func (b *brain) setReady(ready bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.isReady = ready
+}
+
+// sendsAbilityStates returns whether the brain sends ability state events
+func (b *brain) sendsAbilityStates() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.abilityStates
+}
+
+// setSendsAbilityStates records that the brain sends ability state events
+func (b *brain) setSendsAbilityStates() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.abilityStates = true
+}
+
 // ability returns a specific ability based on its name.
 func (b *brain) ability(name string) (a *ability, ok bool) {
 	b.m.Lock()
 	defer b.m.Unlock()
-	a, ok = b.n[name]
+	a, ok = b.n[astibrain.NormalizeAbilityName(name)]
 	return
 }
 
@@ -56,10 +159,47 @@ func (b *brain) abilities(fn func(a *ability) error) (err error) {
 	return
 }
 
+// del deletes the ability from the pool.
+func (b *brain) del(a *ability) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	delete(b.k, a.key)
+	delete(b.n, astibrain.NormalizeAbilityName(a.name))
+}
+
 // set sets the ability in the pool.
 func (b *brain) set(a *ability) {
 	b.m.Lock()
 	defer b.m.Unlock()
 	b.k[a.key] = a
-	b.n[a.name] = a
+	b.n[astibrain.NormalizeAbilityName(a.name)] = a
+}
+
+// addReconfigure adds a pending reconfigure and returns the channel its error, if any, is sent to
+func (b *brain) addReconfigure(id string) chan string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	ch := make(chan string, 1)
+	b.reconfigures[id] = ch
+	return ch
+}
+
+// delReconfigure deletes a pending reconfigure
+func (b *brain) delReconfigure(id string) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	delete(b.reconfigures, id)
+}
+
+// resolveReconfigure resolves a pending reconfigure and returns whether it was pending
+func (b *brain) resolveReconfigure(id, err string) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	ch, ok := b.reconfigures[id]
+	if !ok {
+		return false
+	}
+	delete(b.reconfigures, id)
+	ch <- err
+	return true
 }
@@ -1,6 +1,11 @@
 package astibrain
 
-import "sync"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
 
 // abilities is a pool of abilities
 type abilities struct {
@@ -8,6 +13,13 @@ type abilities struct {
 	m sync.Mutex // Locks a
 }
 
+// NormalizeAbilityName returns the canonical form of an ability name which is trimmed and lowercased.
+// Abilities are looked up by their canonical name so that "Understanding" and " understanding" refer to the same
+// ability, while their name is displayed as it has been provided.
+func NormalizeAbilityName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
 // newAbilities creates a new pool of abilities
 func newAbilities() *abilities {
 	return &abilities{a: make(map[string]*ability)}
@@ -17,7 +29,7 @@ func newAbilities() *abilities {
 func (as *abilities) ability(name string) (a *ability, ok bool) {
 	as.m.Lock()
 	defer as.m.Unlock()
-	a, ok = as.a[name]
+	a, ok = as.a[NormalizeAbilityName(name)]
 	return
 }
 
@@ -34,10 +46,101 @@ func (as *abilities) abilities(fn func(a *ability) error) (err error) {
 	return
 }
 
+// del deletes an ability from the pool.
+func (as *abilities) del(name string) {
+	as.m.Lock()
+	defer as.m.Unlock()
+	delete(as.a, NormalizeAbilityName(name))
+}
+
+// dependents returns the abilities depending on a specific ability.
+func (as *abilities) dependents(name string) (o []*ability) {
+	as.m.Lock()
+	defer as.m.Unlock()
+	name = NormalizeAbilityName(name)
+	for _, a := range as.a {
+		for _, d := range a.c.DependsOn {
+			if NormalizeAbilityName(d) == name {
+				o = append(o, a)
+				break
+			}
+		}
+	}
+	return
+}
+
+// list returns a copy of the abilities so that they can be processed without locking the pool.
+func (as *abilities) list() (o []*ability) {
+	as.m.Lock()
+	defer as.m.Unlock()
+	for _, a := range as.a {
+		o = append(o, a)
+	}
+	return
+}
+
 // set sets a new ability in the pool.
 func (as *abilities) set(a *ability) {
 	as.m.Lock()
 	defer as.m.Unlock()
-	as.a[a.name] = a
+	as.a[NormalizeAbilityName(a.name)] = a
+	return
+}
+
+// sorted returns the abilities sorted so that dependencies always come before their dependents.
+// An error is returned if a cyclic dependency is detected. Unknown dependencies are ignored.
+func (as *abilities) sorted() (o []*ability, err error) {
+	// Lock
+	as.m.Lock()
+	defer as.m.Unlock()
+
+	// Sort names by priority so that the order is deterministic
+	var names []string
+	for n := range as.a {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pi, pj := as.a[names[i]].c.Priority, as.a[names[j]].c.Priority; pi != pj {
+			return pi > pj
+		}
+		return names[i] < names[j]
+	})
+
+	// Visit abilities
+	var visited = make(map[string]bool)
+	var visiting = make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		// Unknown or already visited ability
+		a, ok := as.a[name]
+		if !ok || visited[name] {
+			return nil
+		}
+
+		// Cyclic dependency
+		path = append(path, name)
+		if visiting[name] {
+			return fmt.Errorf("astibrain: cyclic dependency %s", strings.Join(path, " -> "))
+		}
+
+		// Visit dependencies
+		visiting[name] = true
+		for _, d := range a.c.DependsOn {
+			if err := visit(NormalizeAbilityName(d), path); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+
+		// Append
+		o = append(o, a)
+		return nil
+	}
+	for _, n := range names {
+		if err = visit(n, []string{}); err != nil {
+			return
+		}
+	}
 	return
 }
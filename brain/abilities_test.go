@@ -0,0 +1,61 @@
+package astibrain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// namedAbility represents a test ability with a custom name
+type namedAbility struct {
+	*testAbility
+	name string
+}
+
+func (a *namedAbility) Name() string { return a.name }
+
+func newNamedAbility(name string) *namedAbility {
+	return &namedAbility{name: name, testAbility: newTestAbility()}
+}
+
+func TestNormalizeAbilityName(t *testing.T) {
+	assert.Equal(t, "understanding", NormalizeAbilityName(" Understanding\t"))
+	assert.Equal(t, "", NormalizeAbilityName("  "))
+}
+
+func TestBrainLearnNormalizesNames(t *testing.T) {
+	b := New(Configuration{})
+
+	// Empty names are rejected
+	assert.EqualError(t, b.Learn(newNamedAbility(" "), AbilityConfiguration{}), "astibrain: ability name is empty")
+
+	// Names are trimmed but keep their case
+	assert.NoError(t, b.Learn(newNamedAbility(" Understanding "), AbilityConfiguration{}))
+	assert.Equal(t, map[string]AbilityState{"Understanding": AbilityStateOff}, b.AbilitiesStatus())
+
+	// Names only differing by their case collide
+	assert.EqualError(t, b.Learn(newNamedAbility("Understanding"), AbilityConfiguration{}), "astibrain: ability Understanding has already been learned")
+	assert.EqualError(t, b.Learn(newNamedAbility("UNDERSTANDING"), AbilityConfiguration{}), "astibrain: ability UNDERSTANDING collides with already learned ability Understanding")
+	assert.Len(t, b.AbilitiesStatus(), 1)
+
+	// Abilities are looked up by their canonical name
+	s, ok := b.AbilityStatus(" understanding")
+	assert.True(t, ok)
+	assert.Equal(t, AbilityStateOff, s)
+
+	// Dependencies are matched by their canonical name
+	assert.NoError(t, b.Learn(newNamedAbility("Speaking"), AbilityConfiguration{DependsOn: []string{"UNDERSTANDING"}}))
+	ds := b.abilities.dependents("understanding")
+	assert.Len(t, ds, 1)
+	assert.Equal(t, "Speaking", ds[0].name)
+
+	// Cyclic dependencies are detected whatever the case
+	assert.Error(t, b.Learn(newNamedAbility("Hearing"), AbilityConfiguration{DependsOn: []string{"hearing"}}))
+	_, ok = b.AbilityStatus("Hearing")
+	assert.False(t, ok)
+
+	// Abilities are forgotten by their canonical name and can be learned again with another case
+	assert.NoError(t, b.Forget("SPEAKING"))
+	assert.NoError(t, b.Learn(newNamedAbility("speaking"), AbilityConfiguration{}))
+	assert.Equal(t, map[string]AbilityState{"Understanding": AbilityStateOff, "speaking": AbilityStateOff}, b.AbilitiesStatus())
+}
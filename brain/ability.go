@@ -2,11 +2,17 @@ package astibrain
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/pprof"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/asticode/go-astilog"
 	"github.com/asticode/go-astiws"
 	"github.com/pkg/errors"
+	"github.com/rs/xid"
 )
 
 // Ability represents required methods of an ability
@@ -20,11 +26,35 @@ type Activable interface {
 	Activate(a bool)
 }
 
+// ActivableWithError represents an object that can be activated and that can report activation failures.
+// A failed activation is considered as a crash.
+type ActivableWithError interface {
+	Activate(a bool) error
+}
+
+// Initializable represents an object that can be initialized.
+type Initializable interface {
+	Init() error
+}
+
 // Runnable represents an object that can be run.
 type Runnable interface {
 	Run(ctx context.Context) error
 }
 
+// Pausable represents an object that can be paused and resumed without being switched off.
+type Pausable interface {
+	Pause()
+	Resume()
+}
+
+// Reconfigurable represents an object that can be reconfigured while it's on.
+// When reconfigured through the brain, cfg is the raw JSON configuration as a json.RawMessage. The new configuration
+// must be applied atomically and invalid values must be rejected with an error.
+type Reconfigurable interface {
+	Reconfigure(cfg interface{}) error
+}
+
 // DispatchFunc represents a dispatch func
 type DispatchFunc func(e Event)
 
@@ -33,41 +63,379 @@ type Dispatcher interface {
 	SetDispatchFunc(DispatchFunc)
 }
 
+// ClockUser represents an object that tells time and schedules work with the brain's clock, see WithClock
+type ClockUser interface {
+	SetClock(Clock)
+}
+
+// IsConnectedFunc represents a func returning whether the brain is connected to Bob
+type IsConnectedFunc func() bool
+
+// ConnectionChecker represents an object that can check whether the brain is connected to Bob
+type ConnectionChecker interface {
+	SetIsConnectedFunc(IsConnectedFunc)
+}
+
 // WebsocketListener represents an object that can listen to a websocket
 type WebsocketListener interface {
 	WebsocketListeners() map[string]astiws.ListenerFunc
 }
 
+// AbilityState represents an ability state
+type AbilityState string
+
+// Ability states
+const (
+	AbilityStateCrashed  AbilityState = "crashed"
+	AbilityStateOff      AbilityState = "off"
+	AbilityStateOn       AbilityState = "on"
+	AbilityStatePaused   AbilityState = "paused"
+	AbilityStateStarting AbilityState = "starting"
+)
+
 // AbilityConfiguration represents an ability configuration
 type AbilityConfiguration struct {
-	AutoStart bool `toml:"auto_start"`
+	AutoStart bool     `toml:"auto_start"`
+	DependsOn []string `toml:"depends_on"`
+
+	// If MaxRunDuration is > 0, the ability is switched off once it has been on for that duration and it's considered
+	// as a crash
+	MaxRunDuration time.Duration `toml:"max_run_duration"`
+
+	// Identical consecutive crash messages are logged once per CrashLogWindow, the next logged one being preceded by
+	// the number of collapsed ones. Crashed events are still sent for each crash. If 0, every crash is logged.
+	CrashLogWindow time.Duration `toml:"crash_log_window"`
+
+	// Health check options are only used when the ability implements the HealthCheckable interface
+	// If CrashOnUnhealthy is true, a failed health check is considered as a crash
+	CrashOnUnhealthy    bool          `toml:"crash_on_unhealthy"`
+	HealthCheckInterval time.Duration `toml:"health_check_interval"`
+	HealthCheckTimeout  time.Duration `toml:"health_check_timeout"`
+
+	// If MaxGoroutines is > 0, the goroutines started by each run of the ability are counted every
+	// ResourceCheckInterval, 10s by default, and the ability is switched off once it exceeds that limit. Only the run
+	// goroutine of runnable abilities and the goroutines started with astibrain.Go and the context of the run are
+	// counted. Memory can't be attributed to an ability and is not limited.
+	MaxGoroutines         int           `toml:"max_goroutines"`
+	ResourceCheckInterval time.Duration `toml:"resource_check_interval"`
+
+	// Init options are only used when the ability implements the Initializable interface
+	InitMaxAttempts int           `toml:"init_max_attempts"`
+	InitRetryDelay  time.Duration `toml:"init_retry_delay"`
+
+	// Inputs links input ports of the ability to output ports of other abilities formatted as "<ability>.<port>", and is
+	// only used when the ability implements the Consumer interface. Links are checked for type compatibility when either
+	// end is learned. Sources that are not learned by the brain are received as ability events over the websocket.
+	Inputs map[string]string `toml:"inputs"`
+
+	// If Singleton is true, the ability is only switched on once Bob has granted the brain a lease on it so that it
+	// runs on exactly one brain at a time. The lease is renewed while the ability is on and the ability is switched
+	// off if the lease is lost. Brains switching the ability on while another brain holds the lease wait in line and
+	// take over once it has been released or has expired.
+	LeaseDuration time.Duration `toml:"lease_duration"`
+	Singleton     bool          `toml:"singleton"`
+
+	// If SilentEvents is true, the ability's lifecycle events such as started or stopped are logged locally instead of
+	// being sent to Bob. Lease events are still sent and the ability's state is still reported by the brain API.
+	SilentEvents bool `toml:"silent_events"`
+
+	// PreStopTimeout is the max duration the brain waits for the ability's pre-stop hook before switching it off,
+	// see PreStopper. Default is 5s.
+	PreStopTimeout time.Duration `toml:"pre_stop_timeout"`
+
+	// Abilities with a higher Priority are initialized and auto started first. Dependencies are still handled before
+	// the abilities depending on them whatever their priority.
+	Priority int `toml:"priority"`
+
+	// Restart options are only used when RestartOnCrash is true.
+	// A RestartMaxAttempts of 0 means the ability is restarted indefinitely.
+	// Attempts are reset once the ability has run for at least RestartResetWindow.
+	RestartInitialBackoff time.Duration `toml:"restart_initial_backoff"`
+	RestartMaxAttempts    int           `toml:"restart_max_attempts"`
+	RestartMaxBackoff     time.Duration `toml:"restart_max_backoff"`
+	RestartOnCrash        bool          `toml:"restart_on_crash"`
+	RestartResetWindow    time.Duration `toml:"restart_reset_window"`
+
+	// If Schedule is set, the ability is switched on when one of its windows opens and switched off when it closes,
+	// in which case AutoStart is ignored. Windows are formatted as "<days> <start>-<end>" where days follows the cron
+	// day of week syntax (e.g. "mon-fri 08:00-18:00" or "sat,sun 22:00-02:00"). Switching the ability on or off
+	// manually overrides the schedule until the next window boundary.
+	Schedule []string `toml:"schedule"`
+
+	// Start and stop requests received from Bob are serialized and a stop quickly followed by a start is coalesced into
+	// a single clean restart. If ToggleDebounce is > 0, requests are only applied once no other request has been
+	// received for that duration, the last one winning.
+	ToggleDebounce time.Duration `toml:"toggle_debounce"`
+}
+
+// AbilityError represents the error that has made an ability crash
+type AbilityError struct {
+	At    time.Time
+	Err   error
+	RunID string
+}
+
+// Error implements the error interface
+func (e *AbilityError) Error() string {
+	return fmt.Sprintf("astibrain: run %s crashed at %s: %s", e.RunID, e.At.Format(time.RFC3339), e.Err)
+}
+
+// Cause returns the underlying error
+func (e *AbilityError) Cause() error {
+	return e.Err
 }
 
 // ability represents an ability.
 type ability struct {
-	a           Ability
-	c           AbilityConfiguration
-	cancel      context.CancelFunc
-	chanDone    chan error
-	ctx         context.Context
-	description string
-	isOnUnsafe  bool
-	m           sync.Mutex // Locks attributes
-	mr          sync.Mutex // Locks when ability is running
-	name        string
-	ws          *websocket
+	a                       Ability
+	abilities               *abilities
+	c                       AbilityConfiguration
+	cancel                  context.CancelFunc
+	chanDone                chan error
+	chanStopped             chan struct{}
+	clock                   Clock
+	crashLog                crashLog
+	ctx                     context.Context
+	description             string
+	errCrashUnsafe          error
+	health                  AbilityHealth
+	isAbandonedUnsafe       bool // Whether the brain has stopped waiting for the ability to be off, see Brain.Stop
+	isCrashedUnsafe         bool
+	isExitedUnsafe          bool // Whether the current run has exited, see Brain.Stop
+	isInitializedUnsafe     bool
+	isOnUnsafe              bool
+	isPausedUnsafe          bool
+	isScheduleStoppedUnsafe bool
+	isStartingUnsafe        bool
+	isStoppingUnsafe        bool
+	isTogglingUnsafe        bool // Whether the toggle worker is running, see queueToggleUnsafe
+	lastErrUnsafe           *AbilityError
+	leaseExpiresAt          time.Time
+	m                       sync.Mutex // Locks attributes
+	metrics                 *metrics
+	mr                      sync.Mutex // Locks when ability is running
+	name                    string
+	outputs                 []string // Names of the output ports, see Producer
+	restartAttempts         int
+	restartTimer            Timer
+	root                    context.Context
+	runIDUnsafe             string
+	schedule                schedule
+	scheduleCancel          context.CancelFunc
+	startedAt               time.Time
+	toggleOffUnsafe         bool
+	toggleOnUnsafe          bool
+	togglePendingUnsafe     bool
+	toggleTimer             Timer
+	tracer                  Tracer
+	wantsLeaseUnsafe        bool
+	ws                      eventSender
+	wsHandlers              []websocketHandlerID // Set when the ability is learned
+}
+
+// eventSender represents an object capable of sending websocket events to Bob
+type eventSender interface {
+	send(eventName WebsocketEventName, payload interface{})
+}
+
+// abilityOption represents an ability option
+type abilityOption func(a *ability)
+
+// withClock sets the clock used to tell time and schedule work
+func withClock(c Clock) abilityOption {
+	return func(a *ability) {
+		a.clock = c
+	}
+}
+
+// withRootContext sets the context the context of each run derives from
+func withRootContext(ctx context.Context) abilityOption {
+	return func(a *ability) {
+		a.root = ctx
+	}
+}
+
+// rootContext returns the context the context of each run derives from
+func (a *ability) rootContext() context.Context {
+	if a.root == nil {
+		return context.Background()
+	}
+	return a.root
+}
+
+// withTracer sets the tracer used to start the root span of each run
+func withTracer(t Tracer) abilityOption {
+	return func(a *ability) {
+		a.tracer = t
+	}
 }
 
 // newAbility creates a new ability.
-func newAbility(a Ability, ws *websocket, c AbilityConfiguration) *ability {
-	return &ability{
+func newAbility(a Ability, as *abilities, ws eventSender, m *metrics, c AbilityConfiguration, opts ...abilityOption) (o *ability) {
+	// Create
+	o = &ability{
 		a:           a,
+		abilities:   as,
 		c:           c,
 		chanDone:    make(chan error),
+		clock:       RealClock{},
 		description: a.Description(),
-		name:        a.Name(),
+		metrics:     m,
+		name:        strings.TrimSpace(a.Name()),
 		ws:          ws,
 	}
+
+	// Apply options
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// Silence events
+	if o.c.SilentEvents {
+		o.ws = newSilentEventSender(o.name, o.ws)
+	}
+
+	// Default configuration values
+	if o.c.HealthCheckTimeout == 0 {
+		o.c.HealthCheckTimeout = 5 * time.Second
+	}
+	if o.c.InitMaxAttempts <= 0 {
+		o.c.InitMaxAttempts = 1
+	}
+	if o.c.PreStopTimeout <= 0 {
+		o.c.PreStopTimeout = 5 * time.Second
+	}
+	if o.c.LeaseDuration == 0 {
+		o.c.LeaseDuration = 15 * time.Second
+	}
+	if o.c.InitRetryDelay == 0 {
+		o.c.InitRetryDelay = time.Second
+	}
+	if o.c.RestartInitialBackoff == 0 {
+		o.c.RestartInitialBackoff = time.Second
+	}
+	if o.c.RestartMaxBackoff == 0 {
+		o.c.RestartMaxBackoff = 5 * time.Minute
+	}
+	if o.c.RestartResetWindow == 0 {
+		o.c.RestartResetWindow = time.Minute
+	}
+	return
+}
+
+// APIAbilityInitFailed is an ability init failed API payload
+type APIAbilityInitFailed struct {
+	Error string `json:"error"`
+	Name  string `json:"name"`
+}
+
+// init initializes the ability and retries on failure.
+func (a *ability) init(ctx context.Context) (err error) {
+	// Ability is not initializable
+	v, ok := a.a.(Initializable)
+	if !ok {
+		return
+	}
+
+	// Update ability status
+	a.m.Lock()
+	a.isStartingUnsafe = true
+	a.m.Unlock()
+	defer func() {
+		a.m.Lock()
+		a.isStartingUnsafe = false
+		a.m.Unlock()
+	}()
+
+	// Loop through attempts
+	for attempt := 1; attempt <= a.c.InitMaxAttempts; attempt++ {
+		// Init
+		astilog.Debugf("astibrain: initializing %s (attempt #%d)", a.name, attempt)
+		if err = v.Init(); err == nil {
+			a.m.Lock()
+			a.isInitializedUnsafe = true
+			a.m.Unlock()
+			return
+		}
+		err = errors.Wrapf(err, "astibrain: initializing %s failed", a.name)
+
+		// Last attempt
+		if attempt == a.c.InitMaxAttempts {
+			break
+		}
+
+		// Log
+		astilog.Error(errors.Wrapf(err, "astibrain: attempt #%d", attempt))
+
+		// Wait before retrying
+		select {
+		case <-ctx.Done():
+			err = errors.Wrap(ctx.Err(), "astibrain: context error")
+			return
+		case <-a.clock.After(a.c.InitRetryDelay):
+		}
+	}
+
+	// Dispatch websocket event
+	a.ws.send(WebsocketEventNameAbilityInitFailed, APIAbilityInitFailed{
+		Error: err.Error(),
+		Name:  a.name,
+	})
+	return
+}
+
+// isInitialized returns whether the ability has been initialized.
+// Abilities that don't implement the Initializable interface are always considered initialized.
+func (a *ability) isInitialized() bool {
+	if _, ok := a.a.(Initializable); !ok {
+		return true
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.isInitializedUnsafe
+}
+
+// state returns the ability state.
+func (a *ability) state() AbilityState {
+	a.m.Lock()
+	defer a.m.Unlock()
+	switch {
+	case a.isOnUnsafe && a.isPausedUnsafe:
+		return AbilityStatePaused
+	case a.isOnUnsafe:
+		return AbilityStateOn
+	case a.isStartingUnsafe || a.restartTimer != nil:
+		return AbilityStateStarting
+	case a.isCrashedUnsafe:
+		return AbilityStateCrashed
+	default:
+		return AbilityStateOff
+	}
+}
+
+// isInProgress returns whether the ability is being initialized, restarted or switched off.
+func (a *ability) isInProgress() bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.isStartingUnsafe || a.isStoppingUnsafe || a.restartTimer != nil
+}
+
+// isStartingOrStopping returns whether the ability is being initialized or switched off.
+func (a *ability) isStartingOrStopping() bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.isStartingUnsafe || a.isStoppingUnsafe
+}
+
+// lastError returns the error that has made the ability crash the last time, or nil if it has been switched on
+// successfully since then.
+func (a *ability) lastError() error {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if a.lastErrUnsafe == nil {
+		return nil
+	}
+	return a.lastErrUnsafe
 }
 
 // isOn returns whether the ability is on.
@@ -77,6 +445,27 @@ func (a *ability) isOn() bool {
 	return a.isOnUnsafe
 }
 
+// isPaused returns whether the ability is paused.
+func (a *ability) isPaused() bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.isPausedUnsafe
+}
+
+// outputNames returns the names of the output ports of the ability
+func (a *ability) outputNames() []string {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.outputs
+}
+
+// setOutputNames sets the names of the output ports of the ability
+func (a *ability) setOutputNames(ns []string) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.outputs = ns
+}
+
 // on switches the ability on.
 // Its execution must not be blocking as it's used in a websocket call.
 func (a *ability) on() {
@@ -85,22 +474,85 @@ func (a *ability) on() {
 		return
 	}
 
+	// Ability has not been initialized
+	if !a.isInitialized() {
+		astilog.Errorf("astibrain: %s has not been initialized", a.name)
+		return
+	}
+
+	// Ability is a singleton and the brain doesn't hold the lease
+	// The ability is switched on once the lease has been acquired
+	if a.c.Singleton && !a.hasLease() {
+		astilog.Debugf("astibrain: waiting for lease on %s", a.name)
+		a.m.Lock()
+		a.wantsLeaseUnsafe = true
+		a.m.Unlock()
+		a.requestLease()
+		return
+	}
+
 	// Log
 	astilog.Debugf("astibrain: switching %s on", a.name)
 
+	// Root context is done
+	if a.rootContext().Err() != nil {
+		astilog.Errorf("astibrain: root context is done, %s can't be switched on", a.name)
+		return
+	}
+
 	// Reset the context
-	a.ctx, a.cancel = context.WithCancel(context.Background())
+	// If MaxRunDuration is set, the context is cancelled once it's exceeded
+	if a.c.MaxRunDuration > 0 {
+		a.ctx, a.cancel = context.WithTimeout(a.rootContext(), a.c.MaxRunDuration)
+	} else {
+		a.ctx, a.cancel = context.WithCancel(a.rootContext())
+	}
+
+	// Create a logger scoped to this run
+	// The run id changes each time the ability is switched on so that runs can be told apart in logs
+	runID := xid.New().String()
+	a.m.Lock()
+	a.runIDUnsafe = runID
+	a.m.Unlock()
+	l := newAbilityLogger(a.name, runID)
+	a.ctx = contextWithLogger(a.ctx, l)
+	a.ctx = pprof.WithLabels(a.ctx, pprof.Labels(pprofLabelAbility, a.name, pprofLabelRun, runID))
+	var gc *goroutineCounter
+	a.ctx, gc = contextWithGoroutineCounter(a.ctx)
+	if v, ok := a.a.(LoggerSetter); ok {
+		v.SetLogger(l)
+	}
+
+	// Start the root span of this run
+	// It's ended once the ability has stopped
+	a.ctx, _ = startSpan(a.ctx, a.tracer, spanNameAbilityRun)
 
 	// Switch on the activity
+	// Goroutines started while switching on inherit the pprof labels of the run
 	if v, ok := a.a.(Activable); ok {
 		a.onActivable(v)
+	} else if v, ok := a.a.(ActivableWithError); ok {
+		if err := a.onActivableWithError(v); err != nil {
+			a.activationFailed(l, err)
+			return
+		}
 	} else if v, ok := a.a.(Runnable); ok {
 		a.onRunnable(v)
 	}
 
 	// Update ability status
 	a.m.Lock()
+	a.chanStopped = make(chan struct{})
+	a.health = AbilityHealth{}
+	a.isCrashedUnsafe = false
+	a.isExitedUnsafe = false
 	a.isOnUnsafe = true
+	a.lastErrUnsafe = nil
+	if a.restartTimer != nil {
+		a.restartTimer.Stop()
+		a.restartTimer = nil
+	}
+	a.startedAt = a.clock.Now()
 	a.m.Unlock()
 
 	// Lock running mutex
@@ -109,17 +561,34 @@ func (a *ability) on() {
 	// Wait for the end of execution in a go routine
 	go a.wait()
 
+	// Check health in a go routine
+	if v, ok := a.a.(HealthCheckable); ok && a.c.HealthCheckInterval > 0 {
+		go a.checkHealth(a.ctx, v)
+	}
+
+	// Renew lease in a go routine
+	if a.c.Singleton {
+		go a.renewLease(a.ctx)
+	}
+
+	// Check resources in a go routine
+	if a.c.MaxGoroutines > 0 {
+		go a.checkResources(a.ctx, gc)
+	}
+
 	// Log
-	astilog.Infof("astibrain: %s have been switched on", a.name)
+	l.Infof("astibrain: %s have been switched on", a.name)
 
 	// Dispatch websocket event
 	a.ws.send(WebsocketEventNameAbilityStarted, a.name)
+	a.metrics.incEvent(a.name, metricsEventStarted)
+	a.sendState()
 }
 
 // onActivable switches the activable ability on.
 func (a *ability) onActivable(v Activable) {
 	// Activate
-	v.Activate(true)
+	a.withRunLabels(func() { v.Activate(true) })
 
 	// Listen to context in a goroutine
 	go func() {
@@ -129,12 +598,64 @@ func (a *ability) onActivable(v Activable) {
 	}()
 }
 
+// onActivableWithError switches the activable ability on and returns the activation error if any.
+func (a *ability) onActivableWithError(v ActivableWithError) (err error) {
+	// Activate
+	a.withRunLabels(func() { err = v.Activate(true) })
+	if err != nil {
+		a.cancel()
+		err = errors.Wrap(err, "astibrain: activating failed")
+		return
+	}
+
+	// Listen to context in a goroutine
+	go func() {
+		<-a.ctx.Done()
+		if err := v.Activate(false); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibrain: deactivating %s failed", a.name))
+		}
+		a.chanDone <- nil
+	}()
+	return
+}
+
+// activationFailed handles an activation failure the same way as a crash.
+// The ability is never considered as on.
+func (a *ability) activationFailed(l Logger, err error) {
+	// Log
+	l.Error(errors.Wrapf(err, "astibrain: %s crashed", a.name))
+
+	// End the run span since there won't be any run to wait for
+	endSpanWithError(SpanFromContext(a.ctx), err)
+
+	// Dispatch websocket event
+	a.ws.send(WebsocketEventNameAbilityCrashed, a.name)
+	a.metrics.incEvent(a.name, metricsEventCrashed)
+
+	// Update ability status
+	a.m.Lock()
+	a.isCrashedUnsafe = true
+	a.lastErrUnsafe = &AbilityError{At: a.clock.Now(), Err: err, RunID: a.runIDUnsafe}
+	a.startedAt = a.clock.Now()
+	a.m.Unlock()
+
+	// Release lease
+	a.releaseLease()
+
+	// Restart
+	if a.c.RestartOnCrash {
+		a.restart()
+	}
+
+	// Dispatch state
+	a.sendState()
+}
+
 // onRunnable switches the runnable ability on.
 func (a *ability) onRunnable(v Runnable) {
 	// Run in a goroutine
-	go func() {
-		a.chanDone <- v.Run(a.ctx)
-	}()
+	// It's counted against the MaxGoroutines limit
+	Go(a.ctx, func() { a.chanDone <- v.Run(a.ctx) })
 }
 
 // wait waits for the ability to stop or for the context to be done
@@ -145,46 +666,453 @@ func (a *ability) wait() {
 	}
 
 	// Make sure the context is cancelled
-	defer a.cancel()
+	// The context is stored locally since the ability may be switched on again before this function returns
+	ctx, cancel := a.ctx, a.cancel
+	defer cancel()
+
+	// End the run span with the error of the run, if any
+	var errSpan error
+	defer func() { endSpanWithError(SpanFromContext(ctx), errSpan) }()
+
+	// Make sure listeners waiting for the ability to stop are notified
+	a.m.Lock()
+	chanStopped, runID := a.chanStopped, a.runIDUnsafe
+	a.m.Unlock()
+	defer close(chanStopped)
 
 	// Listen to chanDone
-	if err := <-a.chanDone; a.ctx.Err() == nil {
+	err := <-a.chanDone
+
+	// Check whether the ability has been forced to stop or abandoned
+	// The run is flagged as exited under the same lock so that the brain can't abandon it anymore
+	a.m.Lock()
+	errCrash, isAbandoned := a.errCrashUnsafe, a.isAbandonedUnsafe
+	a.errCrashUnsafe = nil
+	a.isExitedUnsafe = true
+	a.m.Unlock()
+
+	// Process error
+	var crashed bool
+	var lastErr *AbilityError
+	if errCrash != nil || ctx.Err() == nil {
+		// Get error
+		// A runnable returning no error while its context is still live has exited unexpectedly
+		if errCrash != nil {
+			err = errCrash
+		} else if err == nil {
+			err = fmt.Errorf("astibrain: %s exited unexpectedly", a.name)
+		}
+
 		// Log
-		astilog.Error(errors.Wrapf(err, "astibrain: %s crashed", a.name))
+		// Identical consecutive crash messages are collapsed so that a crash loop doesn't drown the logs
+		errLog := errors.Wrapf(err, "astibrain: %s crashed", a.name)
+		a.m.Lock()
+		log, collapsed := a.crashLog.add(errLog.Error(), a.clock.Now(), a.c.CrashLogWindow)
+		a.m.Unlock()
+		if collapsed > 0 {
+			LoggerFromContext(ctx).Errorf("astibrain: %s crashed %d more time(s) with the same error", a.name, collapsed)
+		}
+		if log {
+			LoggerFromContext(ctx).Error(errLog)
+		}
 
 		// Dispatch websocket event
 		a.ws.send(WebsocketEventNameAbilityCrashed, a.name)
+		a.metrics.incEvent(a.name, metricsEventCrashed)
+		crashed = true
+		errSpan = err
+		lastErr = &AbilityError{At: a.clock.Now(), Err: err, RunID: runID}
+	} else if ctx.Err() == context.DeadlineExceeded && a.rootContext().Err() == nil {
+		// Log
+		LoggerFromContext(ctx).Errorf("astibrain: %s timed out after %s", a.name, a.c.MaxRunDuration)
+
+		// Dispatch websocket event
+		// A time out is considered as a crash
+		a.ws.send(WebsocketEventNameAbilityTimedOut, a.name)
+		a.metrics.incEvent(a.name, metricsEventTimedOut)
+		crashed = true
+		lastErr = &AbilityError{At: a.clock.Now(), Err: fmt.Errorf("astibrain: %s timed out after %s", a.name, a.c.MaxRunDuration), RunID: runID}
+		errSpan = lastErr.Err
 	} else {
 		// Log
-		astilog.Infof("astibrain: %s have been switched off", a.name)
+		LoggerFromContext(ctx).Infof("astibrain: %s have been switched off", a.name)
 
 		// Dispatch websocket event
-		a.ws.send(WebsocketEventNameAbilityStopped, a.name)
+		// Abandoned abilities have already been reported as stopped
+		if !isAbandoned {
+			a.ws.send(WebsocketEventNameAbilityStopped, a.name)
+			a.metrics.incEvent(a.name, metricsEventStopped)
+		}
 	}
 
 	// Update ability status
 	a.m.Lock()
+	a.isAbandonedUnsafe = false
+	a.isCrashedUnsafe = crashed
+	if lastErr != nil {
+		a.lastErrUnsafe = lastErr
+	}
 	a.isOnUnsafe = false
+	a.isPausedUnsafe = false
+	a.isStoppingUnsafe = false
 	a.m.Unlock()
 
+	// Release lease
+	a.releaseLease()
+
 	// Unlock running mutex
 	a.mr.Unlock()
+
+	// Notify dependents
+	a.notifyDependents()
+
+	// Restart
+	if crashed && a.c.RestartOnCrash {
+		a.restart()
+	}
+
+	// Dispatch state
+	a.sendState()
 	return
 }
 
+// crash switches the ability off while making sure it's considered as crashed
+func (a *ability) crash(err error) {
+	// Ability is not on
+	a.m.Lock()
+	if !a.isOnUnsafe {
+		a.m.Unlock()
+		return
+	}
+
+	// Store error
+	a.errCrashUnsafe = err
+	a.m.Unlock()
+
+	// Cancel the context
+	// The rest is handled through the wait function
+	a.cancel()
+}
+
+// APIAbilityDependencyLost is an ability dependency lost API payload
+type APIAbilityDependencyLost struct {
+	Dependency string `json:"dependency"`
+	Name       string `json:"name"`
+}
+
+// notifyDependents notifies abilities that are on and depend on the ability that it's not on anymore
+func (a *ability) notifyDependents() {
+	for _, d := range a.abilities.dependents(a.name) {
+		// Dependent is not on
+		if !d.isOn() {
+			continue
+		}
+
+		// Log
+		astilog.Infof("astibrain: %s has lost its dependency %s", d.name, a.name)
+
+		// Dispatch websocket event
+		a.ws.send(WebsocketEventNameAbilityDependencyLost, APIAbilityDependencyLost{
+			Dependency: a.name,
+			Name:       d.name,
+		})
+	}
+}
+
+// APIAbilityRestarting is an ability restarting API payload
+type APIAbilityRestarting struct {
+	Attempt int           `json:"attempt"`
+	Backoff time.Duration `json:"backoff"`
+	Name    string        `json:"name"`
+}
+
+// restart schedules switching the crashed ability back on after an exponential backoff
+func (a *ability) restart() {
+	// Lock
+	a.m.Lock()
+
+	// The ability has run long enough to be considered healthy
+	if a.clock.Now().Sub(a.startedAt) >= a.c.RestartResetWindow {
+		a.restartAttempts = 0
+	}
+
+	// Max attempts has been reached
+	if a.c.RestartMaxAttempts > 0 && a.restartAttempts >= a.c.RestartMaxAttempts {
+		a.m.Unlock()
+		astilog.Errorf("astibrain: %s has reached the max number of restart attempts (%d)", a.name, a.c.RestartMaxAttempts)
+		return
+	}
+
+	// Get backoff
+	a.restartAttempts++
+	backoff := a.c.RestartInitialBackoff
+	for idx := 1; idx < a.restartAttempts && backoff < a.c.RestartMaxBackoff; idx++ {
+		backoff *= 2
+	}
+	if backoff > a.c.RestartMaxBackoff {
+		backoff = a.c.RestartMaxBackoff
+	}
+
+	// Schedule restart
+	p := APIAbilityRestarting{
+		Attempt: a.restartAttempts,
+		Backoff: backoff,
+		Name:    a.name,
+	}
+	a.restartTimer = a.clock.AfterFunc(backoff, a.on)
+	a.m.Unlock()
+
+	// Log
+	astilog.Infof("astibrain: restarting %s in %s (attempt #%d)", a.name, backoff, p.Attempt)
+
+	// Dispatch websocket event
+	a.ws.send(WebsocketEventNameAbilityRestarting, p)
+}
+
 // off switches the ability off.
 // Its execution must not be blocking as it's used in a websocket call.
 func (a *ability) off() {
+	// Cancel pending restart
+	a.m.Lock()
+	restartCancelled := a.restartTimer != nil
+	if restartCancelled {
+		a.restartTimer.Stop()
+		a.restartTimer = nil
+	}
+	a.restartAttempts = 0
+	a.m.Unlock()
+
 	// Ability is already off
 	if !a.isOn() {
+		// Stop waiting for the lease
+		a.releaseLease()
+
+		// Dispatch state since it's not starting anymore
+		if restartCancelled {
+			a.sendState()
+		}
 		return
 	}
 
 	// Log
 	astilog.Debugf("astibrain: switching %s off", a.name)
 
-	// Switch off
-	a.cancel()
+	// Update ability status
+	a.m.Lock()
+	isStopping := a.isStoppingUnsafe
+	a.isStoppingUnsafe = true
+	a.m.Unlock()
+
+	// Switch off right away if the ability is already being switched off
+	ctx, cancel := a.ctx, a.cancel
+	if isStopping {
+		cancel()
+		return
+	}
+
+	// Execute pre-stop hook and switch off once it's done
+	// It's only executed the first time the ability is switched off and a failure doesn't prevent the ability from
+	// being switched off
+	a.preStop(func(err error) {
+		if err != nil {
+			LoggerFromContext(ctx).Error(err)
+		}
+		cancel()
+	})
 
 	// The rest is handled through the wait function
 }
+
+// hasLease returns whether the brain holds the lease of the ability
+func (a *ability) hasLease() bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.clock.Now().Before(a.leaseExpiresAt)
+}
+
+// isWaitingForLease returns whether the ability is waiting for its lease to be switched on
+func (a *ability) isWaitingForLease() bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.wantsLeaseUnsafe
+}
+
+// requestLease asks Bob to grant or renew the lease of the ability
+func (a *ability) requestLease() {
+	a.ws.send(WebsocketEventNameAbilityLeaseAcquire, APIAbilityLease{
+		Duration: a.c.LeaseDuration,
+		Name:     a.name,
+	})
+}
+
+// renewLease renews the lease periodically until the context is done and switches the ability off once the lease
+// has expired
+func (a *ability) renewLease(ctx context.Context) {
+	// Create ticker
+	t := a.clock.NewTicker(a.c.LeaseDuration / 3)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			// Lease has expired, most likely because Bob is unreachable
+			if !a.hasLease() {
+				astilog.Errorf("astibrain: lease on %s has expired", a.name)
+				a.leaseLost()
+				return
+			}
+
+			// Renew
+			a.requestLease()
+		}
+	}
+}
+
+// leaseAcquired handles Bob granting or renewing the lease of the ability.
+// Its execution must not be blocking as it's used in a websocket call.
+func (a *ability) leaseAcquired() {
+	// Update lease
+	a.m.Lock()
+	held := a.clock.Now().Before(a.leaseExpiresAt)
+	a.leaseExpiresAt = a.clock.Now().Add(a.c.LeaseDuration)
+	wantsLease := a.wantsLeaseUnsafe
+	a.m.Unlock()
+
+	// Ability doesn't want the lease anymore
+	if !wantsLease {
+		a.releaseLease()
+		return
+	}
+
+	// Lease has just been acquired
+	if !held {
+		astilog.Infof("astibrain: lease on %s has been acquired", a.name)
+		a.on()
+	}
+}
+
+// leaseLost handles the lease of the ability being lost.
+// Its execution must not be blocking as it's used in a websocket call.
+func (a *ability) leaseLost() {
+	// Update lease
+	a.m.Lock()
+	a.leaseExpiresAt = time.Time{}
+	a.m.Unlock()
+
+	// Log
+	astilog.Infof("astibrain: lease on %s has been lost", a.name)
+
+	// Switch off
+	a.off()
+}
+
+// releaseLease releases the lease of the ability, or stops waiting for it
+func (a *ability) releaseLease() {
+	// Ability is not a singleton
+	if !a.c.Singleton {
+		return
+	}
+
+	// Update lease
+	a.m.Lock()
+	held := a.clock.Now().Before(a.leaseExpiresAt)
+	wantsLease := a.wantsLeaseUnsafe
+	a.leaseExpiresAt = time.Time{}
+	a.wantsLeaseUnsafe = false
+	a.m.Unlock()
+
+	// Nothing to release
+	if !held && !wantsLease {
+		return
+	}
+
+	// Dispatch websocket event
+	a.ws.send(WebsocketEventNameAbilityLeaseRelease, APIAbilityLease{Name: a.name})
+}
+
+// reconfigure reconfigures the ability
+func (a *ability) reconfigure(cfg json.RawMessage) (err error) {
+	// Ability is not reconfigurable
+	v, ok := a.a.(Reconfigurable)
+	if !ok {
+		err = fmt.Errorf("astibrain: %s is not reconfigurable", a.name)
+		return
+	}
+
+	// Reconfigure
+	astilog.Debugf("astibrain: reconfiguring %s", a.name)
+	if err = v.Reconfigure(cfg); err != nil {
+		err = errors.Wrapf(err, "astibrain: reconfiguring %s failed", a.name)
+		return
+	}
+
+	// Log
+	astilog.Infof("astibrain: %s have been reconfigured", a.name)
+	return
+}
+
+// pause pauses the ability.
+// The ability is still considered on while it's paused.
+// Its execution must not be blocking as it's used in a websocket call.
+func (a *ability) pause() {
+	// Ability is not pausable
+	v, ok := a.a.(Pausable)
+	if !ok {
+		astilog.Errorf("astibrain: %s is not pausable", a.name)
+		return
+	}
+
+	// Ability is either off or already paused
+	a.m.Lock()
+	if !a.isOnUnsafe || a.isPausedUnsafe {
+		a.m.Unlock()
+		return
+	}
+	a.isPausedUnsafe = true
+	a.m.Unlock()
+
+	// Pause
+	astilog.Debugf("astibrain: pausing %s", a.name)
+	v.Pause()
+
+	// Log
+	astilog.Infof("astibrain: %s have been paused", a.name)
+
+	// Dispatch websocket event
+	a.ws.send(WebsocketEventNameAbilityPaused, a.name)
+	a.sendState()
+}
+
+// resume resumes the ability.
+// Its execution must not be blocking as it's used in a websocket call.
+func (a *ability) resume() {
+	// Ability is not pausable
+	v, ok := a.a.(Pausable)
+	if !ok {
+		astilog.Errorf("astibrain: %s is not pausable", a.name)
+		return
+	}
+
+	// Ability is either off or not paused
+	a.m.Lock()
+	if !a.isOnUnsafe || !a.isPausedUnsafe {
+		a.m.Unlock()
+		return
+	}
+	a.isPausedUnsafe = false
+	a.m.Unlock()
+
+	// Resume
+	astilog.Debugf("astibrain: resuming %s", a.name)
+	v.Resume()
+
+	// Log
+	astilog.Infof("astibrain: %s have been resumed", a.name)
+
+	// Dispatch websocket event
+	a.ws.send(WebsocketEventNameAbilityResumed, a.name)
+	a.sendState()
+}
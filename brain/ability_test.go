@@ -0,0 +1,502 @@
+package astibrain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testAbility represents a runnable and pausable ability whose run is driven by the test
+type testAbility struct {
+	chanRun chan error // Errors returned by Run
+	m       sync.Mutex // Locks pauses and resumes
+	pauses  int
+	resumes int
+}
+
+func newTestAbility() *testAbility {
+	return &testAbility{chanRun: make(chan error)}
+}
+
+func (a *testAbility) Description() string { return "Test ability" }
+
+func (a *testAbility) Name() string { return "Test" }
+
+func (a *testAbility) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-a.chanRun:
+		return err
+	}
+}
+
+func (a *testAbility) Pause() {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.pauses++
+}
+
+func (a *testAbility) Resume() {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.resumes++
+}
+
+// waitForEvents waits for the recorder to have recorded n events and returns their names
+// Events are sent by the ability in its own goroutine once it's stopped, therefore the recorder is polled.
+func waitForEvents(t *testing.T, r *eventRecorder, n int) []string {
+	for deadline := time.Now().Add(time.Second); len(r.events()) < n && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	ns := r.names()
+	if len(ns) < n {
+		t.Fatalf("expected %d events, got %v", n, ns)
+	}
+	return ns
+}
+
+func TestAbilityRestartBackoff(t *testing.T) {
+	ta := newTestAbility()
+	a, r, fc := newAbilityForTest(ta, AbilityConfiguration{
+		RestartInitialBackoff: time.Second,
+		RestartMaxBackoff:     4 * time.Second,
+		RestartOnCrash:        true,
+	})
+	a.on()
+	assert.Equal(t, AbilityStateOn, a.state())
+
+	// Backoff doubles with each attempt until it reaches the max backoff
+	for idx, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		// Crash
+		n := len(r.events())
+		ta.chanRun <- errors.New("test")
+		ns := waitForEvents(t, r, n+2)
+		assert.Equal(t, []string{"ability.crashed", "ability.restarting"}, ns[n:])
+		assert.Equal(t, APIAbilityRestarting{Attempt: idx + 1, Backoff: backoff, Name: "Test"}, r.events()[n+1].payload)
+		assert.Equal(t, AbilityStateStarting, a.state())
+
+		// Restart is not due yet
+		fc.Advance(backoff - time.Nanosecond)
+		assert.False(t, a.isOn())
+
+		// Restart is due
+		fc.Advance(time.Nanosecond)
+		assert.True(t, a.isOn())
+		assert.Equal(t, "ability.started", r.names()[n+2])
+	}
+}
+
+func TestAbilityRestartMaxAttempts(t *testing.T) {
+	ta := newTestAbility()
+	a, r, fc := newAbilityForTest(ta, AbilityConfiguration{
+		RestartMaxAttempts: 1,
+		RestartOnCrash:     true,
+	})
+	a.on()
+
+	// First crash is restarted
+	ta.chanRun <- errors.New("test")
+	waitForEvents(t, r, 3)
+	fc.Advance(time.Second)
+	assert.True(t, a.isOn())
+
+	// Second crash is not
+	ta.chanRun <- errors.New("test")
+	ns := waitForEvents(t, r, 5)
+	for deadline := time.Now().Add(time.Second); a.isOn() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	fc.Advance(time.Hour)
+	assert.Equal(t, []string{"ability.started", "ability.crashed", "ability.restarting", "ability.started", "ability.crashed"}, ns)
+	assert.Equal(t, AbilityStateCrashed, a.state())
+}
+
+func TestAbilityOffCancelsRestart(t *testing.T) {
+	ta := newTestAbility()
+	a, r, fc := newAbilityForTest(ta, AbilityConfiguration{RestartOnCrash: true})
+	a.on()
+	ta.chanRun <- errors.New("test")
+	waitForEvents(t, r, 3)
+
+	// Switching off cancels the pending restart
+	a.off()
+	assert.Equal(t, AbilityStateCrashed, a.state())
+	fc.Advance(time.Hour)
+	assert.False(t, a.isOn())
+	assert.Equal(t, []string{"ability.started", "ability.crashed", "ability.restarting"}, r.names())
+}
+
+func TestAbilityPauseResume(t *testing.T) {
+	ta := newTestAbility()
+	a, r, _ := newAbilityForTest(ta, AbilityConfiguration{})
+
+	// Ability is off
+	a.pause()
+	assert.Equal(t, 0, ta.pauses)
+
+	// Pause
+	a.on()
+	a.pause()
+	a.pause()
+	assert.Equal(t, 1, ta.pauses)
+	assert.Equal(t, AbilityStatePaused, a.state())
+	assert.True(t, a.isOn())
+
+	// Resume
+	a.resume()
+	a.resume()
+	assert.Equal(t, 1, ta.resumes)
+	assert.Equal(t, AbilityStateOn, a.state())
+
+	// Switching off while paused resets the pause
+	a.pause()
+	a.off()
+	ns := waitForEvents(t, r, 5)
+	for deadline := time.Now().Add(time.Second); a.isOn() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, a.isPaused())
+	assert.Equal(t, AbilityStateOff, a.state())
+	assert.Equal(t, []string{"ability.started", "ability.paused", "ability.resumed", "ability.paused", "ability.stopped"}, ns)
+}
+
+func TestAbilityEventsOrder(t *testing.T) {
+	ta := newTestAbility()
+	a, r, fc := newAbilityForTest(ta, AbilityConfiguration{RestartOnCrash: true})
+	a.on()
+	a.pause()
+	a.resume()
+	ta.chanRun <- errors.New("test")
+	waitForEvents(t, r, 5)
+	fc.Advance(time.Second)
+	a.off()
+	assert.Equal(t, []string{
+		"ability.started",
+		"ability.paused",
+		"ability.resumed",
+		"ability.crashed",
+		"ability.restarting",
+		"ability.started",
+		"ability.stopped",
+	}, waitForEvents(t, r, 7))
+}
+
+func TestAbilityToggleRestart(t *testing.T) {
+	ta := newTestAbility()
+	a, r, _ := newAbilityForTest(ta, AbilityConfiguration{})
+	a.on()
+
+	// A quick off followed by on is applied in order as a single clean restart
+	a.requestToggle(false)
+	a.requestToggle(true)
+	assert.Equal(t, []string{"ability.started", "ability.stopped", "ability.started"}, waitForEvents(t, r, 3))
+	for deadline := time.Now().Add(time.Second); !a.isOn() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, a.isOn())
+}
+
+func TestAbilityToggleDebounce(t *testing.T) {
+	ta := newTestAbility()
+	a, r, fc := newAbilityForTest(ta, AbilityConfiguration{ToggleDebounce: time.Second})
+
+	// Requests are not applied before the end of the debounce window
+	a.requestToggle(true)
+	fc.Advance(time.Second / 2)
+	a.requestToggle(false)
+	a.requestToggle(true)
+	fc.Advance(time.Second - time.Nanosecond)
+	assert.Empty(t, r.names())
+
+	// Only the last request is applied
+	fc.Advance(time.Nanosecond)
+	assert.Equal(t, []string{"ability.started"}, waitForEvents(t, r, 1))
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, []string{"ability.started"}, r.names())
+}
+
+// stubbornAbility represents a runnable ability ignoring its context
+type stubbornAbility struct {
+	*testAbility
+}
+
+func (a *stubbornAbility) Run(ctx context.Context) error {
+	return <-a.chanRun
+}
+
+func TestBrainStopAbandonsAbility(t *testing.T) {
+	ta := &stubbornAbility{testAbility: newTestAbility()}
+	a, r, _ := newAbilityForTest(ta, AbilityConfiguration{})
+	b := &Brain{abilities: a.abilities}
+	a.on()
+
+	// Ability doesn't stop in time and is reported as stopped once
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.Stop(ctx)
+	assert.Equal(t, []string{"ability.started", "ability.stopped"}, r.names())
+	ta.chanRun <- nil
+	for deadline := time.Now().Add(time.Second); a.isOn() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []string{"ability.started", "ability.stopped"}, r.names())
+
+	// Next run is not considered as abandoned
+	a.on()
+	a.off()
+	ta.chanRun <- nil
+	assert.Equal(t, []string{"ability.started", "ability.stopped", "ability.started", "ability.stopped"}, waitForEvents(t, r, 4))
+}
+
+// preStopAbility represents a runnable ability whose pre-stop hook is driven by the test
+type preStopAbility struct {
+	*testAbility
+	chanPreStop        chan error
+	chanPreStopStarted chan struct{}
+}
+
+func newPreStopAbility() *preStopAbility {
+	return &preStopAbility{
+		testAbility:        newTestAbility(),
+		chanPreStop:        make(chan error),
+		chanPreStopStarted: make(chan struct{}, 1),
+	}
+}
+
+func (a *preStopAbility) PreStop() error {
+	a.chanPreStopStarted <- struct{}{}
+	return <-a.chanPreStop
+}
+
+func TestAbilityPreStop(t *testing.T) {
+	ta := newPreStopAbility()
+	a, _, fc := newAbilityForTest(ta, AbilityConfiguration{PreStopTimeout: time.Second})
+	chanErr := make(chan error, 1)
+
+	// Error is provided once the hook has returned
+	a.preStop(func(err error) { chanErr <- err })
+	<-ta.chanPreStopStarted
+	ta.chanPreStop <- errors.New("test")
+	assert.EqualError(t, <-chanErr, "astibrain: pre-stop hook of Test failed: test")
+
+	// Error is provided once the hook has timed out
+	a.preStop(func(err error) { chanErr <- err })
+	<-ta.chanPreStopStarted
+	fc.Advance(time.Second - time.Nanosecond)
+	select {
+	case <-chanErr:
+		t.Fatal("pre-stop hook has timed out too early")
+	case <-time.After(10 * time.Millisecond):
+	}
+	fc.Advance(time.Nanosecond)
+	assert.EqualError(t, <-chanErr, "astibrain: pre-stop hook of Test timed out after 1s, switching it off anyway")
+	ta.chanPreStop <- nil
+}
+
+func TestBrainStopRunsPreStopHooksConcurrently(t *testing.T) {
+	// Create abilities
+	fc := NewFakeClock(time.Unix(0, 0))
+	as, r := newAbilities(), &eventRecorder{}
+	var tas []*preStopAbility
+	b := &Brain{abilities: as}
+	for _, n := range []string{"Test 1", "Test 2"} {
+		ta := newPreStopAbility()
+		a := newAbility(ta, as, r, nil, AbilityConfiguration{PreStopTimeout: time.Second}, withClock(fc))
+		a.name = n
+		as.set(a)
+		a.on()
+		tas = append(tas, ta)
+	}
+
+	// Hooks of all abilities are running at the same time and don't block Stop's context
+	ctx, cancel := context.WithCancel(context.Background())
+	chanStopped := make(chan struct{})
+	go func() {
+		b.Stop(ctx)
+		close(chanStopped)
+	}()
+	for _, ta := range tas {
+		select {
+		case <-ta.chanPreStopStarted:
+		case <-time.After(time.Second):
+			t.Fatal("pre-stop hooks are not running concurrently")
+		}
+	}
+
+	// Hooks time out, which switches abilities off
+	fc.Advance(time.Second)
+	<-chanStopped
+	cancel()
+	for _, ta := range tas {
+		ta.chanPreStop <- nil
+	}
+	assert.Equal(t, []string{"ability.started", "ability.started", "ability.stopped", "ability.stopped"}, r.names())
+}
+
+func TestAbilityStopSchedule(t *testing.T) {
+	ta := newTestAbility()
+	a, r, fc := newAbilityForTest(ta, AbilityConfiguration{})
+	s, err := parseSchedule([]string{"01:00-02:00"})
+	assert.NoError(t, err)
+	a.schedule = s
+	b := &Brain{abilities: a.abilities}
+
+	// Window opens
+	chanDone := make(chan struct{})
+	go func() {
+		b.runSchedule(a.scheduleContext(context.Background()), a)
+		close(chanDone)
+	}()
+	waitForTimers(t, fc, 1)
+	fc.Advance(time.Hour)
+	assert.Equal(t, []string{"ability.started"}, waitForEvents(t, r, 1))
+
+	// Stopping the schedule stops its goroutine
+	a.stopSchedule()
+	select {
+	case <-chanDone:
+	case <-time.After(time.Second):
+		t.Fatal("schedule is still running")
+	}
+
+	// Schedule can't be started anymore
+	assert.Error(t, a.scheduleContext(context.Background()).Err())
+	fc.Advance(time.Hour)
+	assert.Equal(t, []string{"ability.started"}, r.names())
+}
+
+// testSpan represents a span recording whether it has ended and with which error
+type testSpan struct {
+	err   error
+	ended bool
+	m     sync.Mutex // Locks err and ended
+	name  string
+}
+
+func (s *testSpan) End() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.ended = true
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.err = err
+}
+
+func (s *testSpan) TraceID() string { return "test" }
+
+func (s *testSpan) state() (ended bool, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.ended, s.err
+}
+
+// testTracer represents a tracer recording the spans it has started
+type testTracer struct {
+	m  sync.Mutex // Locks ss
+	ss []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	s := &testSpan{name: spanName}
+	t.ss = append(t.ss, s)
+	return ctx, s
+}
+
+func (t *testTracer) spans() []*testSpan {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return append([]*testSpan{}, t.ss...)
+}
+
+// activableAbility represents an ability whose activation fails
+type activableAbility struct {
+	*testAbility
+}
+
+func (a *activableAbility) Activate(on bool) error {
+	if on {
+		return errors.New("test")
+	}
+	return nil
+}
+
+func TestAbilityRunSpans(t *testing.T) {
+	// Run span of a failed activation is ended with the error
+	tr := &testTracer{}
+	a := newAbility(&activableAbility{testAbility: newTestAbility()}, newAbilities(), &eventRecorder{}, nil, AbilityConfiguration{}, withClock(NewFakeClock(time.Unix(0, 0))), withTracer(tr))
+	a.on()
+	ss := tr.spans()
+	assert.Len(t, ss, 1)
+	assert.Equal(t, spanNameAbilityRun, ss[0].name)
+	ended, err := ss[0].state()
+	assert.True(t, ended)
+	assert.EqualError(t, err, "astibrain: activating failed: test")
+
+	// Run span of a crashed run is ended with the error
+	tr = &testTracer{}
+	ta := newTestAbility()
+	a = newAbility(ta, newAbilities(), &eventRecorder{}, nil, AbilityConfiguration{}, withClock(NewFakeClock(time.Unix(0, 0))), withTracer(tr))
+	a.on()
+	ta.chanRun <- errors.New("test")
+	for deadline := time.Now().Add(time.Second); a.isOn() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	ended, err = tr.spans()[0].state()
+	for deadline := time.Now().Add(time.Second); !ended && time.Now().Before(deadline); ended, err = tr.spans()[0].state() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, ended)
+	assert.EqualError(t, err, "test")
+
+	// Run span of a run switched off is ended without error
+	a.on()
+	a.off()
+	ended, err = tr.spans()[1].state()
+	for deadline := time.Now().Add(time.Second); !ended && time.Now().Before(deadline); ended, err = tr.spans()[1].state() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, ended)
+	assert.NoError(t, err)
+}
+
+// goroutinesAbility represents a runnable ability starting n counted goroutines blocking until its run is over
+type goroutinesAbility struct {
+	*testAbility
+	chanStarted chan struct{}
+	n           int
+}
+
+func (a *goroutinesAbility) Run(ctx context.Context) error {
+	for idx := 0; idx < a.n; idx++ {
+		Go(ctx, func() { <-ctx.Done() })
+	}
+	close(a.chanStarted)
+	return a.testAbility.Run(ctx)
+}
+
+func TestAbilityMaxGoroutines(t *testing.T) {
+	ta := &goroutinesAbility{chanStarted: make(chan struct{}), testAbility: newTestAbility(), n: 2}
+	a, r, fc := newAbilityForTest(ta, AbilityConfiguration{MaxGoroutines: 2, ResourceCheckInterval: time.Second})
+	a.on()
+	assert.Equal(t, []string{"ability.started"}, waitForEvents(t, r, 1))
+
+	// Run goroutine and the goroutines it has started are counted
+	<-ta.chanStarted
+	waitForTimers(t, fc, 1)
+	fc.Advance(time.Second)
+
+	// Ability is switched off once it exceeds its limit
+	assert.Equal(t, []string{"ability.started", string(WebsocketEventNameAbilityResourceExceeded), "ability.stopped"}, waitForEvents(t, r, 3))
+	assert.Equal(t, APIAbilityResourceExceeded{Limit: 2, Name: "Test", Resource: resourceGoroutines, Value: 3}, r.events()[1].payload)
+	assert.False(t, a.isOn())
+}
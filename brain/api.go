@@ -0,0 +1,318 @@
+package astibrain
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/asticode/go-astilog"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+)
+
+// APIConfiguration represents an API configuration
+// If ListenAddr is empty, the API is disabled.
+// If the websocket token or basic auth credentials are set, requests must hold either of them, the same way the
+// websocket authenticates to Bob.
+// Handlers of abilities implementing the HTTPHandler interface are mounted under /abilities/<name>.
+// GET /abilities returns the descriptors of all abilities, see Describable.
+type APIConfiguration struct {
+	ListenAddr string `toml:"listen_addr"`
+}
+
+// APIAbilityStatus is an ability status API payload
+type APIAbilityStatus struct {
+	Health AbilityHealth `json:"health"`
+	Name   string        `json:"name"`
+	State  AbilityState  `json:"state"`
+}
+
+// APIError represents an API error
+type APIError struct {
+	Message string `json:"message"`
+}
+
+// HTTPHandler represents an object that can serve HTTP requests through the brain API.
+// The pattern is relative to /abilities/<name> and follows the http.ServeMux syntax: a pattern ending with a slash
+// matches all paths starting with it. Paths of the ability API, such as /on and /off, can't be used.
+type HTTPHandler interface {
+	HTTPHandler() (pattern string, h http.Handler)
+}
+
+// api represents the brain HTTP API.
+// A nil *api is valid and doesn't serve anything.
+type api struct {
+	abilities *abilities
+	c         APIConfiguration
+	hs        map[string]*http.ServeMux // Indexed by ability name
+	m         sync.Mutex                // Locks hs
+	password  string
+	token     string
+	username  string
+}
+
+// newAPI creates a new API whose requests are authenticated with the websocket credentials.
+// It returns nil if the API is disabled.
+func newAPI(abilities *abilities, c APIConfiguration, wc WebsocketConfiguration) *api {
+	if len(c.ListenAddr) == 0 {
+		return nil
+	}
+	return &api{
+		abilities: abilities,
+		c:         c,
+		hs:        make(map[string]*http.ServeMux),
+		password:  wc.Password,
+		token:     wc.Token,
+		username:  wc.Username,
+	}
+}
+
+// mount mounts the handler of an ability
+func (a *api) mount(abilityName string, v HTTPHandler) {
+	// API is disabled
+	if a == nil {
+		return
+	}
+
+	// Get handler
+	pattern, h := v.HTTPHandler()
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+
+	// Create mux
+	m := http.NewServeMux()
+	m.Handle(pattern, h)
+
+	// Mount
+	a.m.Lock()
+	a.hs[NormalizeAbilityName(abilityName)] = m
+	a.m.Unlock()
+	astilog.Debugf("astibrain: mounting %s handler on /abilities/%s%s", abilityName, abilityName, pattern)
+}
+
+// unmount unmounts the handler of an ability
+func (a *api) unmount(abilityName string) {
+	// API is disabled
+	if a == nil {
+		return
+	}
+
+	// Unmount
+	a.m.Lock()
+	delete(a.hs, NormalizeAbilityName(abilityName))
+	a.m.Unlock()
+}
+
+// route serves requests with the handler of the ability if it has mounted one and with the router otherwise
+func (a *api) route(r *httprouter.Router) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// Parse path
+		// Paths are /abilities/<name>/<path>
+		ps := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 3)
+		if len(ps) < 3 || ps[0] != "abilities" || ps[2] == "configuration" || ps[2] == "on" || ps[2] == "off" {
+			r.ServeHTTP(rw, req)
+			return
+		}
+
+		// Get handler
+		a.m.Lock()
+		m, ok := a.hs[NormalizeAbilityName(ps[1])]
+		a.m.Unlock()
+		if !ok {
+			r.ServeHTTP(rw, req)
+			return
+		}
+
+		// Serve
+		http.StripPrefix("/abilities/"+ps[1], m).ServeHTTP(rw, req)
+	})
+}
+
+// handler returns the authenticated API handler
+func (a *api) handler() http.Handler {
+	// Create router
+	r := httprouter.New()
+	r.GET("/abilities", a.handleAbilitiesGET)
+	r.GET("/abilities/:name", a.handleAbilityGET)
+	r.POST("/abilities/:name/configuration", a.handleAbilityConfigurationPOST)
+	r.POST("/abilities/:name/off", a.handleAbilityOffPOST)
+	r.POST("/abilities/:name/on", a.handleAbilityOnPOST)
+	return a.authenticate(a.route(r))
+}
+
+// serve serves the API until the context is done
+func (a *api) serve(ctx context.Context) {
+	// Create server
+	s := &http.Server{Addr: a.c.ListenAddr, Handler: a.handler()}
+
+	// Shutdown server once context is done
+	go func() {
+		<-ctx.Done()
+		if err := s.Shutdown(context.Background()); err != nil {
+			astilog.Error(errors.Wrap(err, "astibrain: shutting down api server failed"))
+		}
+	}()
+
+	// Serve
+	astilog.Debugf("astibrain: serving api on %s", a.c.ListenAddr)
+	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		astilog.Error(errors.Wrapf(err, "astibrain: serving api on %s failed", a.c.ListenAddr))
+	}
+}
+
+// authenticate makes sure requests hold the websocket token or basic auth credentials
+func (a *api) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Validate
+		if !a.isAuthorized(r) {
+			apiWriteError(rw, http.StatusUnauthorized, errors.New("astibrain: invalid api credentials"))
+			return
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// isAuthorized checks whether the request holds either the token or the basic auth credentials
+// Requests are authorized if no credentials have been set.
+func (a *api) isAuthorized(r *http.Request) bool {
+	// Get credentials
+	isToken, isBasicAuth := len(a.token) > 0, len(a.username) > 0 && len(a.password) > 0
+	if !isToken && !isBasicAuth {
+		return true
+	}
+
+	// Token
+	if v := r.Header.Get("Authorization"); isToken && strings.HasPrefix(v, "Bearer ") {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(v, "Bearer ")), []byte(a.token)) == 1 {
+			return true
+		}
+	}
+
+	// Basic auth
+	if username, password, ok := r.BasicAuth(); isBasicAuth && ok {
+		return subtle.ConstantTimeCompare([]byte(username), []byte(a.username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1
+	}
+	return false
+}
+
+// handleAbilityGET returns the ability status
+func (a *api) handleAbilityGET(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Retrieve ability
+	o, ok := a.ability(rw, p)
+	if !ok {
+		return
+	}
+
+	// Write
+	apiWrite(rw, http.StatusOK, newAPIAbilityStatus(o))
+}
+
+// handleAbilityOnPOST switches the ability on
+func (a *api) handleAbilityOnPOST(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Retrieve ability
+	o, ok := a.ability(rw, p)
+	if !ok {
+		return
+	}
+
+	// Ability is not ready
+	if !o.isInitialized() {
+		apiWriteError(rw, http.StatusConflict, fmt.Errorf("astibrain: %s has not been initialized", o.name))
+		return
+	} else if o.isInProgress() {
+		apiWriteError(rw, http.StatusConflict, fmt.Errorf("astibrain: an operation on %s is already in progress", o.name))
+		return
+	}
+
+	// Switch on
+	o.on()
+
+	// Write
+	apiWrite(rw, http.StatusOK, newAPIAbilityStatus(o))
+}
+
+// handleAbilityConfigurationPOST reconfigures the ability with the JSON configuration of the body
+func (a *api) handleAbilityConfigurationPOST(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Retrieve ability
+	o, ok := a.ability(rw, p)
+	if !ok {
+		return
+	}
+
+	// Decode body
+	var cfg json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		apiWriteError(rw, http.StatusBadRequest, errors.Wrap(err, "astibrain: json decoding body failed"))
+		return
+	}
+
+	// Reconfigure
+	if err := o.reconfigure(cfg); err != nil {
+		apiWriteError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	// Write
+	apiWrite(rw, http.StatusOK, newAPIAbilityStatus(o))
+}
+
+// handleAbilityOffPOST switches the ability off
+func (a *api) handleAbilityOffPOST(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Retrieve ability
+	o, ok := a.ability(rw, p)
+	if !ok {
+		return
+	}
+
+	// Operation is already in progress
+	// A pending restart is not considered as in progress since switching off cancels it
+	if o.isStartingOrStopping() {
+		apiWriteError(rw, http.StatusConflict, fmt.Errorf("astibrain: an operation on %s is already in progress", o.name))
+		return
+	}
+
+	// Switch off
+	o.off()
+
+	// Write
+	apiWrite(rw, http.StatusOK, newAPIAbilityStatus(o))
+}
+
+// ability retrieves the ability of the request and writes a 404 if it's unknown
+func (a *api) ability(rw http.ResponseWriter, p httprouter.Params) (o *ability, ok bool) {
+	if o, ok = a.abilities.ability(p.ByName("name")); !ok {
+		apiWriteError(rw, http.StatusNotFound, fmt.Errorf("astibrain: unknown ability %s", p.ByName("name")))
+		return
+	}
+	return
+}
+
+// newAPIAbilityStatus creates a new ability status API payload
+func newAPIAbilityStatus(a *ability) APIAbilityStatus {
+	return APIAbilityStatus{
+		Health: a.lastHealth(),
+		Name:   a.name,
+		State:  a.state(),
+	}
+}
+
+// apiWriteError writes an API error
+func apiWriteError(rw http.ResponseWriter, code int, err error) {
+	astilog.Error(err)
+	apiWrite(rw, code, APIError{Message: err.Error()})
+}
+
+// apiWrite writes API data
+func apiWrite(rw http.ResponseWriter, code int, data interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(data); err != nil {
+		astilog.Error(errors.Wrap(err, "astibrain: json encoding failed"))
+	}
+}
@@ -0,0 +1,71 @@
+package astibrain
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIAuthentication(t *testing.T) {
+	ta := newTestAbility()
+	o, _, _ := newAbilityForTest(ta, AbilityConfiguration{})
+	h := newAPI(o.abilities, APIConfiguration{ListenAddr: "test"}, WebsocketConfiguration{
+		Password: "password",
+		Token:    "token",
+		Username: "username",
+	}).handler()
+	for _, v := range []struct {
+		code int
+		fn   func(r *http.Request)
+		name string
+	}{
+		{code: http.StatusUnauthorized, fn: func(r *http.Request) {}, name: "no credentials"},
+		{code: http.StatusOK, fn: func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, name: "token"},
+		{code: http.StatusUnauthorized, fn: func(r *http.Request) { r.Header.Set("Authorization", "Bearer invalid") }, name: "invalid token"},
+		{code: http.StatusOK, fn: func(r *http.Request) { r.SetBasicAuth("username", "password") }, name: "basic auth"},
+		{code: http.StatusUnauthorized, fn: func(r *http.Request) { r.SetBasicAuth("username", "invalid") }, name: "invalid basic auth"},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/abilities/test", nil)
+			v.fn(r)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			assert.Equal(t, v.code, rec.Code)
+		})
+	}
+
+	// No credentials
+	h = newAPI(o.abilities, APIConfiguration{ListenAddr: "test"}, WebsocketConfiguration{}).handler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abilities/test", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abilities/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAPIOffCancelsRestart(t *testing.T) {
+	ta := newTestAbility()
+	o, r, fc := newAbilityForTest(ta, AbilityConfiguration{RestartOnCrash: true})
+	h := newAPI(o.abilities, APIConfiguration{ListenAddr: "test"}, WebsocketConfiguration{}).handler()
+	o.on()
+	ta.chanRun <- errors.New("test")
+	waitForEvents(t, r, 3)
+
+	// Switching on while the restart is pending conflicts
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/abilities/test/on", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Switching off cancels the pending restart
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/abilities/test/off", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	fc.Advance(time.Hour)
+	assert.False(t, o.isOn())
+	assert.Equal(t, []string{"ability.started", "ability.crashed", "ability.restarting"}, r.names())
+}
@@ -0,0 +1,378 @@
+package astibrain
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// AuditConfiguration represents an audit log configuration
+// If Path is set, the lifecycle, toggle, lease and reconfigure websocket events exchanged with Bob are appended to the
+// JSON lines file at Path, see AuditEntry. Entries are written in the background so that sending events never waits
+// for the disk. Once the file exceeds MaxSize bytes, it's rotated to Path.1, previous rotations being shifted, and only
+// the MaxFiles most recent rotations are kept. Other events, such as heartbeats or abilities events, are never audited.
+type AuditConfiguration struct {
+	MaxFiles int    `toml:"max_files"`
+	MaxSize  int64  `toml:"max_size"`
+	Path     string `toml:"path"`
+}
+
+// AuditEntry represents an audit log entry
+type AuditEntry struct {
+	At      time.Time       `json:"at"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// auditedEventNames are the names of the audited events
+var auditedEventNames = map[WebsocketEventName]bool{
+	// Lifecycle
+	WebsocketEventNameAbilityCrashed:          true,
+	WebsocketEventNameAbilityDependencyLost:   true,
+	WebsocketEventNameAbilityForgotten:        true,
+	WebsocketEventNameAbilityInitFailed:       true,
+	WebsocketEventNameAbilityLearned:          true,
+	WebsocketEventNameAbilityPaused:           true,
+	WebsocketEventNameAbilityResourceExceeded: true,
+	WebsocketEventNameAbilityRestarting:       true,
+	WebsocketEventNameAbilityResumed:          true,
+	WebsocketEventNameAbilityStarted:          true,
+	WebsocketEventNameAbilityStopped:          true,
+	WebsocketEventNameAbilityTimedOut:         true,
+	WebsocketEventNameAbilityUnhealthy:        true,
+
+	// Toggle
+	WebsocketEventNameAbilityPause:  true,
+	WebsocketEventNameAbilityResume: true,
+	WebsocketEventNameAbilityStart:  true,
+	WebsocketEventNameAbilityStop:   true,
+
+	// Lease
+	WebsocketEventNameAbilityLeaseAcquire:  true,
+	WebsocketEventNameAbilityLeaseAcquired: true,
+	WebsocketEventNameAbilityLeaseLost:     true,
+	WebsocketEventNameAbilityLeaseRelease:  true,
+
+	// Reconfigure
+	WebsocketEventNameAbilityReconfigure:  true,
+	WebsocketEventNameAbilityReconfigured: true,
+}
+
+// auditLog represents an audit log
+// Entries are written one at a time by a goroutine, in the order they've been added.
+// A nil *auditLog is valid and doesn't audit anything.
+type auditLog struct {
+	c        AuditConfiguration
+	clock    Clock
+	closed   bool
+	cond     *sync.Cond // Broadcast whenever closed, inFlight or q change
+	f        *os.File
+	inFlight bool
+	m        sync.Mutex // Locks closed, f, inFlight, q and size
+	q        [][]byte
+	size     int64
+}
+
+// newAuditLog creates a new audit log
+// It returns nil if the audit log is disabled.
+func newAuditLog(c AuditConfiguration, clock Clock) *auditLog {
+	// Audit log is disabled
+	if len(c.Path) == 0 {
+		return nil
+	}
+
+	// Default configuration values
+	if c.MaxFiles <= 0 {
+		c.MaxFiles = 5
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = 10 << 20
+	}
+
+	// Create
+	l := &auditLog{c: c, clock: clock}
+	l.cond = sync.NewCond(&l.m)
+
+	// Write in a goroutine
+	go l.flush()
+	return l
+}
+
+// isAudited checks whether an event is audited
+func isAudited(eventName WebsocketEventName) bool {
+	return auditedEventNames[eventName]
+}
+
+// add appends an event to the audit log and mutes the error (which is still logged)
+func (l *auditLog) add(eventName WebsocketEventName, payload interface{}) {
+	// Event is not audited
+	if l == nil || !isAudited(eventName) {
+		return
+	}
+
+	// Create entry
+	e := AuditEntry{
+		At:   l.clock.Now(),
+		Name: string(eventName),
+	}
+	if payload != nil {
+		var err error
+		if e.Payload, err = json.Marshal(payload); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibrain: json marshaling %s payload %#v failed", eventName, payload))
+			return
+		}
+	}
+
+	// Marshal entry
+	b, err := json.Marshal(e)
+	if err != nil {
+		astilog.Error(errors.Wrapf(err, "astibrain: json marshaling audit entry %#v failed", e))
+		return
+	}
+	b = append(b, '\n')
+
+	// Enqueue
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.closed {
+		return
+	}
+	l.q = append(l.q, b)
+	l.cond.Broadcast()
+}
+
+// flush writes queued entries until the audit log is closed and its queue is empty
+func (l *auditLog) flush() {
+	for {
+		// Wait for an entry
+		l.m.Lock()
+		for !l.closed && len(l.q) == 0 {
+			l.cond.Wait()
+		}
+
+		// Audit log is closed and its queue is empty
+		if len(l.q) == 0 {
+			l.m.Unlock()
+			return
+		}
+
+		// Pop entries
+		bs := l.q
+		l.q = nil
+		l.inFlight = true
+		l.m.Unlock()
+
+		// Write
+		// Files are only opened, rotated and closed by this goroutine or once it's done
+		for _, b := range bs {
+			if err := l.write(b); err != nil {
+				astilog.Error(errors.Wrap(err, "astibrain: writing audit entry failed"))
+			}
+		}
+
+		// Update in flight attribute
+		l.m.Lock()
+		l.inFlight = false
+		l.cond.Broadcast()
+		l.m.Unlock()
+	}
+}
+
+// waitUnsafe waits for queued entries to be written
+// Assumption is made that m is locked
+func (l *auditLog) waitUnsafe() {
+	for len(l.q) > 0 || l.inFlight {
+		l.cond.Wait()
+	}
+}
+
+// write writes a line to the audit log file and rotates it if needed
+// Assumption is made that it's only executed by flush
+func (l *auditLog) write(b []byte) (err error) {
+	// Rotate
+	if l.f != nil && l.size+int64(len(b)) > l.c.MaxSize {
+		if err = l.rotate(); err != nil {
+			err = errors.Wrap(err, "astibrain: rotating audit log failed")
+			return
+		}
+	}
+
+	// Open file
+	if l.f == nil {
+		if l.f, err = os.OpenFile(l.c.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			err = errors.Wrapf(err, "astibrain: opening %s failed", l.c.Path)
+			return
+		}
+
+		// Get size
+		var fi os.FileInfo
+		if fi, err = l.f.Stat(); err != nil {
+			err = errors.Wrapf(err, "astibrain: stating %s failed", l.c.Path)
+			return
+		}
+		l.size = fi.Size()
+	}
+
+	// Write
+	var n int
+	n, err = l.f.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		err = errors.Wrapf(err, "astibrain: writing to %s failed", l.c.Path)
+		return
+	}
+	return
+}
+
+// rotatedAuditLogPath returns the path of a rotated audit log file
+func rotatedAuditLogPath(path string, idx int) string {
+	return fmt.Sprintf("%s.%d", path, idx)
+}
+
+// rotate closes the audit log file and shifts the rotated files
+// Assumption is made that it's only executed by flush
+func (l *auditLog) rotate() (err error) {
+	// Close file
+	if err = l.f.Close(); err != nil {
+		err = errors.Wrapf(err, "astibrain: closing %s failed", l.c.Path)
+		return
+	}
+	l.f = nil
+	l.size = 0
+
+	// Remove oldest file
+	if err = os.Remove(rotatedAuditLogPath(l.c.Path, l.c.MaxFiles)); err != nil && !os.IsNotExist(err) {
+		err = errors.Wrapf(err, "astibrain: removing %s failed", rotatedAuditLogPath(l.c.Path, l.c.MaxFiles))
+		return
+	}
+
+	// Shift files
+	for idx := l.c.MaxFiles - 1; idx >= 0; idx-- {
+		src := l.c.Path
+		if idx > 0 {
+			src = rotatedAuditLogPath(l.c.Path, idx)
+		}
+		if err = os.Rename(src, rotatedAuditLogPath(l.c.Path, idx+1)); err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "astibrain: renaming %s failed", src)
+			return
+		}
+	}
+	err = nil
+	return
+}
+
+// close writes the queued entries and closes the audit log file
+// Entries added afterwards are discarded.
+func (l *auditLog) close() (err error) {
+	// Audit log is disabled
+	if l == nil {
+		return
+	}
+
+	// Lock
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	// Wait for queued entries to be written
+	l.closed = true
+	l.cond.Broadcast()
+	l.waitUnsafe()
+
+	// File is not open
+	if l.f == nil {
+		return
+	}
+
+	// Close
+	if err = l.f.Close(); err != nil {
+		err = errors.Wrapf(err, "astibrain: closing %s failed", l.c.Path)
+		return
+	}
+	l.f = nil
+	return
+}
+
+// entries returns the audited entries that have happened since the provided time, oldest first
+// If n > 0, only the n most recent entries are returned.
+func (l *auditLog) entries(since time.Time, n int) (es []AuditEntry, err error) {
+	// Audit log is disabled
+	if l == nil {
+		return
+	}
+
+	// Lock so that files are not rotated while they're read
+	// Queued entries are written first so that they're returned as well
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.waitUnsafe()
+
+	// Loop through files, oldest first
+	for idx := l.c.MaxFiles; idx >= 0; idx-- {
+		path := l.c.Path
+		if idx > 0 {
+			path = rotatedAuditLogPath(l.c.Path, idx)
+		}
+		if err = readAuditEntries(path, since, func(e AuditEntry) {
+			es = append(es, e)
+			if n > 0 && len(es) > n {
+				es = es[1:]
+			}
+		}); err != nil {
+			err = errors.Wrapf(err, "astibrain: reading audit entries from %s failed", path)
+			return
+		}
+	}
+	return
+}
+
+// readAuditEntries reads the audit entries of a file that have happened since the provided time
+// Missing files are skipped.
+func readAuditEntries(path string, since time.Time, fn func(e AuditEntry)) (err error) {
+	// Open file
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+		err = errors.Wrapf(err, "astibrain: opening %s failed", path)
+		return
+	}
+	defer f.Close()
+
+	// Loop through lines
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16<<20)
+	for s.Scan() {
+		// Unmarshal
+		var e AuditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibrain: json unmarshaling audit entry %s failed", s.Bytes()))
+			continue
+		}
+
+		// Entry is too old
+		if e.At.Before(since) {
+			continue
+		}
+		fn(e)
+	}
+	if err = s.Err(); err != nil {
+		err = errors.Wrapf(err, "astibrain: scanning %s failed", path)
+		return
+	}
+	return
+}
+
+// AuditEntries returns the audited entries that have happened since the provided time, oldest first, which helps
+// building an offline timeline.
+// If n > 0, only the n most recent entries are returned. Nothing is returned if the audit log is disabled.
+func (b *Brain) AuditEntries(since time.Time, n int) ([]AuditEntry, error) {
+	return b.ws.audit.entries(since, n)
+}
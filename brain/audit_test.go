@@ -0,0 +1,62 @@
+package astibrain
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	// Entries are more than 40 bytes long so that files are rotated after each one
+	dir, err := os.MkdirTemp("", "astibrain")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	fc := NewFakeClock(time.Unix(0, 0).UTC())
+	l := newAuditLog(AuditConfiguration{MaxFiles: 2, MaxSize: 80, Path: path}, fc)
+
+	// Only lifecycle, toggle, lease and reconfigure events are audited
+	for _, n := range []WebsocketEventName{
+		WebsocketEventNameAbilityStart,
+		WebsocketEventNameBrainHeartbeat,
+		WebsocketEventNameAbilityStarted,
+		WebsocketAbilityEventName("Test", "samples"),
+		WebsocketEventNameAbilityLeaseAcquire,
+		WebsocketEventNameAbilityReconfigured,
+		WebsocketEventNameAbilityStopped,
+	} {
+		l.add(n, "Test")
+		fc.Advance(time.Second)
+	}
+
+	// Entries are written in the background but returned once written
+	es, err := l.entries(time.Time{}, 0)
+	assert.NoError(t, err)
+	var ns []string
+	for _, e := range es {
+		ns = append(ns, e.Name)
+	}
+	// Files have been rotated and only the most recent rotations are kept
+	assert.Equal(t, []string{"ability.lease.acquire", "ability.reconfigured", "ability.stopped"}, ns)
+	assert.Equal(t, json.RawMessage(`"Test"`), es[0].Payload)
+	for _, p := range []string{path, rotatedAuditLogPath(path, 1), rotatedAuditLogPath(path, 2)} {
+		_, err = os.Stat(p)
+		assert.NoError(t, err, p)
+	}
+	_, err = os.Stat(rotatedAuditLogPath(path, 3))
+	assert.True(t, os.IsNotExist(err))
+
+	// Most recent entries
+	es, err = l.entries(time.Unix(3, 0), 1)
+	assert.NoError(t, err)
+	assert.Len(t, es, 1)
+	assert.Equal(t, "ability.stopped", es[0].Name)
+
+	// Entries added once closed are discarded
+	assert.NoError(t, l.close())
+	l.add(WebsocketEventNameAbilityStarted, "Test")
+}
@@ -2,7 +2,11 @@ package astibrain
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/asticode/go-astilog"
 	"github.com/asticode/go-astitools/sync"
@@ -12,55 +16,115 @@ import (
 // Brain is an object handling one or more abilities
 type Brain struct {
 	abilities *abilities
+	api       *api
 	c         Configuration
 	cancel    context.CancelFunc
+	clock     Clock
 	ctx       context.Context
 	d         *astisync.Do
+	isReady   bool
+	isRunning bool
+	m         sync.Mutex // Locks isReady and isRunning
+	metrics   *metrics
+	pipeline  *pipeline
+	root      context.Context
 	ws        *websocket
 }
 
 // Configuration is a brain configuration
+// Audit enables a durable record of lifecycle events, see AuditConfiguration.
+// If HeartbeatInterval is > 0, a heartbeat event summarizing the brain's state is sent to Bob at that interval.
+// Simulate allows running the brain without the hardware its abilities need, see SimulateOptions.
+// If StartupGap is > 0, abilities are initialized and auto started one at a time in priority order, waiting StartupGap
+// between each, instead of being all initialized before being auto started. This spreads the load on constrained
+// devices. Either way, a startup progress event is sent to Bob each time an AutoStart ability has been resolved.
+// If Tracer is set, each run of an ability starts a root span that runnable abilities can retrieve from their context
+// with SpanFromContext and start child spans from with StartSpan. The root span is ended once the run is over, with the
+// error of the run if it has crashed or failed to activate and the span implements ErrorRecorder. Tracing is a no-op
+// otherwise.
 type Configuration struct {
-	Name      string                 `toml:"name"`
-	Websocket WebsocketConfiguration `toml:"websocket"`
+	API               APIConfiguration       `toml:"api"`
+	Audit             AuditConfiguration     `toml:"audit"`
+	Discovery         DiscoveryOptions       `toml:"discovery"`
+	DrainTimeout      time.Duration          `toml:"drain_timeout"`
+	HeartbeatInterval time.Duration          `toml:"heartbeat_interval"`
+	Metrics           MetricsConfiguration   `toml:"metrics"`
+	Name              string                 `toml:"name"`
+	Simulate          SimulateOptions        `toml:"simulate"`
+	StartupGap        time.Duration          `toml:"startup_gap"`
+	Tracer            Tracer                 `toml:"-"`
+	Websocket         WebsocketConfiguration `toml:"websocket"`
 }
 
 // Event represents an event
+// Events are sent to Bob as "ability.<ability name>.<event name>". AbilityName is always set to the name of the ability
+// dispatching the event so that events of different abilities can't collide.
 type Event struct {
 	AbilityName string
 	Name        string
 	Payload     interface{}
 }
 
+// Option represents a brain option
+type Option func(b *Brain)
+
+// WithClock sets the clock the brain and its abilities use to tell time and schedule work instead of the time package,
+// which allows driving time based features deterministically with a FakeClock. Default is RealClock.
+func WithClock(c Clock) Option {
+	return func(b *Brain) {
+		b.clock = c
+	}
+}
+
 // New creates a new brain
-func New(c Configuration) (b *Brain) {
+func New(c Configuration, opts ...Option) *Brain {
+	return NewWithContext(context.Background(), c, opts...)
+}
+
+// NewWithContext creates a new brain whose abilities' contexts derive from the root context so that they carry its
+// values.
+// Once the root context is done, every ability is switched off and Run returns.
+func NewWithContext(root context.Context, c Configuration, opts ...Option) (b *Brain) {
 	// Create brain
 	b = &Brain{
 		abilities: newAbilities(),
 		c:         c,
+		clock:     RealClock{},
 		d:         astisync.NewDo(),
+		metrics:   newMetrics(c.Metrics),
+		root:      root,
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		opt(b)
 	}
 
 	// Add websocket
 	b.ws = newWebsocket(b.abilities, c.Websocket)
+	b.ws.audit = newAuditLog(c.Audit, b.clock)
+	b.ws.clock = b.clock
+	b.ws.isReadyFunc = b.Ready
+
+	// Add pipeline
+	b.pipeline = newPipeline(root, b.ws, b.dispatch)
+
+	// Add api
+	// The api is protected by the same token as the websocket
+	b.api = newAPI(b.abilities, c.API, c.Websocket)
 	return
 }
 
 // Close implements the io.Closer interface
 func (b *Brain) Close() (err error) {
-	// Close abilities
-	b.abilities.abilities(func(a *ability) error {
-		// Log
-		astilog.Debugf("astibrain: closing ability %s", a.name)
-
-		// Switch the ability off
-		a.off()
-
-		// Wait for the ability to be really off
-		a.mr.Lock()
-		a.mr.Unlock()
-		return nil
-	})
+	// Stop abilities
+	var ctx = context.Background()
+	if b.c.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.c.DrainTimeout)
+		defer cancel()
+	}
+	b.Stop(ctx)
 
 	// Close ws
 	astilog.Debug("astibrain: closing websocket")
@@ -69,6 +133,13 @@ func (b *Brain) Close() (err error) {
 		return
 	}
 
+	// Close audit log
+	astilog.Debug("astibrain: closing audit log")
+	if err = b.ws.audit.close(); err != nil {
+		err = errors.Wrap(err, "astibrain: closing audit log failed")
+		return
+	}
+
 	// Close doer
 	astilog.Debug("astibrain: closing doer")
 	if err = b.d.Close(); err != nil {
@@ -78,25 +149,270 @@ func (b *Brain) Close() (err error) {
 	return
 }
 
+// Stop switches all abilities off and waits for them to be really off.
+// Pre-stop hooks of all abilities are executed concurrently and their duration counts towards the context deadline.
+// Abilities that are not off when the context is done are abandoned.
+func (b *Brain) Stop(ctx context.Context) {
+	// Switch abilities off
+	// Abilities are retrieved first so that the pool is not locked while they're switched off
+	// off is called even if the ability is not on so that a pending restart is cancelled
+	var as = make(map[*ability]chan struct{})
+	for _, a := range b.abilities.list() {
+		// Get stopped channel before switching the ability off
+		a.m.Lock()
+		c, isOn := a.chanStopped, a.isOnUnsafe
+		a.m.Unlock()
+		if isOn {
+			as[a] = c
+			astilog.Debugf("astibrain: stopping ability %s", a.name)
+		}
+
+		// Switch the ability off
+		a.off()
+	}
+
+	// Wait for abilities to be really off
+	for a, c := range as {
+		select {
+		case <-c:
+		case <-ctx.Done():
+			// Abandon the ability unless its run has exited in the meantime
+			// The ability is flagged so that the stopped event is not dispatched again once it's really off
+			a.m.Lock()
+			abandon := a.chanStopped == c && !a.isExitedUnsafe
+			if abandon {
+				a.isAbandonedUnsafe = true
+			}
+			a.m.Unlock()
+			if !abandon {
+				continue
+			}
+
+			// Log
+			astilog.Errorf("astibrain: %s didn't stop in time, abandoning it", a.name)
+
+			// Dispatch websocket event
+			a.ws.send(WebsocketEventNameAbilityStopped, a.name)
+			a.metrics.incEvent(a.name, metricsEventStopped)
+			a.sendState()
+		}
+	}
+}
+
+// IsConnected returns whether the brain is connected to Bob
+func (b *Brain) IsConnected() bool {
+	return b.ws.connected()
+}
+
+// DroppedMessages returns the number of websocket messages that have been dropped because the queue was full
+func (b *Brain) DroppedMessages() int {
+	return b.ws.droppedMessages()
+}
+
+// AbilityStatus returns the current state of an ability
+func (b *Brain) AbilityStatus(name string) (s AbilityState, ok bool) {
+	var a *ability
+	if a, ok = b.abilities.ability(name); !ok {
+		return
+	}
+	s = a.state()
+	return
+}
+
+// AbilitiesStatus returns a snapshot of the current state of all abilities indexed by name
+func (b *Brain) AbilitiesStatus() (o map[string]AbilityState) {
+	o = make(map[string]AbilityState)
+	for _, a := range b.abilities.list() {
+		o[a.name] = a.state()
+	}
+	return
+}
+
+// AbilityHealth returns the result of the last health check of an ability
+func (b *Brain) AbilityHealth(name string) (h AbilityHealth, ok bool) {
+	var a *ability
+	if a, ok = b.abilities.ability(name); !ok {
+		return
+	}
+	h = a.lastHealth()
+	return
+}
+
+// LastError returns the error that has made an ability crash the last time, as an *AbilityError.
+// It returns nil if the ability has not crashed since it has last been switched on successfully.
+func (b *Brain) LastError(name string) error {
+	a, ok := b.abilities.ability(name)
+	if !ok {
+		return fmt.Errorf("astibrain: unknown ability %s", name)
+	}
+	return a.lastError()
+}
+
 // Learn allows the brain to learn a new ability.
-func (b *Brain) Learn(a Ability, c AbilityConfiguration) {
+// It can be called while the brain is running, in which case the ability is initialized and auto started right away.
+// An error is returned if an ability with the same name has already been learned or if the ability introduces a cyclic
+// dependency.
+func (b *Brain) Learn(a Ability, c AbilityConfiguration) (err error) {
 	// Log
 	astilog.Debugf("astibrain: learning %s", a.Name())
 
+	// Lock
+	// The lock is held until the ability is added so that Run doesn't miss it
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	// Check name
+	name := strings.TrimSpace(a.Name())
+	if len(name) == 0 {
+		err = errors.New("astibrain: ability name is empty")
+		return
+	}
+
+	// Ability already exists
+	// Names are compared in their canonical form so that abilities only differing by their case collide
+	if e, ok := b.abilities.ability(name); ok {
+		if e.name == name {
+			err = fmt.Errorf("astibrain: ability %s has already been learned", name)
+		} else {
+			err = fmt.Errorf("astibrain: ability %s collides with already learned ability %s", name, e.name)
+		}
+		return
+	}
+
+	// Replace ability with a stub
+	if b.c.Simulate.Enabled {
+		a = newSimulatedAbility(a, b.c.Simulate, b.clock)
+	}
+
+	// Parse schedule
+	var s schedule
+	if s, err = parseSchedule(c.Schedule); err != nil {
+		err = errors.Wrapf(err, "astibrain: parsing schedule of %s failed", name)
+		return
+	}
+
 	// Add ability
-	b.abilities.set(newAbility(a, b.ws, c))
+	o := newAbility(a, b.abilities, b.ws, b.metrics, c, withClock(b.clock), withRootContext(b.root), withTracer(b.c.Tracer))
+	o.schedule = s
+	b.abilities.set(o)
+
+	// Check dependencies
+	if _, err = b.abilities.sorted(); err != nil {
+		b.abilities.del(name)
+		err = errors.Wrapf(err, "astibrain: checking dependencies of %s failed", name)
+		return
+	}
+
+	// Wire pipeline
+	if err = b.pipeline.add(name, a, c.Inputs); err != nil {
+		b.abilities.del(name)
+		err = errors.Wrapf(err, "astibrain: wiring pipeline of %s failed", name)
+		return
+	}
+	o.setOutputNames(b.pipeline.outputNames(name))
 
 	// Set dispatch func
 	if v, ok := a.(Dispatcher); ok {
-		v.SetDispatchFunc(b.dispatch)
+		v.SetDispatchFunc(b.dispatchFunc(name))
+	}
+
+	// Set observe func
+	if v, ok := a.(Observer); ok {
+		v.SetObserveFunc(b.observeFunc(name))
+	}
+
+	// Set gauge func
+	if v, ok := a.(Gauger); ok {
+		v.SetGaugeFunc(b.gaugeFunc(name))
+	}
+
+	// Set clock
+	if v, ok := a.(ClockUser); ok {
+		v.SetClock(b.clock)
+	}
+
+	// Set is connected func
+	if v, ok := a.(ConnectionChecker); ok {
+		v.SetIsConnectedFunc(b.IsConnected)
 	}
 
 	// Add custom websocket listeners
+	// They're added as handlers so that they can be removed without removing the other listeners of the same events
 	if v, ok := a.(WebsocketListener); ok {
 		for n, l := range v.WebsocketListeners() {
-			b.ws.c.AddListener(WebsocketAbilityEventName(a.Name(), n), l)
+			o.wsHandlers = append(o.wsHandlers, b.ws.addHandler(WebsocketAbilityEventName(name, n), l))
 		}
 	}
+
+	// Mount http handler
+	if v, ok := a.(HTTPHandler); ok {
+		b.api.mount(name, v)
+	}
+
+	// Brain is not running
+	if !b.isRunning {
+		return
+	}
+
+	// Let Bob know
+	// Abilities learned while disconnected are sent with the register event instead
+	if b.ws.connected() {
+		b.ws.send(WebsocketEventNameAbilityLearned, newAPIAbility(o))
+		b.ws.sendAbilitiesDescribed()
+	}
+
+	// Start ability
+	// The context is cancelled once the ability is forgotten so that its schedule stops
+	go b.start(o.scheduleContext(b.ctx), o)
+	return
+}
+
+// Forget allows the brain to forget an ability.
+// If the ability is on, it's switched off and Forget waits for it to be really off.
+func (b *Brain) Forget(name string) (err error) {
+	// Log
+	astilog.Debugf("astibrain: forgetting %s", name)
+
+	// Retrieve ability
+	a, ok := b.abilities.ability(name)
+	if !ok {
+		err = fmt.Errorf("astibrain: unknown ability %s", name)
+		return
+	}
+
+	// Stop schedule
+	a.stopSchedule()
+
+	// Switch the ability off and wait for it to be really off
+	// off is called even if the ability is not on so that a pending restart is cancelled
+	a.m.Lock()
+	c, isOn := a.chanStopped, a.isOnUnsafe
+	a.m.Unlock()
+	a.off()
+	if isOn {
+		<-c
+	}
+
+	// Remove custom websocket listeners
+	for _, h := range a.wsHandlers {
+		b.ws.delHandler(h)
+	}
+
+	// Unwire pipeline
+	b.pipeline.del(a.name)
+
+	// Unmount http handler
+	b.api.unmount(a.name)
+
+	// Delete ability
+	b.abilities.del(a.name)
+
+	// Let Bob know
+	if b.ws.connected() {
+		b.ws.send(WebsocketEventNameAbilityForgotten, a.name)
+		b.ws.sendAbilitiesDescribed()
+	}
+	return
 }
 
 // Run runs the brain
@@ -105,6 +421,15 @@ func (b *Brain) Run(ctx context.Context) (err error) {
 	b.ctx, b.cancel = context.WithCancel(ctx)
 	defer b.cancel()
 
+	// Stop once the root context is done
+	go func() {
+		select {
+		case <-b.root.Done():
+			b.cancel()
+		case <-b.ctx.Done():
+		}
+	}()
+
 	// Get name
 	var name = b.c.Name
 	if len(name) == 0 {
@@ -115,30 +440,167 @@ func (b *Brain) Run(ctx context.Context) (err error) {
 		}
 	}
 
+	// Configure TLS
+	if err = b.ws.configureTLS(); err != nil {
+		err = errors.Wrap(err, "astibrain: configuring tls failed")
+		return
+	}
+
+	// Discover Bob
+	// The websocket URL is used as a fallback if discovery fails
+	if b.c.Discovery.Enabled {
+		if u, err := discover(b.ctx, DiscoveryDefaults(b.c.Discovery)); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibrain: discovering bob failed, falling back to %s", b.ws.cfg.URL))
+		} else {
+			astilog.Infof("astibrain: bob has been discovered at %s", u)
+			b.ws.cfg.URL = u
+		}
+	}
+
 	// Dial
 	go b.ws.dial(b.ctx, name)
 
-	// Loop through abilities
-	if err = b.abilities.abilities(func(a *ability) (err error) {
-		// Auto start
-		if a.c.AutoStart {
-			a.on()
-		}
-		return
-	}); err != nil {
-		err = errors.Wrap(err, "astibrain: initializing abilities failed")
+	// Serve metrics
+	if b.metrics != nil {
+		go b.metrics.serve(b.ctx)
+	}
+
+	// Serve api
+	if b.api != nil {
+		go b.api.serve(b.ctx)
+	}
+
+	// Send heartbeats
+	if b.c.HeartbeatInterval > 0 {
+		go b.heartbeat(b.ctx, b.clock.Now())
+	}
+
+	// Sort abilities so that dependencies are handled first
+	// Abilities learned from now on are started by Learn
+	b.m.Lock()
+	var as []*ability
+	if as, err = b.abilities.sorted(); err != nil {
+		b.m.Unlock()
+		err = errors.Wrap(err, "astibrain: sorting abilities failed")
 		return
 	}
+	b.isRunning = true
+	b.m.Unlock()
+
+	// Update running and ready attributes
+	defer func() {
+		b.m.Lock()
+		b.isReady = false
+		b.isRunning = false
+		b.m.Unlock()
+	}()
+
+	// Start abilities
+	if b.c.StartupGap > 0 {
+		b.startSequentially(b.ctx, as)
+	} else {
+		// Initialize abilities
+		for _, a := range as {
+			if err := a.init(b.ctx); err != nil {
+				astilog.Error(err)
+			}
+		}
+
+		// Auto start abilities
+		// Scheduled abilities are switched on and off by their schedule instead
+		p := newStartupProgress(as)
+		for _, a := range as {
+			if a.isInitialized() {
+				if len(a.schedule) > 0 {
+					go b.runSchedule(a.scheduleContext(b.ctx), a)
+				} else if a.c.AutoStart {
+					b.autoStart(a)
+				}
+			}
+			p.resolve(b, a)
+		}
+	}
+
+	// All auto started abilities have been resolved
+	b.ready(as)
 
 	// Wait for context to be done
 	<-b.ctx.Done()
 	return
 }
 
+// start initializes an ability learned while the brain is running and auto starts it
+func (b *Brain) start(ctx context.Context, a *ability) {
+	// Initialize
+	if err := a.init(ctx); err != nil {
+		astilog.Error(err)
+		return
+	}
+
+	// Auto start
+	// Scheduled abilities are switched on and off by their schedule instead
+	if len(a.schedule) > 0 {
+		b.runSchedule(ctx, a)
+	} else if a.c.AutoStart {
+		b.autoStart(a)
+	}
+}
+
+// autoStart switches an ability on if all its dependencies are on
+func (b *Brain) autoStart(a *ability) {
+	// Loop through dependencies
+	for _, n := range a.c.DependsOn {
+		// Retrieve dependency
+		d, ok := b.abilities.ability(n)
+		if !ok {
+			astilog.Errorf("astibrain: unknown dependency %s of %s, skipping auto start", n, a.name)
+			return
+		}
+
+		// Dependency is not on
+		if !d.isOn() {
+			astilog.Errorf("astibrain: dependency %s of %s is not on, skipping auto start", n, a.name)
+			return
+		}
+	}
+
+	// Switch on
+	a.on()
+}
+
+// observeFunc returns the observe func of an ability
+func (b *Brain) observeFunc(abilityName string) ObserveFunc {
+	return func(operation string, d time.Duration) {
+		b.metrics.observe(abilityName, operation, d)
+	}
+}
+
+// gaugeFunc returns the gauge func of an ability
+func (b *Brain) gaugeFunc(abilityName string) GaugeFunc {
+	return func(gauge string, v float64) {
+		b.metrics.setGauge(abilityName, gauge, v)
+	}
+}
+
+// dispatchFunc returns the dispatch func of an ability
+func (b *Brain) dispatchFunc(abilityName string) DispatchFunc {
+	return func(e Event) {
+		e.AbilityName = abilityName
+		b.dispatch(e)
+	}
+}
+
 // dispatch dispatches an event to Bob
 func (b *Brain) dispatch(e Event) {
+	// Make sure the event name is not reserved
+	n := WebsocketAbilityEventName(e.AbilityName, e.Name)
+	if IsReservedWebsocketEventName(n) {
+		astilog.Errorf("astibrain: ability %s can't dispatch reserved event %s", e.AbilityName, n)
+		return
+	}
+
 	b.d.Do(func() {
 		// Send
-		b.ws.send(WebsocketAbilityEventName(e.AbilityName, e.Name), e.Payload)
+		b.ws.send(n, e.Payload)
 	})
 }
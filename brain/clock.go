@@ -0,0 +1,91 @@
+package astibrain
+
+import "time"
+
+// Clock represents an object capable of telling time and scheduling work
+// The brain and its abilities use it instead of the time package so that time based features such as restart
+// backoffs, health checks, leases or timeouts can be driven deterministically, see WithClock and FakeClock.
+type Clock interface {
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+	Now() time.Time
+}
+
+// Timer represents a single event scheduled on a clock
+// C returns nil for timers created with AfterFunc.
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// Ticker represents events scheduled periodically on a clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock represents a clock relying on the time package
+type RealClock struct{}
+
+// After implements the Clock interface
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// AfterFunc implements the Clock interface
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{t: time.AfterFunc(d, f)}
+}
+
+// NewTicker implements the Clock interface
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{t: time.NewTicker(d)}
+}
+
+// NewTimer implements the Clock interface
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return realTimer{t: time.NewTimer(d)}
+}
+
+// Now implements the Clock interface
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// realTimer represents a timer relying on the time package
+type realTimer struct {
+	t *time.Timer
+}
+
+// C implements the Timer interface
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+// Reset implements the Timer interface
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
+
+// Stop implements the Timer interface
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+// realTicker represents a ticker relying on the time package
+type realTicker struct {
+	t *time.Ticker
+}
+
+// C implements the Ticker interface
+func (t realTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+// Stop implements the Ticker interface
+func (t realTicker) Stop() {
+	t.t.Stop()
+}
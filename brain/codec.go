@@ -0,0 +1,39 @@
+package astibrain
+
+import (
+	"encoding/json"
+)
+
+// CodecNameJSON is the name of the JSON codec
+const CodecNameJSON = "json"
+
+// Codec represents an object capable of encoding and decoding plugin messages, see PluginConfiguration
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Name() string
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec represents the JSON codec.
+// This is the default codec.
+type JSONCodec struct{}
+
+// NewJSONCodec creates a new JSON codec
+func NewJSONCodec() *JSONCodec {
+	return &JSONCodec{}
+}
+
+// Marshal implements the Codec interface
+func (c *JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Name implements the Codec interface
+func (c *JSONCodec) Name() string {
+	return CodecNameJSON
+}
+
+// Unmarshal implements the Codec interface
+func (c *JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
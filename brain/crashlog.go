@@ -0,0 +1,30 @@
+package astibrain
+
+import (
+	"time"
+)
+
+// crashLog collapses identical consecutive crash messages
+type crashLog struct {
+	at    time.Time // Time the last message has been logged at
+	count int       // Number of identical messages collapsed since the last message has been logged
+	msg   string
+}
+
+// add records a crash message and returns whether it has to be logged as well as the number of identical messages
+// that have been collapsed since the last one has been logged.
+// Messages identical to the last logged one are collapsed as long as they occur within the window. A window <= 0
+// disables the collapsing.
+func (l *crashLog) add(msg string, now time.Time, window time.Duration) (log bool, collapsed int) {
+	// Collapse
+	if window > 0 && msg == l.msg && now.Sub(l.at) < window {
+		l.count++
+		return
+	}
+
+	// Log
+	collapsed = l.count
+	l.at, l.count, l.msg = now, 0, msg
+	log = true
+	return
+}
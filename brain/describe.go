@@ -0,0 +1,72 @@
+package astibrain
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// AbilityDescriptor represents the metadata an ability advertises to clients so that they can render controls
+// specific to it
+// Actions are the names of the actions the ability supports, usually the names of its websocket events. Metadata
+// holds ability specific information such as supported languages.
+type AbilityDescriptor struct {
+	Actions     []string               `json:"actions,omitempty"`
+	Description string                 `json:"description"`
+	DisplayName string                 `json:"display_name"`
+	Icon        string                 `json:"icon,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Name        string                 `json:"name"`
+	Version     string                 `json:"version,omitempty"`
+}
+
+// Describable represents an object that can describe itself to clients
+// Abilities not implementing it get a minimal descriptor holding their name and description.
+type Describable interface {
+	Describe() AbilityDescriptor
+}
+
+// APIAbilitiesDescribed is an abilities described API payload
+type APIAbilitiesDescribed struct {
+	Abilities []AbilityDescriptor `json:"abilities"`
+}
+
+// newAbilityDescriptor creates a new ability descriptor
+func newAbilityDescriptor(a *ability) (d AbilityDescriptor) {
+	// Describe
+	if v, ok := a.a.(Describable); ok {
+		d = v.Describe()
+	}
+
+	// Name can't be overridden
+	d.Name = a.name
+
+	// Default values
+	if len(d.Description) == 0 {
+		d.Description = a.description
+	}
+	if len(d.DisplayName) == 0 {
+		d.DisplayName = a.name
+	}
+	return
+}
+
+// newAPIAbilitiesDescribed creates a new abilities described API payload
+func newAPIAbilitiesDescribed(abilities *abilities) (p APIAbilitiesDescribed) {
+	p = APIAbilitiesDescribed{Abilities: []AbilityDescriptor{}}
+	abilities.abilities(func(a *ability) error {
+		p.Abilities = append(p.Abilities, newAbilityDescriptor(a))
+		return nil
+	})
+	return
+}
+
+// sendAbilitiesDescribed sends the descriptors of all abilities to Bob
+func (ws *websocket) sendAbilitiesDescribed() {
+	ws.send(WebsocketEventNameAbilitiesDescribed, newAPIAbilitiesDescribed(ws.abilities))
+}
+
+// handleAbilitiesGET returns the descriptors of all abilities
+func (a *api) handleAbilitiesGET(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	apiWrite(rw, http.StatusOK, newAPIAbilitiesDescribed(a.abilities))
+}
@@ -0,0 +1,110 @@
+package astibrain
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/grandcat/zeroconf"
+	"github.com/pkg/errors"
+)
+
+// Discovery defaults
+const (
+	DiscoveryDefaultDomain      = "local."
+	DiscoveryDefaultServiceName = "_astibob._tcp"
+	DiscoveryTextPath           = "path"
+	DiscoveryTextScheme         = "scheme"
+)
+
+// DiscoveryOptions represents mDNS discovery options.
+// When enabled, Bob advertises its brains server and brains resolve it at startup. Brains fall back to the websocket
+// URL if discovery fails.
+// Timeout is the max duration brains wait for Bob to be resolved.
+type DiscoveryOptions struct {
+	Domain      string        `toml:"domain"`
+	Enabled     bool          `toml:"enabled"`
+	ServiceName string        `toml:"service_name"`
+	Timeout     time.Duration `toml:"timeout"`
+}
+
+// DiscoveryDefaults returns the options with default values
+func DiscoveryDefaults(o DiscoveryOptions) DiscoveryOptions {
+	if len(o.Domain) == 0 {
+		o.Domain = DiscoveryDefaultDomain
+	}
+	if len(o.ServiceName) == 0 {
+		o.ServiceName = DiscoveryDefaultServiceName
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Second
+	}
+	return o
+}
+
+// discover resolves Bob's websocket URL through mDNS
+func discover(ctx context.Context, o DiscoveryOptions) (u string, err error) {
+	// Create resolver
+	var r *zeroconf.Resolver
+	if r, err = zeroconf.NewResolver(); err != nil {
+		err = errors.Wrap(err, "astibrain: creating mdns resolver failed")
+		return
+	}
+
+	// Create context
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	// Browse
+	astilog.Debugf("astibrain: browsing %s%s", o.ServiceName, o.Domain)
+	var entries = make(chan *zeroconf.ServiceEntry)
+	if err = r.Browse(ctx, o.ServiceName, o.Domain, entries); err != nil {
+		err = errors.Wrapf(err, "astibrain: browsing %s%s failed", o.ServiceName, o.Domain)
+		return
+	}
+
+	// Wait for the first entry with an address
+	for {
+		select {
+		case e, ok := <-entries:
+			if !ok {
+				err = fmt.Errorf("astibrain: no %s%s service found", o.ServiceName, o.Domain)
+				return
+			}
+			if u = discoveryURL(e); len(u) > 0 {
+				return
+			}
+		case <-ctx.Done():
+			err = errors.Wrapf(ctx.Err(), "astibrain: no %s%s service found", o.ServiceName, o.Domain)
+			return
+		}
+	}
+}
+
+// discoveryURL returns the websocket URL of a service entry
+func discoveryURL(e *zeroconf.ServiceEntry) string {
+	// Get host
+	var host string
+	if len(e.AddrIPv4) > 0 {
+		host = e.AddrIPv4[0].String()
+	} else if len(e.AddrIPv6) > 0 {
+		host = e.AddrIPv6[0].String()
+	} else {
+		return ""
+	}
+
+	// Get path and scheme
+	path, scheme := "/websocket", "ws"
+	for _, t := range e.Text {
+		if strings.HasPrefix(t, DiscoveryTextPath+"=") {
+			path = strings.TrimPrefix(t, DiscoveryTextPath+"=")
+		} else if strings.HasPrefix(t, DiscoveryTextScheme+"=") {
+			scheme = strings.TrimPrefix(t, DiscoveryTextScheme+"=")
+		}
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(e.Port)) + path
+}
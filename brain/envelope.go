@@ -0,0 +1,181 @@
+package astibrain
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+)
+
+// WebsocketHeaderEnvelope is the header the brain uses to ask Bob to wrap websocket events in envelopes during the
+// websocket handshake. Its value is the envelope format version. Bob rejects the handshake if it doesn't know the
+// format so that both ends always agree.
+const WebsocketHeaderEnvelope = "X-Astibob-Envelope"
+
+// WebsocketEnvelopeFormatVersion is the current envelope format version
+const WebsocketEnvelopeFormatVersion = "1"
+
+// Envelope represents a versioned websocket event.
+// Version is the schema version of the payload, see RegisterWebsocketEventSchema.
+type Envelope struct {
+	Name      string          `json:"name"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Version   int             `json:"version"`
+}
+
+// DowngradeFunc represents a func converting a payload into the payload of the previous schema version
+type DowngradeFunc func(payload json.RawMessage) (json.RawMessage, error)
+
+// websocketEventSchema represents the schema versions of a websocket event
+type websocketEventSchema struct {
+	downgrades map[int]DowngradeFunc // Indexed by the version they convert from
+	version    int
+}
+
+// websocketEventSchemas is the registry of websocket event schema versions
+var websocketEventSchemas = struct {
+	m sync.Mutex // Locks s
+	s map[string]*websocketEventSchema
+}{s: make(map[string]*websocketEventSchema)}
+
+// RegisterWebsocketEventSchema registers a schema version of a websocket event as well as the func converting its
+// payload into the payload of the previous version.
+// The current version of an event is the highest version registered. Events that have not been registered are in
+// version 1.
+func RegisterWebsocketEventSchema(eventName string, version int, downgrade DowngradeFunc) {
+	// Lock
+	websocketEventSchemas.m.Lock()
+	defer websocketEventSchemas.m.Unlock()
+
+	// Get schema
+	s, ok := websocketEventSchemas.s[eventName]
+	if !ok {
+		s = &websocketEventSchema{
+			downgrades: make(map[int]DowngradeFunc),
+			version:    1,
+		}
+		websocketEventSchemas.s[eventName] = s
+	}
+
+	// Update schema
+	if downgrade != nil {
+		s.downgrades[version] = downgrade
+	}
+	if version > s.version {
+		s.version = version
+	}
+}
+
+// WebsocketEventVersion returns the current schema version of a websocket event
+func WebsocketEventVersion(eventName string) int {
+	websocketEventSchemas.m.Lock()
+	defer websocketEventSchemas.m.Unlock()
+	if s, ok := websocketEventSchemas.s[eventName]; ok {
+		return s.version
+	}
+	return 1
+}
+
+// WebsocketEventVersions returns the current schema versions of registered websocket events indexed by event name.
+// They're exchanged during the registration so that each end knows which versions the other end understands.
+func WebsocketEventVersions() (o map[string]int) {
+	websocketEventSchemas.m.Lock()
+	defer websocketEventSchemas.m.Unlock()
+	o = make(map[string]int)
+	for n, s := range websocketEventSchemas.s {
+		o[n] = s.version
+	}
+	return
+}
+
+// downgradeWebsocketPayload converts a payload into the payload of an older schema version
+func downgradeWebsocketPayload(eventName string, payload json.RawMessage, from, to int) (json.RawMessage, error) {
+	// Get downgrades
+	websocketEventSchemas.m.Lock()
+	var ds map[int]DowngradeFunc
+	if s, ok := websocketEventSchemas.s[eventName]; ok {
+		ds = s.downgrades
+	}
+	websocketEventSchemas.m.Unlock()
+
+	// Loop through versions
+	for v := from; v > to; v-- {
+		// Get downgrade
+		fn, ok := ds[v]
+		if !ok {
+			return nil, fmt.Errorf("astibrain: no downgrade from version %d of %s", v, eventName)
+		}
+
+		// Downgrade
+		var err error
+		if payload, err = fn(payload); err != nil {
+			return nil, errors.Wrapf(err, "astibrain: downgrading %s from version %d failed", eventName, v)
+		}
+	}
+	return payload, nil
+}
+
+// NewEnvelope wraps a websocket event payload in an envelope.
+// If the peer understands an older version of the event, the payload is downgraded where possible. Otherwise the
+// current version is sent.
+func NewEnvelope(eventName string, payload interface{}, peerVersions map[string]int) (Envelope, error) {
+	return newEnvelope(eventName, payload, peerVersions, time.Now())
+}
+
+// newEnvelope wraps a websocket event payload in an envelope timestamped with now
+func newEnvelope(eventName string, payload interface{}, peerVersions map[string]int, now time.Time) (e Envelope, err error) {
+	// Create envelope
+	e = Envelope{
+		Name:      eventName,
+		Timestamp: now,
+		Version:   WebsocketEventVersion(eventName),
+	}
+
+	// Marshal
+	if payload != nil {
+		if e.Payload, err = json.Marshal(payload); err != nil {
+			err = errors.Wrapf(err, "astibrain: json marshaling %#v failed", payload)
+			return
+		}
+	}
+
+	// Downgrade
+	if v, ok := peerVersions[eventName]; ok && v < e.Version {
+		if p, err := downgradeWebsocketPayload(eventName, e.Payload, e.Version, v); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibrain: downgrading %s to version %d failed, sending version %d", eventName, v, e.Version))
+		} else {
+			e.Payload, e.Version = p, v
+		}
+	}
+	return
+}
+
+// UnwrapWebsocketListener wraps a websocket listener so that it receives the payload of the envelope
+func UnwrapWebsocketListener(fn astiws.ListenerFunc) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Unmarshal envelope
+		var e Envelope
+		if err := json.Unmarshal(payload, &e); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibrain: json unmarshaling %s envelope %s failed", eventName, payload))
+			return nil
+		}
+
+		// Version is newer than the one we know
+		if v := WebsocketEventVersion(eventName); e.Version > v {
+			astilog.Debugf("astibrain: received version %d of %s whereas version %d is the latest known", e.Version, eventName, v)
+		}
+
+		// Execute listener
+		// An empty payload is converted to null so that listeners still get valid JSON
+		p := e.Payload
+		if len(p) == 0 {
+			p = json.RawMessage("null")
+		}
+		return fn(c, eventName, p)
+	}
+}
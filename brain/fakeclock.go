@@ -0,0 +1,172 @@
+package astibrain
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock represents a clock whose time only moves forward when told to, see Advance
+// It allows testing time based features deterministically once injected with WithClock.
+type FakeClock struct {
+	m   sync.Mutex // Locks now and ts
+	now time.Time
+	ts  []*fakeTimer
+}
+
+// fakeTimer represents an event scheduled on a fake clock
+// Events either execute f or send the time to ch. Events with a period are rescheduled each time they're due.
+type fakeTimer struct {
+	at     time.Time
+	c      *FakeClock
+	ch     chan time.Time
+	f      func()
+	period time.Duration
+}
+
+// NewFakeClock creates a new fake clock
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// After implements the Clock interface
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// AfterFunc implements the Clock interface
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.schedule(&fakeTimer{c: c, f: f}, d)
+}
+
+// NewTicker implements the Clock interface
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("astibrain: non-positive interval for NewTicker")
+	}
+	return fakeTicker{t: c.schedule(&fakeTimer{c: c, ch: make(chan time.Time, 1), period: d}, d)}
+}
+
+// NewTimer implements the Clock interface
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.schedule(&fakeTimer{c: c, ch: make(chan time.Time, 1)}, d)
+}
+
+// Now implements the Clock interface
+func (c *FakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// schedule schedules an event
+func (c *FakeClock) schedule(t *fakeTimer, d time.Duration) *fakeTimer {
+	c.m.Lock()
+	defer c.m.Unlock()
+	t.at = c.now.Add(d)
+	c.ts = append(c.ts, t)
+	return t
+}
+
+// Advance moves the time forward and executes the events that are due, in the order they're due.
+// The time is set to the time of each event before it's executed. Funcs are executed synchronously and outside of the
+// lock so that they can use the clock, and events they schedule are executed if they're due as well. Like with the
+// time package, times sent to a channel that is not read are dropped.
+func (c *FakeClock) Advance(d time.Duration) {
+	// Get target time
+	c.m.Lock()
+	to := c.now.Add(d)
+	c.m.Unlock()
+
+	// Loop
+	for {
+		// Lock
+		c.m.Lock()
+
+		// Get next due event
+		idx := -1
+		for i, t := range c.ts {
+			if !t.at.After(to) && (idx < 0 || t.at.Before(c.ts[idx].at)) {
+				idx = i
+			}
+		}
+
+		// No more due event
+		if idx < 0 {
+			c.now = to
+			c.m.Unlock()
+			return
+		}
+
+		// Update time
+		t := c.ts[idx]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		now := c.now
+
+		// Reschedule or remove event
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			c.ts = append(c.ts[:idx], c.ts[idx+1:]...)
+		}
+
+		// Unlock
+		c.m.Unlock()
+
+		// Execute event
+		if t.f != nil {
+			t.f()
+		} else {
+			select {
+			case t.ch <- now:
+			default:
+			}
+		}
+	}
+}
+
+// C implements the Timer interface
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// Reset implements the Timer interface
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	active := t.stop()
+	t.c.schedule(t, d)
+	return active
+}
+
+// Stop implements the Timer interface
+func (t *fakeTimer) Stop() bool {
+	return t.stop()
+}
+
+// stop removes the event from the clock and returns whether it was scheduled
+func (t *fakeTimer) stop() bool {
+	t.c.m.Lock()
+	defer t.c.m.Unlock()
+	for idx, v := range t.c.ts {
+		if v == t {
+			t.c.ts = append(t.c.ts[:idx], t.c.ts[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTicker represents a ticker scheduled on a fake clock
+type fakeTicker struct {
+	t *fakeTimer
+}
+
+// C implements the Ticker interface
+func (t fakeTicker) C() <-chan time.Time {
+	return t.t.ch
+}
+
+// Stop implements the Ticker interface
+func (t fakeTicker) Stop() {
+	t.t.stop()
+}
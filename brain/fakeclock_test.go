@@ -0,0 +1,89 @@
+package astibrain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClockAdvance(t *testing.T) {
+	// Schedule events in a different order than they're due
+	now := time.Unix(100, 0)
+	c := NewFakeClock(now)
+	var ats []time.Duration
+	record := func() { ats = append(ats, c.Now().Sub(now)) }
+	c.AfterFunc(3*time.Second, record)
+	c.AfterFunc(time.Second, func() {
+		record()
+
+		// Events scheduled by funcs are executed if they're due
+		c.AfterFunc(time.Second, record)
+		c.AfterFunc(5*time.Second, record)
+	})
+	stopped := c.AfterFunc(2*time.Second, record)
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	ch := c.After(time.Second)
+
+	// Events are executed in the order they're due, the time being set to the time of each event
+	c.Advance(4 * time.Second)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, ats)
+	assert.Equal(t, now.Add(4*time.Second), c.Now())
+	assert.Equal(t, now.Add(time.Second), <-ch)
+
+	// Remaining events are executed once they're due
+	c.Advance(time.Second)
+	assert.Len(t, ats, 3)
+	c.Advance(time.Second)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 6 * time.Second}, ats)
+
+	// Reset timers are rescheduled from now
+	tm := c.NewTimer(time.Second)
+	assert.True(t, tm.Reset(2*time.Second))
+	c.Advance(time.Second)
+	assert.Len(t, tm.C(), 0)
+	c.Advance(time.Second)
+	assert.Equal(t, now.Add(8*time.Second), <-tm.C())
+	assert.False(t, tm.Reset(time.Second))
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	// Ticker is rescheduled each time it's due
+	now := time.Unix(100, 0)
+	c := NewFakeClock(now)
+	tk := c.NewTicker(time.Second)
+	c.Advance(time.Second)
+	assert.Equal(t, now.Add(time.Second), <-tk.C())
+	c.Advance(1500 * time.Millisecond)
+	assert.Equal(t, now.Add(2*time.Second), <-tk.C())
+	c.Advance(500 * time.Millisecond)
+	assert.Equal(t, now.Add(3*time.Second), <-tk.C())
+
+	// Ticks that are not read are dropped
+	c.Advance(3 * time.Second)
+	assert.Equal(t, now.Add(4*time.Second), <-tk.C())
+	assert.Len(t, tk.C(), 0)
+
+	// Stopped ticker doesn't tick anymore
+	tk.Stop()
+	c.Advance(time.Second)
+	assert.Len(t, tk.C(), 0)
+	assert.Panics(t, func() { c.NewTicker(0) })
+}
+
+func TestBrainClockIsInjected(t *testing.T) {
+	// Plugin abilities use the brain's clock
+	c := NewFakeClock(time.Unix(100, 0))
+	b := New(Configuration{}, WithClock(c))
+	a := NewPluginAbility(PluginConfiguration{Name: "Plugin"})
+	assert.Equal(t, RealClock{}, a.clock)
+	assert.NoError(t, b.Learn(a, AbilityConfiguration{}))
+	assert.Equal(t, c, a.clock)
+
+	// Envelopes are timestamped with the brain's clock
+	b.ws.cfg.Envelope = true
+	e, err := b.ws.encode("test", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(100, 0), e.(Envelope).Timestamp)
+}
@@ -0,0 +1,75 @@
+package astibrain
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// This file holds the harness used to drive the ability lifecycle deterministically: time only moves forward when the
+// fake clock is told to and websocket events are recorded in the order they've been sent instead of being sent to Bob.
+
+// recordedEvent represents an event recorded by the event recorder
+type recordedEvent struct {
+	name    string
+	payload interface{}
+}
+
+// eventRecorder represents an event sender recording events in the order they've been sent
+// Ability state events are only recorded if states is true so that lifecycle sequences can be asserted on their own.
+type eventRecorder struct {
+	es     []recordedEvent
+	m      sync.Mutex // Locks es
+	states bool
+}
+
+// send implements the eventSender interface
+func (r *eventRecorder) send(eventName WebsocketEventName, payload interface{}) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if eventName == WebsocketEventNameAbilityState && !r.states {
+		return
+	}
+	r.es = append(r.es, recordedEvent{name: string(eventName), payload: payload})
+}
+
+// events returns the recorded events
+func (r *eventRecorder) events() []recordedEvent {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]recordedEvent{}, r.es...)
+}
+
+// names returns the names of the recorded events
+func (r *eventRecorder) names() (ns []string) {
+	for _, e := range r.events() {
+		ns = append(ns, e.name)
+	}
+	return
+}
+
+// newAbilityForTest creates an ability whose websocket events are recorded and whose time is driven by a fake clock
+func newAbilityForTest(a Ability, c AbilityConfiguration) (o *ability, r *eventRecorder, fc *FakeClock) {
+	r = &eventRecorder{}
+	fc = NewFakeClock(time.Unix(0, 0))
+	as := newAbilities()
+	o = newAbility(a, as, r, nil, c, withClock(fc))
+	as.set(o)
+	return
+}
+
+// waitForTimers waits for n events to be scheduled on the fake clock
+// Events are scheduled by goroutines, therefore the clock is polled.
+func waitForTimers(t *testing.T, fc *FakeClock, n int) {
+	count := func() int {
+		fc.m.Lock()
+		defer fc.m.Unlock()
+		return len(fc.ts)
+	}
+	for deadline := time.Now().Add(time.Second); count() < n && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if c := count(); c < n {
+		t.Fatalf("expected %d scheduled events, got %d", n, c)
+	}
+}
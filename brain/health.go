@@ -0,0 +1,111 @@
+package astibrain
+
+import (
+	"context"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// HealthCheckable represents an object that can check its own health.
+type HealthCheckable interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// AbilityHealth represents the result of the last health check of an ability
+type AbilityHealth struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+	IsHealthy bool      `json:"is_healthy"`
+}
+
+// APIAbilityUnhealthy is an ability unhealthy API payload
+type APIAbilityUnhealthy struct {
+	Error string `json:"error"`
+	Name  string `json:"name"`
+}
+
+// checkHealth checks the ability health periodically until the context is done
+func (a *ability) checkHealth(ctx context.Context, v HealthCheckable) {
+	// Create ticker
+	t := a.clock.NewTicker(a.c.HealthCheckInterval)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			// Probe
+			err := a.probeHealth(ctx, v)
+
+			// Context has been cancelled while probing
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Store result
+			h := AbilityHealth{
+				CheckedAt: a.clock.Now(),
+				IsHealthy: err == nil,
+			}
+			if err != nil {
+				h.Error = err.Error()
+			}
+			a.m.Lock()
+			a.health = h
+			a.m.Unlock()
+
+			// Ability is healthy
+			if err == nil {
+				continue
+			}
+
+			// Log
+			astilog.Error(errors.Wrapf(err, "astibrain: %s is unhealthy", a.name))
+
+			// Dispatch websocket event
+			a.ws.send(WebsocketEventNameAbilityUnhealthy, APIAbilityUnhealthy{
+				Error: err.Error(),
+				Name:  a.name,
+			})
+
+			// Crash
+			if a.c.CrashOnUnhealthy {
+				a.crash(errors.Wrap(err, "astibrain: health check failed"))
+				return
+			}
+		}
+	}
+}
+
+// probeHealth executes the health check with a timeout.
+// The health check is executed in a goroutine so that a hung health check doesn't block the caller.
+func (a *ability) probeHealth(ctx context.Context, v HealthCheckable) (err error) {
+	// Create context
+	ctx, cancel := context.WithTimeout(ctx, a.c.HealthCheckTimeout)
+	defer cancel()
+
+	// Check health
+	var chanDone = make(chan error, 1)
+	go func() {
+		chanDone <- v.HealthCheck(ctx)
+	}()
+
+	// Wait for either the health check or the context to be done
+	select {
+	case err = <-chanDone:
+	case <-ctx.Done():
+		err = errors.Wrapf(ctx.Err(), "astibrain: health check of %s timed out", a.name)
+	}
+	return
+}
+
+// lastHealth returns the result of the last health check
+func (a *ability) lastHealth() AbilityHealth {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.health
+}
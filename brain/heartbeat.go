@@ -0,0 +1,45 @@
+package astibrain
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// APIBrainHeartbeat is a brain heartbeat API payload
+// Abilities is the number of abilities indexed by state.
+type APIBrainHeartbeat struct {
+	Abilities  map[AbilityState]int `json:"abilities"`
+	Goroutines int                  `json:"goroutines"`
+	Uptime     time.Duration        `json:"uptime"`
+}
+
+// heartbeat dispatches a heartbeat event periodically until the context is done
+func (b *Brain) heartbeat(ctx context.Context, startedAt time.Time) {
+	// Create ticker
+	t := b.clock.NewTicker(b.c.HeartbeatInterval)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			b.ws.send(WebsocketEventNameBrainHeartbeat, b.newAPIBrainHeartbeat(startedAt))
+		}
+	}
+}
+
+// newAPIBrainHeartbeat creates a new brain heartbeat API payload
+func (b *Brain) newAPIBrainHeartbeat(startedAt time.Time) (p APIBrainHeartbeat) {
+	p = APIBrainHeartbeat{
+		Abilities:  make(map[AbilityState]int),
+		Goroutines: runtime.NumGoroutine(),
+		Uptime:     b.clock.Now().Sub(startedAt),
+	}
+	for _, a := range b.abilities.list() {
+		p.Abilities[a.state()]++
+	}
+	return
+}
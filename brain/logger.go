@@ -0,0 +1,90 @@
+package astibrain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/asticode/go-astilog"
+)
+
+// Logger represents a logger
+type Logger interface {
+	Debug(v ...interface{})
+	Debugf(format string, v ...interface{})
+	Error(v ...interface{})
+	Errorf(format string, v ...interface{})
+	Info(v ...interface{})
+	Infof(format string, v ...interface{})
+}
+
+// LoggerSetter represents an object that can receive the logger scoped to its current run.
+// A new logger is set each time the ability is switched on.
+type LoggerSetter interface {
+	SetLogger(Logger)
+}
+
+// contextKeyLogger is the context key of the logger
+type contextKeyLogger struct{}
+
+// LoggerFromContext returns the logger carried by the context.
+// Runnable abilities receive a context carrying a logger scoped to their current run. If the context doesn't carry
+// any logger, the global logger is returned.
+func LoggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(contextKeyLogger{}).(Logger); ok {
+		return l
+	}
+	return globalLogger
+}
+
+// contextWithLogger returns a context carrying the logger
+func contextWithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKeyLogger{}, l)
+}
+
+// globalLogger is the logger writing to the global logger without any tag
+var globalLogger = newScopedLogger("")
+
+// scopedLogger represents a logger that tags log lines before writing them to the global logger
+type scopedLogger struct {
+	prefix string
+}
+
+// newScopedLogger creates a new scoped logger
+func newScopedLogger(prefix string) *scopedLogger {
+	return &scopedLogger{prefix: prefix}
+}
+
+// newAbilityLogger creates a logger tagging log lines with the ability name and the run id
+func newAbilityLogger(abilityName, runID string) *scopedLogger {
+	return newScopedLogger(fmt.Sprintf("[ability=%s run=%s] ", abilityName, runID))
+}
+
+// Debug implements the Logger interface
+func (l *scopedLogger) Debug(v ...interface{}) {
+	astilog.Debug(l.prefix + fmt.Sprint(v...))
+}
+
+// Debugf implements the Logger interface
+func (l *scopedLogger) Debugf(format string, v ...interface{}) {
+	astilog.Debugf(l.prefix+format, v...)
+}
+
+// Error implements the Logger interface
+func (l *scopedLogger) Error(v ...interface{}) {
+	astilog.Error(l.prefix + fmt.Sprint(v...))
+}
+
+// Errorf implements the Logger interface
+func (l *scopedLogger) Errorf(format string, v ...interface{}) {
+	astilog.Errorf(l.prefix+format, v...)
+}
+
+// Info implements the Logger interface
+func (l *scopedLogger) Info(v ...interface{}) {
+	astilog.Info(l.prefix + fmt.Sprint(v...))
+}
+
+// Infof implements the Logger interface
+func (l *scopedLogger) Infof(format string, v ...interface{}) {
+	astilog.Infof(l.prefix+format, v...)
+}
@@ -0,0 +1,243 @@
+package astibrain
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// This file holds the in-memory transport used to test interactions between abilities without binding sockets: events
+// are sent with the same names and JSON payloads as on the websocket but are delivered to listeners of the same process.
+
+// loopback represents an event sender delivering events to in-memory listeners.
+// Events are delivered one at a time, in the order they've been sent.
+type loopback struct {
+	closed    bool
+	cond      *sync.Cond // Broadcast whenever closed, inFlight or q change
+	drop      func(eventName string) bool
+	inFlight  bool
+	latency   time.Duration
+	listeners map[string][]astiws.ListenerFunc
+	m         sync.Mutex // Locks closed, inFlight, listeners and q
+	q         []loopbackMessage
+}
+
+// loopbackMessage represents a message waiting to be delivered
+type loopbackMessage struct {
+	eventName string
+	payload   json.RawMessage
+}
+
+// loopbackOption represents a loopback option
+type loopbackOption func(l *loopback)
+
+// withLoopbackLatency delays the delivery of each event
+func withLoopbackLatency(d time.Duration) loopbackOption {
+	return func(l *loopback) {
+		l.latency = d
+	}
+}
+
+// withLoopbackDrop drops events for which the func returns true
+func withLoopbackDrop(fn func(eventName string) bool) loopbackOption {
+	return func(l *loopback) {
+		l.drop = fn
+	}
+}
+
+// newLoopback creates a new loopback and starts delivering events
+func newLoopback(opts ...loopbackOption) (l *loopback) {
+	// Create
+	l = &loopback{listeners: make(map[string][]astiws.ListenerFunc)}
+	l.cond = sync.NewCond(&l.m)
+
+	// Apply options
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	// Deliver in a goroutine
+	go l.deliver()
+	return
+}
+
+// close stops delivering events.
+// Events that have not been delivered yet are discarded.
+func (l *loopback) close() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.closed = true
+	l.q = nil
+	l.cond.Broadcast()
+}
+
+// addListener adds a listener
+func (l *loopback) addListener(eventName WebsocketEventName, fn astiws.ListenerFunc) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.listeners[string(eventName)] = append(l.listeners[string(eventName)], fn)
+}
+
+// send implements the eventSender interface
+func (l *loopback) send(eventName WebsocketEventName, payload interface{}) {
+	// Drop
+	if l.drop != nil && l.drop(string(eventName)) {
+		astilog.Debugf("astibrain: loopback is dropping %s event", eventName)
+		return
+	}
+
+	// Marshal
+	// Payloads are marshaled right away, as on the websocket, so that listeners can't share memory with the sender
+	b, err := json.Marshal(payload)
+	if err != nil {
+		astilog.Error(errors.Wrapf(err, "astibrain: json marshaling %s payload %#v failed", eventName, payload))
+		return
+	}
+
+	// Enqueue
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.closed {
+		return
+	}
+	l.q = append(l.q, loopbackMessage{eventName: string(eventName), payload: b})
+	l.cond.Broadcast()
+}
+
+// wait blocks until all events sent so far, and the ones their listeners have sent, have been delivered
+func (l *loopback) wait() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for !l.closed && (len(l.q) > 0 || l.inFlight) {
+		l.cond.Wait()
+	}
+}
+
+// deliver delivers events until the loopback is closed
+func (l *loopback) deliver() {
+	for {
+		// Wait for a message
+		l.m.Lock()
+		for !l.closed && len(l.q) == 0 {
+			l.cond.Wait()
+		}
+
+		// Loopback is closed
+		if l.closed {
+			l.m.Unlock()
+			return
+		}
+
+		// Pop message
+		m := l.q[0]
+		l.q = l.q[1:]
+		l.inFlight = true
+		fns := append([]astiws.ListenerFunc{}, l.listeners[m.eventName]...)
+		l.m.Unlock()
+
+		// Simulate latency
+		if l.latency > 0 {
+			time.Sleep(l.latency)
+		}
+
+		// Execute listeners
+		for _, fn := range fns {
+			if err := fn(nil, m.eventName, m.payload); err != nil {
+				astilog.Error(errors.Wrapf(err, "astibrain: executing %s listener failed", m.eventName))
+			}
+		}
+
+		// Update in flight attribute
+		l.m.Lock()
+		l.inFlight = false
+		l.cond.Broadcast()
+		l.m.Unlock()
+	}
+}
+
+// newAbilitiesForTest creates abilities exchanging events through the loopback the same way they would through Bob.
+// Ability events are sent as "ability.<ability name>.<event name>", custom websocket listeners are added with the
+// same names and abilities can be toggled by sending the ability toggle events.
+func newAbilitiesForTest(l *loopback, as ...Ability) (o *abilities) {
+	// Create abilities
+	o = newAbilities()
+	for _, a := range as {
+		// Add ability
+		o.set(newAbility(a, o, l, nil, AbilityConfiguration{}))
+
+		// Set dispatch func
+		if v, ok := a.(Dispatcher); ok {
+			abilityName := a.Name()
+			v.SetDispatchFunc(func(e Event) {
+				n := WebsocketAbilityEventName(abilityName, e.Name)
+				if IsReservedWebsocketEventName(n) {
+					astilog.Errorf("astibrain: ability %s can't dispatch reserved event %s", abilityName, n)
+					return
+				}
+				l.send(n, e.Payload)
+			})
+		}
+
+		// Add custom websocket listeners
+		if v, ok := a.(WebsocketListener); ok {
+			for n, fn := range v.WebsocketListeners() {
+				l.addListener(WebsocketAbilityEventName(a.Name(), n), fn)
+			}
+		}
+	}
+
+	// Add toggle listeners
+	for _, n := range []WebsocketEventName{
+		WebsocketEventNameAbilityPause,
+		WebsocketEventNameAbilityResume,
+		WebsocketEventNameAbilityStart,
+		WebsocketEventNameAbilityStop,
+	} {
+		l.addListener(n, func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			toggleAbility(o, eventName, payload)
+			return nil
+		})
+	}
+	return
+}
+
+func TestLoopback(t *testing.T) {
+	// Ability events are dropped
+	l := newLoopback(withLoopbackDrop(func(eventName string) bool { return eventName == string(WebsocketEventNameAbilityStopped) }))
+	defer l.close()
+	as := newAbilitiesForTest(l, newTestAbility())
+	var ns []string
+	for _, n := range []WebsocketEventName{WebsocketEventNameAbilityStarted, WebsocketEventNameAbilityStopped} {
+		l.addListener(n, func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			var name string
+			if err := json.Unmarshal(payload, &name); err != nil {
+				return err
+			}
+			ns = append(ns, eventName+":"+name)
+			return nil
+		})
+	}
+	a, _ := as.ability("Test")
+
+	// Toggle events sent through the loopback switch the ability on and off
+	l.send(WebsocketEventNameAbilityStart, "Test")
+	for deadline := time.Now().Add(time.Second); !a.isOn() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, a.isOn())
+	l.send(WebsocketEventNameAbilityStop, "Test")
+	for deadline := time.Now().Add(time.Second); a.isOn() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, a.isOn())
+
+	// Events sent by the ability are delivered unless they're dropped
+	l.wait()
+	assert.Equal(t, []string{string(WebsocketEventNameAbilityStarted) + ":Test"}, ns)
+}
@@ -0,0 +1,213 @@
+package astibrain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Metrics event names
+const (
+	metricsEventCrashed  = "crashed"
+	metricsEventStarted  = "started"
+	metricsEventStopped  = "stopped"
+	metricsEventTimedOut = "timed_out"
+)
+
+// ObserveFunc represents a func capable of observing the duration of an ability operation
+type ObserveFunc func(operation string, d time.Duration)
+
+// Observer represents an object that can observe the duration of its operations
+type Observer interface {
+	SetObserveFunc(ObserveFunc)
+}
+
+// GaugeFunc represents a func capable of setting the current value of an ability gauge such as a number of in-flight
+// operations
+type GaugeFunc func(gauge string, v float64)
+
+// Gauger represents an object that can report the current value of its gauges
+type Gauger interface {
+	SetGaugeFunc(GaugeFunc)
+}
+
+// MetricsConfiguration represents a metrics configuration
+// If ListenAddr is empty, metrics are disabled.
+type MetricsConfiguration struct {
+	ListenAddr string `toml:"listen_addr"`
+}
+
+// metricsKey represents a metrics key
+type metricsKey struct {
+	ability string
+	label   string
+}
+
+// metricsDuration represents a duration summary
+type metricsDuration struct {
+	count int
+	sum   time.Duration
+}
+
+// metrics represents ability metrics.
+// A nil *metrics is valid and doesn't collect anything.
+type metrics struct {
+	c         MetricsConfiguration
+	durations map[metricsKey]*metricsDuration
+	events    map[metricsKey]int
+	gauges    map[metricsKey]float64
+	m         sync.Mutex // Locks durations, events and gauges
+}
+
+// newMetrics creates new metrics.
+// It returns nil if metrics are disabled.
+func newMetrics(c MetricsConfiguration) *metrics {
+	if len(c.ListenAddr) == 0 {
+		return nil
+	}
+	return &metrics{
+		c:         c,
+		durations: make(map[metricsKey]*metricsDuration),
+		events:    make(map[metricsKey]int),
+		gauges:    make(map[metricsKey]float64),
+	}
+}
+
+// incEvent increments the event counter of an ability
+func (m *metrics) incEvent(abilityName, event string) {
+	if m == nil {
+		return
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.events[metricsKey{ability: abilityName, label: event}]++
+}
+
+// observe observes the duration of an ability operation
+func (m *metrics) observe(abilityName, operation string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	k := metricsKey{ability: abilityName, label: operation}
+	if _, ok := m.durations[k]; !ok {
+		m.durations[k] = &metricsDuration{}
+	}
+	m.durations[k].count++
+	m.durations[k].sum += d
+}
+
+// setGauge sets the current value of an ability gauge
+func (m *metrics) setGauge(abilityName, gauge string, v float64) {
+	if m == nil {
+		return
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.gauges[metricsKey{ability: abilityName, label: gauge}] = v
+}
+
+// serve serves the metrics until the context is done
+func (m *metrics) serve(ctx context.Context) {
+	// Create server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.handleMetrics)
+	s := &http.Server{Addr: m.c.ListenAddr, Handler: mux}
+
+	// Shutdown server once context is done
+	go func() {
+		<-ctx.Done()
+		if err := s.Shutdown(context.Background()); err != nil {
+			astilog.Error(errors.Wrap(err, "astibrain: shutting down metrics server failed"))
+		}
+	}()
+
+	// Serve
+	astilog.Debugf("astibrain: serving metrics on %s", m.c.ListenAddr)
+	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		astilog.Error(errors.Wrapf(err, "astibrain: serving metrics on %s failed", m.c.ListenAddr))
+	}
+}
+
+// handleMetrics writes the metrics in the Prometheus text format
+func (m *metrics) handleMetrics(rw http.ResponseWriter, r *http.Request) {
+	// Lock
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	// Write events
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(rw, "# HELP astibrain_ability_events_total Number of ability events.")
+	fmt.Fprintln(rw, "# TYPE astibrain_ability_events_total counter")
+	for _, k := range sortedMetricsKeys(m.events) {
+		fmt.Fprintf(rw, "astibrain_ability_events_total{ability=\"%s\",event=\"%s\"} %d\n", escapeMetricsLabel(k.ability), escapeMetricsLabel(k.label), m.events[k])
+	}
+
+	// Write durations
+	fmt.Fprintln(rw, "# HELP astibrain_ability_operation_duration_seconds Duration of ability operations.")
+	fmt.Fprintln(rw, "# TYPE astibrain_ability_operation_duration_seconds summary")
+	ks := make([]metricsKey, 0, len(m.durations))
+	for k := range m.durations {
+		ks = append(ks, k)
+	}
+	sortMetricsKeys(ks)
+	for _, k := range ks {
+		writeMetricsDuration(rw, k, m.durations[k])
+	}
+
+	// Write gauges
+	fmt.Fprintln(rw, "# HELP astibrain_ability_gauge Current value of ability gauges.")
+	fmt.Fprintln(rw, "# TYPE astibrain_ability_gauge gauge")
+	ks = make([]metricsKey, 0, len(m.gauges))
+	for k := range m.gauges {
+		ks = append(ks, k)
+	}
+	sortMetricsKeys(ks)
+	for _, k := range ks {
+		fmt.Fprintf(rw, "astibrain_ability_gauge{ability=\"%s\",gauge=\"%s\"} %g\n", escapeMetricsLabel(k.ability), escapeMetricsLabel(k.label), m.gauges[k])
+	}
+}
+
+// writeMetricsDuration writes a duration summary
+func writeMetricsDuration(w io.Writer, k metricsKey, d *metricsDuration) {
+	l := fmt.Sprintf("ability=\"%s\",operation=\"%s\"", escapeMetricsLabel(k.ability), escapeMetricsLabel(k.label))
+	fmt.Fprintf(w, "astibrain_ability_operation_duration_seconds_sum{%s} %g\n", l, d.sum.Seconds())
+	fmt.Fprintf(w, "astibrain_ability_operation_duration_seconds_count{%s} %d\n", l, d.count)
+}
+
+// sortedMetricsKeys returns the sorted keys of a counter
+func sortedMetricsKeys(m map[metricsKey]int) (ks []metricsKey) {
+	ks = make([]metricsKey, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sortMetricsKeys(ks)
+	return
+}
+
+// sortMetricsKeys sorts metrics keys so that the output is stable
+func sortMetricsKeys(ks []metricsKey) {
+	sort.Slice(ks, func(i, j int) bool {
+		if ks[i].ability != ks[j].ability {
+			return ks[i].ability < ks[j].ability
+		}
+		return ks[i].label < ks[j].label
+	})
+}
+
+// metricsLabelReplacer escapes label values
+var metricsLabelReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// escapeMetricsLabel escapes a label value
+func escapeMetricsLabel(v string) string {
+	return metricsLabelReplacer.Replace(v)
+}
@@ -0,0 +1,392 @@
+package astibrain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+)
+
+// Producer represents an object that can send values to other abilities of the same brain through typed channels
+// OutputPorts is called once when the ability is learned and returns receive channels (e.g. <-chan T or chan T)
+// indexed by port name. The brain reads them for as long as the ability is learned: values are forwarded to the inputs
+// linked to the port or, if no input of the brain is linked to it, dispatched to Bob as an "<port>" ability event.
+// Ports are not buffered by the brain which means producers should send values without blocking.
+type Producer interface {
+	OutputPorts() map[string]interface{}
+}
+
+// Consumer represents an object that can receive values from other abilities through typed channels
+// InputPorts is called once when the ability is learned and returns send channels (e.g. chan<- T or chan T) indexed by
+// port name. Ports are linked to outputs through AbilityConfiguration.Inputs. Values are sent without blocking and are
+// dropped if the channel is not ready which means consumers should buffer their inputs.
+type Consumer interface {
+	InputPorts() map[string]interface{}
+}
+
+// pipelinePort represents a port of an ability, the ability name being in its canonical form
+type pipelinePort struct {
+	ability string
+	port    string
+}
+
+// String implements the fmt.Stringer interface
+func (p pipelinePort) String() string {
+	return p.ability + "." + p.port
+}
+
+// parsePipelinePort parses a port formatted as "<ability>.<port>" and returns the ability name as it's been provided
+func parsePipelinePort(s string) (p pipelinePort, abilityName string, err error) {
+	i := strings.LastIndex(s, ".")
+	if i <= 0 || i == len(s)-1 {
+		err = fmt.Errorf("astibrain: port %s is not formatted as <ability>.<port>", s)
+		return
+	}
+	abilityName = strings.TrimSpace(s[:i])
+	p = pipelinePort{ability: NormalizeAbilityName(abilityName), port: strings.TrimSpace(s[i+1:])}
+	return
+}
+
+// pipelineProducer represents a producer known by the pipeline
+type pipelineProducer struct {
+	cancel  context.CancelFunc
+	name    string
+	outputs map[string]reflect.Value
+}
+
+// pipelineConsumer represents a consumer known by the pipeline
+type pipelineConsumer struct {
+	inputs map[string]reflect.Value
+	links  map[string]pipelinePort // Sources indexed by input port
+	name   string
+	names  map[string]string // Source ability names, as they've been provided, indexed by input port
+}
+
+// pipelineRelay represents a source received over the websocket
+type pipelineRelay struct {
+	handler      websocketHandlerID
+	n            int // Number of links listening to the source
+	subscription APIRelay
+}
+
+// pipeline wires the outputs of producers to the inputs of consumers learned by the same brain
+// Links whose source is not learned by the brain fall back to the websocket: the brain subscribes to the source, Bob
+// relays the ability event dispatched by the brain that has learned it and the event is decoded into the input's type.
+type pipeline struct {
+	consumers map[string]*pipelineConsumer
+	dispatch  func(e Event)
+	m         sync.Mutex // Locks consumers, producers and relays
+	producers map[string]*pipelineProducer
+	relays    map[pipelinePort]*pipelineRelay
+	root      context.Context
+	ws        *websocket
+}
+
+// newPipeline creates a new pipeline
+func newPipeline(root context.Context, ws *websocket, dispatch func(e Event)) *pipeline {
+	return &pipeline{
+		consumers: make(map[string]*pipelineConsumer),
+		dispatch:  dispatch,
+		producers: make(map[string]*pipelineProducer),
+		relays:    make(map[pipelinePort]*pipelineRelay),
+		root:      root,
+		ws:        ws,
+	}
+}
+
+// pipelinePorts retrieves the channels of a port map and checks their direction
+func pipelinePorts(ports map[string]interface{}, dir reflect.ChanDir) (vs map[string]reflect.Value, err error) {
+	vs = make(map[string]reflect.Value)
+	for n, c := range ports {
+		v := reflect.ValueOf(c)
+		if v.Kind() != reflect.Chan || v.IsNil() || v.Type().ChanDir()&dir == 0 {
+			err = fmt.Errorf("astibrain: port %s is a %T which is not a valid channel", n, c)
+			return
+		}
+		vs[n] = v
+	}
+	return
+}
+
+// checkPipelineLink checks that an output can feed an input
+func checkPipelineLink(src pipelinePort, o reflect.Value, dst pipelinePort, i reflect.Value) error {
+	if ot, it := o.Type().Elem(), i.Type().Elem(); !ot.AssignableTo(it) {
+		return fmt.Errorf("astibrain: output %s of type %s can't feed input %s of type %s", src, ot, dst, it)
+	}
+	return nil
+}
+
+// add validates the ports and links of an ability and wires them
+// Nothing is wired if an error is returned.
+func (p *pipeline) add(name string, a Ability, inputs map[string]string) (err error) {
+	// Lock
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// Get outputs
+	key := NormalizeAbilityName(name)
+	var pr *pipelineProducer
+	if v, ok := a.(Producer); ok {
+		pr = &pipelineProducer{name: name}
+		if pr.outputs, err = pipelinePorts(v.OutputPorts(), reflect.RecvDir); err != nil {
+			err = errors.Wrapf(err, "astibrain: getting output ports of %s failed", name)
+			return
+		}
+	}
+
+	// Get inputs
+	var co *pipelineConsumer
+	if v, ok := a.(Consumer); ok {
+		co = &pipelineConsumer{links: make(map[string]pipelinePort), name: name, names: make(map[string]string)}
+		if co.inputs, err = pipelinePorts(v.InputPorts(), reflect.SendDir); err != nil {
+			err = errors.Wrapf(err, "astibrain: getting input ports of %s failed", name)
+			return
+		}
+	}
+
+	// Check links declared by the ability
+	for in, s := range inputs {
+		// Get input
+		dst := pipelinePort{ability: key, port: in}
+		var i reflect.Value
+		if co != nil {
+			i = co.inputs[in]
+		}
+		if !i.IsValid() {
+			err = fmt.Errorf("astibrain: input %s doesn't exist", dst)
+			return
+		}
+
+		// Parse source
+		var src pipelinePort
+		var srcName string
+		if src, srcName, err = parsePipelinePort(s); err != nil {
+			err = errors.Wrapf(err, "astibrain: parsing source of input %s failed", dst)
+			return
+		}
+
+		// Source is the ability itself
+		var sp *pipelineProducer
+		if src.ability == key {
+			sp = pr
+		} else {
+			sp = p.producers[src.ability]
+		}
+
+		// Check source is compatible
+		// Sources that are not learned by the brain are checked once they're learned
+		if sp != nil {
+			o, ok := sp.outputs[src.port]
+			if !ok {
+				err = fmt.Errorf("astibrain: output %s linked to input %s doesn't exist", src, dst)
+				return
+			}
+			if err = checkPipelineLink(src, o, dst, i); err != nil {
+				return
+			}
+		}
+		co.links[in] = src
+		co.names[in] = srcName
+	}
+
+	// Check links declared by other abilities to the ability's outputs
+	for _, c := range p.consumers {
+		for in, src := range c.links {
+			// Link is not to the ability
+			if src.ability != key {
+				continue
+			}
+
+			// Check source is compatible
+			dst := pipelinePort{ability: NormalizeAbilityName(c.name), port: in}
+			var o reflect.Value
+			if pr != nil {
+				o = pr.outputs[src.port]
+			}
+			if !o.IsValid() {
+				err = fmt.Errorf("astibrain: output %s linked to input %s doesn't exist", src, dst)
+				return
+			}
+			if err = checkPipelineLink(src, o, dst, c.inputs[in]); err != nil {
+				return
+			}
+		}
+	}
+
+	// Add consumer
+	if co != nil {
+		p.consumers[key] = co
+		for in, src := range co.links {
+			p.addRelayUnsafe(src, co.names[in])
+		}
+	}
+
+	// Add producer
+	if pr != nil {
+		var ctx context.Context
+		ctx, pr.cancel = context.WithCancel(p.root)
+		p.producers[key] = pr
+		for n, o := range pr.outputs {
+			go p.read(ctx, pipelinePort{ability: key, port: n}, pr.name, o)
+		}
+	}
+	return
+}
+
+// del unwires an ability
+func (p *pipeline) del(name string) {
+	// Lock
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// Delete producer
+	key := NormalizeAbilityName(name)
+	if pr, ok := p.producers[key]; ok {
+		pr.cancel()
+		delete(p.producers, key)
+	}
+
+	// Delete consumer
+	if co, ok := p.consumers[key]; ok {
+		for _, src := range co.links {
+			p.delRelayUnsafe(src)
+		}
+		delete(p.consumers, key)
+	}
+}
+
+// addRelayUnsafe makes sure values dispatched to Bob by a source are received by its links
+// Assumption is made that m is locked
+func (p *pipeline) addRelayUnsafe(src pipelinePort, abilityName string) {
+	// Source is already received
+	if r, ok := p.relays[src]; ok {
+		r.n++
+		return
+	}
+
+	// Add handler
+	eventName := WebsocketAbilityEventName(abilityName, src.port)
+	h := p.ws.addHandler(eventName, func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		p.forward(src, func(t reflect.Type) (reflect.Value, error) { return decodePipelineValue(payload, t) })
+		return nil
+	})
+	r := &pipelineRelay{handler: h, n: 1, subscription: APIRelay{Ability: abilityName, Port: src.port}}
+	p.relays[src] = r
+
+	// Subscribe
+	p.ws.subscribeRelay(r.subscription)
+}
+
+// delRelayUnsafe stops receiving a source once no link needs it anymore
+// Assumption is made that m is locked
+func (p *pipeline) delRelayUnsafe(src pipelinePort) {
+	// Source is still needed
+	r, ok := p.relays[src]
+	if !ok {
+		return
+	} else if r.n--; r.n > 0 {
+		return
+	}
+
+	// Remove handler
+	delete(p.relays, src)
+	p.ws.delHandler(r.handler)
+
+	// Unsubscribe
+	p.ws.unsubscribeRelay(r.subscription)
+}
+
+// decodePipelineValue decodes a value received over the websocket into the type of an input
+func decodePipelineValue(payload json.RawMessage, t reflect.Type) (v reflect.Value, err error) {
+	v = reflect.New(t)
+	if err = json.Unmarshal(payload, v.Interface()); err != nil {
+		err = errors.Wrapf(err, "astibrain: json unmarshaling %s into %s failed", payload, t)
+		return
+	}
+	v = v.Elem()
+	return
+}
+
+// outputNames returns the sorted names of the output ports of an ability
+func (p *pipeline) outputNames(name string) (ns []string) {
+	// Lock
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// Loop through outputs
+	pr, ok := p.producers[NormalizeAbilityName(name)]
+	if !ok {
+		return
+	}
+	for n := range pr.outputs {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return
+}
+
+// read reads an output until the context is done
+func (p *pipeline) read(ctx context.Context, src pipelinePort, name string, o reflect.Value) {
+	cs := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: o},
+	}
+	for {
+		// Receive
+		idx, v, ok := reflect.Select(cs)
+		if idx == 0 {
+			return
+		} else if !ok {
+			astilog.Debugf("astibrain: output %s has been closed", src)
+			return
+		}
+
+		// Forward
+		if n := p.forward(src, func(reflect.Type) (reflect.Value, error) { return v, nil }); n > 0 {
+			continue
+		}
+
+		// No input is linked to the output
+		p.dispatch(Event{AbilityName: name, Name: src.port, Payload: v.Interface()})
+	}
+}
+
+// forward sends a value to the inputs linked to a source and returns the number of linked inputs
+// fn returns the value to send to an input of a specific type.
+func (p *pipeline) forward(src pipelinePort, fn func(t reflect.Type) (reflect.Value, error)) (n int) {
+	// Lock
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// Loop through consumers
+	for _, c := range p.consumers {
+		for in, s := range c.links {
+			// Input is not linked to the source
+			if s != src {
+				continue
+			}
+			n++
+
+			// Get value
+			i := c.inputs[in]
+			v, err := fn(i.Type().Elem())
+			if err != nil {
+				astilog.Error(errors.Wrapf(err, "astibrain: getting value of input %s.%s failed", c.name, in))
+				continue
+			}
+
+			// Send
+			if !i.TrySend(v) {
+				astilog.Errorf("astibrain: input %s.%s is not ready, value from %s has been dropped", c.name, in, src)
+			}
+		}
+	}
+	return
+}
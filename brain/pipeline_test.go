@@ -0,0 +1,162 @@
+package astibrain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// portsAbility represents a test ability with custom ports
+type portsAbility struct {
+	*namedAbility
+	inputs  map[string]interface{}
+	outputs map[string]interface{}
+}
+
+func (a *portsAbility) InputPorts() map[string]interface{} { return a.inputs }
+
+func (a *portsAbility) OutputPorts() map[string]interface{} { return a.outputs }
+
+func newProducerForTest(name, port string, ch interface{}) *portsAbility {
+	return &portsAbility{namedAbility: newNamedAbility(name), outputs: map[string]interface{}{port: ch}}
+}
+
+func newConsumerForTest(name, port string, ch interface{}) *portsAbility {
+	return &portsAbility{namedAbility: newNamedAbility(name), inputs: map[string]interface{}{port: ch}}
+}
+
+// queuedMessages returns the messages waiting to be sent to Bob
+func queuedMessages(ws *websocket) []websocketMessage {
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	return append([]websocketMessage{}, ws.q...)
+}
+
+// waitForQueuedMessage waits for a message to be queued
+func waitForQueuedMessage(t *testing.T, ws *websocket, eventName WebsocketEventName, payload interface{}) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, m := range queuedMessages(ws) {
+			if m.eventName == eventName && assert.ObjectsAreEqual(payload, m.payload) {
+				return
+			}
+		}
+	}
+	t.Fatalf("no %s message with payload %#v has been queued", eventName, payload)
+}
+
+// receiveForTest receives a value from a channel
+func receiveForTest(t *testing.T, ch chan string) string {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("no value has been received")
+		return ""
+	}
+}
+
+func TestPipelineValidation(t *testing.T) {
+	b := New(Configuration{})
+	assert.NoError(t, b.Learn(newProducerForTest("Producer", "text", make(chan string)), AbilityConfiguration{}))
+	for _, v := range []struct {
+		a      Ability
+		inputs map[string]string
+		name   string
+	}{
+		{a: newConsumerForTest("Consumer", "text", make(chan string)), inputs: map[string]string{"text": "producer"}, name: "invalid source"},
+		{a: newConsumerForTest("Consumer", "text", make(chan string)), inputs: map[string]string{"unknown": "producer.text"}, name: "unknown input"},
+		{a: newConsumerForTest("Consumer", "text", make(chan string)), inputs: map[string]string{"text": "producer.unknown"}, name: "unknown output"},
+		{a: newConsumerForTest("Consumer", "text", make(chan int)), inputs: map[string]string{"text": "producer.text"}, name: "type mismatch"},
+		{a: newConsumerForTest("Consumer", "text", "text"), name: "not a channel"},
+		{a: newConsumerForTest("Consumer", "text", make(<-chan string)), name: "receive only input"},
+		{a: newProducerForTest("Consumer", "text", make(chan<- string)), name: "send only output"},
+		{a: newConsumerForTest("Consumer", "text", (chan string)(nil)), name: "nil channel"},
+	} {
+		assert.Error(t, b.Learn(v.a, AbilityConfiguration{Inputs: v.inputs}), v.name)
+		_, ok := b.AbilityStatus("Consumer")
+		assert.False(t, ok, v.name)
+	}
+
+	// Values are assignable to the input type
+	assert.NoError(t, b.Learn(newConsumerForTest("Consumer", "text", make(chan interface{}, 1)), AbilityConfiguration{Inputs: map[string]string{"text": "producer.text"}}))
+
+	// Sources learned after their consumers are checked as well
+	assert.NoError(t, b.Learn(newConsumerForTest("Late", "n", make(chan int)), AbilityConfiguration{Inputs: map[string]string{"n": "source.n"}}))
+	assert.Error(t, b.Learn(newProducerForTest("Source", "n", make(chan string)), AbilityConfiguration{}))
+	assert.Error(t, b.Learn(newProducerForTest("Source", "other", make(chan int)), AbilityConfiguration{}))
+	assert.NoError(t, b.Learn(newProducerForTest("Source", "n", make(chan int)), AbilityConfiguration{}))
+}
+
+func TestPipelineForward(t *testing.T) {
+	// Learn abilities
+	b := New(Configuration{})
+	out, in := make(chan string), make(chan string, 1)
+	assert.NoError(t, b.Learn(newProducerForTest("Producer", "text", out), AbilityConfiguration{}))
+	assert.NoError(t, b.Learn(newConsumerForTest("Consumer", "text", in), AbilityConfiguration{Inputs: map[string]string{"text": "Producer.text"}}))
+	a, _ := b.abilities.ability("Producer")
+	assert.Equal(t, []string{"text"}, newAPIAbility(a).Outputs)
+
+	// Values are forwarded in process
+	out <- "test"
+	assert.Equal(t, "test", receiveForTest(t, in))
+
+	// Values are dropped if the input is not ready
+	// "3" is only received once "2" has been forwarded, which means "1" is still in the input when "2" is forwarded
+	out <- "1"
+	out <- "2"
+	out <- "3"
+	assert.Equal(t, "1", receiveForTest(t, in))
+	select {
+	case v := <-in:
+		assert.Equal(t, "3", v)
+	default:
+	}
+
+	// Values are dispatched to Bob once no input is linked to the output
+	assert.NoError(t, b.Forget("consumer"))
+	out <- "bob"
+	waitForQueuedMessage(t, b.ws, WebsocketAbilityEventName("Producer", "text"), "bob")
+}
+
+func TestPipelineRelay(t *testing.T) {
+	// Learn consumers whose source has not been learned by the brain
+	b := New(Configuration{})
+	in1, in2 := make(chan int, 1), make(chan int, 1)
+	assert.NoError(t, b.Learn(newConsumerForTest("Consumer1", "n", in1), AbilityConfiguration{Inputs: map[string]string{"n": "Remote.n"}}))
+	assert.NoError(t, b.Learn(newConsumerForTest("Consumer2", "n", in2), AbilityConfiguration{Inputs: map[string]string{"n": "Remote.n"}}))
+
+	// Brain subscribes once
+	var ns []WebsocketEventName
+	for _, m := range queuedMessages(b.ws) {
+		ns = append(ns, m.eventName)
+	}
+	assert.Equal(t, []WebsocketEventName{WebsocketEventNameRelaySubscribe}, ns)
+	assert.Equal(t, APIRelay{Ability: "Remote", Port: "n"}, queuedMessages(b.ws)[0].payload)
+	assert.Equal(t, map[APIRelay]bool{{Ability: "Remote", Port: "n"}: true}, b.ws.relays)
+
+	// Relayed values are decoded into the input type
+	// Handlers are executed synchronously which means values are in the inputs once handle returns
+	assert.NoError(t, b.ws.handle(nil, "ability.Remote.n", []byte("42")))
+	assert.Len(t, in1, 1)
+	assert.Len(t, in2, 1)
+	assert.Equal(t, 42, <-in1)
+	assert.Equal(t, 42, <-in2)
+
+	// Values that can't be decoded are dropped
+	assert.NoError(t, b.ws.handle(nil, "ability.Remote.n", []byte(`"test"`)))
+	assert.Len(t, in1, 0)
+	assert.Len(t, in2, 0)
+
+	// Brain keeps on receiving the source until no input is linked to it anymore
+	assert.NoError(t, b.Forget("Consumer1"))
+	assert.NoError(t, b.ws.handle(nil, "ability.Remote.n", []byte("1")))
+	assert.Len(t, in1, 0)
+	assert.Len(t, in2, 1)
+	assert.Equal(t, 1, <-in2)
+	assert.NoError(t, b.Forget("Consumer2"))
+	assert.NoError(t, b.ws.handle(nil, "ability.Remote.n", []byte("2")))
+	assert.Len(t, in2, 0)
+	waitForQueuedMessage(t, b.ws, WebsocketEventNameRelayUnsubscribe, APIRelay{Ability: "Remote", Port: "n"})
+	assert.Empty(t, b.ws.relays)
+}
@@ -0,0 +1,388 @@
+package astibrain
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Plugin message names
+// The brain sends the start message once the plugin has connected and the stop message once the ability is switched
+// off. Activable plugins should activate themselves on start and deactivate themselves on stop. The plugin sends
+// dispatch messages to dispatch events to Bob and a crash message if it can't go on, after which it's killed.
+const (
+	PluginMessageNameCrash    = "crash"
+	PluginMessageNameDispatch = "dispatch"
+	PluginMessageNameStart    = "start"
+	PluginMessageNameStop     = "stop"
+)
+
+// Plugin environment variables
+// They're provided to the plugin process so that it knows where to connect and how to encode its messages.
+const (
+	PluginEnvCodec  = "ASTIBOB_PLUGIN_CODEC"
+	PluginEnvSocket = "ASTIBOB_PLUGIN_SOCKET"
+)
+
+// pluginMaxFrameSize is the max size of a plugin frame
+const pluginMaxFrameSize = 16 << 20
+
+// PluginMessage represents a message exchanged with a plugin.
+// Messages are framed by a 4 bytes big endian length followed by the message encoded with the codec.
+type PluginMessage struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// PluginDispatch represents the payload of a dispatch message
+type PluginDispatch struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// PluginConfiguration represents a plugin configuration
+// Codec is the codec used to encode messages. If nil, messages are encoded in JSON.
+// SocketPath is the path of the Unix socket the plugin connects to. If empty, a temporary path is used.
+// StartTimeout is the max duration the brain waits for the plugin to connect.
+// StopTimeout is the max duration the brain waits for the plugin to exit once the stop message has been sent before
+// killing it.
+type PluginConfiguration struct {
+	Args         []string      `toml:"args"`
+	Codec        Codec         `toml:"-"`
+	Command      string        `toml:"command"`
+	Description  string        `toml:"description"`
+	Name         string        `toml:"name"`
+	SocketPath   string        `toml:"socket_path"`
+	StartTimeout time.Duration `toml:"start_timeout"`
+	StopTimeout  time.Duration `toml:"stop_timeout"`
+}
+
+// PluginAbility represents an ability implemented by an external process.
+// The process is started each time the ability is switched on and its exit is considered as a crash so that the
+// restart options apply.
+type PluginAbility struct {
+	c            PluginConfiguration
+	clock        Clock
+	codec        Codec
+	dispatchFunc DispatchFunc
+}
+
+// NewPluginAbility creates a new plugin ability
+func NewPluginAbility(c PluginConfiguration) (a *PluginAbility) {
+	// Create
+	a = &PluginAbility{
+		c:     c,
+		clock: RealClock{},
+		codec: c.Codec,
+	}
+
+	// Default configuration values
+	if a.codec == nil {
+		a.codec = NewJSONCodec()
+	}
+	if a.c.StartTimeout == 0 {
+		a.c.StartTimeout = 10 * time.Second
+	}
+	if a.c.StopTimeout == 0 {
+		a.c.StopTimeout = 5 * time.Second
+	}
+	return
+}
+
+// Name implements the Ability interface
+func (a *PluginAbility) Name() string {
+	return a.c.Name
+}
+
+// Description implements the Ability interface
+func (a *PluginAbility) Description() string {
+	return a.c.Description
+}
+
+// SetClock implements the ClockUser interface
+func (a *PluginAbility) SetClock(c Clock) {
+	a.clock = c
+}
+
+// SetDispatchFunc implements the Dispatcher interface
+func (a *PluginAbility) SetDispatchFunc(fn DispatchFunc) {
+	a.dispatchFunc = fn
+}
+
+// Run implements the Runnable interface
+func (a *PluginAbility) Run(ctx context.Context) (err error) {
+	// Get socket path
+	p := a.c.SocketPath
+	if len(p) == 0 {
+		var dir string
+		if dir, err = ioutil.TempDir("", "astibob-plugin"); err != nil {
+			err = errors.Wrap(err, "astibrain: creating temp dir failed")
+			return
+		}
+		defer os.RemoveAll(dir)
+		p = filepath.Join(dir, "plugin.sock")
+	}
+
+	// Listen
+	var l net.Listener
+	if l, err = net.Listen("unix", p); err != nil {
+		err = errors.Wrapf(err, "astibrain: listening on %s failed", p)
+		return
+	}
+	defer l.Close()
+
+	// Start process
+	cmd := exec.Command(a.c.Command, a.c.Args...)
+	cmd.Env = append(os.Environ(), PluginEnvCodec+"="+a.codec.Name(), PluginEnvSocket+"="+p)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	astilog.Debugf("astibrain: starting plugin %s", a.c.Command)
+	if err = cmd.Start(); err != nil {
+		err = errors.Wrapf(err, "astibrain: starting plugin %s failed", a.c.Command)
+		return
+	}
+
+	// Wait for the process to exit in a goroutine
+	var chanExited = make(chan error, 1)
+	go func() { chanExited <- cmd.Wait() }()
+
+	// Make sure the process is dead when leaving
+	defer func() {
+		select {
+		case <-chanExited:
+		default:
+			cmd.Process.Kill()
+			<-chanExited
+		}
+	}()
+
+	// Accept connection
+	var c net.Conn
+	if c, err = a.accept(l, chanExited); err != nil {
+		err = errors.Wrap(err, "astibrain: accepting plugin connection failed")
+		return
+	}
+	pc := newPluginConn(c, a.codec)
+	defer pc.close()
+
+	// Read in a goroutine
+	var chanCrashed = make(chan error, 1)
+	go a.read(pc, chanCrashed)
+
+	// Start
+	if err = pc.write(PluginMessageNameStart, nil); err != nil {
+		err = errors.Wrap(err, "astibrain: writing start message failed")
+		return
+	}
+
+	// Wait for either the context to be done or the process to exit
+	select {
+	case <-ctx.Done():
+		a.stop(pc, chanExited)
+		return
+	case err = <-chanCrashed:
+		err = errors.Wrap(err, "astibrain: plugin crashed")
+		return
+	case err = <-chanExited:
+		if err == nil {
+			err = errors.New("astibrain: plugin exited")
+		} else {
+			err = errors.Wrap(err, "astibrain: plugin exited")
+		}
+		return
+	}
+}
+
+// accept waits for the plugin to connect
+func (a *PluginAbility) accept(l net.Listener, chanExited chan error) (c net.Conn, err error) {
+	// Accept in a goroutine
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	var chanAccepted = make(chan result, 1)
+	go func() {
+		c, err := l.Accept()
+		chanAccepted <- result{c: c, err: err}
+	}()
+
+	// Wait
+	select {
+	case r := <-chanAccepted:
+		return r.c, r.err
+	case err = <-chanExited:
+		// Make sure the process is considered as exited by the caller
+		chanExited <- err
+		err = fmt.Errorf("astibrain: plugin exited before connecting: %v", err)
+	case <-a.clock.After(a.c.StartTimeout):
+		err = fmt.Errorf("astibrain: plugin didn't connect within %s", a.c.StartTimeout)
+	}
+
+	// Release the accepting goroutine
+	l.Close()
+	return
+}
+
+// stop asks the plugin to stop and waits for it to exit
+func (a *PluginAbility) stop(pc *pluginConn, chanExited chan error) {
+	// Write stop message
+	if err := pc.write(PluginMessageNameStop, nil); err != nil {
+		astilog.Error(errors.Wrap(err, "astibrain: writing stop message failed"))
+		return
+	}
+
+	// Wait for the process to exit
+	select {
+	case err := <-chanExited:
+		chanExited <- err
+	case <-a.clock.After(a.c.StopTimeout):
+		astilog.Errorf("astibrain: plugin %s didn't stop within %s, killing it", a.c.Command, a.c.StopTimeout)
+	}
+}
+
+// read reads messages sent by the plugin until the connection is closed
+func (a *PluginAbility) read(pc *pluginConn, chanCrashed chan error) {
+	for {
+		// Read
+		m, err := pc.read()
+		if err != nil {
+			if err != io.EOF && !pc.isClosed() {
+				astilog.Error(errors.Wrap(err, "astibrain: reading plugin message failed"))
+			}
+			return
+		}
+
+		// Process message
+		switch m.Name {
+		case PluginMessageNameCrash:
+			var s string
+			if err = json.Unmarshal(m.Payload, &s); err != nil {
+				s = string(m.Payload)
+			}
+			chanCrashed <- errors.New(s)
+			return
+		case PluginMessageNameDispatch:
+			// Unmarshal
+			var d PluginDispatch
+			if err = json.Unmarshal(m.Payload, &d); err != nil {
+				astilog.Error(errors.Wrapf(err, "astibrain: json unmarshaling %s into %#v failed", m.Payload, d))
+				continue
+			}
+
+			// Dispatch
+			if a.dispatchFunc != nil {
+				a.dispatchFunc(Event{Name: d.Name, Payload: d.Payload})
+			}
+		default:
+			astilog.Errorf("astibrain: unknown plugin message %s", m.Name)
+		}
+	}
+}
+
+// pluginConn represents a connection to a plugin
+type pluginConn struct {
+	c      net.Conn
+	closed bool
+	codec  Codec
+	m      sync.Mutex // Locks closed and writes
+	r      *bufio.Reader
+}
+
+// newPluginConn creates a new plugin connection
+func newPluginConn(c net.Conn, codec Codec) *pluginConn {
+	return &pluginConn{
+		c:     c,
+		codec: codec,
+		r:     bufio.NewReader(c),
+	}
+}
+
+// close closes the connection
+func (pc *pluginConn) close() {
+	pc.m.Lock()
+	pc.closed = true
+	pc.m.Unlock()
+	pc.c.Close()
+}
+
+// isClosed checks whether the connection has been closed on purpose
+func (pc *pluginConn) isClosed() bool {
+	pc.m.Lock()
+	defer pc.m.Unlock()
+	return pc.closed
+}
+
+// write writes a message
+func (pc *pluginConn) write(name string, payload interface{}) (err error) {
+	// Create message
+	m := PluginMessage{Name: name}
+	if payload != nil {
+		if m.Payload, err = json.Marshal(payload); err != nil {
+			err = errors.Wrapf(err, "astibrain: json marshaling %#v failed", payload)
+			return
+		}
+	}
+
+	// Encode
+	var b []byte
+	if b, err = pc.codec.Marshal(m); err != nil {
+		err = errors.Wrapf(err, "astibrain: encoding %s message failed", name)
+		return
+	}
+
+	// Lock
+	pc.m.Lock()
+	defer pc.m.Unlock()
+
+	// Write
+	var h [4]byte
+	binary.BigEndian.PutUint32(h[:], uint32(len(b)))
+	if _, err = pc.c.Write(append(h[:], b...)); err != nil {
+		err = errors.Wrapf(err, "astibrain: writing %s message failed", name)
+		return
+	}
+	return
+}
+
+// read reads a message
+func (pc *pluginConn) read() (m PluginMessage, err error) {
+	// Read header
+	var h [4]byte
+	if _, err = io.ReadFull(pc.r, h[:]); err != nil {
+		return
+	}
+
+	// Check size
+	n := binary.BigEndian.Uint32(h[:])
+	if n > pluginMaxFrameSize {
+		err = fmt.Errorf("astibrain: plugin frame of %d bytes exceeds max size of %d bytes", n, pluginMaxFrameSize)
+		return
+	}
+
+	// Read body
+	b := make([]byte, n)
+	if _, err = io.ReadFull(pc.r, b); err != nil {
+		err = errors.Wrap(err, "astibrain: reading plugin frame failed")
+		return
+	}
+
+	// Decode
+	if err = pc.codec.Unmarshal(b, &m); err != nil {
+		err = errors.Wrap(err, "astibrain: decoding plugin message failed")
+		return
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package astibrain
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// PreStopper represents an object that needs to do some work, such as checkpointing its state, right before being
+// switched off.
+// PreStop is called while the ability is still on, right before its context is cancelled. It's given
+// AbilityConfiguration.PreStopTimeout to return after which the ability is switched off anyway. A returned error is
+// logged but doesn't prevent the ability from being switched off.
+type PreStopper interface {
+	PreStop() error
+}
+
+// preStop executes the pre-stop hook of the ability, if any, and executes fn with its error once it has returned or
+// once it has timed out.
+// It doesn't block: the timeout is scheduled before returning and the hook is executed in a goroutine so that callers,
+// such as the API and websocket handlers, are not blocked while it runs.
+func (a *ability) preStop(fn func(err error)) {
+	// Ability doesn't have a pre-stop hook
+	v, ok := a.a.(PreStopper)
+	if !ok {
+		fn(nil)
+		return
+	}
+
+	// Schedule timeout
+	var chanTimeout = make(chan struct{})
+	t := a.clock.AfterFunc(a.c.PreStopTimeout, func() { close(chanTimeout) })
+
+	// Execute hook
+	var chanDone = make(chan error, 1)
+	go func() {
+		chanDone <- v.PreStop()
+	}()
+
+	// Wait for either the hook to be done or the timeout
+	go func() {
+		defer t.Stop()
+		select {
+		case err := <-chanDone:
+			if err != nil {
+				err = errors.Wrapf(err, "astibrain: pre-stop hook of %s failed", a.name)
+			}
+			fn(err)
+		case <-chanTimeout:
+			fn(fmt.Errorf("astibrain: pre-stop hook of %s timed out after %s, switching it off anyway", a.name, a.c.PreStopTimeout))
+		}
+	}()
+}
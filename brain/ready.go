@@ -0,0 +1,61 @@
+package astibrain
+
+import (
+	"github.com/asticode/go-astilog"
+)
+
+// APIBrainReady is a brain ready API payload
+// Abilities is the final state of the AutoStart abilities indexed by ability name. Abilities that have crashed while
+// being switched on are reported as crashed even if they're about to be restarted. Singleton abilities still waiting
+// for their lease are not included since another brain may hold it indefinitely: they're reported through their
+// started event once the lease has been granted.
+type APIBrainReady struct {
+	Abilities map[string]AbilityState `json:"abilities"`
+}
+
+// Ready returns whether all AutoStart abilities have been resolved since the brain started running, either because
+// they have been switched on or because they have failed to. Singleton abilities waiting for their lease are not
+// waited for.
+func (b *Brain) Ready() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.isReady
+}
+
+// resolvedState returns the state of an ability that has just been auto started.
+// Abilities that have crashed while being switched on are reported as crashed even if they're about to be restarted.
+func resolvedState(a *ability) AbilityState {
+	s := a.state()
+	if s != AbilityStateOn && s != AbilityStatePaused && a.lastError() != nil {
+		s = AbilityStateCrashed
+	}
+	return s
+}
+
+// ready marks the brain as ready and dispatches the brain ready event.
+// It must be called once every AutoStart ability has been switched on or has failed to.
+func (b *Brain) ready(as []*ability) {
+	// Create payload
+	p := APIBrainReady{Abilities: make(map[string]AbilityState)}
+	for _, a := range as {
+		// Ability is not auto started or is waiting for its lease
+		if !a.c.AutoStart || len(a.schedule) > 0 || a.isWaitingForLease() {
+			continue
+		}
+
+		// Get final state
+		p.Abilities[a.name] = resolvedState(a)
+	}
+
+	// Update ready attribute
+	b.m.Lock()
+	b.isReady = true
+	b.m.Unlock()
+
+	// Log
+	astilog.Infof("astibrain: brain is ready")
+
+	// Dispatch websocket event
+	// It's queued until the brain is connected to Bob
+	b.ws.send(WebsocketEventNameBrainReady, p)
+}
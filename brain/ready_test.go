@@ -0,0 +1,27 @@
+package astibrain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrainReadyExcludesSingletonsWaitingForLease(t *testing.T) {
+	a, _, _ := newAbilityForTest(newTestAbility(), AbilityConfiguration{AutoStart: true, Singleton: true})
+	b := &Brain{abilities: a.abilities, ws: newWebsocket(a.abilities, WebsocketConfiguration{})}
+	ready := func() APIBrainReady {
+		b.ready([]*ability{a})
+		b.ws.m.Lock()
+		defer b.ws.m.Unlock()
+		return b.ws.q[len(b.ws.q)-1].payload.(APIBrainReady)
+	}
+
+	// Singleton waiting for its lease is not included
+	a.wantsLeaseUnsafe = true
+	assert.Equal(t, APIBrainReady{Abilities: map[string]AbilityState{}}, ready())
+	assert.True(t, b.Ready())
+
+	// Singleton that has been resolved is included
+	a.wantsLeaseUnsafe = false
+	assert.Equal(t, APIBrainReady{Abilities: map[string]AbilityState{"Test": AbilityStateOff}}, ready())
+}
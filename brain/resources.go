@@ -0,0 +1,115 @@
+package astibrain
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astilog"
+)
+
+// Pprof labels
+// Goroutines started by an ability carry the pprof labels of its run so that they can be attributed to it, in
+// goroutine profiles for instance.
+const (
+	pprofLabelAbility = "astibrain_ability"
+	pprofLabelRun     = "astibrain_run"
+)
+
+// Resources
+const (
+	resourceGoroutines = "goroutines"
+)
+
+// defaultResourceCheckInterval is the default interval at which resources are checked
+const defaultResourceCheckInterval = 10 * time.Second
+
+// APIAbilityResourceExceeded is an ability resource exceeded API payload
+type APIAbilityResourceExceeded struct {
+	Limit    int    `json:"limit"`
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+	Value    int    `json:"value"`
+}
+
+// goroutineCounter counts the goroutines of a run that are still running
+type goroutineCounter struct {
+	n int64
+}
+
+// goroutineCounterKey is the context key of the goroutine counter of a run
+type goroutineCounterKey struct{}
+
+// contextWithGoroutineCounter returns a context carrying a new goroutine counter
+func contextWithGoroutineCounter(ctx context.Context) (context.Context, *goroutineCounter) {
+	c := &goroutineCounter{}
+	return context.WithValue(ctx, goroutineCounterKey{}, c), c
+}
+
+// count returns the number of goroutines still running
+func (c *goroutineCounter) count() int {
+	return int(atomic.LoadInt64(&c.n))
+}
+
+// Go executes fn in a goroutine counted against the MaxGoroutines limit of the run the context belongs to, if any.
+// The goroutine inherits the pprof labels of the context.
+func Go(ctx context.Context, fn func()) {
+	c, _ := ctx.Value(goroutineCounterKey{}).(*goroutineCounter)
+	if c != nil {
+		atomic.AddInt64(&c.n, 1)
+	}
+	go func() {
+		if c != nil {
+			defer atomic.AddInt64(&c.n, -1)
+		}
+		pprof.Do(ctx, pprof.Labels(), func(context.Context) { fn() })
+	}()
+}
+
+// withRunLabels executes fn with the pprof labels of the current run so that the goroutines it starts inherit them
+func (a *ability) withRunLabels(fn func()) {
+	pprof.Do(a.ctx, pprof.Labels(), func(context.Context) { fn() })
+}
+
+// checkResources checks the resources of the run periodically until the context is done.
+// The ability is switched off once a limit has been exceeded.
+func (a *ability) checkResources(ctx context.Context, c *goroutineCounter) {
+	// Create ticker
+	d := a.c.ResourceCheckInterval
+	if d <= 0 {
+		d = defaultResourceCheckInterval
+	}
+	t := a.clock.NewTicker(d)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			// Limit has not been exceeded
+			n := c.count()
+			if n <= a.c.MaxGoroutines {
+				continue
+			}
+
+			// Log
+			astilog.Errorf("astibrain: %s has exceeded its %s limit: %d > %d", a.name, resourceGoroutines, n, a.c.MaxGoroutines)
+
+			// Dispatch websocket event
+			a.ws.send(WebsocketEventNameAbilityResourceExceeded, APIAbilityResourceExceeded{
+				Limit:    a.c.MaxGoroutines,
+				Name:     a.name,
+				Resource: resourceGoroutines,
+				Value:    n,
+			})
+
+			// Switch off
+			// The request goes through the toggle worker so that it's ordered with the other toggle requests
+			a.requestToggle(false)
+			return
+		}
+	}
+}
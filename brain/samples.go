@@ -0,0 +1,129 @@
+package astibrain
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Samples encodings
+// By default samples are sent as a JSON array which is readable by any client but is very verbose.
+// SamplesEncodingBinary sends samples as little-endian int32. SamplesEncodingDeflate does the same but compresses them as well.
+// Compression only applies to the samples payload: websocket messages themselves are not compressed.
+const (
+	SamplesEncodingBinary  = "binary"
+	SamplesEncodingDeflate = "deflate"
+	SamplesEncodingJSON    = ""
+)
+
+// SamplesEncodingConfiguration represents a samples encoding configuration
+// CompressionLevel is the flate compression level used by SamplesEncodingDeflate. Default is flate.DefaultCompression.
+type SamplesEncodingConfiguration struct {
+	CompressionLevel int    `toml:"compression_level"`
+	Encoding         string `toml:"encoding"`
+}
+
+// EncodedSamples represents encoded samples
+type EncodedSamples struct {
+	Data     []byte `json:"data"`
+	Encoding string `json:"encoding"`
+}
+
+// EncodeSamples encodes samples based on the configuration.
+// It returns nil if samples should be sent as a JSON array or if encoding failed.
+func EncodeSamples(samples []int32, c SamplesEncodingConfiguration) (e *EncodedSamples, err error) {
+	// Samples should be sent as a JSON array
+	if c.Encoding == SamplesEncodingJSON {
+		return
+	}
+
+	// Write samples in binary
+	buf := &bytes.Buffer{}
+	if err = binary.Write(buf, binary.LittleEndian, samples); err != nil {
+		err = errors.Wrap(err, "astibrain: writing samples in binary failed")
+		return
+	}
+
+	// Switch on encoding
+	var data []byte
+	switch c.Encoding {
+	case SamplesEncodingBinary:
+		data = buf.Bytes()
+	case SamplesEncodingDeflate:
+		// Get compression level
+		level := c.CompressionLevel
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+
+		// Create writer
+		var w *flate.Writer
+		out := &bytes.Buffer{}
+		if w, err = flate.NewWriter(out, level); err != nil {
+			err = errors.Wrapf(err, "astibrain: creating flate writer with level %d failed", level)
+			return
+		}
+
+		// Compress
+		if _, err = w.Write(buf.Bytes()); err != nil {
+			err = errors.Wrap(err, "astibrain: compressing samples failed")
+			return
+		}
+
+		// Close
+		if err = w.Close(); err != nil {
+			err = errors.Wrap(err, "astibrain: closing flate writer failed")
+			return
+		}
+		data = out.Bytes()
+	default:
+		err = fmt.Errorf("astibrain: unknown samples encoding %s", c.Encoding)
+		return
+	}
+
+	// Create encoded samples once every step has succeeded
+	e = &EncodedSamples{
+		Data:     data,
+		Encoding: c.Encoding,
+	}
+	return
+}
+
+// Decode decodes the samples
+func (e EncodedSamples) Decode() (samples []int32, err error) {
+	// Switch on encoding
+	var b []byte
+	switch e.Encoding {
+	case SamplesEncodingBinary:
+		b = e.Data
+	case SamplesEncodingDeflate:
+		// Decompress
+		r := flate.NewReader(bytes.NewReader(e.Data))
+		defer r.Close()
+		if b, err = ioutil.ReadAll(r); err != nil {
+			err = errors.Wrap(err, "astibrain: decompressing samples failed")
+			return
+		}
+	default:
+		err = fmt.Errorf("astibrain: unknown samples encoding %s", e.Encoding)
+		return
+	}
+
+	// Invalid length
+	if len(b)%4 != 0 {
+		err = fmt.Errorf("astibrain: invalid encoded samples length %d", len(b))
+		return
+	}
+
+	// Read samples
+	samples = make([]int32, len(b)/4)
+	if err = binary.Read(bytes.NewReader(b), binary.LittleEndian, samples); err != nil {
+		err = errors.Wrap(err, "astibrain: reading samples in binary failed")
+		return
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package astibrain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeSamples(t *testing.T) {
+	samples := []int32{-1 << 31, -1, 0, 1, 1<<31 - 1}
+	for _, v := range []struct {
+		name    string
+		c       SamplesEncodingConfiguration
+		encoded bool
+	}{
+		{name: "json", c: SamplesEncodingConfiguration{}},
+		{name: "binary", c: SamplesEncodingConfiguration{Encoding: SamplesEncodingBinary}, encoded: true},
+		{name: "deflate", c: SamplesEncodingConfiguration{Encoding: SamplesEncodingDeflate}, encoded: true},
+		{name: "deflate with level", c: SamplesEncodingConfiguration{CompressionLevel: 9, Encoding: SamplesEncodingDeflate}, encoded: true},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			e, err := EncodeSamples(samples, v.c)
+			assert.NoError(t, err)
+			if !v.encoded {
+				assert.Nil(t, e)
+				return
+			}
+			assert.Equal(t, v.c.Encoding, e.Encoding)
+			d, err := e.Decode()
+			assert.NoError(t, err)
+			assert.Equal(t, samples, d)
+		})
+	}
+}
+
+func TestEncodeSamplesFailure(t *testing.T) {
+	// Nothing is returned when encoding fails so that callers fall back to JSON arrays
+	for _, c := range []SamplesEncodingConfiguration{
+		{Encoding: "invalid"},
+		{CompressionLevel: 42, Encoding: SamplesEncodingDeflate},
+	} {
+		e, err := EncodeSamples([]int32{1}, c)
+		assert.Error(t, err)
+		assert.Nil(t, e)
+	}
+}
+
+func TestDecodeSamplesFailure(t *testing.T) {
+	_, err := EncodedSamples{Data: []byte{1, 2, 3}, Encoding: SamplesEncodingBinary}.Decode()
+	assert.Error(t, err)
+	_, err = EncodedSamples{Encoding: "invalid"}.Decode()
+	assert.Error(t, err)
+}
@@ -0,0 +1,275 @@
+package astibrain
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// scheduleDayNames are the day names allowed in a schedule window
+var scheduleDayNames = map[string]int{
+	"sun": 0,
+	"mon": 1,
+	"tue": 2,
+	"wed": 3,
+	"thu": 4,
+	"fri": 5,
+	"sat": 6,
+}
+
+// schedule represents the windows during which an ability should be on
+type schedule []scheduleWindow
+
+// scheduleWindow represents a window during which an ability should be on.
+// start and end are expressed in minutes since midnight. A window whose end is before its start spans midnight and
+// belongs to the day it starts on.
+type scheduleWindow struct {
+	days  [7]bool
+	end   int
+	start int
+}
+
+// parseSchedule parses schedule windows.
+// Windows are formatted as "<days> <start>-<end>" where days follows the cron day of week syntax ("*", "1-5",
+// "mon-fri", "sat,sun", etc.) and start and end are formatted as "15:04". Days can be omitted, in which case the
+// window applies every day.
+func parseSchedule(ws []string) (s schedule, err error) {
+	for _, v := range ws {
+		var w scheduleWindow
+		if w, err = parseScheduleWindow(v); err != nil {
+			err = errors.Wrapf(err, "astibrain: parsing schedule window %s failed", v)
+			return
+		}
+		s = append(s, w)
+	}
+	return
+}
+
+// parseScheduleWindow parses a schedule window
+func parseScheduleWindow(v string) (w scheduleWindow, err error) {
+	// Split
+	fs := strings.Fields(v)
+	var days, hours string
+	switch len(fs) {
+	case 1:
+		days, hours = "*", fs[0]
+	case 2:
+		days, hours = fs[0], fs[1]
+	default:
+		err = fmt.Errorf("astibrain: schedule window should be formatted as \"<days> <start>-<end>\"")
+		return
+	}
+
+	// Parse days
+	if w.days, err = parseScheduleDays(days); err != nil {
+		err = errors.Wrapf(err, "astibrain: parsing days %s failed", days)
+		return
+	}
+
+	// Parse hours
+	ps := strings.Split(hours, "-")
+	if len(ps) != 2 {
+		err = fmt.Errorf("astibrain: hours %s should be formatted as \"<start>-<end>\"", hours)
+		return
+	}
+	if w.start, err = parseScheduleTime(ps[0]); err != nil {
+		err = errors.Wrapf(err, "astibrain: parsing start %s failed", ps[0])
+		return
+	}
+	if w.end, err = parseScheduleTime(ps[1]); err != nil {
+		err = errors.Wrapf(err, "astibrain: parsing end %s failed", ps[1])
+		return
+	}
+	if w.start == w.end {
+		err = fmt.Errorf("astibrain: start and end are equal")
+		return
+	}
+	return
+}
+
+// parseScheduleDays parses a cron like day of week field
+func parseScheduleDays(v string) (days [7]bool, err error) {
+	for _, p := range strings.Split(v, ",") {
+		// Wildcard
+		if p == "*" {
+			for idx := range days {
+				days[idx] = true
+			}
+			continue
+		}
+
+		// Get bounds
+		var from, to int
+		bs := strings.Split(p, "-")
+		if from, err = parseScheduleDay(bs[0]); err != nil {
+			return
+		}
+		to = from
+		if len(bs) == 2 {
+			if to, err = parseScheduleDay(bs[1]); err != nil {
+				return
+			}
+		} else if len(bs) > 2 {
+			err = fmt.Errorf("astibrain: invalid range %s", p)
+			return
+		}
+
+		// Set days
+		// Ranges can wrap around the end of the week
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return
+}
+
+// parseScheduleDay parses a day, either as a number between 0 (sunday) and 7 (sunday) or as a name
+func parseScheduleDay(v string) (d int, err error) {
+	// Name
+	var ok bool
+	if d, ok = scheduleDayNames[strings.ToLower(v)]; ok {
+		return
+	}
+
+	// Number
+	if d, err = strconv.Atoi(v); err != nil || d < 0 || d > 7 {
+		err = fmt.Errorf("astibrain: invalid day %s", v)
+		return
+	}
+	d %= 7
+	return
+}
+
+// parseScheduleTime parses a time of the day and returns it in minutes since midnight
+func parseScheduleTime(v string) (m int, err error) {
+	var t time.Time
+	if t, err = time.Parse("15:04", v); err != nil {
+		err = errors.Wrapf(err, "astibrain: parsing time %s failed", v)
+		return
+	}
+	m = t.Hour()*60 + t.Minute()
+	return
+}
+
+// isOpen checks whether one of the windows is open at the provided time
+func (s schedule) isOpen(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	for _, w := range s {
+		if w.start < w.end {
+			if w.days[t.Weekday()] && m >= w.start && m < w.end {
+				return true
+			}
+		} else {
+			if (w.days[t.Weekday()] && m >= w.start) || (w.days[(t.Weekday()+6)%7] && m < w.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// next returns the first window boundary strictly after the provided time
+func (s schedule) next(t time.Time) (n time.Time) {
+	// Windows span at most 2 days and apply at least once a week
+	for d := -1; d <= 7; d++ {
+		y, mo, da := t.Date()
+		day := time.Date(y, mo, da+d, 0, 0, 0, 0, t.Location())
+		for _, w := range s {
+			// Window doesn't apply on that day
+			if !w.days[day.Weekday()] {
+				continue
+			}
+
+			// Get boundaries
+			start := day.Add(time.Duration(w.start) * time.Minute)
+			end := day.Add(time.Duration(w.end) * time.Minute)
+			if w.end < w.start {
+				end = end.AddDate(0, 0, 1)
+			}
+
+			// Keep the earliest boundary
+			for _, b := range []time.Time{start, end} {
+				if b.After(t) && (n.IsZero() || b.Before(n)) {
+					n = b
+				}
+			}
+		}
+	}
+	return
+}
+
+// scheduleContext returns a context that is cancelled once the schedule of the ability is stopped, see stopSchedule.
+// It's created before the schedule goroutine is started so that an ability forgotten in the meantime is not scheduled.
+func (a *ability) scheduleContext(ctx context.Context) context.Context {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if a.scheduleCancel != nil {
+		a.scheduleCancel()
+	}
+	ctx, a.scheduleCancel = context.WithCancel(ctx)
+	if a.isScheduleStoppedUnsafe {
+		a.scheduleCancel()
+	}
+	return ctx
+}
+
+// stopSchedule stops the schedule of the ability, if any
+func (a *ability) stopSchedule() {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.isScheduleStoppedUnsafe = true
+	if a.scheduleCancel != nil {
+		a.scheduleCancel()
+		a.scheduleCancel = nil
+	}
+}
+
+// runSchedule switches the ability on and off as its schedule windows open and close until the context is done.
+// Manually switching the ability on or off overrides the schedule until the next window boundary.
+func (b *Brain) runSchedule(ctx context.Context, a *ability) {
+	// Apply the current window
+	if a.schedule.isOpen(a.clock.Now()) {
+		b.autoStart(a)
+	}
+
+	// Loop
+	for {
+		// Get next boundary
+		n := a.schedule.next(a.clock.Now())
+		if n.IsZero() {
+			return
+		}
+
+		// Wait for next boundary
+		c := make(chan struct{})
+		t := a.clock.AfterFunc(n.Sub(a.clock.Now()), func() { close(c) })
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-c:
+		}
+
+		// Schedule has been stopped in the meantime
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Apply window
+		if a.schedule.isOpen(a.clock.Now()) {
+			astilog.Debugf("astibrain: schedule window of %s has opened", a.name)
+			b.autoStart(a)
+		} else {
+			astilog.Debugf("astibrain: schedule window of %s has closed", a.name)
+			a.off()
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package astibrain
+
+import "github.com/asticode/go-astilog"
+
+// silentEventSender represents an event sender only logging the lifecycle events of an ability locally
+// Lease events are still sent since Bob needs them to grant leases.
+type silentEventSender struct {
+	name string
+	ws   eventSender
+}
+
+// newSilentEventSender creates a new silent event sender
+func newSilentEventSender(name string, ws eventSender) *silentEventSender {
+	return &silentEventSender{
+		name: name,
+		ws:   ws,
+	}
+}
+
+// send implements the eventSender interface
+func (s *silentEventSender) send(eventName WebsocketEventName, payload interface{}) {
+	// Lease events are always sent
+	if eventName == WebsocketEventNameAbilityLeaseAcquire || eventName == WebsocketEventNameAbilityLeaseRelease {
+		s.ws.send(eventName, payload)
+		return
+	}
+
+	// Log
+	astilog.Debugf("astibrain: %s event of ability %s is silent: %+v", eventName, s.name, payload)
+}
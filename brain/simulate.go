@@ -0,0 +1,87 @@
+package astibrain
+
+import (
+	"context"
+	"time"
+
+	"github.com/asticode/go-astilog"
+)
+
+// SimulateOptions represents simulate options
+// If Enabled is true, learned abilities are replaced with stubs that never touch real devices: they keep their name,
+// description and configuration, are switched on and off exactly like the real ones and honor AutoStart, but they
+// run until they're switched off without doing anything. Their custom websocket listeners, HTTP handlers and Init
+// method are ignored. This allows validating a brain's configuration and demoing the UI without the required hardware.
+// If TickInterval is > 0, running stubs dispatch a simulation tick event at that interval.
+type SimulateOptions struct {
+	Enabled      bool          `toml:"enabled"`
+	TickInterval time.Duration `toml:"tick_interval"`
+}
+
+// Simulated ability event names
+const (
+	simulatedEventNameTick = "simulation.tick"
+)
+
+// simulatedAbility represents a stub replacing an ability in simulate mode
+type simulatedAbility struct {
+	c            SimulateOptions
+	clock        Clock
+	description  string
+	dispatchFunc DispatchFunc
+	name         string
+}
+
+// newSimulatedAbility creates a new simulated ability
+func newSimulatedAbility(a Ability, c SimulateOptions, clock Clock) *simulatedAbility {
+	return &simulatedAbility{
+		c:           c,
+		clock:       clock,
+		description: a.Description(),
+		name:        a.Name(),
+	}
+}
+
+// Name implements the Ability interface
+func (a *simulatedAbility) Name() string {
+	return a.name
+}
+
+// Description implements the Ability interface
+func (a *simulatedAbility) Description() string {
+	return a.description
+}
+
+// SetDispatchFunc implements the Dispatcher interface
+func (a *simulatedAbility) SetDispatchFunc(fn DispatchFunc) {
+	a.dispatchFunc = fn
+}
+
+// Run implements the Runnable interface
+func (a *simulatedAbility) Run(ctx context.Context) (err error) {
+	// Log
+	astilog.Debugf("astibrain: simulating %s", a.name)
+
+	// No ticks
+	if a.c.TickInterval <= 0 {
+		<-ctx.Done()
+		return
+	}
+
+	// Tick
+	t := a.clock.NewTicker(a.c.TickInterval)
+	defer t.Stop()
+	for {
+		select {
+		case at := <-t.C():
+			if a.dispatchFunc != nil {
+				a.dispatchFunc(Event{
+					Name:    simulatedEventNameTick,
+					Payload: at,
+				})
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
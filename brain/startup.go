@@ -0,0 +1,99 @@
+package astibrain
+
+import (
+	"context"
+
+	"github.com/asticode/go-astilog"
+)
+
+// APIBrainStartupProgress is a brain startup progress API payload
+// It's sent each time an AutoStart ability has been resolved while the brain is starting. Index starts at 1 and Total
+// is the number of AutoStart abilities.
+type APIBrainStartupProgress struct {
+	Ability string       `json:"ability"`
+	Index   int          `json:"index"`
+	State   AbilityState `json:"state"`
+	Total   int          `json:"total"`
+}
+
+// startupProgress represents the progress of the startup of the brain
+type startupProgress struct {
+	idx   int
+	total int
+}
+
+// newStartupProgress creates a new startup progress
+func newStartupProgress(as []*ability) (p *startupProgress) {
+	p = &startupProgress{}
+	for _, a := range as {
+		if isAutoStarted(a) {
+			p.total++
+		}
+	}
+	return
+}
+
+// isAutoStarted returns whether an ability is switched on when the brain starts
+func isAutoStarted(a *ability) bool {
+	return a.c.AutoStart && len(a.schedule) == 0
+}
+
+// resolve sends the startup progress once an ability has been resolved.
+// Abilities that are not auto started are ignored.
+func (p *startupProgress) resolve(b *Brain, a *ability) {
+	// Ability is not auto started
+	if !isAutoStarted(a) {
+		return
+	}
+
+	// Create payload
+	p.idx++
+	pl := APIBrainStartupProgress{
+		Ability: a.name,
+		Index:   p.idx,
+		State:   resolvedState(a),
+		Total:   p.total,
+	}
+
+	// Log
+	astilog.Debugf("astibrain: %s has been resolved (%d/%d)", a.name, pl.Index, pl.Total)
+
+	// Dispatch websocket event
+	// It's queued until the brain is connected to Bob
+	b.ws.send(WebsocketEventNameBrainStartupProgress, pl)
+}
+
+// startSequentially initializes and auto starts abilities one at a time, in order, waiting StartupGap between each
+func (b *Brain) startSequentially(ctx context.Context, as []*ability) {
+	p := newStartupProgress(as)
+	for idx, a := range as {
+		// Initialize
+		if err := a.init(ctx); err != nil {
+			astilog.Error(err)
+		}
+
+		// Auto start
+		// Scheduled abilities are switched on and off by their schedule instead
+		var started bool
+		if a.isInitialized() {
+			if len(a.schedule) > 0 {
+				go b.runSchedule(a.scheduleContext(ctx), a)
+			} else if a.c.AutoStart {
+				b.autoStart(a)
+				started = true
+			}
+		}
+		p.resolve(b, a)
+
+		// Wait before starting the next ability
+		// Only abilities that have actually been started use resources
+		if !started || idx == len(as)-1 {
+			continue
+		}
+		select {
+		case <-b.clock.After(b.c.StartupGap):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
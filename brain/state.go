@@ -0,0 +1,69 @@
+package astibrain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/asticode/go-astiws"
+)
+
+// APIAbilityState is an ability state API payload
+// LastError is the error that has made the ability crash the last time, if it hasn't been switched on successfully
+// since then. Uptime is the duration the ability has been on for, or 0 if it's off.
+type APIAbilityState struct {
+	LastError string        `json:"last_error,omitempty"`
+	Name      string        `json:"name"`
+	State     AbilityState  `json:"state"`
+	Uptime    time.Duration `json:"uptime"`
+}
+
+// APIStateSnapshot is a state snapshot API payload
+type APIStateSnapshot struct {
+	Abilities []APIAbilityState `json:"abilities"`
+}
+
+// newAPIAbilityState creates a new ability state API payload
+func newAPIAbilityState(a *ability) (p APIAbilityState) {
+	p = APIAbilityState{
+		Name:   a.name,
+		State:  a.state(),
+		Uptime: a.uptime(),
+	}
+	if err := a.lastError(); err != nil {
+		p.LastError = err.Error()
+	}
+	return
+}
+
+// uptime returns the duration the ability has been on for, or 0 if it's off
+func (a *ability) uptime() time.Duration {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if !a.isOnUnsafe {
+		return 0
+	}
+	return a.clock.Now().Sub(a.startedAt)
+}
+
+// sendState sends the state of the ability to Bob.
+// It's sent once a transition is over so that Bob can apply it without asking for a state snapshot.
+func (a *ability) sendState() {
+	a.ws.send(WebsocketEventNameAbilityState, newAPIAbilityState(a))
+}
+
+// newAPIStateSnapshot creates a new state snapshot API payload
+func newAPIStateSnapshot(abilities *abilities) (p APIStateSnapshot) {
+	p = APIStateSnapshot{Abilities: []APIAbilityState{}}
+	abilities.abilities(func(a *ability) error {
+		p.Abilities = append(p.Abilities, newAPIAbilityState(a))
+		return nil
+	})
+	return
+}
+
+// handleStateResync handles the state resync websocket event
+// Bob sends it whenever it wants to know the state of every ability, for instance once the brain has registered.
+func (ws *websocket) handleStateResync(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	ws.send(WebsocketEventNameStateSnapshot, newAPIStateSnapshot(ws.abilities))
+	return nil
+}
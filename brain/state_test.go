@@ -0,0 +1,45 @@
+package astibrain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedStates returns the ability state payloads recorded by the recorder
+func recordedStates(r *eventRecorder) (ps []APIAbilityState) {
+	for _, e := range r.events() {
+		if e.name == string(WebsocketEventNameAbilityState) {
+			ps = append(ps, e.payload.(APIAbilityState))
+		}
+	}
+	return
+}
+
+func TestAbilitySendsStates(t *testing.T) {
+	ta := newTestAbility()
+	a, r, _ := newAbilityForTest(ta, AbilityConfiguration{RestartOnCrash: true})
+	r.states = true
+
+	// Each transition is followed by the resulting state
+	a.on()
+	a.pause()
+	a.resume()
+	ta.chanRun <- errors.New("test")
+	ns := waitForEvents(t, r, 9)
+	a.off()
+	ns = waitForEvents(t, r, 10)
+	assert.Equal(t, []string{"ability.started", "ability.state", "ability.paused", "ability.state", "ability.resumed", "ability.state", "ability.crashed", "ability.restarting", "ability.state", "ability.state"}, ns)
+
+	// States
+	var ss []AbilityState
+	ps := recordedStates(r)
+	for _, p := range ps {
+		ss = append(ss, p.State)
+	}
+	assert.Equal(t, []AbilityState{AbilityStateOn, AbilityStatePaused, AbilityStateOn, AbilityStateStarting, AbilityStateCrashed}, ss)
+	assert.Equal(t, "", ps[0].LastError)
+	assert.Contains(t, ps[3].LastError, "test")
+	assert.Equal(t, "Test", ps[4].Name)
+}
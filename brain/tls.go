@@ -0,0 +1,199 @@
+package astibrain
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// tlsTunnelTokenHeader is the header holding the token of the tls tunnel
+const tlsTunnelTokenHeader = "X-Astibrain-Tunnel-Token"
+
+// tlsConfig returns the TLS config used to dial wss:// URLs.
+// It returns nil if no TLS option has been set, in which case the system roots are used.
+func (c WebsocketConfiguration) tlsConfig() (t *tls.Config, err error) {
+	// No TLS option
+	if c.TLSConfig == nil && len(c.CAFile) == 0 && !c.InsecureSkipVerify {
+		return
+	}
+
+	// Clone config
+	t = &tls.Config{}
+	if c.TLSConfig != nil {
+		t = c.TLSConfig.Clone()
+	}
+
+	// Pin CA
+	if len(c.CAFile) > 0 {
+		// Read file
+		var b []byte
+		if b, err = ioutil.ReadFile(c.CAFile); err != nil {
+			err = errors.Wrapf(err, "astibrain: reading %s failed", c.CAFile)
+			return
+		}
+
+		// Add cert
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(b) {
+			err = fmt.Errorf("astibrain: no valid cert found in %s", c.CAFile)
+			return
+		}
+	}
+
+	// Self-signed setups
+	if c.InsecureSkipVerify {
+		t.InsecureSkipVerify = true
+	}
+	return
+}
+
+// configureTLS configures the TLS config used to dial Bob
+// The config is only used by the brain's own connection, see dialWithHeaders.
+func (ws *websocket) configureTLS() (err error) {
+	if ws.tlsConfig, err = ws.cfg.tlsConfig(); err != nil {
+		err = errors.Wrap(err, "astibrain: getting tls config failed")
+		return
+	}
+	return
+}
+
+// dialWithHeaders dials Bob
+// The websocket client dials through gorilla's default dialer which is shared by the whole process, and configuring it
+// would change TLS verification for every other websocket user. Therefore, when TLS options are set and the URL is a
+// wss:// URL, the client dials a plain ws:// URL on a loopback listener instead, and the single connection it opens is
+// forwarded to Bob over TLS by a dialer dedicated to the brain. The connection must hold a random token generated for
+// this dial so that other local processes can't use the tunnel.
+func (ws *websocket) dialWithHeaders() (err error) {
+	// Parse URL
+	var u *url.URL
+	if u, err = url.Parse(ws.cfg.URL); err != nil {
+		err = errors.Wrapf(err, "astibrain: parsing %s failed", ws.cfg.URL)
+		return
+	}
+
+	// No TLS option or not a wss:// URL
+	if ws.tlsConfig == nil || u.Scheme != "wss" {
+		return ws.c.DialWithHeaders(ws.cfg.URL, ws.h)
+	}
+
+	// Listen
+	var l net.Listener
+	if l, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		err = errors.Wrap(err, "astibrain: listening on loopback failed")
+		return
+	}
+	defer l.Close()
+
+	// Generate token
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		err = errors.Wrap(err, "astibrain: generating tls tunnel token failed")
+		return
+	}
+	token := hex.EncodeToString(b)
+
+	// Forward the next connection holding the token
+	addr := u.Host
+	if len(u.Port()) == 0 {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+	go ws.forwardTLS(l, addr, u.Hostname(), token)
+
+	// Dial loopback
+	// The Host header is kept so that Bob sees the URL it's been dialed with
+	lu := *u
+	lu.Scheme = "ws"
+	lu.Host = l.Addr().String()
+	h := ws.h.Clone()
+	h.Set("Host", u.Host)
+	h.Set(tlsTunnelTokenHeader, token)
+	if err = ws.c.DialWithHeaders(lu.String(), h); err != nil {
+		err = errors.Wrapf(err, "astibrain: dialing %s through tls tunnel failed", ws.cfg.URL)
+		return
+	}
+	return
+}
+
+// forwardTLS accepts the next connection of the listener holding the token and forwards it to addr over TLS until
+// either side is closed.
+// The token is removed from the handshake request before it's forwarded.
+func (ws *websocket) forwardTLS(l net.Listener, addr, serverName, token string) {
+	// Accept
+	// Connections are accepted until one holds the token or the listener is closed
+	var lc net.Conn
+	var br *bufio.Reader
+	var r *http.Request
+	for {
+		// Accept
+		var err error
+		if lc, err = l.Accept(); err != nil {
+			astilog.Debug(errors.Wrap(err, "astibrain: accepting tls tunnel connection failed"))
+			return
+		}
+
+		// Read handshake request
+		lc.SetReadDeadline(time.Now().Add(10 * time.Second))
+		br = bufio.NewReader(lc)
+		if r, err = http.ReadRequest(br); err == nil && subtle.ConstantTimeCompare([]byte(r.Header.Get(tlsTunnelTokenHeader)), []byte(token)) == 1 {
+			lc.SetReadDeadline(time.Time{})
+			break
+		}
+
+		// Reject
+		astilog.Errorf("astibrain: rejecting tls tunnel connection from %s without a valid token", lc.RemoteAddr())
+		lc.Close()
+	}
+	defer lc.Close()
+
+	// Create dialer
+	c := ws.tlsConfig.Clone()
+	if len(c.ServerName) == 0 {
+		c.ServerName = serverName
+	}
+	d := &tls.Dialer{
+		Config:    c,
+		NetDialer: &net.Dialer{Timeout: 10 * time.Second},
+	}
+
+	// Dial
+	rc, err := d.Dial("tcp", addr)
+	if err != nil {
+		astilog.Error(errors.Wrapf(err, "astibrain: dialing %s over tls failed", addr))
+		return
+	}
+	defer rc.Close()
+
+	// Forward handshake request
+	r.Header.Del(tlsTunnelTokenHeader)
+	if err = r.Write(rc); err != nil {
+		astilog.Error(errors.Wrapf(err, "astibrain: writing handshake request to %s failed", addr))
+		return
+	}
+
+	// Forward
+	// Both connections are closed as soon as one of them is done. Bytes already buffered while reading the handshake
+	// request are forwarded first.
+	var chanDone = make(chan struct{}, 2)
+	go func() {
+		io.Copy(rc, br)
+		chanDone <- struct{}{}
+	}()
+	go func() {
+		io.Copy(lc, rc)
+		chanDone <- struct{}{}
+	}()
+	<-chanDone
+}
@@ -0,0 +1,54 @@
+package astibrain
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardTLSRequiresToken(t *testing.T) {
+	// Server fails requests still holding the token
+	s := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get(tlsTunnelTokenHeader)) > 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer s.Close()
+	ws := &websocket{tlsConfig: &tls.Config{InsecureSkipVerify: true}}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go ws.forwardTLS(l, strings.TrimPrefix(s.URL, "https://"), "127.0.0.1", "token")
+	do := func(token string) (*http.Response, error) {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		r, _ := http.NewRequest(http.MethodGet, "http://"+l.Addr().String(), nil)
+		if len(token) > 0 {
+			r.Header.Set(tlsTunnelTokenHeader, token)
+		}
+		if err = r.Write(c); err != nil {
+			return nil, err
+		}
+		return http.ReadResponse(bufio.NewReader(c), r)
+	}
+
+	// Connections without a valid token are rejected
+	_, err = do("")
+	assert.Error(t, err)
+	_, err = do("invalid")
+	assert.Error(t, err)
+
+	// Connection holding the token is forwarded without it
+	resp, err := do("token")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,117 @@
+package astibrain
+
+import (
+	"github.com/asticode/go-astilog"
+)
+
+// requestToggle records the state requested by Bob and applies it once no other request has been received for the
+// debounce window, so that rapid toggles don't thrash the ability.
+// Its execution must not be blocking as it's used in a websocket call.
+func (a *ability) requestToggle(on bool) {
+	// Lock
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// Request is redundant
+	if a.toggleTimer == nil && !a.togglePendingUnsafe && !a.toggleOffUnsafe && on == a.isOnUnsafe && !a.isStoppingUnsafe && a.restartTimer == nil && !a.wantsLeaseUnsafe {
+		astilog.Debugf("astibrain: ignoring redundant toggle of %s", a.name)
+		return
+	}
+
+	// Record request
+	a.toggleOnUnsafe = on
+	if !on {
+		a.toggleOffUnsafe = true
+	}
+
+	// Debounce
+	if a.toggleTimer != nil {
+		a.toggleTimer.Stop()
+		a.toggleTimer = nil
+	}
+	if a.c.ToggleDebounce > 0 {
+		a.toggleTimer = a.clock.AfterFunc(a.c.ToggleDebounce, a.queueToggle)
+		return
+	}
+	a.queueToggleUnsafe()
+}
+
+// queueToggle queues the application of the last requested state once the debounce window is over
+func (a *ability) queueToggle() {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.toggleTimer = nil
+	a.queueToggleUnsafe()
+}
+
+// queueToggleUnsafe queues the application of the last requested state.
+// Toggles are applied in order by a single worker which is started if it's not running already and exits once
+// there's nothing left to apply.
+func (a *ability) queueToggleUnsafe() {
+	a.togglePendingUnsafe = true
+	if a.isTogglingUnsafe {
+		return
+	}
+	a.isTogglingUnsafe = true
+	go a.toggleWorker()
+}
+
+// toggleWorker applies queued toggles until there's none left
+func (a *ability) toggleWorker() {
+	for {
+		// Nothing left to apply
+		a.m.Lock()
+		if !a.togglePendingUnsafe {
+			a.isTogglingUnsafe = false
+			a.m.Unlock()
+			return
+		}
+		a.togglePendingUnsafe = false
+		a.m.Unlock()
+
+		// Apply
+		a.applyToggle()
+	}
+}
+
+// applyToggle applies the last requested state.
+// It's only called by the toggle worker so that toggles are serialized. A quick off followed by on is coalesced into
+// a single clean restart: the ability is switched back on only once it's really off.
+func (a *ability) applyToggle() {
+	// Get requested state
+	a.m.Lock()
+	on, wasOff := a.toggleOnUnsafe, a.toggleOffUnsafe
+	a.toggleOffUnsafe = false
+	a.m.Unlock()
+
+	// Switch off
+	if !on {
+		a.off()
+		return
+	}
+
+	// Restart
+	if wasOff && a.isOn() {
+		astilog.Debugf("astibrain: restarting %s", a.name)
+		a.off()
+	}
+
+	// Wait for the ability to be really off
+	a.m.Lock()
+	isStopping, chanStopped := a.isStoppingUnsafe, a.chanStopped
+	a.m.Unlock()
+	if isStopping {
+		<-chanStopped
+
+		// Another request has been received in the meantime
+		a.m.Lock()
+		pending := a.toggleTimer != nil || a.toggleOffUnsafe || a.togglePendingUnsafe
+		a.m.Unlock()
+		if pending {
+			return
+		}
+	}
+
+	// Switch on
+	a.on()
+}
@@ -0,0 +1,90 @@
+package astibrain
+
+import (
+	"context"
+)
+
+// Span names
+const (
+	spanNameAbilityRun = "astibrain.ability.run"
+)
+
+// Tracer represents an object capable of starting spans.
+// Its method set mirrors OpenTelemetry's so that an OpenTelemetry tracer can be plugged in with a thin adapter.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span represents a span
+// TraceID is the hex encoded id of the trace the span belongs to.
+type Span interface {
+	End()
+	TraceID() string
+}
+
+// ErrorRecorder represents a span capable of recording an error.
+// It mirrors OpenTelemetry's RecordError. Spans not implementing it are ended without the error.
+type ErrorRecorder interface {
+	RecordError(err error)
+}
+
+// endSpanWithError records the error on the span, if it supports it, and ends it
+func endSpanWithError(s Span, err error) {
+	if v, ok := s.(ErrorRecorder); ok && err != nil {
+		v.RecordError(err)
+	}
+	s.End()
+}
+
+// contextKeySpan is the context key of the span
+type contextKeySpan struct{}
+
+// contextKeyTracer is the context key of the tracer
+type contextKeyTracer struct{}
+
+// noopSpan is the span returned when no tracer is configured
+type noopSpan struct{}
+
+// End implements the Span interface
+func (noopSpan) End() {}
+
+// TraceID implements the Span interface
+func (noopSpan) TraceID() string { return "" }
+
+// StartSpan starts a span with the tracer carried by the context.
+// Runnable abilities receive a context carrying the tracer and a root span per run. If the context doesn't carry any
+// tracer, it's a no-op and the returned span does nothing.
+func StartSpan(ctx context.Context, spanName string) (context.Context, Span) {
+	t, ok := ctx.Value(contextKeyTracer{}).(Tracer)
+	if !ok {
+		return ctx, noopSpan{}
+	}
+	return startSpan(ctx, t, spanName)
+}
+
+// SpanFromContext returns the span carried by the context.
+// If the context doesn't carry any span, the returned span does nothing.
+func SpanFromContext(ctx context.Context) Span {
+	if s, ok := ctx.Value(contextKeySpan{}).(Span); ok {
+		return s
+	}
+	return noopSpan{}
+}
+
+// TraceIDFromContext returns the trace id of the span carried by the context or an empty string if there's none
+func TraceIDFromContext(ctx context.Context) string {
+	return SpanFromContext(ctx).TraceID()
+}
+
+// startSpan starts a span with the tracer and returns a context carrying both.
+// It's a no-op if the tracer is nil.
+func startSpan(ctx context.Context, t Tracer, spanName string) (context.Context, Span) {
+	// No tracer
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+
+	// Start span
+	ctx, s := t.Start(context.WithValue(ctx, contextKeyTracer{}, t), spanName)
+	return context.WithValue(ctx, contextKeySpan{}, s), s
+}
@@ -0,0 +1,54 @@
+package astibrain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartSpan(t *testing.T) {
+	// Without tracer, spans do nothing
+	ctx, s := StartSpan(context.Background(), "test")
+	assert.Equal(t, noopSpan{}, s)
+	assert.Equal(t, noopSpan{}, SpanFromContext(ctx))
+	assert.Equal(t, "", TraceIDFromContext(ctx))
+	ctx, s = startSpan(context.Background(), nil, "test")
+	assert.Equal(t, noopSpan{}, s)
+	assert.Equal(t, "", TraceIDFromContext(ctx))
+
+	// Root span is carried by the context along with its tracer
+	tr := &testTracer{}
+	ctx, s = startSpan(context.Background(), tr, "root")
+	assert.Equal(t, s, SpanFromContext(ctx))
+	assert.Equal(t, "test", TraceIDFromContext(ctx))
+
+	// Child spans are started with the tracer carried by the context
+	cctx, cs := StartSpan(ctx, "child")
+	assert.Equal(t, cs, SpanFromContext(cctx))
+	assert.Equal(t, s, SpanFromContext(ctx))
+	ss := tr.spans()
+	assert.Len(t, ss, 2)
+	assert.Equal(t, "root", ss[0].name)
+	assert.Equal(t, "child", ss[1].name)
+}
+
+func TestEndSpanWithError(t *testing.T) {
+	// Error is recorded
+	s := &testSpan{}
+	endSpanWithError(s, errors.New("test"))
+	ended, err := s.state()
+	assert.True(t, ended)
+	assert.EqualError(t, err, "test")
+
+	// No error
+	s = &testSpan{}
+	endSpanWithError(s, nil)
+	ended, err = s.state()
+	assert.True(t, ended)
+	assert.NoError(t, err)
+
+	// Spans not recording errors are ended anyway
+	endSpanWithError(noopSpan{}, errors.New("test"))
+}
@@ -2,10 +2,14 @@ package astibrain
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,65 +19,420 @@ import (
 	"github.com/pkg/errors"
 )
 
+// WebsocketEventName represents a websocket event name
+type WebsocketEventName string
+
 // Websocket event names
+// They are reserved and can't be dispatched by abilities, see IsReservedWebsocketEventName
+const (
+	WebsocketEventNameAbilitiesDescribed      WebsocketEventName = "abilities.described"
+	WebsocketEventNameAbilityCrashed          WebsocketEventName = "ability.crashed"
+	WebsocketEventNameAbilityDependencyLost   WebsocketEventName = "ability.dependency.lost"
+	WebsocketEventNameAbilityForgotten        WebsocketEventName = "ability.forgotten"
+	WebsocketEventNameAbilityInitFailed       WebsocketEventName = "ability.init.failed"
+	WebsocketEventNameAbilityLearned          WebsocketEventName = "ability.learned"
+	WebsocketEventNameAbilityLeaseAcquire     WebsocketEventName = "ability.lease.acquire"
+	WebsocketEventNameAbilityLeaseAcquired    WebsocketEventName = "ability.lease.acquired"
+	WebsocketEventNameAbilityLeaseLost        WebsocketEventName = "ability.lease.lost"
+	WebsocketEventNameAbilityLeaseRelease     WebsocketEventName = "ability.lease.release"
+	WebsocketEventNameAbilityPause            WebsocketEventName = "ability.pause"
+	WebsocketEventNameAbilityPaused           WebsocketEventName = "ability.paused"
+	WebsocketEventNameAbilityReconfigure      WebsocketEventName = "ability.reconfigure"
+	WebsocketEventNameAbilityReconfigured     WebsocketEventName = "ability.reconfigured"
+	WebsocketEventNameAbilityRestarting       WebsocketEventName = "ability.restarting"
+	WebsocketEventNameAbilityState            WebsocketEventName = "ability.state"
+	WebsocketEventNameAbilityResume           WebsocketEventName = "ability.resume"
+	WebsocketEventNameAbilityResourceExceeded WebsocketEventName = "ability.resource.exceeded"
+	WebsocketEventNameAbilityResumed          WebsocketEventName = "ability.resumed"
+	WebsocketEventNameAbilityStart            WebsocketEventName = "ability.start"
+	WebsocketEventNameAbilityStarted          WebsocketEventName = "ability.started"
+	WebsocketEventNameAbilityStop             WebsocketEventName = "ability.stop"
+	WebsocketEventNameAbilityStopped          WebsocketEventName = "ability.stopped"
+	WebsocketEventNameAbilityTimedOut         WebsocketEventName = "ability.timed.out"
+	WebsocketEventNameAbilityUnhealthy        WebsocketEventName = "ability.unhealthy"
+	WebsocketEventNameBrainHeartbeat          WebsocketEventName = "brain.heartbeat"
+	WebsocketEventNameBrainReady              WebsocketEventName = "brain.ready"
+	WebsocketEventNameBrainStartupProgress    WebsocketEventName = "brain.startup.progress"
+	WebsocketEventNameMessagesDropped         WebsocketEventName = "messages.dropped"
+	WebsocketEventNamePing                    WebsocketEventName = "ping"
+	WebsocketEventNamePong                    WebsocketEventName = "pong"
+	WebsocketEventNameRegister                WebsocketEventName = "register"
+	WebsocketEventNameRegistered              WebsocketEventName = "registered"
+	WebsocketEventNameRelaySubscribe          WebsocketEventName = "relay.subscribe"
+	WebsocketEventNameRelayUnsubscribe        WebsocketEventName = "relay.unsubscribe"
+	WebsocketEventNameStateResync             WebsocketEventName = "state.resync"
+	WebsocketEventNameStateSnapshot           WebsocketEventName = "state.snapshot"
+)
+
+// reservedWebsocketEventNames are the websocket event names used internally.
+// Abilities can't dispatch events with those names.
+var reservedWebsocketEventNames = map[WebsocketEventName]bool{
+	WebsocketEventNameAbilitiesDescribed:      true,
+	WebsocketEventNameAbilityCrashed:          true,
+	WebsocketEventNameAbilityDependencyLost:   true,
+	WebsocketEventNameAbilityForgotten:        true,
+	WebsocketEventNameAbilityInitFailed:       true,
+	WebsocketEventNameAbilityLearned:          true,
+	WebsocketEventNameAbilityLeaseAcquire:     true,
+	WebsocketEventNameAbilityLeaseAcquired:    true,
+	WebsocketEventNameAbilityLeaseLost:        true,
+	WebsocketEventNameAbilityLeaseRelease:     true,
+	WebsocketEventNameAbilityPause:            true,
+	WebsocketEventNameAbilityPaused:           true,
+	WebsocketEventNameAbilityReconfigure:      true,
+	WebsocketEventNameAbilityReconfigured:     true,
+	WebsocketEventNameAbilityRestarting:       true,
+	WebsocketEventNameAbilityState:            true,
+	WebsocketEventNameAbilityResume:           true,
+	WebsocketEventNameAbilityResourceExceeded: true,
+	WebsocketEventNameAbilityResumed:          true,
+	WebsocketEventNameAbilityStart:            true,
+	WebsocketEventNameAbilityStarted:          true,
+	WebsocketEventNameAbilityStop:             true,
+	WebsocketEventNameAbilityStopped:          true,
+	WebsocketEventNameAbilityTimedOut:         true,
+	WebsocketEventNameAbilityUnhealthy:        true,
+	WebsocketEventNameBrainHeartbeat:          true,
+	WebsocketEventNameBrainReady:              true,
+	WebsocketEventNameBrainStartupProgress:    true,
+	WebsocketEventNameMessagesDropped:         true,
+	WebsocketEventNamePing:                    true,
+	WebsocketEventNamePong:                    true,
+	WebsocketEventNameRegister:                true,
+	WebsocketEventNameRegistered:              true,
+	WebsocketEventNameRelaySubscribe:          true,
+	WebsocketEventNameRelayUnsubscribe:        true,
+	WebsocketEventNameStateResync:             true,
+	WebsocketEventNameStateSnapshot:           true,
+}
+
+// IsReservedWebsocketEventName checks whether the websocket event name is used internally
+func IsReservedWebsocketEventName(eventName WebsocketEventName) bool {
+	return reservedWebsocketEventNames[eventName]
+}
+
+// registeredWebsocketEventNames is the registry of websocket event names that are neither reserved nor ability event
+// names but are still known
+var registeredWebsocketEventNames = struct {
+	m sync.Mutex // Locks s
+	s map[WebsocketEventName]bool
+}{s: make(map[WebsocketEventName]bool)}
+
+// RegisterWebsocketEventName registers a websocket event name so that it's considered as known, see
+// WebsocketConfiguration.WarnUnknownEventNames
+func RegisterWebsocketEventName(eventName WebsocketEventName) {
+	registeredWebsocketEventNames.m.Lock()
+	defer registeredWebsocketEventNames.m.Unlock()
+	registeredWebsocketEventNames.s[eventName] = true
+}
+
+// isRegisteredWebsocketEventName checks whether the websocket event name has been registered
+func isRegisteredWebsocketEventName(eventName WebsocketEventName) bool {
+	registeredWebsocketEventNames.m.Lock()
+	defer registeredWebsocketEventNames.m.Unlock()
+	return registeredWebsocketEventNames.s[eventName]
+}
+
+// isKnownEventName checks whether the websocket event name is reserved, has been registered or is the event name of a
+// learned ability, see WebsocketAbilityEventName
+func (ws *websocket) isKnownEventName(eventName WebsocketEventName) (ok bool) {
+	// Reserved or registered
+	if reservedWebsocketEventNames[eventName] || isRegisteredWebsocketEventName(eventName) {
+		return true
+	}
+
+	// Not an ability event name
+	n := string(eventName)
+	if !strings.HasPrefix(n, websocketAbilityEventNamePrefix) {
+		return false
+	}
+	n = strings.TrimPrefix(n, websocketAbilityEventNamePrefix)
+
+	// Loop through abilities
+	ws.abilities.abilities(func(a *ability) error {
+		if strings.HasPrefix(n, a.name+".") && len(n) > len(a.name)+1 {
+			ok = true
+		}
+		return nil
+	})
+	return
+}
+
+// Queue policies
 const (
-	WebsocketEventNameAbilityCrashed = "ability.crashed"
-	WebsocketEventNameAbilityStart   = "ability.start"
-	WebsocketEventNameAbilityStarted = "ability.started"
-	WebsocketEventNameAbilityStop    = "ability.stop"
-	WebsocketEventNameAbilityStopped = "ability.stopped"
-	WebsocketEventNameRegister       = "register"
-	WebsocketEventNameRegistered     = "registered"
+	// QueuePolicyBlock blocks the sender until there's room in the queue
+	QueuePolicyBlock = "block"
+	// QueuePolicyDropNewest drops the message being sent
+	QueuePolicyDropNewest = "drop.newest"
+	// QueuePolicyDropOldest drops the oldest queued message
+	QueuePolicyDropOldest = "drop.oldest"
 )
 
 // websocket represents a websocket wrapper
 type websocket struct {
-	abilities   *abilities
-	c           *astiws.Client
-	cfg         WebsocketConfiguration
-	isConnected bool
-	h           http.Header
-	m           sync.Mutex
-	q           []astiws.BodyMessage
+	abilities          *abilities
+	audit              *auditLog
+	c                  *astiws.Client
+	cfg                WebsocketConfiguration
+	clock              Clock
+	closed             bool
+	cond               *sync.Cond // Broadcast whenever closed, connectionID, isConnected or q change
+	connectionID       int
+	dropped            int
+	droppedNoticeAt    time.Time
+	droppedSinceNotice int
+	handlerID          int
+	handlers           map[WebsocketEventName][]websocketHandler
+	hm                 sync.Mutex // Locks handlerID and handlers
+	isConnected        bool
+	isReadyFunc        func() bool
+	h                  http.Header
+	lastPongAt         time.Time
+	m                  sync.Mutex // Locks closed, connectionID, dropped, droppedNoticeAt, droppedSinceNotice, isConnected, lastPongAt, peerVersions, q and relays
+	peerVersions       map[string]int
+	q                  []websocketMessage
+	relays             map[APIRelay]bool
+	tlsConfig          *tls.Config
 }
 
 // WebsocketConfiguration is a websocket configuration
+// CAFile is the path to the CA certs used to verify Bob's cert when the URL is a wss:// URL. If empty, the system roots
+// are used. InsecureSkipVerify disables the verification, which should only be used for self-signed setups.
+// TLSConfig can be used instead or on top of them.
+// If Envelope is true, events are wrapped in versioned envelopes, see Envelope. Bob must know the envelope format.
+// PingInterval enables keepalive pings when > 0. The connection is closed if no pong is received within PongTimeout.
+// DroppedNoticeInterval is the min duration between two messages dropped events sent to Bob. If 0, no event is sent.
+// MaxMessageSize is the max size in bytes of websocket messages, samples included. The connection is closed with the
+// 1009 (message too big) close code once an incoming message exceeds it, in which case the brain reconnects. Outgoing
+// messages exceeding it are dropped and logged. It overrides Client.MaxMessageSize if > 0. If 0, messages are not
+// limited.
+// If WarnUnknownEventNames is true, which is meant for development, a warning is logged whenever an event whose name is
+// neither reserved, registered with RegisterWebsocketEventName nor the event name of a learned ability is sent.
+// QueuePolicy is the policy applied once the queue is full, see the QueuePolicy constants. Default is QueuePolicyDropOldest.
+// Messages that couldn't be written are put back at the head of the queue without waiting, even with
+// QueuePolicyBlock.
+// QueueSize is the max number of messages waiting to be sent, either because the websocket is disconnected or because
+// Bob is slower than the brain.
+// ReconnectJitterFactor, between 0 and 1, randomizes the reconnection backoff so that brains don't all reconnect at
+// the same time once Bob restarts: each backoff is picked randomly between (1 - ReconnectJitterFactor) * backoff and
+// backoff, which means it never exceeds ReconnectMaxBackoff. 1 means full jitter. If 0, there's no jitter.
 type WebsocketConfiguration struct {
-	Client   astiws.ClientConfiguration `toml:"client"`
-	Password string                     `toml:"password"`
-	URL      string                     `toml:"url"`
-	Username string                     `toml:"username"`
+	CAFile                  string                     `toml:"ca_file"`
+	Client                  astiws.ClientConfiguration `toml:"client"`
+	DroppedNoticeInterval   time.Duration              `toml:"dropped_notice_interval"`
+	Envelope                bool                       `toml:"envelope"`
+	InsecureSkipVerify      bool                       `toml:"insecure_skip_verify"`
+	MaxMessageSize          int                        `toml:"max_message_size"`
+	Password                string                     `toml:"password"`
+	PingInterval            time.Duration              `toml:"ping_interval"`
+	PongTimeout             time.Duration              `toml:"pong_timeout"`
+	QueuePolicy             string                     `toml:"queue_policy"`
+	QueueSize               int                        `toml:"queue_size"`
+	ReconnectInitialBackoff time.Duration              `toml:"reconnect_initial_backoff"`
+	ReconnectJitterFactor   float64                    `toml:"reconnect_jitter_factor"`
+	ReconnectMaxBackoff     time.Duration              `toml:"reconnect_max_backoff"`
+	TLSConfig               *tls.Config                `toml:"-"`
+	Token                   string                     `toml:"token"`
+	URL                     string                     `toml:"url"`
+	Username                string                     `toml:"username"`
+	WarnUnknownEventNames   bool                       `toml:"warn_unknown_event_names"`
 }
 
 // newWebsocket creates a new websocket wrapper
 func newWebsocket(abilities *abilities, c WebsocketConfiguration) (ws *websocket) {
+	// Limit incoming messages
+	if c.MaxMessageSize > 0 {
+		c.Client.MaxMessageSize = c.MaxMessageSize
+	}
+
 	// Create websocket
 	ws = &websocket{
 		abilities: abilities,
 		c:         astiws.NewClient(c.Client),
 		cfg:       c,
+		clock:     RealClock{},
 		h:         make(http.Header),
+		handlers:  make(map[WebsocketEventName][]websocketHandler),
+		relays:    make(map[APIRelay]bool),
+	}
+	ws.cond = sync.NewCond(&ws.m)
+
+	// Default configuration values
+	if ws.cfg.PingInterval > 0 && ws.cfg.PongTimeout <= 0 {
+		ws.cfg.PongTimeout = 3 * ws.cfg.PingInterval
+	}
+	if ws.cfg.QueueSize <= 0 {
+		ws.cfg.QueueSize = 1000
+	}
+	if ws.cfg.ReconnectInitialBackoff == 0 {
+		ws.cfg.ReconnectInitialBackoff = time.Second
+	}
+	if ws.cfg.ReconnectMaxBackoff == 0 {
+		ws.cfg.ReconnectMaxBackoff = time.Minute
+	}
+	if ws.cfg.ReconnectJitterFactor < 0 {
+		ws.cfg.ReconnectJitterFactor = 0
+	} else if ws.cfg.ReconnectJitterFactor > 1 {
+		ws.cfg.ReconnectJitterFactor = 1
 	}
 
 	// Set headers
-	if len(ws.cfg.Username) > 0 && len(ws.cfg.Password) > 0 {
+	// The token is only sent in the handshake and takes precedence over basic auth
+	if len(ws.cfg.Token) > 0 {
+		ws.h.Set("Authorization", "Bearer "+ws.cfg.Token)
+	} else if len(ws.cfg.Username) > 0 && len(ws.cfg.Password) > 0 {
 		ws.h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(ws.cfg.Username+":"+ws.cfg.Password)))
 	}
 
+	// The envelope header is only sent if envelopes are enabled so that older versions of Bob still work
+	if ws.cfg.Envelope {
+		ws.h.Set(WebsocketHeaderEnvelope, WebsocketEnvelopeFormatVersion)
+	}
+
 	// Add default listeners
-	ws.c.AddListener(WebsocketEventNameAbilityStart, ws.handleAbilityToggle)
-	ws.c.AddListener(WebsocketEventNameAbilityStop, ws.handleAbilityToggle)
-	ws.c.AddListener(WebsocketEventNameRegistered, ws.handleRegistered)
+	ws.addListener(WebsocketEventNameAbilityLeaseAcquired, ws.handleAbilityLease)
+	ws.addListener(WebsocketEventNameAbilityLeaseLost, ws.handleAbilityLease)
+	ws.addListener(WebsocketEventNameAbilityPause, ws.handleAbilityToggle)
+	ws.addListener(WebsocketEventNameAbilityReconfigure, ws.handleAbilityReconfigure)
+	ws.addListener(WebsocketEventNameAbilityResume, ws.handleAbilityToggle)
+	ws.addListener(WebsocketEventNameAbilityStart, ws.handleAbilityToggle)
+	ws.addListener(WebsocketEventNameAbilityStop, ws.handleAbilityToggle)
+	ws.addListener(WebsocketEventNamePong, ws.handlePong)
+	ws.addListener(WebsocketEventNameRegistered, ws.handleRegistered)
+	ws.addListener(WebsocketEventNameStateResync, ws.handleStateResync)
 	return
 }
 
+// addListener adds a listener that receives payloads unwrapped from their envelope
+// Audited events are added to the audit log before being handled.
+func (ws *websocket) addListener(eventName WebsocketEventName, l astiws.ListenerFunc) {
+	if isAudited(eventName) {
+		fn := l
+		l = func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			ws.audit.add(WebsocketEventName(eventName), payload)
+			return fn(c, eventName, payload)
+		}
+	}
+	if ws.cfg.Envelope {
+		l = UnwrapWebsocketListener(l)
+	}
+	ws.c.AddListener(string(eventName), l)
+}
+
+// websocketHandler represents a listener that can be removed on its own, see addHandler
+type websocketHandler struct {
+	id int
+	l  astiws.ListenerFunc
+}
+
+// websocketHandlerID identifies a handler added with addHandler
+type websocketHandlerID struct {
+	eventName WebsocketEventName
+	id        int
+}
+
+// addHandler adds a listener that can be removed on its own with delHandler.
+// astiws can only remove all the listeners of an event at once, therefore the handlers of an event are executed in
+// order by a single listener added the first time a handler is added for that event and never removed.
+func (ws *websocket) addHandler(eventName WebsocketEventName, l astiws.ListenerFunc) websocketHandlerID {
+	// Lock
+	ws.hm.Lock()
+	defer ws.hm.Unlock()
+
+	// Add listener
+	if _, ok := ws.handlers[eventName]; !ok {
+		ws.handlers[eventName] = []websocketHandler{}
+		ws.addListener(eventName, ws.handle)
+	}
+
+	// Add handler
+	ws.handlerID++
+	ws.handlers[eventName] = append(ws.handlers[eventName], websocketHandler{id: ws.handlerID, l: l})
+	return websocketHandlerID{eventName: eventName, id: ws.handlerID}
+}
+
+// delHandler removes a handler added with addHandler
+func (ws *websocket) delHandler(id websocketHandlerID) {
+	// Lock
+	ws.hm.Lock()
+	defer ws.hm.Unlock()
+
+	// Loop through handlers
+	hs := ws.handlers[id.eventName]
+	for idx, h := range hs {
+		if h.id == id.id {
+			ws.handlers[id.eventName] = append(hs[:idx:idx], hs[idx+1:]...)
+			return
+		}
+	}
+}
+
+// handle executes the handlers of an event until one of them fails
+func (ws *websocket) handle(c *astiws.Client, eventName string, payload json.RawMessage) (err error) {
+	// Get handlers
+	// They're copied so that handlers can be added or removed while being executed
+	ws.hm.Lock()
+	hs := append([]websocketHandler{}, ws.handlers[WebsocketEventName(eventName)]...)
+	ws.hm.Unlock()
+
+	// Loop through handlers
+	for _, h := range hs {
+		if err = h.l(c, eventName, payload); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// subscribeRelay asks Bob to relay the output of an ability learned by another brain
+// Subscriptions are sent again when registering so that they survive reconnections.
+func (ws *websocket) subscribeRelay(r APIRelay) {
+	ws.m.Lock()
+	ws.relays[r] = true
+	ws.m.Unlock()
+	ws.send(WebsocketEventNameRelaySubscribe, r)
+}
+
+// unsubscribeRelay asks Bob to stop relaying the output of an ability learned by another brain
+func (ws *websocket) unsubscribeRelay(r APIRelay) {
+	ws.m.Lock()
+	delete(ws.relays, r)
+	ws.m.Unlock()
+	ws.send(WebsocketEventNameRelayUnsubscribe, r)
+}
+
+// encode wraps the payload in an envelope if needed
+func (ws *websocket) encode(eventName WebsocketEventName, payload interface{}) (e interface{}, err error) {
+	// Wrap
+	if ws.cfg.Envelope {
+		ws.m.Lock()
+		vs := ws.peerVersions
+		ws.m.Unlock()
+		if payload, err = newEnvelope(string(eventName), payload, vs, ws.clock.Now()); err != nil {
+			err = errors.Wrapf(err, "astibrain: wrapping %s payload failed", eventName)
+			return
+		}
+	}
+
+	return payload, nil
+}
+
+// websocketAbilityEventNamePrefix is the prefix of websocket ability event names
+const websocketAbilityEventNamePrefix = "ability."
+
 // WebsocketAbilityEventName returns the websocket ability event name
-func WebsocketAbilityEventName(abilityName, eventName string) string {
-	return fmt.Sprintf("ability.%s.%s", abilityName, eventName)
+func WebsocketAbilityEventName(abilityName, eventName string) WebsocketEventName {
+	return WebsocketEventName(fmt.Sprintf("%s%s.%s", websocketAbilityEventNamePrefix, abilityName, eventName))
 }
 
 // Close implements the io.Closer interface
 func (ws *websocket) Close() (err error) {
+	// Update closed attribute so that blocked senders are released
+	ws.m.Lock()
+	ws.closed = true
+	ws.cond.Broadcast()
+	ws.m.Unlock()
+
 	// Close client
 	astilog.Debug("astibrain: closing websocket client")
 	if err = ws.c.Close(); err != nil {
@@ -85,55 +444,206 @@ func (ws *websocket) Close() (err error) {
 
 // dial dials the websocket
 func (ws *websocket) dial(ctx context.Context, name string) {
+	// Brains started at the same time must not share the same jitter
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
 	// Infinite loop to handle reconnect
-	const sleepError = 5 * time.Second
+	var backoff time.Duration
 	for {
+		// Sleep
+		if backoff > 0 {
+			d := jitter(backoff, ws.cfg.ReconnectJitterFactor, r)
+			astilog.Debugf("astibrain: reconnecting websocket in %s", d)
+			select {
+			case <-ctx.Done():
+			case <-ws.clock.After(d):
+			}
+		}
+
 		// Check context error
 		if ctx.Err() != nil {
 			return
 		}
 
+		// Increase backoff
+		if backoff *= 2; backoff == 0 {
+			backoff = ws.cfg.ReconnectInitialBackoff
+		} else if backoff > ws.cfg.ReconnectMaxBackoff {
+			backoff = ws.cfg.ReconnectMaxBackoff
+		}
+
 		// Dial
-		if err := ws.c.DialWithHeaders(ws.cfg.URL, ws.h); err != nil {
+		if err := ws.dialWithHeaders(); err != nil {
 			astilog.Error(errors.Wrap(err, "astibrain: dialing websocket failed"))
-			time.Sleep(sleepError)
 			continue
 		}
 
 		// Register
 		if err := ws.sendRegister(name); err != nil {
 			astilog.Error(errors.Wrap(err, "astibrain: sending register websocket event failed"))
-			time.Sleep(sleepError)
 			continue
 		}
 
+		// Ping
+		ctxPing, cancelPing := context.WithCancel(ctx)
+		if ws.cfg.PingInterval > 0 {
+			go ws.ping(ctxPing)
+		}
+
 		// Read
-		if err := ws.c.Read(); err != nil {
+		start := ws.clock.Now()
+		err := ws.c.Read()
+		cancelPing()
+
+		// Update connected attribute
+		ws.m.Lock()
+		ws.isConnected = false
+		ws.cond.Broadcast()
+		ws.m.Unlock()
+
+		// Log
+		if v, ok := errors.Cause(err).(*gorilla.CloseError); err == nil || (ok && v.Code == gorilla.CloseNormalClosure) {
+			astilog.Info("astibrain: brain has disconnected from bob")
+		} else {
+			astilog.Error(errors.Wrap(err, "astibrain: reading websocket failed"))
+		}
+
+		// Reset backoff if the connection has been up for long enough
+		if ws.clock.Now().Sub(start) >= ws.cfg.ReconnectMaxBackoff {
+			backoff = ws.cfg.ReconnectInitialBackoff
+		}
+	}
+}
+
+// jitter randomizes a backoff between (1 - factor) * backoff and backoff
+func jitter(backoff time.Duration, factor float64, r *rand.Rand) time.Duration {
+	if factor <= 0 {
+		return backoff
+	}
+	return backoff - time.Duration(factor*r.Float64()*float64(backoff))
+}
+
+// ping sends pings periodically and closes the client when the peer has stopped answering
+func (ws *websocket) ping(ctx context.Context) {
+	// Reset last pong
+	ws.m.Lock()
+	ws.lastPongAt = ws.clock.Now()
+	ws.m.Unlock()
+
+	// Create ticker
+	t := ws.clock.NewTicker(ws.cfg.PingInterval)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			// Check last pong
 			ws.m.Lock()
-			ws.isConnected = false
+			d := ws.clock.Now().Sub(ws.lastPongAt)
 			ws.m.Unlock()
-			if v, ok := errors.Cause(err).(*gorilla.CloseError); ok && v.Code == gorilla.CloseNormalClosure {
-				astilog.Info("astibrain: brain has disconnected from bob")
-			} else {
-				astilog.Error(errors.Wrap(err, "astibrain: reading websocket failed"))
+			if d > ws.cfg.PongTimeout {
+				astilog.Errorf("astibrain: no pong received for %s, closing websocket", d)
+				if err := ws.c.Close(); err != nil {
+					astilog.Error(errors.Wrap(err, "astibrain: closing websocket client failed"))
+				}
+				return
 			}
-			time.Sleep(sleepError)
-			continue
+
+			// Write
+			ws.write(WebsocketEventNamePing, nil)
 		}
 	}
 }
 
+// connected returns whether the websocket is connected
+func (ws *websocket) connected() bool {
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	return ws.isConnected
+}
+
+// droppedMessages returns the number of messages that have been dropped because the queue was full
+func (ws *websocket) droppedMessages() int {
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	return ws.dropped
+}
+
 // APIRegister is a register API payload
+// Ready is true if the brain is already ready, see Brain.Ready. Otherwise a brain ready event follows once it is.
+// Versions are the schema versions of the websocket events the brain knows, see WebsocketEventVersions.
 type APIRegister struct {
 	Abilities map[string]APIAbility `json:"abilities"`
 	Name      string                `json:"name"`
+	Ready     bool                  `json:"ready,omitempty"`
+	Relays    []APIRelay            `json:"relays,omitempty"`
+	Versions  map[string]int        `json:"versions,omitempty"`
+}
+
+// APIRelay is a relay subscription API payload
+// It designates the output of an ability learned by another brain that Bob relays to the brain. The event is relayed
+// as WebsocketAbilityEventName(Ability, Port), the ability name being matched in its canonical form.
+type APIRelay struct {
+	Ability string `json:"ability"`
+	Port    string `json:"port"`
+}
+
+// APIRegistered is a registered API payload
+// Versions are the schema versions of the websocket events Bob knows, see WebsocketEventVersions.
+type APIRegistered struct {
+	Versions map[string]int `json:"versions,omitempty"`
+}
+
+// APIAbilityLease is an ability lease API payload
+type APIAbilityLease struct {
+	Duration time.Duration `json:"duration"`
+	Name     string        `json:"name"`
+}
+
+// APIAbilityReconfigure is an ability reconfigure API payload
+// ID is echoed in the ability reconfigured event so that the sender can match it with its request.
+type APIAbilityReconfigure struct {
+	Configuration json.RawMessage `json:"configuration"`
+	ID            string          `json:"id,omitempty"`
+	Name          string          `json:"name"`
+}
+
+// APIAbilityReconfigured is an ability reconfigured API payload
+// Error is set if the configuration has been rejected.
+type APIAbilityReconfigured struct {
+	Error string `json:"error,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+}
+
+// APIMessagesDropped is a messages dropped API payload
+type APIMessagesDropped struct {
+	Count int `json:"count"`
+	Total int `json:"total"`
 }
 
 // APIAbility is an ability API payload
+// Outputs are the names of the ability output ports, see Producer, so that Bob can relay them to other brains.
 type APIAbility struct {
-	IsOn        bool   `json:"is_on"`
-	Description string `json:"description"`
-	Name        string `json:"name"`
+	IsOn        bool     `json:"is_on"`
+	IsPaused    bool     `json:"is_paused"`
+	Description string   `json:"description"`
+	Name        string   `json:"name"`
+	Outputs     []string `json:"outputs,omitempty"`
+}
+
+// newAPIAbility creates a new ability API payload
+func newAPIAbility(a *ability) APIAbility {
+	return APIAbility{
+		Description: a.description,
+		IsOn:        a.isOn(),
+		IsPaused:    a.isPaused(),
+		Name:        a.name,
+		Outputs:     a.outputNames(),
+	}
 }
 
 // sendRegister sends a register event
@@ -142,92 +652,272 @@ func (ws *websocket) sendRegister(name string) (err error) {
 	p := APIRegister{
 		Abilities: make(map[string]APIAbility),
 		Name:      name,
+		Versions:  WebsocketEventVersions(),
+	}
+	if ws.isReadyFunc != nil {
+		p.Ready = ws.isReadyFunc()
 	}
 
 	// Loop through abilities
 	ws.abilities.abilities(func(a *ability) error {
-		p.Abilities[a.name] = APIAbility{
-			Description: a.description,
-			IsOn:        a.isOn(),
-			Name:        a.name,
-		}
+		p.Abilities[a.name] = newAPIAbility(a)
 		return nil
 	})
 
+	// Loop through relays
+	ws.m.Lock()
+	for r := range ws.relays {
+		p.Relays = append(p.Relays, r)
+	}
+	ws.m.Unlock()
+	sort.Slice(p.Relays, func(i, j int) bool {
+		if p.Relays[i].Ability != p.Relays[j].Ability {
+			return p.Relays[i].Ability < p.Relays[j].Ability
+		}
+		return p.Relays[i].Port < p.Relays[j].Port
+	})
+
+	// Encode
+	var e interface{}
+	if e, err = ws.encode(WebsocketEventNameRegister, p); err != nil {
+		err = errors.Wrapf(err, "astibrain: encoding register payload %#v failed", p)
+		return
+	}
+
 	// Write
-	if err = ws.c.Write(WebsocketEventNameRegister, p); err != nil {
+	if err = ws.c.Write(string(WebsocketEventNameRegister), e); err != nil {
 		err = errors.Wrapf(err, "astibrain: sending register event with payload %#v failed", p)
 		return
 	}
 	return
 }
 
-// processQueue processes the queue
-func (ws *websocket) processQueue() {
-	// Lock
-	ws.m.Lock()
-	defer ws.m.Unlock()
+// websocketMessage represents a websocket message waiting to be sent
+type websocketMessage struct {
+	eventName WebsocketEventName
+	payload   interface{}
+}
 
-	// Nothing to do
-	if len(ws.q) == 0 {
-		return
+// enqueue adds a message to the queue while applying the queue policy.
+// Assumption is made that m is locked
+func (ws *websocket) enqueue(eventName WebsocketEventName, payload interface{}) {
+	// Queue is full
+	for len(ws.q) >= ws.cfg.QueueSize {
+		switch ws.cfg.QueuePolicy {
+		case QueuePolicyBlock:
+			// Websocket is closed
+			if ws.closed {
+				ws.drop(1)
+				return
+			}
+
+			// Wait for the queue to be processed
+			ws.cond.Wait()
+		case QueuePolicyDropNewest:
+			ws.drop(1)
+			return
+		default:
+			ws.q = ws.q[1:]
+			ws.drop(1)
+		}
 	}
 
-	// Log
-	astilog.Debugf("astibrain: processing %d queued websocket messages", len(ws.q))
+	// Append
+	ws.q = append(ws.q, websocketMessage{eventName: eventName, payload: payload})
+	ws.cond.Broadcast()
+}
 
-	// Loop through queue
-	for _, m := range ws.q {
-		ws.write(m.EventName, m.Payload)
+// requeue puts a message that couldn't be written back at the head of the queue.
+// It never waits, even with the block policy, since senders may have filled the queue in the meantime: if the queue is
+// full, the newest message is dropped with the drop.newest policy and the requeued message, which is the oldest,
+// is dropped otherwise.
+// Assumption is made that m is locked
+func (ws *websocket) requeue(m websocketMessage) {
+	// Queue is full
+	if len(ws.q) >= ws.cfg.QueueSize {
+		if ws.cfg.QueuePolicy != QueuePolicyDropNewest {
+			ws.drop(1)
+			return
+		}
+		ws.q = ws.q[:len(ws.q)-1]
+		ws.drop(1)
 	}
 
-	// Reset queue
-	ws.q = []astiws.BodyMessage{}
+	// Prepend
+	ws.q = append([]websocketMessage{m}, ws.q...)
+	ws.cond.Broadcast()
 }
 
-// send sends an event and mutes the error (which is still logged)
-func (ws *websocket) send(eventName string, payload interface{}) {
-	// Retrieve connected status
+// drop updates the dropped messages counters and sends a throttled notice.
+// Assumption is made that m is locked
+func (ws *websocket) drop(n int) {
+	// Update counters
+	ws.dropped += n
+	ws.droppedSinceNotice += n
+	astilog.Debugf("astibrain: websocket queue is full, %d message(s) dropped (%d total)", n, ws.dropped)
+
+	// Send notice
+	if ws.cfg.DroppedNoticeInterval > 0 && ws.isConnected && ws.clock.Now().Sub(ws.droppedNoticeAt) >= ws.cfg.DroppedNoticeInterval {
+		p := APIMessagesDropped{Count: ws.droppedSinceNotice, Total: ws.dropped}
+		ws.droppedNoticeAt = ws.clock.Now()
+		ws.droppedSinceNotice = 0
+		go ws.write(WebsocketEventNameMessagesDropped, p)
+	}
+}
+
+// send adds an event to the queue.
+// Queued events are written once the websocket is connected. Lifecycle events are audited no matter what.
+func (ws *websocket) send(eventName WebsocketEventName, payload interface{}) {
+	// Check event name
+	// The event is sent anyway
+	if ws.cfg.WarnUnknownEventNames && !ws.isKnownEventName(eventName) {
+		astilog.Warnf("astibrain: sending unknown websocket event %s, see RegisterWebsocketEventName", eventName)
+	}
+
+	// Send
+	ws.audit.add(eventName, payload)
 	ws.m.Lock()
-	isConnected := ws.isConnected
-	ws.m.Unlock()
+	defer ws.m.Unlock()
+	ws.enqueue(eventName, payload)
+}
 
-	// Websocket is not connected, add message to queue
-	if !isConnected {
+// flush writes queued messages until the websocket is disconnected or a new connection is made
+func (ws *websocket) flush(connectionID int) {
+	for {
+		// Wait for a message
 		ws.m.Lock()
-		ws.q = append(ws.q, astiws.BodyMessage{EventName: eventName, Payload: payload})
+		for ws.isConnected && ws.connectionID == connectionID && len(ws.q) == 0 {
+			ws.cond.Wait()
+		}
+
+		// Websocket is disconnected
+		if !ws.isConnected || ws.connectionID != connectionID {
+			ws.m.Unlock()
+			return
+		}
+
+		// Pop message
+		m := ws.q[0]
+		ws.q = ws.q[1:]
+		ws.cond.Broadcast()
 		ws.m.Unlock()
+
+		// Write
+		if err := ws.write(m.eventName, m.payload); err != nil {
+			// Put message back in the queue so that it's sent once reconnected
+			ws.m.Lock()
+			ws.requeue(m)
+			ws.m.Unlock()
+			return
+		}
+	}
+}
+
+// write writes an event and mutes the error (which is still logged)
+func (ws *websocket) write(eventName WebsocketEventName, payload interface{}) (err error) {
+	// Encode
+	// The message is dropped since it could never be encoded
+	e, errEncode := ws.encode(eventName, payload)
+	if errEncode != nil {
+		astilog.Error(errors.Wrapf(errEncode, "astibrain: encoding %s websocket event payload %#v failed", eventName, payload))
+		return
+	}
+
+	// Check size
+	// The message is dropped since it could never be sent
+	if errSize := CheckWebsocketMessageSize(string(eventName), e, ws.cfg.MaxMessageSize); errSize != nil {
+		astilog.Error(errors.Wrapf(errSize, "astibrain: checking %s websocket event size failed", eventName))
 		return
 	}
 
 	// Write
-	ws.write(eventName, payload)
+	// astiws only deals with untyped event names
+	if err = ws.c.Write(string(eventName), e); err != nil {
+		astilog.Error(errors.Wrapf(err, "astibrain: sending %s websocket event with payload %#v failed", eventName, payload))
+	}
+	return
 }
 
-// write writes an event and mutes the error (which is still logged)
-func (ws *websocket) write(eventName string, payload interface{}) {
-	if err := ws.c.Write(eventName, payload); err != nil {
-		astilog.Error(errors.Wrapf(err, "astibrain: sending %s websocket event with payload %#v failed", eventName, payload))
+// ErrMessageTooBig is the cause of the error returned when a websocket message exceeds the max message size
+var ErrMessageTooBig = errors.New("astibrain: message too big")
+
+// CheckWebsocketMessageSize returns an error whose cause is ErrMessageTooBig if the websocket message made of the event
+// name and the encoded payload exceeds max bytes.
+// It's a no-op if max is <= 0.
+func CheckWebsocketMessageSize(eventName string, payload interface{}, max int) (err error) {
+	// No limit
+	if max <= 0 {
+		return
+	}
+
+	// Marshal
+	var b []byte
+	if b, err = json.Marshal(astiws.BodyMessage{EventName: eventName, Payload: payload}); err != nil {
+		err = errors.Wrapf(err, "astibrain: json marshaling %s message failed", eventName)
+		return
+	}
+
+	// Check size
+	if len(b) > max {
+		err = errors.Wrapf(ErrMessageTooBig, "astibrain: %s message of %d bytes exceeds %d bytes", eventName, len(b), max)
+		return
 	}
+	return
 }
 
 // handleRegistered handles the registered websocket event
 func (ws *websocket) handleRegistered(c *astiws.Client, eventName string, payload json.RawMessage) error {
-	// Process queued message
-	ws.processQueue()
+	// Unmarshal payload
+	// Older versions of Bob don't send any payload
+	var p APIRegistered
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibrain: json unmarshaling %s payload %s failed", eventName, payload))
+		}
+	}
 
-	// Update connected attribute
+	// Lock
 	ws.m.Lock()
+
+	// Update peer versions
+	ws.peerVersions = p.Versions
+
+	// Log
+	if len(ws.q) > 0 {
+		astilog.Debugf("astibrain: processing %d queued websocket messages", len(ws.q))
+	}
+
+	// Update connected attribute
+	ws.connectionID++
 	ws.isConnected = true
+	ws.cond.Broadcast()
+
+	// Flush queue
+	go ws.flush(ws.connectionID)
+
+	// Unlock
 	ws.m.Unlock()
 
 	// Log
 	astilog.Info("astibrain: brain has connected to bob")
+
+	// Let Bob know what abilities can do
+	// It's only sent once the queue is being flushed so that a full queue with a blocking policy can't block the read
+	// loop
+	ws.sendAbilitiesDescribed()
 	return nil
 }
 
-// handleAbilityToggle handles the ability toggle websocket events
-func (ws *websocket) handleAbilityToggle(c *astiws.Client, eventName string, payload json.RawMessage) error {
+// handlePong handles the pong websocket event
+func (ws *websocket) handlePong(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	ws.lastPongAt = ws.clock.Now()
+	return nil
+}
+
+// handleAbilityLease handles the ability lease websocket events
+func (ws *websocket) handleAbilityLease(c *astiws.Client, eventName string, payload json.RawMessage) error {
 	// Decode payload
 	var name string
 	if err := json.Unmarshal(payload, &name); err != nil {
@@ -242,11 +932,72 @@ func (ws *websocket) handleAbilityToggle(c *astiws.Client, eventName string, pay
 		return nil
 	}
 
-	// Either start or stop the ability
-	if eventName == WebsocketEventNameAbilityStart {
-		a.on()
+	// Process lease
+	if WebsocketEventName(eventName) == WebsocketEventNameAbilityLeaseAcquired {
+		a.leaseAcquired()
 	} else {
-		a.off()
+		a.leaseLost()
+	}
+	return nil
+}
+
+// handleAbilityReconfigure handles the ability reconfigure websocket event
+func (ws *websocket) handleAbilityReconfigure(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	// Decode payload
+	var p APIAbilityReconfigure
+	if err := json.Unmarshal(payload, &p); err != nil {
+		astilog.Error(errors.Wrapf(err, "astibrain: json unmarshaling %s payload %#v failed", eventName, payload))
+		return nil
+	}
+
+	// Retrieve ability
+	r := APIAbilityReconfigured{ID: p.ID, Name: p.Name}
+	if a, ok := ws.abilities.ability(p.Name); !ok {
+		err := fmt.Errorf("astibrain: unknown ability %s", p.Name)
+		astilog.Error(err)
+		r.Error = err.Error()
+	} else if err := a.reconfigure(p.Configuration); err != nil {
+		// Reconfigure
+		astilog.Error(err)
+		r.Error = err.Error()
 	}
+
+	// Let Bob know
+	ws.send(WebsocketEventNameAbilityReconfigured, r)
+	return nil
+}
+
+// handleAbilityToggle handles the ability toggle websocket events
+func (ws *websocket) handleAbilityToggle(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	toggleAbility(ws.abilities, eventName, payload)
 	return nil
 }
+
+// toggleAbility toggles the ability whose name is the payload of an ability toggle websocket event
+func toggleAbility(abilities *abilities, eventName string, payload json.RawMessage) {
+	// Decode payload
+	var name string
+	if err := json.Unmarshal(payload, &name); err != nil {
+		astilog.Error(errors.Wrapf(err, "astibrain: json unmarshaling %s payload %#v failed", eventName, payload))
+		return
+	}
+
+	// Retrieve ability
+	a, ok := abilities.ability(name)
+	if !ok {
+		astilog.Error(fmt.Errorf("astibrain: unknown ability %s", name))
+		return
+	}
+
+	// Toggle the ability
+	switch WebsocketEventName(eventName) {
+	case WebsocketEventNameAbilityPause:
+		a.pause()
+	case WebsocketEventNameAbilityResume:
+		a.resume()
+	case WebsocketEventNameAbilityStart:
+		a.requestToggle(true)
+	default:
+		a.requestToggle(false)
+	}
+}
@@ -0,0 +1,139 @@
+package astibrain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/asticode/go-astiws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebsocketRequeue(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		policy   string
+		expected []string
+	}{
+		{name: "block", policy: QueuePolicyBlock, expected: []string{"2", "3"}},
+		{name: "drop oldest", policy: QueuePolicyDropOldest, expected: []string{"2", "3"}},
+		{name: "drop newest", policy: QueuePolicyDropNewest, expected: []string{"1", "2"}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			ws := newWebsocket(newAbilities(), WebsocketConfiguration{QueuePolicy: v.policy, QueueSize: 2})
+
+			// Queue is not full
+			ws.m.Lock()
+			ws.requeue(websocketMessage{eventName: "3"})
+			ws.requeue(websocketMessage{eventName: "2"})
+
+			// Queue is full, requeue must not wait
+			ws.requeue(websocketMessage{eventName: "1"})
+			var ns []string
+			for _, m := range ws.q {
+				ns = append(ns, string(m.eventName))
+			}
+			ws.m.Unlock()
+			assert.Equal(t, v.expected, ns)
+			assert.Equal(t, 1, ws.droppedMessages())
+		})
+	}
+}
+
+func TestWebsocketIsKnownEventName(t *testing.T) {
+	as := newAbilities()
+	as.set(newAbility(newTestAbility(), as, &eventRecorder{}, nil, AbilityConfiguration{}))
+	ws := newWebsocket(as, WebsocketConfiguration{})
+	RegisterWebsocketEventName("test.registered")
+	for _, v := range []struct {
+		eventName WebsocketEventName
+		expected  bool
+	}{
+		{eventName: WebsocketEventNameAbilityStarted, expected: true},
+		{eventName: "test.registered", expected: true},
+		{eventName: WebsocketAbilityEventName("Test", "event"), expected: true},
+		{eventName: "ability.Test.", expected: false},
+		{eventName: WebsocketAbilityEventName("Unknown", "event"), expected: false},
+		{eventName: "ability.startd", expected: false},
+	} {
+		assert.Equal(t, v.expected, ws.isKnownEventName(v.eventName), string(v.eventName))
+	}
+}
+
+func TestWebsocketHandlers(t *testing.T) {
+	// Add handlers
+	ws := newWebsocket(newAbilities(), WebsocketConfiguration{})
+	var calls []string
+	handler := func(name string, err error) astiws.ListenerFunc {
+		return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			calls = append(calls, name+":"+string(payload))
+			return err
+		}
+	}
+	h1 := ws.addHandler("test", handler("1", nil))
+	ws.addHandler("test", handler("2", nil))
+	ws.addHandler("other", handler("3", nil))
+
+	// Handlers are executed in order
+	assert.NoError(t, ws.handle(nil, "test", []byte("a")))
+	assert.Equal(t, []string{"1:a", "2:a"}, calls)
+
+	// Handlers are removed on their own
+	calls = nil
+	ws.delHandler(h1)
+	ws.delHandler(h1)
+	assert.NoError(t, ws.handle(nil, "test", []byte("b")))
+	assert.NoError(t, ws.handle(nil, "other", []byte("b")))
+	assert.Equal(t, []string{"2:b", "3:b"}, calls)
+
+	// Events without handlers are ignored, even once their last handler has been removed
+	calls = nil
+	assert.NoError(t, ws.handle(nil, "unknown", []byte("c")))
+	assert.Len(t, ws.handlers, 2)
+	ws.addHandler("test", handler("4", errors.New("test")))
+	ws.addHandler("test", handler("5", nil))
+	assert.Len(t, ws.handlers, 2)
+
+	// Execution stops at the first error
+	assert.EqualError(t, ws.handle(nil, "test", []byte("d")), "test")
+	assert.Equal(t, []string{"2:d", "4:d"}, calls)
+}
+
+// listenerAbility represents an ability with custom websocket listeners
+type listenerAbility struct {
+	*namedAbility
+	calls *[]string
+}
+
+func (a *listenerAbility) WebsocketListeners() map[string]astiws.ListenerFunc {
+	return map[string]astiws.ListenerFunc{"event": func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		*a.calls = append(*a.calls, a.name)
+		return nil
+	}}
+}
+
+func TestBrainForgetKeepsOtherListeners(t *testing.T) {
+	// Learn a consumer listening to the same event as an ability
+	// The ability is not a producer which means the consumer listens to its event over the websocket
+	b := New(Configuration{})
+	var calls []string
+	assert.NoError(t, b.Learn(&listenerAbility{calls: &calls, namedAbility: newNamedAbility("Listener")}, AbilityConfiguration{}))
+	assert.NoError(t, b.Learn(&listenerAbility{calls: &calls, namedAbility: newNamedAbility("Other")}, AbilityConfiguration{}))
+	in := make(chan string, 1)
+	assert.NoError(t, b.Learn(newConsumerForTest("Consumer", "event", in), AbilityConfiguration{Inputs: map[string]string{"event": "Other.event"}}))
+	assert.NoError(t, b.ws.handle(nil, string(WebsocketAbilityEventName("Other", "event")), []byte(`"test"`)))
+	assert.Equal(t, []string{"Other"}, calls)
+	assert.Equal(t, "test", <-in)
+	calls = nil
+
+	// Forgetting the consumer keeps the listener of the ability
+	assert.NoError(t, b.Forget("Consumer"))
+	assert.NoError(t, b.ws.handle(nil, string(WebsocketAbilityEventName("Other", "event")), []byte(`"test"`)))
+	assert.Equal(t, []string{"Other"}, calls)
+
+	// Forgetting an ability only removes its own listeners
+	assert.NoError(t, b.Forget("Other"))
+	assert.NoError(t, b.ws.handle(nil, string(WebsocketAbilityEventName("Other", "event")), []byte(`"test"`)))
+	assert.NoError(t, b.ws.handle(nil, string(WebsocketAbilityEventName("Listener", "event")), []byte(`"test"`)))
+	assert.Equal(t, []string{"Other", "Listener"}, calls)
+}
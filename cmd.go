@@ -1,10 +1,13 @@
 package astibob
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/asticode/go-astibob/brain"
 	"github.com/pkg/errors"
+	"github.com/rs/xid"
 )
 
 // Cmd represents a cmd
@@ -30,8 +33,82 @@ func (b *Bob) ExecOnBrain(cmd *Cmd, brainName string) (err error) {
 
 	// Write
 	eventName := astibrain.WebsocketAbilityEventName(cmd.AbilityName, cmd.EventName)
-	if err = brn.ws.Write(eventName, cmd.Payload); err != nil {
-		err = errors.Wrapf(err, "astibob: writing event %s with payload %#v failed", eventName, cmd.Payload)
+	if err = brn.write(eventName, cmd.Payload); err != nil {
+		err = errors.Wrapf(err, "astibob: writing event %s to brain %s failed", eventName, brn.name)
+		return
+	}
+	return
+}
+
+// Pause pauses an ability.
+// The ability must implement the astibrain.Pausable interface.
+func (b *Bob) Pause(abilityName string) error {
+	return b.toggle(abilityName, astibrain.WebsocketEventNameAbilityPause)
+}
+
+// Resume resumes an ability
+func (b *Bob) Resume(abilityName string) error {
+	return b.toggle(abilityName, astibrain.WebsocketEventNameAbilityResume)
+}
+
+// Reconfigure reconfigures an ability while it's on.
+// The ability must implement the astibrain.Reconfigurable interface. The configuration is marshaled to JSON and
+// Reconfigure waits for the brain to answer, for the brains server timeout at most, returning the error it has
+// reconfigured the ability with, if any.
+func (b *Bob) Reconfigure(abilityName string, cfg interface{}) (err error) {
+	// Fetch brain
+	var brn *brain
+	cmd := &Cmd{AbilityName: abilityName}
+	if brn, err = b.brainForExec(cmd, ""); err != nil {
+		err = errors.Wrapf(err, "astibob: fetching brain for cmd %+v failed", *cmd)
+		return
+	}
+
+	// Marshal
+	p := astibrain.APIAbilityReconfigure{ID: xid.New().String(), Name: abilityName}
+	if p.Configuration, err = json.Marshal(cfg); err != nil {
+		err = errors.Wrapf(err, "astibob: json marshaling %#v failed", cfg)
+		return
+	}
+
+	// Add pending reconfigure
+	// It's added before writing so that the answer can't be missed
+	ch := brn.addReconfigure(p.ID)
+	defer brn.delReconfigure(p.ID)
+
+	// Write
+	if err = brn.write(astibrain.WebsocketEventNameAbilityReconfigure, p); err != nil {
+		err = errors.Wrapf(err, "astibob: writing event %s to brain %s failed", astibrain.WebsocketEventNameAbilityReconfigure, brn.name)
+		return
+	}
+
+	// Wait for the answer
+	t := time.NewTimer(b.brainsServer.c.Timeout)
+	defer t.Stop()
+	select {
+	case e := <-ch:
+		if len(e) > 0 {
+			err = fmt.Errorf("astibob: reconfiguring ability %s of brain %s failed: %s", abilityName, brn.name, e)
+		}
+	case <-t.C:
+		err = fmt.Errorf("astibob: brain %s has not answered reconfiguring ability %s after %s", brn.name, abilityName, b.brainsServer.c.Timeout)
+	}
+	return
+}
+
+// toggle sends a toggle event to the brain running the ability
+func (b *Bob) toggle(abilityName string, eventName astibrain.WebsocketEventName) (err error) {
+	// Fetch brain
+	var brn *brain
+	cmd := &Cmd{AbilityName: abilityName}
+	if brn, err = b.brainForExec(cmd, ""); err != nil {
+		err = errors.Wrapf(err, "astibob: fetching brain for cmd %+v failed", *cmd)
+		return
+	}
+
+	// Write
+	if err = brn.write(eventName, abilityName); err != nil {
+		err = errors.Wrapf(err, "astibob: writing event %s to brain %s failed", eventName, brn.name)
 		return
 	}
 	return
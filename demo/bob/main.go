@@ -104,6 +104,14 @@ func main() {
 		return nil
 	})
 
+	// Pause speaking while the user is talking
+	understanding.OnSpeech(func(analysisBrainName, audioBrainName string, isSpeaking bool) error {
+		if isSpeaking {
+			return bob.Pause(speaking.Name())
+		}
+		return bob.Resume(speaking.Name())
+	})
+
 	// Run Bob
 	if err = bob.Run(ctx); err != nil {
 		astilog.Fatal(errors.Wrap(err, "main: running bob failed"))
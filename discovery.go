@@ -0,0 +1,41 @@
+package astibob
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/grandcat/zeroconf"
+	"github.com/pkg/errors"
+)
+
+// advertise advertises the brains server through mDNS so that brains can discover it.
+// The advertised port is the one of the brains server public address.
+func (b *Bob) advertise() (s *zeroconf.Server, err error) {
+	// Get options
+	o := astibrain.DiscoveryDefaults(b.c.Discovery)
+
+	// Get port
+	var port int
+	var p string
+	if _, p, err = net.SplitHostPort(b.brainsServer.c.PublicAddr); err != nil {
+		err = errors.Wrapf(err, "astibob: splitting host port of %s failed", b.brainsServer.c.PublicAddr)
+		return
+	}
+	if port, err = strconv.Atoi(p); err != nil {
+		err = errors.Wrapf(err, "astibob: atoi of %s failed", p)
+		return
+	}
+
+	// Register
+	astilog.Debugf("astibob: advertising %s%s on port %d", o.ServiceName, o.Domain, port)
+	if s, err = zeroconf.Register("Bob", o.ServiceName, o.Domain, port, []string{
+		astibrain.DiscoveryTextPath + "=/websocket",
+		astibrain.DiscoveryTextScheme + "=" + b.brainsServer.websocketScheme(),
+	}, nil); err != nil {
+		err = errors.Wrapf(err, "astibob: registering %s%s failed", o.ServiceName, o.Domain)
+		return
+	}
+	return
+}
@@ -1,19 +1,57 @@
 package astibob
 
+import "github.com/asticode/go-astibob/brain"
+
 // Event names
 const (
-	EventNameAbilityStarted    = "ability.started"
-	EventNameAbilityStopped    = "ability.stopped"
-	EventNameBrainDisconnected = "brain.disconnected"
-	EventNameBrainRegistered   = "brain.registered"
-	EventNameReady             = "ready"
+	EventNameAbilitiesDescribed   = "abilities.described"
+	EventNameAbilityForgotten     = "ability.forgotten"
+	EventNameAbilityLearned       = "ability.learned"
+	EventNameAbilityLeaseAcquired = "ability.lease.acquired"
+	EventNameAbilityLeaseLost     = "ability.lease.lost"
+	EventNameAbilityStarted       = "ability.started"
+	EventNameAbilityStopped       = "ability.stopped"
+	EventNameBrainDisconnected    = "brain.disconnected"
+	EventNameBrainHeartbeat       = "brain.heartbeat"
+	EventNameBrainReady           = "brain.ready"
+	EventNameBrainRegistered      = "brain.registered"
+	EventNameBrainStartupProgress = "brain.startup.progress"
+	EventNameReady                = "ready"
 )
 
 // Event represents an event
 type Event struct {
-	Ability *EventAbility
-	Brain   *EventBrain
-	Name    string
+	AbilitiesDescribed *EventAbilitiesDescribed
+	Ability            *EventAbility
+	Brain              *EventBrain
+	BrainReady         *EventBrainReady
+	Heartbeat          *EventHeartbeat
+	Name               string
+	StartupProgress    *EventStartupProgress
+}
+
+// EventAbilitiesDescribed represents an abilities described event.
+type EventAbilitiesDescribed struct {
+	astibrain.APIAbilitiesDescribed
+	BrainName string `json:"brain_name"`
+}
+
+// EventBrainReady represents a brain ready event.
+type EventBrainReady struct {
+	astibrain.APIBrainReady
+	BrainName string `json:"brain_name"`
+}
+
+// EventHeartbeat represents a brain heartbeat event.
+type EventHeartbeat struct {
+	astibrain.APIBrainHeartbeat
+	BrainName string `json:"brain_name"`
+}
+
+// EventStartupProgress represents a brain startup progress event.
+type EventStartupProgress struct {
+	astibrain.APIBrainStartupProgress
+	BrainName string `json:"brain_name"`
 }
 
 // EventBob represents a Bob event.
@@ -35,16 +73,19 @@ func newEventBob(brains *brains) (e EventBob) {
 }
 
 // EventBrain represents a brain event.
+// Ready is true once the brain has resolved its AutoStart abilities.
 type EventBrain struct {
 	Abilities []*EventAbility `json:"abilities,omitempty"`
 	Name      string          `json:"name"`
+	Ready     bool            `json:"ready"`
 }
 
 // newEventBrain creates a new brain event
 func newEventBrain(b *brain) (o *EventBrain) {
 	// Create Event brain
 	o = &EventBrain{
-		Name: b.name,
+		Name:  b.name,
+		Ready: b.ready(),
 	}
 
 	// Loop through abilities
@@ -56,18 +97,22 @@ func newEventBrain(b *brain) (o *EventBrain) {
 }
 
 // EventAbility represents an ability event.
+// Descriptor is set once the brain has described its abilities, see astibrain.Describable.
 type EventAbility struct {
-	BrainName   string `json:"brain_name,omitempty"`
-	Description string `json:"description"`
-	IsOn        bool   `json:"is_on"`
-	Name        string `json:"name"`
-	WebHomepage string `json:"web_homepage,omitempty"`
+	BrainName   string                       `json:"brain_name,omitempty"`
+	Description string                       `json:"description"`
+	Descriptor  *astibrain.AbilityDescriptor `json:"descriptor,omitempty"`
+	IsOn        bool                         `json:"is_on"`
+	Name        string                       `json:"name"`
+	Replay      bool                         `json:"replay,omitempty"`
+	WebHomepage string                       `json:"web_homepage,omitempty"`
 }
 
 // newEventAbility creates a new ability event
 func newEventAbility(a *ability) *EventAbility {
 	return &EventAbility{
 		Description: a.description,
+		Descriptor:  a.descriptor(),
 		IsOn:        a.isOn(),
 		Name:        a.name,
 		WebHomepage: a.webHomepage,
@@ -0,0 +1,192 @@
+package astibob
+
+import (
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+)
+
+// leases represents the leases of singleton abilities.
+// Only one brain can hold the lease of an ability at a time. Other brains asking for it wait in line and the lease is
+// granted to the first of them once it has been released or has expired. Brains only release a lease once their
+// ability is off, therefore a lease held by a brain that disconnects is only granted again once it has expired since
+// the ability may still be running.
+type leases struct {
+	d  *dispatcher
+	ls map[string]*lease // Indexed by ability name
+	m  sync.Mutex        // Locks ls
+}
+
+// lease represents the lease of a singleton ability
+type lease struct {
+	holder       *brain
+	isHolderGone bool // Whether the holder has disconnected without releasing the lease
+	t            *time.Timer
+	waiting      []leaseRequest
+}
+
+// leaseRequest represents a lease request
+type leaseRequest struct {
+	b        *brain
+	duration time.Duration
+}
+
+// newLeases creates new leases
+func newLeases(d *dispatcher) *leases {
+	return &leases{
+		d:  d,
+		ls: make(map[string]*lease),
+	}
+}
+
+// acquire grants or renews the lease if it's available and adds the brain to the waiting line otherwise
+func (ls *leases) acquire(b *brain, abilityName string, duration time.Duration) {
+	// Lock
+	ls.m.Lock()
+	defer ls.m.Unlock()
+
+	// Get lease
+	l, ok := ls.ls[abilityName]
+	if !ok {
+		l = &lease{}
+		ls.ls[abilityName] = l
+	}
+
+	// Process request
+	switch l.holder {
+	case nil:
+		ls.grant(l, abilityName, leaseRequest{b: b, duration: duration})
+	case b:
+		l.t.Reset(duration)
+		b.dispatch(astibrain.WebsocketEventNameAbilityLeaseAcquired, abilityName)
+	default:
+		// Brain is already waiting
+		for _, r := range l.waiting {
+			if r.b == b {
+				return
+			}
+		}
+
+		// Wait in line
+		l.waiting = append(l.waiting, leaseRequest{b: b, duration: duration})
+		astilog.Debugf("astibob: brain %s is waiting for lease on %s held by brain %s", b.name, abilityName, l.holder.name)
+	}
+}
+
+// grant grants the lease to a brain.
+// Assumption is made that m is locked
+func (ls *leases) grant(l *lease, abilityName string, r leaseRequest) {
+	// Update lease
+	l.holder = r.b
+	l.isHolderGone = false
+	l.t = time.AfterFunc(r.duration, func() { ls.expire(l, abilityName, r.b) })
+
+	// Log
+	astilog.Infof("astibob: brain %s has acquired lease on %s", r.b.name, abilityName)
+
+	// Dispatch event to brain
+	r.b.dispatch(astibrain.WebsocketEventNameAbilityLeaseAcquired, abilityName)
+
+	// Dispatch event to GO
+	ls.d.dispatch(Event{Ability: &EventAbility{BrainName: r.b.name, Name: abilityName}, Brain: &EventBrain{Name: r.b.name}, Name: EventNameAbilityLeaseAcquired})
+}
+
+// release releases the lease if the brain holds it and removes the brain from the waiting line otherwise
+func (ls *leases) release(b *brain, abilityName string) {
+	// Lock
+	ls.m.Lock()
+	defer ls.m.Unlock()
+
+	// Get lease
+	l, ok := ls.ls[abilityName]
+	if !ok {
+		return
+	}
+
+	// Brain doesn't hold the lease
+	if l.holder != b {
+		ls.removeWaiting(l, b)
+		return
+	}
+
+	// Release
+	ls.lose(l, abilityName, false)
+}
+
+// releaseBrain handles the brain disconnecting: it's removed from all waiting lines and leases it holds are kept
+// until they expire since there's no way to know whether its abilities have stopped
+func (ls *leases) releaseBrain(b *brain) {
+	// Lock
+	ls.m.Lock()
+	defer ls.m.Unlock()
+
+	// Loop through leases
+	for abilityName, l := range ls.ls {
+		if l.holder == b {
+			l.isHolderGone = true
+			astilog.Infof("astibob: brain %s holding lease on %s has disconnected, lease will be available once it has expired", b.name, abilityName)
+		} else {
+			ls.removeWaiting(l, b)
+		}
+	}
+}
+
+// expire expires the lease if the brain still holds it
+func (ls *leases) expire(l *lease, abilityName string, b *brain) {
+	// Lock
+	ls.m.Lock()
+	defer ls.m.Unlock()
+
+	// Brain doesn't hold the lease anymore
+	if l.holder != b {
+		return
+	}
+
+	// Log
+	astilog.Errorf("astibob: lease of brain %s on %s has expired", b.name, abilityName)
+
+	// Lose
+	ls.lose(l, abilityName, !l.isHolderGone)
+}
+
+// lose removes the holder of the lease and grants it to the first brain waiting in line.
+// It must only be called once the holder has released the lease, which means its ability is off, or once the lease
+// has expired.
+// Assumption is made that m is locked
+func (ls *leases) lose(l *lease, abilityName string, notify bool) {
+	// Update lease
+	b := l.holder
+	l.holder = nil
+	l.t.Stop()
+
+	// Log
+	astilog.Infof("astibob: brain %s has lost lease on %s", b.name, abilityName)
+
+	// Dispatch event to brain
+	if notify {
+		b.dispatch(astibrain.WebsocketEventNameAbilityLeaseLost, abilityName)
+	}
+
+	// Dispatch event to GO
+	ls.d.dispatch(Event{Ability: &EventAbility{BrainName: b.name, Name: abilityName}, Brain: &EventBrain{Name: b.name}, Name: EventNameAbilityLeaseLost})
+
+	// Grant lease to the first brain waiting in line
+	if len(l.waiting) > 0 {
+		r := l.waiting[0]
+		l.waiting = l.waiting[1:]
+		ls.grant(l, abilityName, r)
+	}
+}
+
+// removeWaiting removes the brain from the waiting line.
+// Assumption is made that m is locked
+func (ls *leases) removeWaiting(l *lease, b *brain) {
+	for idx, r := range l.waiting {
+		if r.b == b {
+			l.waiting = append(l.waiting[:idx], l.waiting[idx+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package astisampleformat
+
+// Resample converts samples from a sample rate to another using linear interpolation.
+// Samples are returned as is if both sample rates are the same.
+func Resample(samples []int32, srcSampleRate, dstSampleRate int) []int32 {
+	// Nothing to do
+	if srcSampleRate == dstSampleRate || srcSampleRate <= 0 || dstSampleRate <= 0 || len(samples) == 0 {
+		return samples
+	}
+
+	// Create output
+	n := int(int64(len(samples)) * int64(dstSampleRate) / int64(srcSampleRate))
+	o := make([]int32, n)
+
+	// Loop through output samples
+	ratio := float64(srcSampleRate) / float64(dstSampleRate)
+	for idx := range o {
+		// Get position in input samples
+		pos := float64(idx) * ratio
+		i := int(pos)
+
+		// Last sample
+		if i >= len(samples)-1 {
+			o[idx] = samples[len(samples)-1]
+			continue
+		}
+
+		// Interpolate
+		f := pos - float64(i)
+		o[idx] = int32(float64(samples[i])*(1-f) + float64(samples[i+1])*f)
+	}
+	return o
+}
@@ -0,0 +1,32 @@
+package astisampleformat
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResample(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		i        []int32
+		src, dst int
+		expected []int32
+	}{
+		{name: "same rate", i: []int32{1, 2}, src: 16000, dst: 16000, expected: []int32{1, 2}},
+		{name: "invalid src", i: []int32{1, 2}, src: 0, dst: 16000, expected: []int32{1, 2}},
+		{name: "invalid dst", i: []int32{1, 2}, src: 16000, dst: -1, expected: []int32{1, 2}},
+		{name: "empty", i: []int32{}, src: 8000, dst: 16000, expected: []int32{}},
+		{name: "up", i: []int32{0, 10}, src: 8000, dst: 16000, expected: []int32{0, 5, 10, 10}},
+		{name: "up single sample", i: []int32{7}, src: 8000, dst: 24000, expected: []int32{7, 7, 7}},
+		{name: "up extremes", i: []int32{math.MinInt32, math.MaxInt32}, src: 1, dst: 2, expected: []int32{math.MinInt32, 0, math.MaxInt32, math.MaxInt32}},
+		{name: "down", i: []int32{0, 10, 20, 30}, src: 16000, dst: 8000, expected: []int32{0, 20}},
+		{name: "down interpolated", i: []int32{0, 30, 60}, src: 3, dst: 2, expected: []int32{0, 45}},
+		{name: "down to nothing", i: []int32{1}, src: 16000, dst: 8000, expected: []int32{}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Resample(v.i, v.src, v.dst))
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package astisampleformat
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Sample formats
+const (
+	SampleFormatFloat32 = "float32"
+	SampleFormatInt16   = "int16"
+	SampleFormatInt32   = "int32"
+)
+
+// maxValue returns the max value of a signed sample with that many significant bits.
+// Significant bits are clamped between 2 and 32, a value <= 0 meaning 32.
+func maxValue(significantBits int) int64 {
+	if significantBits <= 0 || significantBits > 32 {
+		significantBits = 32
+	} else if significantBits < 2 {
+		significantBits = 2
+	}
+	return 1<<uint(significantBits-1) - 1
+}
+
+// clip clips a value between the min and max values of a signed sample with that many significant bits
+func clip(v, max int64) int64 {
+	if v > max {
+		return max
+	} else if v < -max-1 {
+		return -max - 1
+	}
+	return v
+}
+
+// scale scales a value from a max value to another.
+// The value is shifted when both max values are powers of 2 minus 1 so that no precision is lost.
+func scale(v, srcMax, dstMax int64) int64 {
+	// Nothing to do
+	if srcMax == dstMax {
+		return v
+	}
+
+	// Shift
+	if dstMax > srcMax {
+		return clip(v*((dstMax+1)/(srcMax+1)), dstMax)
+	}
+	return clip(v/((srcMax+1)/(dstMax+1)), dstMax)
+}
+
+// ConvertSignificantBits converts samples with srcBits significant bits to samples with dstBits significant bits
+func ConvertSignificantBits(samples []int32, srcBits, dstBits int) []int32 {
+	// Nothing to do
+	srcMax, dstMax := maxValue(srcBits), maxValue(dstBits)
+	if srcMax == dstMax {
+		return samples
+	}
+
+	// Convert
+	o := make([]int32, len(samples))
+	for idx, s := range samples {
+		o[idx] = int32(scale(clip(int64(s), srcMax), srcMax, dstMax))
+	}
+	return o
+}
+
+// Int16ToInt32 converts 16 bits samples to samples with that many significant bits
+func Int16ToInt32(samples []int16, significantBits int) (o []int32) {
+	o = make([]int32, len(samples))
+	dstMax := maxValue(significantBits)
+	for idx, s := range samples {
+		o[idx] = int32(scale(int64(s), math.MaxInt16, dstMax))
+	}
+	return
+}
+
+// Int32ToInt16 converts samples with that many significant bits to 16 bits samples
+func Int32ToInt16(samples []int32, significantBits int) (o []int16) {
+	o = make([]int16, len(samples))
+	srcMax := maxValue(significantBits)
+	for idx, s := range samples {
+		o[idx] = int16(scale(clip(int64(s), srcMax), srcMax, math.MaxInt16))
+	}
+	return
+}
+
+// Float32ToInt32 converts float samples between -1 and 1 to samples with that many significant bits.
+// Values out of range are clipped and NaNs are converted to 0.
+func Float32ToInt32(samples []float32, significantBits int) (o []int32) {
+	o = make([]int32, len(samples))
+	max := maxValue(significantBits)
+	for idx, s := range samples {
+		// Clip
+		f := float64(s)
+		switch {
+		case math.IsNaN(f):
+			f = 0
+		case f > 1:
+			f = 1
+		case f < -1:
+			f = -1
+		}
+
+		// Scale
+		o[idx] = int32(clip(int64(math.Round(f*float64(max))), max))
+	}
+	return
+}
+
+// Int32ToFloat32 converts samples with that many significant bits to float samples between -1 and 1
+func Int32ToFloat32(samples []int32, significantBits int) (o []float32) {
+	o = make([]float32, len(samples))
+	max := maxValue(significantBits)
+	for idx, s := range samples {
+		f := float64(clip(int64(s), max)) / float64(max)
+		if f < -1 {
+			f = -1
+		}
+		o[idx] = float32(f)
+	}
+	return
+}
+
+// BytesToInt16 decodes 16 bits samples with the provided byte order.
+// An incomplete trailing sample is dropped.
+func BytesToInt16(b []byte, order binary.ByteOrder) (o []int16) {
+	o = make([]int16, len(b)/2)
+	for idx := range o {
+		o[idx] = int16(order.Uint16(b[idx*2:]))
+	}
+	return
+}
+
+// BytesToFloat32 decodes IEEE 754 float samples with the provided byte order.
+// An incomplete trailing sample is dropped.
+func BytesToFloat32(b []byte, order binary.ByteOrder) (o []float32) {
+	o = make([]float32, len(b)/4)
+	for idx := range o {
+		o[idx] = math.Float32frombits(order.Uint32(b[idx*4:]))
+	}
+	return
+}
+
+// Normalize converts samples received as int32 values in the provided format to samples with that many significant
+// bits.
+// With SampleFormatInt16, values are expected to be in the 16 bits range. With SampleFormatFloat32, values are expected
+// to hold the IEEE 754 bits of the float samples, as returned by audio backends writing floats in int32 buffers. Samples
+// in any other format are returned as is.
+func Normalize(samples []int32, format string, significantBits int) []int32 {
+	switch format {
+	case SampleFormatFloat32:
+		fs := make([]float32, len(samples))
+		for idx, s := range samples {
+			fs[idx] = math.Float32frombits(uint32(s))
+		}
+		return Float32ToInt32(fs, significantBits)
+	case SampleFormatInt16:
+		o := make([]int32, len(samples))
+		dstMax := maxValue(significantBits)
+		for idx, s := range samples {
+			o[idx] = int32(scale(clip(int64(s), math.MaxInt16), math.MaxInt16, dstMax))
+		}
+		return o
+	}
+	return samples
+}
+
+// Denormalize converts samples with that many significant bits to samples provided as int32 values in the provided
+// format, which is the opposite of Normalize.
+// With SampleFormatInt16, values are in the 16 bits range. With SampleFormatFloat32, values hold the IEEE 754 bits of
+// the float samples. Samples in any other format are returned as is.
+func Denormalize(samples []int32, format string, significantBits int) []int32 {
+	switch format {
+	case SampleFormatFloat32:
+		fs := Int32ToFloat32(samples, significantBits)
+		o := make([]int32, len(fs))
+		for idx, f := range fs {
+			o[idx] = int32(math.Float32bits(f))
+		}
+		return o
+	case SampleFormatInt16:
+		is := Int32ToInt16(samples, significantBits)
+		o := make([]int32, len(is))
+		for idx, s := range is {
+			o[idx] = int32(s)
+		}
+		return o
+	}
+	return samples
+}
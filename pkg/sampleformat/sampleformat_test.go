@@ -0,0 +1,145 @@
+package astisampleformat
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertSignificantBits(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		i        []int32
+		srcBits  int
+		dstBits  int
+		expected []int32
+	}{
+		{name: "same bits", i: []int32{40000, -40000}, srcBits: 16, dstBits: 16, expected: []int32{40000, -40000}},
+		{name: "16 to 32", i: []int32{math.MinInt16, 0, math.MaxInt16}, srcBits: 16, dstBits: 32, expected: []int32{math.MinInt32, 0, 2147418112}},
+		{name: "32 to 16", i: []int32{math.MinInt32, 0, math.MaxInt32}, srcBits: 32, dstBits: 16, expected: []int32{math.MinInt16, 0, math.MaxInt16}},
+		{name: "0 means 32", i: []int32{math.MinInt32, math.MaxInt32}, srcBits: 0, dstBits: 16, expected: []int32{math.MinInt16, math.MaxInt16}},
+		{name: "16 to 24 clipped", i: []int32{40000, -40000}, srcBits: 16, dstBits: 24, expected: []int32{8388352, -8388608}},
+		{name: "24 to 16 clipped", i: []int32{1 << 23, -1<<23 - 1}, srcBits: 24, dstBits: 16, expected: []int32{math.MaxInt16, math.MinInt16}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, ConvertSignificantBits(v.i, v.srcBits, v.dstBits))
+		})
+	}
+}
+
+func TestInt16ToInt32(t *testing.T) {
+	for _, v := range []struct {
+		name            string
+		i               []int16
+		significantBits int
+		expected        []int32
+	}{
+		{name: "16", i: []int16{math.MinInt16, 0, math.MaxInt16}, significantBits: 16, expected: []int32{math.MinInt16, 0, math.MaxInt16}},
+		{name: "24", i: []int16{math.MinInt16, 0, math.MaxInt16}, significantBits: 24, expected: []int32{-8388608, 0, 8388352}},
+		{name: "32", i: []int16{math.MinInt16, 0, math.MaxInt16}, significantBits: 32, expected: []int32{math.MinInt32, 0, 2147418112}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Int16ToInt32(v.i, v.significantBits))
+		})
+	}
+}
+
+func TestInt32ToInt16(t *testing.T) {
+	for _, v := range []struct {
+		name            string
+		i               []int32
+		significantBits int
+		expected        []int16
+	}{
+		{name: "16", i: []int32{math.MinInt16, 0, math.MaxInt16}, significantBits: 16, expected: []int16{math.MinInt16, 0, math.MaxInt16}},
+		{name: "16 clipped", i: []int32{40000, -40000}, significantBits: 16, expected: []int16{math.MaxInt16, math.MinInt16}},
+		{name: "24 clipped", i: []int32{1 << 23, -1<<23 - 1}, significantBits: 24, expected: []int16{math.MaxInt16, math.MinInt16}},
+		{name: "32", i: []int32{math.MinInt32, 0, math.MaxInt32}, significantBits: 32, expected: []int16{math.MinInt16, 0, math.MaxInt16}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Int32ToInt16(v.i, v.significantBits))
+		})
+	}
+}
+
+func TestFloat32ToInt32(t *testing.T) {
+	for _, v := range []struct {
+		name            string
+		i               []float32
+		significantBits int
+		expected        []int32
+	}{
+		{name: "16", i: []float32{-1, 0, 0.5, 1}, significantBits: 16, expected: []int32{-math.MaxInt16, 0, 16384, math.MaxInt16}},
+		{name: "32", i: []float32{-1, 0, 1}, significantBits: 32, expected: []int32{-math.MaxInt32, 0, math.MaxInt32}},
+		{name: "clipped", i: []float32{-2, 2, float32(math.Inf(-1)), float32(math.Inf(1))}, significantBits: 16, expected: []int32{-math.MaxInt16, math.MaxInt16, -math.MaxInt16, math.MaxInt16}},
+		{name: "nan", i: []float32{float32(math.NaN())}, significantBits: 16, expected: []int32{0}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Float32ToInt32(v.i, v.significantBits))
+		})
+	}
+}
+
+func TestInt32ToFloat32(t *testing.T) {
+	for _, v := range []struct {
+		name            string
+		i               []int32
+		significantBits int
+		expected        []float32
+	}{
+		{name: "16", i: []int32{math.MinInt16, -math.MaxInt16, 0, math.MaxInt16}, significantBits: 16, expected: []float32{-1, -1, 0, 1}},
+		{name: "16 clipped", i: []int32{-40000, 40000}, significantBits: 16, expected: []float32{-1, 1}},
+		{name: "32", i: []int32{math.MinInt32, 0, math.MaxInt32}, significantBits: 32, expected: []float32{-1, 0, 1}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Int32ToFloat32(v.i, v.significantBits))
+		})
+	}
+}
+
+func TestBytes(t *testing.T) {
+	// Incomplete trailing samples are dropped
+	assert.Equal(t, []int16{math.MinInt16, math.MaxInt16}, BytesToInt16([]byte{0x00, 0x80, 0xff, 0x7f, 0x01}, binary.LittleEndian))
+	assert.Equal(t, []int16{math.MinInt16, math.MaxInt16}, BytesToInt16([]byte{0x80, 0x00, 0x7f, 0xff}, binary.BigEndian))
+	assert.Equal(t, []float32{1, -1}, BytesToFloat32([]byte{0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x80, 0xbf, 0x01}, binary.LittleEndian))
+}
+
+func TestNormalize(t *testing.T) {
+	for _, v := range []struct {
+		name            string
+		i               []int32
+		format          string
+		significantBits int
+		expected        []int32
+	}{
+		{name: "unknown format", i: []int32{40000}, format: "", significantBits: 16, expected: []int32{40000}},
+		{name: "int16", i: []int32{math.MinInt16, 0, math.MaxInt16}, format: SampleFormatInt16, significantBits: 32, expected: []int32{math.MinInt32, 0, 2147418112}},
+		{name: "int16 clipped", i: []int32{40000, -40000}, format: SampleFormatInt16, significantBits: 16, expected: []int32{math.MaxInt16, math.MinInt16}},
+		{name: "float32", i: []int32{int32(math.Float32bits(1)), int32(math.Float32bits(-1)), int32(math.Float32bits(2))}, format: SampleFormatFloat32, significantBits: 32, expected: []int32{math.MaxInt32, -math.MaxInt32, math.MaxInt32}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Normalize(v.i, v.format, v.significantBits))
+		})
+	}
+}
+
+func TestDenormalize(t *testing.T) {
+	for _, v := range []struct {
+		name            string
+		i               []int32
+		format          string
+		significantBits int
+		expected        []int32
+	}{
+		{name: "unknown format", i: []int32{40000}, format: "", significantBits: 16, expected: []int32{40000}},
+		{name: "int16", i: []int32{math.MinInt32, 0, math.MaxInt32}, format: SampleFormatInt16, significantBits: 32, expected: []int32{math.MinInt16, 0, math.MaxInt16}},
+		{name: "int16 clipped", i: []int32{40000, -40000}, format: SampleFormatInt16, significantBits: 16, expected: []int32{math.MaxInt16, math.MinInt16}},
+		{name: "float32", i: []int32{math.MinInt16, math.MaxInt16}, format: SampleFormatFloat32, significantBits: 16, expected: []int32{int32(math.Float32bits(-1)), int32(math.Float32bits(1))}},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Denormalize(v.i, v.format, v.significantBits))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package astispeak
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/asticode/go-astilog"
+	"github.com/cryptix/wav"
+	"github.com/pkg/errors"
+)
+
+// Player represents a player based on the system's audio playback binary.
+// Samples are expected to use 16 significant bits, which is what the speaking ability provides by default.
+type Player struct {
+	c Configuration
+}
+
+// NewPlayer creates a new player
+func NewPlayer(c Configuration) *Player {
+	return &Player{c: c}
+}
+
+// Play implements the astispeaking.Player interface
+// Samples are written to a temporary wav file which is played by the system's binary. Cancelling the context kills it.
+func (p *Player) Play(ctx context.Context, samples []int32, sampleRate int) (err error) {
+	// Write wav
+	var path string
+	if path, err = writeWav(samples, sampleRate); err != nil {
+		err = errors.Wrap(err, "astispeak: writing wav failed")
+		return
+	}
+	defer os.Remove(path)
+
+	// Init cmd
+	var cmd = p.cmd(ctx, path)
+
+	// Exec
+	astilog.Debugf("astispeak: executing %s", strings.Join(cmd.Args, " "))
+	var b []byte
+	if b, err = cmd.CombinedOutput(); err != nil {
+		err = errors.Wrapf(err, "astispeak: running %s failed with combined output %s", strings.Join(cmd.Args, " "), b)
+		return
+	}
+	return
+}
+
+// writeWav writes 16 bits samples to a temporary wav file and returns its path.
+// Samples exceeding 16 bits are clipped.
+func writeWav(samples []int32, sampleRate int) (path string, err error) {
+	// Create file
+	var f *os.File
+	if f, err = ioutil.TempFile("", "astispeak-*.wav"); err != nil {
+		err = errors.Wrap(err, "astispeak: creating temporary file failed")
+		return
+	}
+	path = f.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(path)
+			path = ""
+		}
+	}()
+	defer f.Close()
+
+	// Create wav writer
+	wf := wav.File{
+		Channels:        1,
+		SampleRate:      uint32(sampleRate),
+		SignificantBits: 16,
+	}
+	var w *wav.Writer
+	if w, err = wf.NewWriter(f); err != nil {
+		err = errors.Wrap(err, "astispeak: creating wav writer failed")
+		return
+	}
+
+	// Write samples
+	for _, s := range samples {
+		if s > math.MaxInt16 {
+			s = math.MaxInt16
+		} else if s < math.MinInt16 {
+			s = math.MinInt16
+		}
+		if err = w.WriteInt32(s); err != nil {
+			err = errors.Wrap(err, "astispeak: writing wav sample failed")
+			return
+		}
+	}
+
+	// Close wav writer
+	if err = w.Close(); err != nil {
+		err = errors.Wrap(err, "astispeak: closing wav writer failed")
+		return
+	}
+	return
+}
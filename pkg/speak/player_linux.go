@@ -0,0 +1,17 @@
+package astispeak
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+)
+
+// cmd returns the command playing a wav file
+func (p *Player) cmd(ctx context.Context, path string) *exec.Cmd {
+	// Binary path
+	var name = "aplay"
+	if len(p.c.BinaryDirPath) > 0 {
+		name = filepath.Join(p.c.BinaryDirPath, name)
+	}
+	return exec.CommandContext(ctx, name, "-q", path)
+}
@@ -0,0 +1,55 @@
+package astispeak
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBinaryForTest writes an executable shell script named after a binary
+func writeBinaryForTest(t *testing.T, dir, name, script string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlayerPlay(t *testing.T) {
+	// Fake aplay copies the played file
+	dir, err := ioutil.TempDir("", "astispeak")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "played.wav")
+	writeBinaryForTest(t, dir, "aplay", "cp \"$2\" "+dst+"\n")
+
+	// Play
+	p := NewPlayer(Configuration{BinaryDirPath: dir})
+	assert.NoError(t, p.Play(context.Background(), []int32{1, 2, 3}, 16000))
+
+	// Played file has been written, then removed
+	b, err := ioutil.ReadFile(dst)
+	assert.NoError(t, err)
+	samples, sampleRate, err := decodeWav(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 16000, sampleRate)
+	assert.Equal(t, []int32{1, 2, 3}, samples)
+	fs, err := filepath.Glob(filepath.Join(os.TempDir(), "astispeak-*.wav"))
+	assert.NoError(t, err)
+	assert.Empty(t, fs)
+
+	// Failure
+	writeBinaryForTest(t, dir, "aplay", "echo failed >&2\nexit 1\n")
+	assert.Error(t, p.Play(context.Background(), []int32{1}, 16000))
+
+	// Cancellation kills the binary
+	writeBinaryForTest(t, dir, "aplay", "exec sleep 10\n")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	n := time.Now()
+	assert.Error(t, p.Play(ctx, []int32{1}, 16000))
+	assert.True(t, time.Since(n) < 5*time.Second)
+}
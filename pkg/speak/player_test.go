@@ -0,0 +1,25 @@
+package astispeak
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteWav(t *testing.T) {
+	// Write
+	path, err := writeWav([]int32{0, 1000, -1000, math.MaxInt32, math.MinInt32}, 22050)
+	assert.NoError(t, err)
+	defer os.Remove(path)
+
+	// Decode
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	samples, sampleRate, err := decodeWav(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 22050, sampleRate)
+	assert.Equal(t, []int32{0, 1000, -1000, math.MaxInt16, math.MinInt16}, samples)
+}
@@ -0,0 +1,18 @@
+package astispeak
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// cmd returns the command playing a wav file
+func (p *Player) cmd(ctx context.Context, path string) *exec.Cmd {
+	// Binary path
+	var name = "powershell"
+	if len(p.c.BinaryDirPath) > 0 {
+		name = filepath.Join(p.c.BinaryDirPath, name)
+	}
+	return exec.CommandContext(ctx, name, "-NoProfile", "-NonInteractive", "-Command", "(New-Object Media.SoundPlayer '"+strings.Replace(path, "'", "''", -1)+"').PlaySync()")
+}
@@ -0,0 +1,45 @@
+package astispeak
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cryptix/wav"
+	"github.com/pkg/errors"
+)
+
+// Synthesizer represents a synthesizer based on the system's speech synthesis binary
+type Synthesizer struct {
+	c Configuration
+}
+
+// NewSynthesizer creates a new synthesizer
+func NewSynthesizer(c Configuration) *Synthesizer {
+	return &Synthesizer{c: c}
+}
+
+// decodeWav decodes wav bytes into samples
+func decodeWav(b []byte) (samples []int32, sampleRate int, err error) {
+	// Create wav reader
+	var r *wav.Reader
+	if r, err = wav.NewReader(bytes.NewReader(b), int64(len(b))); err != nil {
+		err = errors.Wrap(err, "astispeak: creating wav reader failed")
+		return
+	}
+	sampleRate = int(r.GetFile().SampleRate)
+
+	// Read samples
+	var sample int32
+	for {
+		if sample, err = r.ReadSample(); err != nil {
+			if err != io.EOF {
+				err = errors.Wrap(err, "astispeak: reading wav sample failed")
+				return
+			}
+			err = nil
+			break
+		}
+		samples = append(samples, sample)
+	}
+	return
+}
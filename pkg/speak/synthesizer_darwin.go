@@ -0,0 +1,65 @@
+package astispeak
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Say implements the astispeaking.Synthesizer interface
+// say voices are not named after languages, therefore the language is ignored
+func (s *Synthesizer) Say(ctx context.Context, text, language string) (samples []int32, sampleRate int, err error) {
+	// Create temporary file
+	var f *os.File
+	if f, err = ioutil.TempFile("", "astispeak"); err != nil {
+		err = errors.Wrap(err, "astispeak: creating temporary file failed")
+		return
+	}
+	f.Close()
+	path := f.Name() + ".wav"
+	defer os.Remove(f.Name())
+	defer os.Remove(path)
+
+	// Init args
+	var args = []string{"-o", path, "--data-format=LEI16@22050"}
+	if len(s.c.Voice) > 0 {
+		args = append(args, "-v", s.c.Voice)
+	}
+	args = append(args, text)
+
+	// Binary path
+	var name = "say"
+	if len(s.c.BinaryDirPath) > 0 {
+		name = filepath.Join(s.c.BinaryDirPath, name)
+	}
+
+	// Init cmd
+	var cmd = exec.CommandContext(ctx, name, args...)
+
+	// Exec
+	astilog.Debugf("astispeak: executing %s", strings.Join(cmd.Args, " "))
+	var b []byte
+	if b, err = cmd.CombinedOutput(); err != nil {
+		err = errors.Wrapf(err, "astispeak: running %s failed with combined output %s", strings.Join(cmd.Args, " "), b)
+		return
+	}
+
+	// Read wav
+	if b, err = ioutil.ReadFile(path); err != nil {
+		err = errors.Wrapf(err, "astispeak: reading %s failed", path)
+		return
+	}
+
+	// Decode
+	if samples, sampleRate, err = decodeWav(b); err != nil {
+		err = errors.Wrap(err, "astispeak: decoding wav failed")
+		return
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package astispeak
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Say implements the astispeaking.Synthesizer interface
+// espeak voices are named after languages, therefore the language takes precedence over the configured voice
+func (s *Synthesizer) Say(ctx context.Context, text, language string) (samples []int32, sampleRate int, err error) {
+	// Init args
+	var args = []string{"--stdout"}
+	if len(language) > 0 {
+		args = append(args, "-v", language)
+	} else if len(s.c.Voice) > 0 {
+		args = append(args, "-v", s.c.Voice)
+	}
+	args = append(args, text)
+
+	// Binary path
+	var name = "espeak"
+	if len(s.c.BinaryDirPath) > 0 {
+		name = filepath.Join(s.c.BinaryDirPath, name)
+	}
+
+	// Init cmd
+	var cmd = exec.CommandContext(ctx, name, args...)
+
+	// Exec
+	astilog.Debugf("astispeak: executing %s", strings.Join(cmd.Args, " "))
+	var b []byte
+	if b, err = cmd.Output(); err != nil {
+		err = errors.Wrapf(err, "astispeak: running %s failed", strings.Join(cmd.Args, " "))
+		return
+	}
+
+	// Decode
+	if samples, sampleRate, err = decodeWav(b); err != nil {
+		err = errors.Wrap(err, "astispeak: decoding wav failed")
+		return
+	}
+	return
+}
@@ -0,0 +1,13 @@
+package astispeak
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Say implements the astispeaking.Synthesizer interface
+func (s *Synthesizer) Say(ctx context.Context, text, language string) (samples []int32, sampleRate int, err error) {
+	err = errors.New("astispeak: synthesizer is not supported on windows")
+	return
+}
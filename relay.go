@@ -0,0 +1,106 @@
+package astibob
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+)
+
+// relays relays the outputs of abilities to the brains linking inputs to them without having learned them
+// Brains subscribe to the outputs they need, see astibrain.APIRelay. Bob listens to the outputs declared by each
+// ability when it's learned and relays them to the subscribed brains except the one that has sent them.
+type relays struct {
+	m sync.Mutex                   // Locks s
+	s map[string]map[*brain]string // Event names subscribers listen to indexed by relay key and subscriber
+}
+
+// newRelays creates new relays
+func newRelays() *relays {
+	return &relays{s: make(map[string]map[*brain]string)}
+}
+
+// relayKey returns the key of an output, the ability name being in its canonical form
+func relayKey(abilityName, port string) string {
+	return string(astibrain.WebsocketAbilityEventName(astibrain.NormalizeAbilityName(abilityName), port))
+}
+
+// subscribe subscribes a brain to an output
+func (r *relays) subscribe(b *brain, p astibrain.APIRelay) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	k := relayKey(p.Ability, p.Port)
+	if _, ok := r.s[k]; !ok {
+		r.s[k] = make(map[*brain]string)
+	}
+	r.s[k][b] = string(astibrain.WebsocketAbilityEventName(p.Ability, p.Port))
+}
+
+// unsubscribe unsubscribes a brain from an output
+func (r *relays) unsubscribe(b *brain, p astibrain.APIRelay) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	k := relayKey(p.Ability, p.Port)
+	delete(r.s[k], b)
+	if len(r.s[k]) == 0 {
+		delete(r.s, k)
+	}
+}
+
+// del unsubscribes a brain from all outputs
+func (r *relays) del(b *brain) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for k, ss := range r.s {
+		delete(ss, b)
+		if len(ss) == 0 {
+			delete(r.s, k)
+		}
+	}
+}
+
+// subscribers returns the event names the subscribers of an output listen to, the source brain excluded
+func (r *relays) subscribers(src *brain, abilityName, port string) (o map[*brain]string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	o = make(map[*brain]string)
+	for b, n := range r.s[relayKey(abilityName, port)] {
+		if b != src {
+			o[b] = n
+		}
+	}
+	return
+}
+
+// relay returns the listener relaying an output sent by a brain to its subscribers
+func (r *relays) relay(src *brain, abilityName, port string) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		for b, n := range r.subscribers(src, abilityName, port) {
+			b.dispatch(astibrain.WebsocketEventName(n), payload)
+		}
+		return nil
+	}
+}
+
+// handleWebsocketRelaySubscription handles the relay subscribe and unsubscribe websocket events
+func (s *brainsServer) handleWebsocketRelaySubscription(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIRelay
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Update subscriptions
+		if astibrain.WebsocketEventName(eventName) == astibrain.WebsocketEventNameRelaySubscribe {
+			s.relays.subscribe(b, p)
+		} else {
+			s.relays.unsubscribe(b, p)
+		}
+		return nil
+	}
+}
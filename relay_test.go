@@ -0,0 +1,85 @@
+package astibob
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astiws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelays(t *testing.T) {
+	r := newRelays()
+	b1, b2 := newBrain("1", nil, false, nil, 0), newBrain("2", nil, false, nil, 0)
+
+	// Ability names are matched in their canonical form and events are relayed with the name subscribers listen to
+	r.subscribe(b1, astibrain.APIRelay{Ability: "producer", Port: "text"})
+	r.subscribe(b2, astibrain.APIRelay{Ability: "Producer", Port: "text"})
+	assert.Equal(t, map[*brain]string{b1: "ability.producer.text", b2: "ability.Producer.text"}, r.subscribers(nil, "PRODUCER", "text"))
+	assert.Empty(t, r.subscribers(nil, "Producer", "other"))
+
+	// Events are not relayed to the brain that has sent them
+	assert.Equal(t, map[*brain]string{b2: "ability.Producer.text"}, r.subscribers(b1, "Producer", "text"))
+
+	// Unsubscribe
+	r.unsubscribe(b2, astibrain.APIRelay{Ability: "producer", Port: "text"})
+	assert.Equal(t, map[*brain]string{b1: "ability.producer.text"}, r.subscribers(nil, "Producer", "text"))
+	r.del(b1)
+	assert.Empty(t, r.s)
+}
+
+// dialBrainForTest dials the brains server, registers a brain and returns the record of the events it receives
+func dialBrainForTest(t *testing.T, url string, p astibrain.APIRegister, eventNames ...string) (c *astiws.Client, ch chan json.RawMessage) {
+	// Dial
+	c = astiws.NewClient(astiws.ClientConfiguration{})
+	ch = make(chan json.RawMessage, 10)
+	registered := make(chan json.RawMessage, 1)
+	c.AddListener(string(astibrain.WebsocketEventNameRegistered), func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		registered <- payload
+		return nil
+	})
+	for _, n := range eventNames {
+		c.AddListener(n, func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+			ch <- payload
+			return nil
+		})
+	}
+	if !assert.NoError(t, c.Dial(url)) {
+		t.FailNow()
+	}
+	go c.Read()
+	t.Cleanup(func() { c.Close() })
+
+	// Register
+	assert.NoError(t, c.Write(string(astibrain.WebsocketEventNameRegister), p))
+	waitForPayload(t, registered)
+	return
+}
+
+func TestBrainsServerRelay(t *testing.T) {
+	// Create server
+	s := newBrainsServer(nil, newBrains(), astiws.NewManager(astiws.ManagerConfiguration{}), astiws.NewManager(astiws.ManagerConfiguration{}), newDispatcher(), newInterfaces(), newReplayer(0), newSubscriptions(nil), ServerConfiguration{})
+	hs := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { s.handleWebsocketGET(rw, r, nil) }))
+	defer hs.Close()
+	url := "ws" + strings.TrimPrefix(hs.URL, "http") + "/websocket"
+
+	// Consumers subscribe when registering or afterwards
+	_, ch1 := dialBrainForTest(t, url, astibrain.APIRegister{Name: "Consumer1", Relays: []astibrain.APIRelay{{Ability: "producer", Port: "text"}}}, "ability.producer.text")
+	c2, ch2 := dialBrainForTest(t, url, astibrain.APIRegister{Name: "Consumer2"}, "ability.Producer.text")
+	assert.NoError(t, c2.Write(string(astibrain.WebsocketEventNameRelaySubscribe), astibrain.APIRelay{Ability: "Producer", Port: "text"}))
+
+	// Producer declares its outputs
+	c, _ := dialBrainForTest(t, url, astibrain.APIRegister{
+		Abilities: map[string]astibrain.APIAbility{"Producer": {Name: "Producer", Outputs: []string{"text"}}},
+		Name:      "Producer",
+	})
+
+	// Outputs are relayed to subscribers
+	assert.NoError(t, c.Write("ability.Producer.text", "test"))
+	assert.Equal(t, `"test"`, string(waitForPayload(t, ch1)))
+	assert.Equal(t, `"test"`, string(waitForPayload(t, ch2)))
+}
@@ -0,0 +1,88 @@
+package astibob
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/asticode/go-astiws"
+)
+
+// replayer represents a bounded history of ability lifecycle events replayed to newly connected clients.
+// High volume events such as samples are never retained.
+type replayer struct {
+	es   map[string][]replayEvent // Indexed by brain key + ability key
+	m    sync.Mutex               // Locks es and seq
+	seq  int
+	size int
+}
+
+// replayEvent represents a retained event
+type replayEvent struct {
+	name    string
+	payload EventAbility
+	seq     int
+}
+
+// newReplayer creates a new replayer
+func newReplayer(size int) *replayer {
+	return &replayer{
+		es:   make(map[string][]replayEvent),
+		size: size,
+	}
+}
+
+// replayKey returns the replay key of an ability
+func replayKey(b *brain, a *ability) string {
+	return b.key + "/" + a.key
+}
+
+// add retains an event while keeping the history of the ability capped
+func (r *replayer) add(key, eventName string, e EventAbility) {
+	// Replay is disabled
+	if r.size <= 0 {
+		return
+	}
+
+	// Lock
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// Append
+	r.seq++
+	r.es[key] = append(r.es[key], replayEvent{name: eventName, payload: e, seq: r.seq})
+
+	// Drop oldest events
+	if len(r.es[key]) > r.size {
+		r.es[key] = r.es[key][len(r.es[key])-r.size:]
+	}
+}
+
+// del deletes the history of an ability
+func (r *replayer) del(key string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	delete(r.es, key)
+}
+
+// replay replays the retained events the client is subscribed to in the order they have been dispatched
+func (r *replayer) replay(c *astiws.Client, ss *subscriptions) {
+	// Get events
+	r.m.Lock()
+	var es []replayEvent
+	for _, v := range r.es {
+		es = append(es, v...)
+	}
+	r.m.Unlock()
+
+	// Sort events
+	sort.Slice(es, func(i, j int) bool { return es[i].seq < es[j].seq })
+
+	// Loop through events
+	for _, e := range es {
+		if !ss.isSubscribed(c, e.name) {
+			continue
+		}
+		e.payload.Replay = true
+		dispatchWsEventToClient(c, ss, e.name, e.payload)
+	}
+}
@@ -140,6 +140,12 @@ let base = {
             case consts.websocket.eventNames.abilityStopped:
                 menu.updateToggle(payload, false);
                 break;
+            case consts.websocket.eventNames.abilityForgotten:
+                menu.forgetAbility(payload);
+                break;
+            case consts.websocket.eventNames.abilityLearned:
+                menu.learnAbility(payload);
+                break;
             case consts.websocket.eventNames.abilityStarted:
                 menu.updateToggle(payload, true);
                 break;
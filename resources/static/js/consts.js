@@ -1,13 +1,22 @@
 let consts = {
     websocket: {
         eventNames: {
+            abilitiesDescribed: "abilities.described",
             abilityCrashed: "ability.crashed",
+            abilityForgotten: "ability.forgotten",
+            abilityLearned: "ability.learned",
             abilityStart: "ability.start",
             abilityStarted: "ability.started",
             abilityStop: "ability.stop",
             abilityStopped: "ability.stopped",
             brainDisconnected: "brain.disconnected",
-            brainRegistered: "brain.registered"
+            brainReady: "brain.ready",
+            brainRegistered: "brain.registered",
+            brainStartupProgress: "brain.startup.progress",
+            stateDiff: "state.diff",
+            stateResync: "state.resync",
+            stateSnapshot: "state.snapshot",
+            subscribe: "subscribe"
         }
     }
 };
\ No newline at end of file
@@ -107,6 +107,34 @@ let menu = {
         // Append to pool
         brain.abilities[ability.name] = ability;
     },
+    forgetAbility: function(data) {
+        // Fetch brain
+        let brain = menu.brains[data.brain_name];
+
+        // Brain exists
+        if (typeof brain !== "undefined") {
+            // Fetch ability
+            let ability = brain.abilities[data.name];
+
+            // Ability exists
+            if (typeof ability !== "undefined") {
+                // Remove HTML
+                ability.html.wrapper.remove();
+
+                // Delete from pool
+                delete(brain.abilities[data.name]);
+            }
+        }
+    },
+    learnAbility: function(data) {
+        // Fetch brain
+        let brain = menu.brains[data.brain_name];
+
+        // Brain exists
+        if (typeof brain !== "undefined") {
+            menu.addAbility(brain, data);
+        }
+    },
     newAbility: function(brain, data) {
         // Create results
         let r = {
@@ -2,7 +2,10 @@ package astibob
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/asticode/go-astilog"
@@ -19,15 +22,35 @@ type server struct {
 }
 
 // ServerConfiguration is a server configuration
+// ReplaySize is the max number of ability lifecycle events retained per ability and replayed to newly connected clients.
+// It's only used by the clients server. If 0, events are not replayed.
+// CertFile and KeyFile are the paths to the cert/key pair used to serve TLS. TLSConfig can be used instead or on top of
+// them. If none of them is set, the server is served in plaintext.
+// UnsubscribedEvents are the event name patterns clients don't receive until they subscribe to them. It's only used by
+// the clients server. If nil, high volume events such as audio levels and samples are unsubscribed by default.
+// Token and TokenValidator are only used to authenticate brains websocket connections. If TokenValidator is set, Token is ignored.
+// Brains can authenticate with either the token or the Username/Password basic auth credentials.
+// Ws.MaxMessageSize limits both incoming messages, whose connection is closed with the 1009 (message too big) close
+// code, and outgoing messages sent to brains, which are rejected.
 type ServerConfiguration struct {
-	ListenAddr string                      `toml:"listen_addr"`
-	Password   string                      `toml:"password"`
-	PublicAddr string                      `toml:"public_addr"`
-	Timeout    time.Duration               `toml:"timeout"`
-	Username   string                      `toml:"username"`
-	Ws         astiws.ManagerConfiguration `toml:"ws"`
+	CertFile           string                      `toml:"cert_file"`
+	KeyFile            string                      `toml:"key_file"`
+	ListenAddr         string                      `toml:"listen_addr"`
+	Password           string                      `toml:"password"`
+	PublicAddr         string                      `toml:"public_addr"`
+	ReplaySize         int                         `toml:"replay_size"`
+	Timeout            time.Duration               `toml:"timeout"`
+	TLSConfig          *tls.Config                 `toml:"-"`
+	Token              string                      `toml:"token"`
+	TokenValidator     TokenValidator              `toml:"-"`
+	UnsubscribedEvents []string                    `toml:"unsubscribed_events"`
+	Username           string                      `toml:"username"`
+	Ws                 astiws.ManagerConfiguration `toml:"ws"`
 }
 
+// TokenValidator represents a func capable of validating a websocket token
+type TokenValidator func(token string) bool
+
 // newServer creates a new server
 func newServer(name string, ws *astiws.Manager, c ServerConfiguration) *server {
 	// Create
@@ -47,9 +70,48 @@ func newServer(name string, ws *astiws.Manager, c ServerConfiguration) *server {
 	return s
 }
 
+// isAuthorized checks whether the request holds either a valid bearer token or valid basic auth credentials
+// If neither a token nor credentials are configured, every request is authorized.
+func (s *server) isAuthorized(r *http.Request) bool {
+	// Check token
+	hasToken := s.c.TokenValidator != nil || len(s.c.Token) > 0
+	if h := r.Header.Get("Authorization"); hasToken && strings.HasPrefix(h, "Bearer ") {
+		token := strings.TrimPrefix(h, "Bearer ")
+		if s.c.TokenValidator != nil {
+			if s.c.TokenValidator(token) {
+				return true
+			}
+		} else if subtle.ConstantTimeCompare([]byte(token), []byte(s.c.Token)) == 1 {
+			return true
+		}
+	}
+
+	// Check basic auth
+	hasBasicAuth := len(s.c.Username) > 0 && len(s.c.Password) > 0
+	if username, password, ok := r.BasicAuth(); hasBasicAuth && ok {
+		if subtle.ConstantTimeCompare([]byte(username), []byte(s.c.Username)) == 1 && subtle.ConstantTimeCompare([]byte(password), []byte(s.c.Password)) == 1 {
+			return true
+		}
+	}
+	return !hasToken && !hasBasicAuth
+}
+
+// isTLS checks whether the server is served over TLS
+func (s *server) isTLS() bool {
+	return len(s.c.CertFile) > 0 || s.c.TLSConfig != nil
+}
+
+// websocketScheme returns the scheme of the server websocket
+func (s *server) websocketScheme() string {
+	if s.isTLS() {
+		return "wss"
+	}
+	return "ws"
+}
+
 // setHandler sets the handler
 func (s *server) setHandler(h http.Handler) {
-	s.s = &http.Server{Addr: s.c.ListenAddr, Handler: h}
+	s.s = &http.Server{Addr: s.c.ListenAddr, Handler: h, TLSConfig: s.c.TLSConfig}
 }
 
 // Close implements the io.Closer interface
@@ -72,8 +134,13 @@ func (s *server) Close() (err error) {
 func (s *server) run() (err error) {
 	// Run
 	astilog.Infof("astibob: running %s server on %s", s.name, s.s.Addr)
-	if err = s.s.ListenAndServe(); err != nil {
-		err = errors.Wrapf(err, "astibob: running %s server failed")
+	if s.isTLS() {
+		err = s.s.ListenAndServeTLS(s.c.CertFile, s.c.KeyFile)
+	} else {
+		err = s.s.ListenAndServe()
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "astibob: running %s server failed", s.name)
 		return
 	}
 	return
@@ -9,7 +9,6 @@ import (
 
 	"github.com/asticode/go-astibob/brain"
 	"github.com/asticode/go-astilog"
-	"github.com/asticode/go-astitools/http"
 	"github.com/asticode/go-astitools/template"
 	"github.com/asticode/go-astiws"
 	"github.com/gorilla/websocket"
@@ -20,23 +19,31 @@ import (
 // brainsServer is a server for the brains
 type brainsServer struct {
 	*server
-	brains     *brains
-	clientsWs  *astiws.Manager
-	dispatcher *dispatcher
-	interfaces *interfaces
-	templater  *astitemplate.Templater
+	brains        *brains
+	clientsWs     *astiws.Manager
+	dispatcher    *dispatcher
+	interfaces    *interfaces
+	leases        *leases
+	relays        *relays
+	replayer      *replayer
+	subscriptions *subscriptions
+	templater     *astitemplate.Templater
 }
 
 // newBrainsServer creates a new brains server.
-func newBrainsServer(t *astitemplate.Templater, b *brains, bWs *astiws.Manager, cWs *astiws.Manager, d *dispatcher, i *interfaces, c ServerConfiguration) (s *brainsServer) {
+func newBrainsServer(t *astitemplate.Templater, b *brains, bWs *astiws.Manager, cWs *astiws.Manager, d *dispatcher, i *interfaces, rp *replayer, ss *subscriptions, c ServerConfiguration) (s *brainsServer) {
 	// Create server
 	s = &brainsServer{
-		brains:     b,
-		clientsWs:  cWs,
-		dispatcher: d,
-		interfaces: i,
-		server:     newServer("brains", bWs, c),
-		templater:  t,
+		brains:        b,
+		clientsWs:     cWs,
+		dispatcher:    d,
+		interfaces:    i,
+		leases:        newLeases(d),
+		relays:        newRelays(),
+		replayer:      rp,
+		server:        newServer("brains", bWs, c),
+		subscriptions: ss,
+		templater:     t,
 	}
 
 	// Init router
@@ -45,17 +52,35 @@ func newBrainsServer(t *astitemplate.Templater, b *brains, bWs *astiws.Manager,
 	// Websocket
 	r.GET("/websocket", s.handleWebsocketGET)
 
-	// Chain middlewares
-	var h = astihttp.ChainMiddlewares(r, astihttp.MiddlewareBasicAuth(s.c.Username, s.c.Password))
-
 	// Set handler
-	s.setHandler(h)
+	// Authentication is handled by the websocket handler since brains can use either a token or basic auth
+	s.setHandler(r)
 	return
 }
 
 // handleWebsocketGET handles the websockets.
 func (s *brainsServer) handleWebsocketGET(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	if err := s.ws.ServeHTTP(rw, r, s.adaptWebsocketClient); err != nil {
+	// Check authentication
+	if !s.isAuthorized(r) {
+		astilog.Errorf("astibob: unauthorized websocket upgrade from %s", r.RemoteAddr)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Negotiate envelope
+	var envelope bool
+	switch v := r.Header.Get(astibrain.WebsocketHeaderEnvelope); v {
+	case "":
+	case astibrain.WebsocketEnvelopeFormatVersion:
+		envelope = true
+	default:
+		astilog.Errorf("astibob: unknown envelope format %s requested by %s", v, r.RemoteAddr)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Serve
+	if err := s.ws.ServeHTTP(rw, r, s.adaptWebsocketClient(envelope)); err != nil {
 		if v, ok := errors.Cause(err).(*websocket.CloseError); !ok || v.Code != websocket.CloseNormalClosure {
 			astilog.Error(errors.Wrapf(err, "astibob: handling websocket on %s failed", s.s.Addr))
 		}
@@ -63,14 +88,43 @@ func (s *brainsServer) handleWebsocketGET(rw http.ResponseWriter, r *http.Reques
 	}
 }
 
-// ClientAdapter returns the client adapter.
-func (s *brainsServer) adaptWebsocketClient(c *astiws.Client) {
-	s.ws.AutoRegisterClient(c)
-	c.AddListener(astibrain.WebsocketEventNameRegister, s.handleWebsocketRegistered)
+// adaptWebsocketClient returns the client adapter.
+func (s *brainsServer) adaptWebsocketClient(envelope bool) astiws.ClientAdapter {
+	return func(c *astiws.Client) {
+		s.ws.AutoRegisterClient(c)
+		ping, register := s.handleWebsocketPing(envelope), s.handleWebsocketRegistered(envelope)
+		if envelope {
+			ping, register = astibrain.UnwrapWebsocketListener(ping), astibrain.UnwrapWebsocketListener(register)
+		}
+		c.AddListener(string(astibrain.WebsocketEventNamePing), ping)
+		c.AddListener(string(astibrain.WebsocketEventNameRegister), register)
+	}
+}
+
+// handleWebsocketPing handles the ping websocket event
+// Pings are answered directly and never dispatched to clients
+func (s *brainsServer) handleWebsocketPing(envelope bool) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		p, err := wrapWsEvent(envelope, nil, string(astibrain.WebsocketEventNamePong), nil)
+		if err == nil {
+			err = writeWsEvent(c, s.c.Ws.MaxMessageSize, string(astibrain.WebsocketEventNamePong), p)
+		}
+		if err != nil {
+			astilog.Error(errors.Wrap(err, "astibob: writing pong event failed"))
+		}
+		return nil
+	}
 }
 
 // handleWebsocketRegistered handles the registered websocket event
-func (s *brainsServer) handleWebsocketRegistered(c *astiws.Client, eventName string, payload json.RawMessage) error {
+func (s *brainsServer) handleWebsocketRegistered(envelope bool) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		return s.register(c, envelope, payload)
+	}
+}
+
+// register registers a brain
+func (s *brainsServer) register(c *astiws.Client, envelope bool, payload json.RawMessage) error {
 	// Unmarshal payload
 	var ip astibrain.APIRegister
 	if err := json.Unmarshal(payload, &ip); err != nil {
@@ -79,117 +133,177 @@ func (s *brainsServer) handleWebsocketRegistered(c *astiws.Client, eventName str
 	}
 
 	// Create brain
-	var b = newBrain(ip.Name, c)
+	var b = newBrain(ip.Name, c, envelope, ip.Versions, s.c.Ws.MaxMessageSize)
+	b.setReady(ip.Ready)
 
 	// Loop through abilities
-	var clientWebsocketListeners, webTemplatesPaths []string
 	for _, pa := range ip.Abilities {
-		// Create ability
-		var a = newAbility(pa.Name, pa.Description, pa.IsOn)
-
-		// Check if interface has been declared for this ability
-		i, ok := s.interfaces.get(a.name)
-		if ok {
-			// Add api handlers
-			if v, ok := i.(APIHandler); ok {
-				for path, h := range v.APIHandlers() {
-					if _, ok := a.apiHandlers[path]; !ok {
-						a.apiHandlers[path] = h
-					}
-				}
-			}
-
-			// Set dispatch func
-			if v, ok := i.(Dispatcher); ok {
-				v.SetDispatchFunc(s.dispatchFunc(b.key, a.key))
-			}
-
-			// Add brain websocket listeners
-			if v, ok := i.(BrainWebsocketListener); ok {
-				for n, l := range v.BrainWebsocketListeners() {
-					c.AddListener(astibrain.WebsocketAbilityEventName(a.name, n), l(b.name))
-				}
-			}
-
-			// Add client websocket listeners
-			if v, ok := i.(ClientWebsocketListener); ok {
-				// Loop through clients
-				s.clientsWs.Clients(func(k interface{}, c *astiws.Client) error {
-					for n, l := range v.ClientWebsocketListeners() {
-						eventName := clientAbilityWebsocketEventName(b.key, a.key, n)
-						clientWebsocketListeners = append(clientWebsocketListeners, eventName)
-						c.AddListener(eventName, l)
-					}
-					return nil
-				})
-			}
-
-			// Add static handlers
-			if v, ok := i.(StaticHandler); ok {
-				for path, h := range v.StaticHandlers() {
-					if _, ok := a.staticHandlers[path]; !ok {
-						a.staticHandlers[path] = h
-					}
-				}
-			}
-
-			// Add web templates
-			if v, ok := i.(WebTemplater); ok {
-				// Loop through templates
-				for path, content := range v.WebTemplates() {
-					// Add full path
-					fullPath := s.abilityWebTemplatePath(b.key, a.key, path)
-
-					// Add template
-					if err := s.templater.Add(fullPath, content); err != nil {
-						astilog.Error(errors.Wrapf(err, "astibob: adding web template for brain %s, ability %s and path %s", b.name, a.name, fullPath))
-					} else {
-						webTemplatesPaths = append(webTemplatesPaths, fullPath)
-					}
-
-					// Update web homepage
-					if path == "/index" {
-						a.webHomepage = serverPatternWeb + s.abilityWebTemplatePattern(b.key, a.key, path)
-					}
-				}
-			}
-		}
+		b.set(s.learnAbility(b, pa))
+	}
 
-		// Add ability
-		b.set(a)
+	// Subscribe to relays
+	for _, p := range ip.Relays {
+		s.relays.subscribe(b, p)
 	}
 
 	// Add brain
 	s.brains.set(b)
 
 	// Adapt ws client
-	c.AddListener(astiws.EventNameDisconnect, s.handleWebsocketDisconnected(b, clientWebsocketListeners, webTemplatesPaths))
-	c.AddListener(astibrain.WebsocketEventNameAbilityStarted, s.handleWebsocketAbilityToggle(b))
-	c.AddListener(astibrain.WebsocketEventNameAbilityStopped, s.handleWebsocketAbilityToggle(b))
-	c.AddListener(astibrain.WebsocketEventNameAbilityCrashed, s.handleWebsocketAbilityToggle(b))
+	c.AddListener(astiws.EventNameDisconnect, s.handleWebsocketDisconnected(b))
+	b.addListener(astibrain.WebsocketEventNameAbilitiesDescribed, s.handleWebsocketAbilitiesDescribed(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityForgotten, s.handleWebsocketAbilityForgotten(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityLearned, s.handleWebsocketAbilityLearned(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityLeaseAcquire, s.handleWebsocketAbilityLease(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityLeaseRelease, s.handleWebsocketAbilityLease(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityPaused, s.handleWebsocketAbilityStateChanged(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityReconfigured, s.handleWebsocketAbilityReconfigured(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityRestarting, s.handleWebsocketAbilityStateChanged(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityState, s.handleWebsocketAbilityState(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityResumed, s.handleWebsocketAbilityStateChanged(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityStarted, s.handleWebsocketAbilityToggle(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityStopped, s.handleWebsocketAbilityToggle(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityCrashed, s.handleWebsocketAbilityToggle(b))
+	b.addListener(astibrain.WebsocketEventNameAbilityTimedOut, s.handleWebsocketAbilityToggle(b))
+	b.addListener(astibrain.WebsocketEventNameBrainHeartbeat, s.handleWebsocketBrainHeartbeat(b))
+	b.addListener(astibrain.WebsocketEventNameBrainReady, s.handleWebsocketBrainReady(b))
+	b.addListener(astibrain.WebsocketEventNameBrainStartupProgress, s.handleWebsocketBrainStartupProgress(b))
+	b.addListener(astibrain.WebsocketEventNameMessagesDropped, s.handleWebsocketMessagesDropped(b))
+	b.addListener(astibrain.WebsocketEventNameRelaySubscribe, s.handleWebsocketRelaySubscription(b))
+	b.addListener(astibrain.WebsocketEventNameRelayUnsubscribe, s.handleWebsocketRelaySubscription(b))
+	b.addListener(astibrain.WebsocketEventNameStateSnapshot, s.handleWebsocketStateSnapshot(b))
 
 	// Log
 	astilog.Infof("astibob: brain %s has registered", b.name)
 
 	// Dispatch event to brain
-	dispatchWsEventToClient(c, astibrain.WebsocketEventNameRegistered, nil)
+	// Older versions of brains ignore the payload
+	b.dispatch(astibrain.WebsocketEventNameRegistered, astibrain.APIRegistered{Versions: astibrain.WebsocketEventVersions()})
+
+	// Ask the brain for a state snapshot
+	// Older versions of brains ignore it
+	b.dispatch(astibrain.WebsocketEventNameStateResync, nil)
 
 	// Create event payload
 	e := newEventBrain(b)
 
 	// Dispatch event to clients
-	dispatchWsEventToManager(s.clientsWs, clientsWebsocketEventNameBrainRegistered, e)
+	dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameBrainRegistered, e)
 
 	// Dispatch event to GO
 	s.dispatcher.dispatch(Event{Brain: e, Name: EventNameBrainRegistered})
 	return nil
 }
 
+// learnAbility creates an ability and adapts the brain client and the clients based on its interface
+func (s *brainsServer) learnAbility(b *brain, pa astibrain.APIAbility) (a *ability) {
+	// Create ability
+	a = newAbility(pa.Name, pa.Description, pa.IsOn)
+
+	// Relay outputs
+	// Listeners are added whether other brains have subscribed or not since they can only be added safely while the
+	// brain's events are being handled
+	for _, o := range pa.Outputs {
+		eventName := astibrain.WebsocketAbilityEventName(a.name, o)
+		a.brainWebsocketListeners = append(a.brainWebsocketListeners, eventName)
+		b.addListener(eventName, s.relays.relay(b, a.name, o))
+	}
+
+	// Check if interface has been declared for this ability
+	i, ok := s.interfaces.get(a.name)
+	if !ok {
+		return
+	}
+
+	// Add api handlers
+	if v, ok := i.(APIHandler); ok {
+		for path, h := range v.APIHandlers() {
+			if _, ok := a.apiHandlers[path]; !ok {
+				a.apiHandlers[path] = h
+			}
+		}
+	}
+
+	// Set dispatch func
+	if v, ok := i.(Dispatcher); ok {
+		v.SetDispatchFunc(s.dispatchFunc(b.key, a.key))
+	}
+
+	// Add brain websocket listeners
+	if v, ok := i.(BrainWebsocketListener); ok {
+		for n, l := range v.BrainWebsocketListeners() {
+			eventName := astibrain.WebsocketAbilityEventName(a.name, n)
+			a.brainWebsocketListeners = append(a.brainWebsocketListeners, eventName)
+			b.addListener(eventName, l(b.name))
+		}
+	}
+
+	// Add client websocket listeners
+	if v, ok := i.(ClientWebsocketListener); ok {
+		// Loop through clients
+		s.clientsWs.Clients(func(k interface{}, c *astiws.Client) error {
+			for n, l := range v.ClientWebsocketListeners() {
+				eventName := clientAbilityWebsocketEventName(b.key, a.key, n)
+				a.clientWebsocketListeners = append(a.clientWebsocketListeners, eventName)
+				addClientWsListener(c, s.subscriptions, eventName, l)
+			}
+			return nil
+		})
+	}
+
+	// Add static handlers
+	if v, ok := i.(StaticHandler); ok {
+		for path, h := range v.StaticHandlers() {
+			if _, ok := a.staticHandlers[path]; !ok {
+				a.staticHandlers[path] = h
+			}
+		}
+	}
+
+	// Add web templates
+	if v, ok := i.(WebTemplater); ok {
+		// Loop through templates
+		for path, content := range v.WebTemplates() {
+			// Add full path
+			fullPath := s.abilityWebTemplatePath(b.key, a.key, path)
+
+			// Add template
+			if err := s.templater.Add(fullPath, content); err != nil {
+				astilog.Error(errors.Wrapf(err, "astibob: adding web template for brain %s, ability %s and path %s", b.name, a.name, fullPath))
+			} else {
+				a.webTemplatesPaths = append(a.webTemplatesPaths, fullPath)
+			}
+
+			// Update web homepage
+			if path == "/index" {
+				a.webHomepage = serverPatternWeb + s.abilityWebTemplatePattern(b.key, a.key, path)
+			}
+		}
+	}
+	return
+}
+
+// forgetAbility removes the client websocket listeners and the web templates of an ability
+func (s *brainsServer) forgetAbility(a *ability) {
+	// Remove client websocket listeners
+	s.clientsWs.Clients(func(k interface{}, c *astiws.Client) error {
+		for _, n := range a.clientWebsocketListeners {
+			c.DelListener(n)
+		}
+		return nil
+	})
+
+	// Remove web templates
+	for _, path := range a.webTemplatesPaths {
+		s.templater.Del(path)
+	}
+}
+
 // dispatchFunc returns the func that dispatches client events
 func (s *brainsServer) dispatchFunc(brainKey, abilityKey string) func(e ClientEvent) {
 	return func(e ClientEvent) {
 		// TODO Make sure this is non blocking
-		dispatchWsEventToManager(s.clientsWs, clientAbilityWebsocketEventName(brainKey, abilityKey, e.Name), e.Payload)
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientAbilityWebsocketEventName(brainKey, abilityKey, e.Name), e.Payload)
 	}
 }
 
@@ -207,20 +321,22 @@ func (s *brainsServer) abilityWebTemplatePath(brainKey, abilityKey, path string)
 }
 
 // handleWebsocketDisconnected handles the disconnected websocket event
-func (s *brainsServer) handleWebsocketDisconnected(b *brain, clientWebsocketListeners, webTemplatesPaths []string) astiws.ListenerFunc {
+func (s *brainsServer) handleWebsocketDisconnected(b *brain) astiws.ListenerFunc {
 	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
-		// Remove client websocket listeners
-		s.clientsWs.Clients(func(k interface{}, c *astiws.Client) error {
-			for _, n := range clientWebsocketListeners {
-				c.DelListener(n)
-			}
+		// Forget abilities
+		var as []*ability
+		b.abilities(func(a *ability) error {
+			s.forgetAbility(a)
+			s.replayer.del(replayKey(b, a))
+			as = append(as, a)
 			return nil
 		})
 
-		// Remove web templates
-		for _, path := range webTemplatesPaths {
-			s.templater.Del(path)
-		}
+		// Release leases
+		s.leases.releaseBrain(b)
+
+		// Unsubscribe from relays
+		s.relays.del(b)
 
 		// Delete brain
 		s.brains.del(b)
@@ -231,8 +347,9 @@ func (s *brainsServer) handleWebsocketDisconnected(b *brain, clientWebsocketList
 		// Create event payload
 		e := newEventBrain(b)
 
-		// Dispatch event to clients
-		dispatchWsEventToManager(s.clientsWs, clientsWebsocketEventNameBrainDisconnected, e)
+		// Dispatch events to clients
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameBrainDisconnected, e)
+		s.dispatchStateRemoved(b, as...)
 
 		// Dispatch event to GO
 		s.dispatcher.dispatch(Event{Brain: e, Name: EventNameBrainDisconnected})
@@ -243,6 +360,251 @@ func (s *brainsServer) handleWebsocketDisconnected(b *brain, clientWebsocketList
 	}
 }
 
+// handleWebsocketAbilityLearned handles the ability learned websocket event
+func (s *brainsServer) handleWebsocketAbilityLearned(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var pa astibrain.APIAbility
+		if err := json.Unmarshal(payload, &pa); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Ability already exists
+		if _, ok := b.ability(pa.Name); ok {
+			return nil
+		}
+
+		// Learn ability
+		a := s.learnAbility(b, pa)
+		b.set(a)
+
+		// Log
+		astilog.Infof("astibob: brain %s has learned ability %s", b.name, a.name)
+
+		// Create event payload
+		e := newEventAbility(a)
+		e.BrainName = b.name
+
+		// Dispatch event to clients
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameAbilityLearned, e)
+
+		// Dispatch event to GO
+		s.dispatcher.dispatch(Event{Ability: e, Name: EventNameAbilityLearned})
+		return nil
+	}
+}
+
+// handleWebsocketAbilityLease handles the ability lease websocket events
+func (s *brainsServer) handleWebsocketAbilityLease(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIAbilityLease
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Acquire or release lease
+		if astibrain.WebsocketEventName(eventName) == astibrain.WebsocketEventNameAbilityLeaseAcquire {
+			s.leases.acquire(b, p.Name, p.Duration)
+		} else {
+			s.leases.release(b, p.Name)
+		}
+		return nil
+	}
+}
+
+// handleWebsocketAbilityReconfigured handles the ability reconfigured websocket event
+func (s *brainsServer) handleWebsocketAbilityReconfigured(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIAbilityReconfigured
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Resolve pending reconfigure
+		// Its error is returned by Reconfigure instead of being logged
+		if len(p.ID) > 0 && b.resolveReconfigure(p.ID, p.Error) {
+			return nil
+		}
+
+		// Log
+		if len(p.Error) > 0 {
+			astilog.Errorf("astibob: reconfiguring ability %s of brain %s failed: %s", p.Name, b.name, p.Error)
+		} else {
+			astilog.Infof("astibob: ability %s of brain %s has been reconfigured", p.Name, b.name)
+		}
+		return nil
+	}
+}
+
+// handleWebsocketAbilitiesDescribed handles the abilities described websocket event
+func (s *brainsServer) handleWebsocketAbilitiesDescribed(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIAbilitiesDescribed
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Update descriptors
+		for _, d := range p.Abilities {
+			if a, ok := b.ability(d.Name); ok {
+				a.setDescriptor(d)
+			}
+		}
+
+		// Create event payload
+		e := &EventAbilitiesDescribed{APIAbilitiesDescribed: p, BrainName: b.name}
+
+		// Dispatch event to clients
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameAbilitiesDescribed, e)
+
+		// Dispatch event to GO
+		s.dispatcher.dispatch(Event{AbilitiesDescribed: e, Name: EventNameAbilitiesDescribed})
+		return nil
+	}
+}
+
+// handleWebsocketBrainHeartbeat handles the brain heartbeat websocket event
+func (s *brainsServer) handleWebsocketBrainHeartbeat(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIBrainHeartbeat
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Create event payload
+		e := &EventHeartbeat{APIBrainHeartbeat: p, BrainName: b.name}
+
+		// Dispatch event to clients
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameBrainHeartbeat, e)
+
+		// Dispatch event to GO
+		s.dispatcher.dispatch(Event{Heartbeat: e, Name: EventNameBrainHeartbeat})
+		return nil
+	}
+}
+
+// handleWebsocketBrainReady handles the brain ready websocket event
+func (s *brainsServer) handleWebsocketBrainReady(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIBrainReady
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Update brain
+		b.setReady(true)
+
+		// Log
+		astilog.Infof("astibob: brain %s is ready", b.name)
+
+		// Create event payload
+		e := &EventBrainReady{APIBrainReady: p, BrainName: b.name}
+
+		// Dispatch event to clients
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameBrainReady, e)
+
+		// Dispatch event to GO
+		s.dispatcher.dispatch(Event{BrainReady: e, Name: EventNameBrainReady})
+		return nil
+	}
+}
+
+// handleWebsocketBrainStartupProgress handles the brain startup progress websocket event
+func (s *brainsServer) handleWebsocketBrainStartupProgress(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIBrainStartupProgress
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Log
+		astilog.Debugf("astibob: ability %s of brain %s has been resolved as %s (%d/%d)", p.Ability, b.name, p.State, p.Index, p.Total)
+
+		// Create event payload
+		e := &EventStartupProgress{APIBrainStartupProgress: p, BrainName: b.name}
+
+		// Dispatch event to clients
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameBrainStartupProgress, e)
+
+		// Dispatch event to GO
+		s.dispatcher.dispatch(Event{Name: EventNameBrainStartupProgress, StartupProgress: e})
+		return nil
+	}
+}
+
+// handleWebsocketMessagesDropped handles the messages dropped websocket event
+func (s *brainsServer) handleWebsocketMessagesDropped(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIMessagesDropped
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Log
+		astilog.Errorf("astibob: brain %s has dropped %d message(s) (%d total)", b.name, p.Count, p.Total)
+		return nil
+	}
+}
+
+// handleWebsocketAbilityForgotten handles the ability forgotten websocket event
+func (s *brainsServer) handleWebsocketAbilityForgotten(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var name string
+		if err := json.Unmarshal(payload, &name); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Retrieve ability
+		a, ok := b.ability(name)
+		if !ok {
+			astilog.Error(fmt.Errorf("astibob: unknown ability %s for brain %s", name, b.name))
+			return nil
+		}
+
+		// Remove brain websocket listeners
+		for _, n := range a.brainWebsocketListeners {
+			b.delListener(n)
+		}
+
+		// Forget ability
+		s.forgetAbility(a)
+		s.replayer.del(replayKey(b, a))
+		b.del(a)
+
+		// Log
+		astilog.Infof("astibob: brain %s has forgotten ability %s", b.name, a.name)
+
+		// Create event payload
+		e := newEventAbility(a)
+		e.BrainName = b.name
+
+		// Dispatch events to clients
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameAbilityForgotten, e)
+		s.dispatchStateRemoved(b, a)
+
+		// Dispatch event to GO
+		s.dispatcher.dispatch(Event{Ability: e, Name: EventNameAbilityForgotten})
+		return nil
+	}
+}
+
 // handleWebsocketAbilityToggle handles the ability toggle websocket event
 func (s *brainsServer) handleWebsocketAbilityToggle(b *brain) astiws.ListenerFunc {
 	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
@@ -262,7 +624,7 @@ func (s *brainsServer) handleWebsocketAbilityToggle(b *brain) astiws.ListenerFun
 
 		// Get event name
 		var eventNameClients, eventNameGO string
-		if eventName == astibrain.WebsocketEventNameAbilityStarted {
+		if astibrain.WebsocketEventName(eventName) == astibrain.WebsocketEventNameAbilityStarted {
 			eventNameClients = clientsWebsocketEventNameAbilityStarted
 			eventNameGO = EventNameAbilityStarted
 			a.setOn(true)
@@ -277,10 +639,14 @@ func (s *brainsServer) handleWebsocketAbilityToggle(b *brain) astiws.ListenerFun
 		e.BrainName = b.name
 
 		// Dispatch event to clients
-		dispatchWsEventToManager(s.clientsWs, eventNameClients, e)
+		dispatchWsEventToManager(s.clientsWs, s.subscriptions, eventNameClients, e)
+		s.replayer.add(replayKey(b, a), eventNameClients, *e)
 
 		// Dispatch event to GO
 		s.dispatcher.dispatch(Event{Ability: e, Name: eventNameGO})
+
+		// Ask the brain for a state snapshot if needed
+		s.resyncStateIfNeeded(b)
 		return nil
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"strings"
+	"time"
 
 	"github.com/asticode/go-astibob/brain"
 	"github.com/asticode/go-astilog"
@@ -27,33 +28,47 @@ const (
 
 // Clients websocket events
 const (
-	clientsWebsocketEventNameAbilityStart      = "ability.start"
-	clientsWebsocketEventNameAbilityStarted    = "ability.started"
-	clientsWebsocketEventNameAbilityStop       = "ability.stop"
-	clientsWebsocketEventNameAbilityStopped    = "ability.stopped"
-	clientsWebsocketEventNameBrainRegistered   = "brain.registered"
-	clientsWebsocketEventNameBrainDisconnected = "brain.disconnected"
-	clientsWebsocketEventNamePing              = "ping"
+	clientsWebsocketEventNameAbilitiesDescribed   = "abilities.described"
+	clientsWebsocketEventNameAbilityForgotten     = "ability.forgotten"
+	clientsWebsocketEventNameAbilityLearned       = "ability.learned"
+	clientsWebsocketEventNameAbilityStart         = "ability.start"
+	clientsWebsocketEventNameAbilityStarted       = "ability.started"
+	clientsWebsocketEventNameAbilityStop          = "ability.stop"
+	clientsWebsocketEventNameAbilityStopped       = "ability.stopped"
+	clientsWebsocketEventNameBrainRegistered      = "brain.registered"
+	clientsWebsocketEventNameBrainDisconnected    = "brain.disconnected"
+	clientsWebsocketEventNameBrainHeartbeat       = "brain.heartbeat"
+	clientsWebsocketEventNameBrainReady           = "brain.ready"
+	clientsWebsocketEventNameBrainStartupProgress = "brain.startup.progress"
+	clientsWebsocketEventNamePing                 = "ping"
+	clientsWebsocketEventNameStateDiff            = "state.diff"
+	clientsWebsocketEventNameStateResync          = "state.resync"
+	clientsWebsocketEventNameStateSnapshot        = "state.snapshot"
+	clientsWebsocketEventNameSubscribe            = "subscribe"
 )
 
 // clientsServer is a server for the clients
 type clientsServer struct {
 	*server
-	brains     *brains
-	interfaces *interfaces
-	stopFunc   func()
-	templater  *astitemplate.Templater
+	brains        *brains
+	interfaces    *interfaces
+	replayer      *replayer
+	stopFunc      func()
+	subscriptions *subscriptions
+	templater     *astitemplate.Templater
 }
 
 // newClientsServer creates a new clients server.
-func newClientsServer(t *astitemplate.Templater, b *brains, cWs *astiws.Manager, interfaces *interfaces, stopFunc func(), c Configuration) (s *clientsServer) {
+func newClientsServer(t *astitemplate.Templater, b *brains, cWs *astiws.Manager, interfaces *interfaces, rp *replayer, ss *subscriptions, stopFunc func(), c Configuration) (s *clientsServer) {
 	// Create server
 	s = &clientsServer{
-		brains:     b,
-		interfaces: interfaces,
-		server:     newServer("clients", cWs, c.ClientsServer),
-		stopFunc:   stopFunc,
-		templater:  t,
+		brains:        b,
+		interfaces:    interfaces,
+		replayer:      rp,
+		server:        newServer("clients", cWs, c.ClientsServer),
+		stopFunc:      stopFunc,
+		subscriptions: ss,
+		templater:     t,
 	}
 
 	// Init router
@@ -148,9 +163,26 @@ func (s *clientsServer) templateData(r *http.Request, p httprouter.Params, name
 	return
 }
 
+// clientsWebsocketQueryEnvelope is the query parameter clients use to ask Bob to wrap websocket events in envelopes,
+// since browsers can't set headers during the websocket handshake. Its value is the envelope format version.
+const clientsWebsocketQueryEnvelope = "envelope"
+
 // handleWebsocketGET handles the websockets.
 func (s *clientsServer) handleWebsocketGET(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	if err := s.ws.ServeHTTP(rw, r, s.adaptWebsocketClient); err != nil {
+	// Negotiate envelope
+	var envelope bool
+	switch v := r.URL.Query().Get(clientsWebsocketQueryEnvelope); v {
+	case "":
+	case astibrain.WebsocketEnvelopeFormatVersion:
+		envelope = true
+	default:
+		astilog.Errorf("astibob: unknown envelope format %s requested by %s", v, r.RemoteAddr)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Serve
+	if err := s.ws.ServeHTTP(rw, r, s.adaptWebsocketClient(envelope)); err != nil {
 		if v, ok := errors.Cause(err).(*websocket.CloseError); !ok || (v.Code != websocket.CloseNoStatusReceived && v.Code != websocket.CloseNormalClosure) {
 			astilog.Error(errors.Wrapf(err, "astibob: handling websocket on %s failed", s.s.Addr))
 		}
@@ -168,42 +200,68 @@ func clientAbilityWebsocketEventName(brainKey, abilityKey, eventName string) str
 	return fmt.Sprintf("%s.%s", clientAbilityWebsocketBaseEventName(brainKey, abilityKey), eventName)
 }
 
-// ClientAdapter returns the client adapter.
-func (s *clientsServer) adaptWebsocketClient(c *astiws.Client) {
-	// Register client
-	s.ws.AutoRegisterClient(c)
-
-	// Add default listeners
-	c.AddListener(astiws.EventNameDisconnect, s.handleWebsocketDisconnected)
-	c.AddListener(clientsWebsocketEventNameAbilityStart, s.handleWebsocketAbilityToggle)
-	c.AddListener(clientsWebsocketEventNameAbilityStop, s.handleWebsocketAbilityToggle)
-	c.AddListener(clientsWebsocketEventNamePing, s.handleWebsocketPing)
-
-	// Loop through brains
-	s.brains.brains(func(b *brain) error {
-		// Loop through abilities
-		b.abilities(func(a *ability) error {
-			// Fetch interface
-			i, ok := s.interfaces.get(a.name)
-			if !ok {
-				return nil
-			}
+// addClientWsListener adds a client websocket listener that receives payloads unwrapped from their envelope
+func addClientWsListener(c *astiws.Client, ss *subscriptions, eventName string, l astiws.ListenerFunc) {
+	if ss.hasEnvelope(c) {
+		l = astibrain.UnwrapWebsocketListener(l)
+	}
+	c.AddListener(eventName, l)
+}
+
+// adaptWebsocketClient returns the client adapter.
+func (s *clientsServer) adaptWebsocketClient(envelope bool) astiws.ClientAdapter {
+	return func(c *astiws.Client) {
+		// Register client
+		s.ws.AutoRegisterClient(c)
+		if envelope {
+			s.subscriptions.setEnvelope(c)
+		}
 
-			// Add client websocket listener
-			if v, ok := i.(ClientWebsocketListener); ok {
-				for n, l := range v.ClientWebsocketListeners() {
-					c.AddListener(clientAbilityWebsocketEventName(b.key, a.key, n), l)
+		// Add default listeners
+		// The disconnect event is emitted locally and is therefore never wrapped
+		c.AddListener(astiws.EventNameDisconnect, s.handleWebsocketDisconnected)
+		addClientWsListener(c, s.subscriptions, clientsWebsocketEventNameAbilityStart, s.handleWebsocketAbilityToggle)
+		addClientWsListener(c, s.subscriptions, clientsWebsocketEventNameAbilityStop, s.handleWebsocketAbilityToggle)
+		addClientWsListener(c, s.subscriptions, clientsWebsocketEventNamePing, s.handleWebsocketPing)
+		addClientWsListener(c, s.subscriptions, clientsWebsocketEventNameStateResync, s.handleWebsocketStateResync)
+		addClientWsListener(c, s.subscriptions, clientsWebsocketEventNameSubscribe, s.handleWebsocketSubscribe)
+
+		// Loop through brains
+		s.brains.brains(func(b *brain) error {
+			// Loop through abilities
+			b.abilities(func(a *ability) error {
+				// Fetch interface
+				i, ok := s.interfaces.get(a.name)
+				if !ok {
+					return nil
 				}
-			}
+
+				// Add client websocket listener
+				if v, ok := i.(ClientWebsocketListener); ok {
+					for n, l := range v.ClientWebsocketListeners() {
+						addClientWsListener(c, s.subscriptions, clientAbilityWebsocketEventName(b.key, a.key, n), l)
+					}
+				}
+				return nil
+			})
 			return nil
 		})
-		return nil
-	})
+
+		// Replay recent events
+		s.replayer.replay(c, s.subscriptions)
+
+		// Dispatch state snapshot
+		// It's dispatched after the replayed events so that it reflects the current state
+		if s.subscriptions.isSubscribed(c, clientsWebsocketEventNameStateSnapshot) {
+			dispatchWsEventToClient(c, s.subscriptions, clientsWebsocketEventNameStateSnapshot, newEventStateSnapshot(s.brains, time.Now()))
+		}
+	}
 }
 
 // handleWebsocketDisconnected handles the disconnected websocket event
 func (s *clientsServer) handleWebsocketDisconnected(c *astiws.Client, eventName string, payload json.RawMessage) error {
 	s.ws.UnregisterClient(c)
+	s.subscriptions.del(c)
 	return nil
 }
 
@@ -245,7 +303,7 @@ func (s *clientsServer) handleWebsocketAbilityToggle(c *astiws.Client, eventName
 	}
 
 	// Dispatch to brain
-	dispatchWsEventToClient(b.ws, eventNameBrain, e.Name)
+	b.dispatch(eventNameBrain, e.Name)
 	return nil
 }
 
@@ -296,7 +354,7 @@ type APIReferences struct {
 // handleAPIReferencesGET returns the references.
 func (s *clientsServer) handleAPIReferencesGET(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	APIWrite(rw, APIReferences{
-		WsURL:        "ws://" + s.c.PublicAddr + "/websocket",
+		WsURL:        s.websocketScheme() + "://" + s.c.PublicAddr + "/websocket",
 		WsPingPeriod: int(astiws.PingPeriod.Seconds()),
 	})
 }
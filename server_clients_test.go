@@ -0,0 +1,94 @@
+package astibob
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astiws"
+	"github.com/stretchr/testify/assert"
+)
+
+// newClientsServerForTest creates a clients server serving its websocket with an httptest server
+func newClientsServerForTest(t *testing.T) (s *clientsServer, url string) {
+	s = &clientsServer{
+		brains:        newBrains(),
+		interfaces:    newInterfaces(),
+		replayer:      newReplayer(0),
+		server:        newServer("clients", astiws.NewManager(astiws.ManagerConfiguration{}), ServerConfiguration{}),
+		subscriptions: newSubscriptions(nil),
+	}
+	s.s = &http.Server{}
+	hs := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { s.handleWebsocketGET(rw, r, nil) }))
+	t.Cleanup(hs.Close)
+	url = "ws" + strings.TrimPrefix(hs.URL, "http") + "/websocket"
+	return
+}
+
+// dialClientForTest dials the clients server and returns the payload of the first state snapshot
+func dialClientForTest(t *testing.T, url string) (c *astiws.Client, snapshot chan json.RawMessage) {
+	c = astiws.NewClient(astiws.ClientConfiguration{})
+	snapshot = make(chan json.RawMessage, 1)
+	c.AddListener(clientsWebsocketEventNameStateSnapshot, func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		snapshot <- payload
+		return nil
+	})
+	if !assert.NoError(t, c.Dial(url)) {
+		t.FailNow()
+	}
+	go c.Read()
+	t.Cleanup(func() { c.Close() })
+	return
+}
+
+// waitForPayload waits for a payload
+func waitForPayload(t *testing.T, ch chan json.RawMessage) (p json.RawMessage) {
+	select {
+	case p = <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no payload received")
+	}
+	return
+}
+
+func TestClientsWebsocketEnvelope(t *testing.T) {
+	s, url := newClientsServerForTest(t)
+
+	// Unknown format
+	rw := httptest.NewRecorder()
+	s.handleWebsocketGET(rw, httptest.NewRequest(http.MethodGet, "/websocket?envelope=0", nil), nil)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	// No envelope
+	_, ch := dialClientForTest(t, url)
+	var sn EventStateSnapshot
+	assert.NoError(t, json.Unmarshal(waitForPayload(t, ch), &sn))
+	assert.Equal(t, []EventAbilityState{}, sn.Abilities)
+
+	// Envelope
+	c, ch := dialClientForTest(t, url+"?envelope="+astibrain.WebsocketEnvelopeFormatVersion)
+	var e astibrain.Envelope
+	assert.NoError(t, json.Unmarshal(waitForPayload(t, ch), &e))
+	assert.Equal(t, clientsWebsocketEventNameStateSnapshot, e.Name)
+	assert.Equal(t, 1, e.Version)
+	sn = EventStateSnapshot{}
+	assert.NoError(t, json.Unmarshal(e.Payload, &sn))
+	assert.Equal(t, []EventAbilityState{}, sn.Abilities)
+
+	// Incoming events are unwrapped
+	p, err := astibrain.NewEnvelope(clientsWebsocketEventNameSubscribe, ClientSubscription{Events: []string{clientsWebsocketEventNameStateSnapshot}}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Write(clientsWebsocketEventNameSubscribe, p))
+	assert.NoError(t, c.Write(clientsWebsocketEventNameStateResync, nil))
+	waitForPayload(t, ch)
+	s.ws.Clients(func(k interface{}, sc *astiws.Client) error {
+		if s.subscriptions.hasEnvelope(sc) {
+			assert.False(t, s.subscriptions.isSubscribed(sc, clientsWebsocketEventNameBrainHeartbeat))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,185 @@
+package astibob
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+)
+
+// EventAbilityState represents an ability state event.
+// Uptime is the duration the ability has been on for as of the moment the event has been created.
+type EventAbilityState struct {
+	BrainName string                 `json:"brain_name"`
+	LastError string                 `json:"last_error,omitempty"`
+	Name      string                 `json:"name"`
+	State     astibrain.AbilityState `json:"state"`
+	Uptime    time.Duration          `json:"uptime"`
+}
+
+// EventStateSnapshot represents a state snapshot event.
+type EventStateSnapshot struct {
+	Abilities []EventAbilityState `json:"abilities"`
+}
+
+// EventStateDiff represents a state diff event.
+// Abilities are the abilities whose state or last error has changed and Removed are the abilities that have been
+// forgotten, holding their last known state.
+type EventStateDiff struct {
+	Abilities []EventAbilityState `json:"abilities,omitempty"`
+	Removed   []EventAbilityState `json:"removed,omitempty"`
+}
+
+// newEventStateSnapshot creates a new state snapshot event
+func newEventStateSnapshot(brains *brains, now time.Time) (e EventStateSnapshot) {
+	// Init
+	e = EventStateSnapshot{Abilities: []EventAbilityState{}}
+
+	// Loop through brains
+	brains.brains(func(b *brain) error {
+		// Loop through abilities
+		b.abilities(func(a *ability) error {
+			e.Abilities = append(e.Abilities, a.eventState(b.name, now))
+			return nil
+		})
+		return nil
+	})
+	return
+}
+
+// eventState returns the ability state event
+func (a *ability) eventState(brainName string, now time.Time) (e EventAbilityState) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	e = EventAbilityState{
+		BrainName: brainName,
+		LastError: a.lastErr,
+		Name:      a.name,
+		State:     a.st,
+	}
+	if a.st == astibrain.AbilityStateOn || a.st == astibrain.AbilityStatePaused {
+		e.Uptime = a.uptime + now.Sub(a.uptimeAt)
+	}
+	return
+}
+
+// setState updates the ability state and returns whether it has changed.
+// Uptime alone doesn't count as a change since it keeps on growing while the ability is on.
+func (a *ability) setState(p astibrain.APIAbilityState, now time.Time) (changed bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	changed = a.lastErr != p.LastError || a.st != p.State
+	a.lastErr = p.LastError
+	a.st = p.State
+	a.uptime = p.Uptime
+	a.uptimeAt = now
+	return
+}
+
+// handleWebsocketAbilityStateChanged handles the websocket events of an ability whose state has changed
+// Brains sending ability state events are not asked for a state snapshot since the state is applied once it's received.
+// Older brains are since lifecycle events don't hold enough information to deduce the state.
+func (s *brainsServer) handleWebsocketAbilityStateChanged(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		s.resyncStateIfNeeded(b)
+		return nil
+	}
+}
+
+// resyncStateIfNeeded asks the brain for a state snapshot if it doesn't send ability state events
+func (s *brainsServer) resyncStateIfNeeded(b *brain) {
+	if !b.sendsAbilityStates() {
+		b.dispatch(astibrain.WebsocketEventNameStateResync, nil)
+	}
+}
+
+// handleWebsocketAbilityState handles the ability state websocket event
+func (s *brainsServer) handleWebsocketAbilityState(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIAbilityState
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// The brain sends ability state events, there's no need to ask it for snapshots anymore
+		b.setSendsAbilityStates()
+
+		// Apply state
+		s.applyStates(b, time.Now(), p)
+		return nil
+	}
+}
+
+// handleWebsocketStateSnapshot handles the state snapshot websocket event
+// Snapshots are only received once the brain has registered or when Bob resyncs with older brains.
+func (s *brainsServer) handleWebsocketStateSnapshot(b *brain) astiws.ListenerFunc {
+	return func(c *astiws.Client, eventName string, payload json.RawMessage) error {
+		// Decode payload
+		var p astibrain.APIStateSnapshot
+		if err := json.Unmarshal(payload, &p); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+			return nil
+		}
+
+		// Apply states
+		s.applyStates(b, time.Now(), p.Abilities...)
+		return nil
+	}
+}
+
+// applyStates updates the state of the abilities and dispatches a state diff event to the clients for the ones that
+// have changed
+func (s *brainsServer) applyStates(b *brain, now time.Time, ps ...astibrain.APIAbilityState) (e EventStateDiff) {
+	// Loop through abilities
+	for _, p := range ps {
+		// Retrieve ability
+		// Abilities that are not known yet are added by the ability learned event
+		a, ok := b.ability(p.Name)
+		if !ok {
+			continue
+		}
+
+		// Update state
+		if a.setState(p, now) {
+			e.Abilities = append(e.Abilities, a.eventState(b.name, now))
+		}
+	}
+
+	// Nothing has changed
+	if len(e.Abilities) == 0 {
+		return
+	}
+
+	// Dispatch event to clients
+	dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameStateDiff, e)
+	return
+}
+
+// dispatchStateRemoved dispatches a state diff event to the clients for abilities that have been forgotten
+func (s *brainsServer) dispatchStateRemoved(b *brain, as ...*ability) {
+	// Create event payload
+	var e EventStateDiff
+	now := time.Now()
+	for _, a := range as {
+		e.Removed = append(e.Removed, a.eventState(b.name, now))
+	}
+
+	// Nothing has been removed
+	if len(e.Removed) == 0 {
+		return
+	}
+
+	// Dispatch event to clients
+	dispatchWsEventToManager(s.clientsWs, s.subscriptions, clientsWebsocketEventNameStateDiff, e)
+}
+
+// handleWebsocketStateResync handles the state resync websocket event
+func (s *clientsServer) handleWebsocketStateResync(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	dispatchWsEventToClient(c, s.subscriptions, clientsWebsocketEventNameStateSnapshot, newEventStateSnapshot(s.brains, time.Now()))
+	return nil
+}
@@ -0,0 +1,48 @@
+package astibob
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob/brain"
+	"github.com/asticode/go-astiws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyStates(t *testing.T) {
+	s := &brainsServer{clientsWs: astiws.NewManager(astiws.ManagerConfiguration{}), subscriptions: newSubscriptions(nil)}
+	b := newBrain("Brain", nil, false, nil, 0)
+	b.set(newAbility("A", "", false))
+	b.set(newAbility("B", "", false))
+	now := time.Unix(100, 0)
+
+	// Only abilities whose state has changed are in the diff
+	assert.Equal(t, EventStateDiff{Abilities: []EventAbilityState{{BrainName: "Brain", Name: "A", State: astibrain.AbilityStateOn}}}, s.applyStates(b, now,
+		astibrain.APIAbilityState{Name: "A", State: astibrain.AbilityStateOn},
+		astibrain.APIAbilityState{Name: "B", State: astibrain.AbilityStateOff},
+		astibrain.APIAbilityState{Name: "Unknown", State: astibrain.AbilityStateOn},
+	))
+
+	// Uptime alone is not a change
+	assert.Equal(t, EventStateDiff{}, s.applyStates(b, now.Add(time.Second), astibrain.APIAbilityState{Name: "A", State: astibrain.AbilityStateOn, Uptime: time.Second}))
+
+	// Uptime keeps on growing while the ability is on
+	a, _ := b.ability("A")
+	assert.Equal(t, 3*time.Second, a.eventState(b.name, now.Add(3*time.Second)).Uptime)
+
+	// Last error is a change
+	assert.Equal(t, EventStateDiff{Abilities: []EventAbilityState{{BrainName: "Brain", LastError: "test", Name: "A", State: astibrain.AbilityStateCrashed}}}, s.applyStates(b, now, astibrain.APIAbilityState{LastError: "test", Name: "A", State: astibrain.AbilityStateCrashed}))
+}
+
+func TestHandleWebsocketAbilityState(t *testing.T) {
+	s := &brainsServer{clientsWs: astiws.NewManager(astiws.ManagerConfiguration{}), subscriptions: newSubscriptions(nil)}
+	b := newBrain("Brain", nil, false, nil, 0)
+	b.set(newAbility("A", "", false))
+
+	// Brains are considered as not sending ability state events until they do
+	assert.False(t, b.sendsAbilityStates())
+	assert.NoError(t, s.handleWebsocketAbilityState(b)(nil, string(astibrain.WebsocketEventNameAbilityState), []byte(`{"name":"A","state":"on"}`)))
+	assert.True(t, b.sendsAbilityStates())
+	a, _ := b.ability("A")
+	assert.Equal(t, astibrain.AbilityStateOn, a.eventState(b.name, time.Now()).State)
+}
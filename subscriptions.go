@@ -0,0 +1,126 @@
+package astibob
+
+import (
+	"encoding/json"
+	"path"
+	"sync"
+
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astiws"
+	"github.com/pkg/errors"
+)
+
+// defaultUnsubscribedEvents are the high volume events clients don't receive unless they subscribe to them
+var defaultUnsubscribedEvents = []string{
+	"brain.*.ability.*.audio.level",
+	"brain.*.ability.*.samples",
+}
+
+// ClientSubscription represents the payload of the subscribe client websocket event.
+// Events are the names of the events the client wants to receive. Patterns follow the path.Match syntax, for instance
+// "brain.*.ability.*.samples". A subscription replaces the previous one. If Events is nil, the client receives every
+// event but the unsubscribed ones, which is also what happens until the client subscribes.
+type ClientSubscription struct {
+	Events []string `json:"events"`
+}
+
+// subscriptions represents the event subscriptions of clients as well as whether they've negotiated envelopes
+type subscriptions struct {
+	envelopes    map[*astiws.Client]bool
+	m            sync.Mutex // Locks envelopes and s
+	s            map[*astiws.Client][]string
+	unsubscribed []string
+}
+
+// newSubscriptions creates new subscriptions
+func newSubscriptions(unsubscribed []string) *subscriptions {
+	if unsubscribed == nil {
+		unsubscribed = defaultUnsubscribedEvents
+	}
+	return &subscriptions{
+		envelopes:    make(map[*astiws.Client]bool),
+		s:            make(map[*astiws.Client][]string),
+		unsubscribed: unsubscribed,
+	}
+}
+
+// set sets the subscription of a client
+func (s *subscriptions) set(c *astiws.Client, events []string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if events == nil {
+		delete(s.s, c)
+		return
+	}
+	s.s[c] = events
+}
+
+// del deletes the subscription of a client
+func (s *subscriptions) del(c *astiws.Client) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.envelopes, c)
+	delete(s.s, c)
+}
+
+// setEnvelope records that a client has negotiated envelopes
+func (s *subscriptions) setEnvelope(c *astiws.Client) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.envelopes[c] = true
+}
+
+// hasEnvelope checks whether a client has negotiated envelopes
+func (s *subscriptions) hasEnvelope(c *astiws.Client) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.envelopes[c]
+}
+
+// isSubscribed checks whether a client should receive an event
+func (s *subscriptions) isSubscribed(c *astiws.Client, eventName string) bool {
+	// Get subscription
+	s.m.Lock()
+	events, ok := s.s[c]
+	s.m.Unlock()
+
+	// Client has not subscribed
+	if !ok {
+		return !matchEventName(s.unsubscribed, eventName)
+	}
+	return matchEventName(events, eventName)
+}
+
+// matchEventName checks whether an event name matches one of the patterns
+func matchEventName(patterns []string, eventName string) bool {
+	for _, p := range patterns {
+		if ok, err := path.Match(p, eventName); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: matching %s against pattern %s failed", eventName, p))
+		} else if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWebsocketSubscribe handles the subscribe websocket event
+func (s *clientsServer) handleWebsocketSubscribe(c *astiws.Client, eventName string, payload json.RawMessage) error {
+	// Decode payload
+	var p ClientSubscription
+	if err := json.Unmarshal(payload, &p); err != nil {
+		astilog.Error(errors.Wrapf(err, "astibob: json unmarshaling %s payload %#v failed", eventName, payload))
+		return nil
+	}
+
+	// Validate patterns
+	for _, v := range p.Events {
+		if _, err := path.Match(v, ""); err != nil {
+			astilog.Error(errors.Wrapf(err, "astibob: invalid subscription pattern %s", v))
+			return nil
+		}
+	}
+
+	// Set subscription
+	s.subscriptions.set(c, p.Events)
+	return nil
+}